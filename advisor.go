@@ -0,0 +1,149 @@
+/*
+	Copyright 2017 Daniel Nichter
+	Copyright 2014-2016 Percona LLC and/or its affiliates
+*/
+
+package slowlog
+
+import (
+	"fmt"
+	"strings"
+)
+
+const (
+	// DEFAULT_FULL_SCAN_PCT is the default ColumnAdvisor.MinFullScanPct.
+	DEFAULT_FULL_SCAN_PCT = 10
+
+	// DEFAULT_EXAMINED_RATIO is the default ColumnAdvisor.MinExaminedRatio.
+	DEFAULT_EXAMINED_RATIO = 100
+
+	// MAX_INDEX_COLUMNS is the max number of columns in an index suggested
+	// by ColumnAdvisor.
+	MAX_INDEX_COLUMNS = 5
+)
+
+// An IndexSuggestion is an index that might make the queries of a class
+// faster. Table is empty if the advisor does not know it.
+type IndexSuggestion struct {
+	Table   string   `json:",omitempty"`
+	Columns []string // in index order
+	Reason  string   `json:",omitempty"` // why the index is suggested
+}
+
+// An IndexAdvisor suggests indexes for a class. Set one with
+// Aggregator.SetIndexAdvisor to annotate every class with Class.Indexes,
+// like a ColumnAdvisor or an advisor that asks a service with the schema.
+type IndexAdvisor interface {
+	// Advise returns the suggested indexes for the finalized class, if any.
+	// It is not called for the global class.
+	Advise(c *Class) []IndexSuggestion
+}
+
+// ColumnAdvisor is a simple IndexAdvisor that does not know the schema. If
+// a class looks like it scans too many rows, it suggests one index on its
+// Class.TopColumns: WHERE columns, then GROUP BY columns, then ORDER BY
+// columns. Columns are only counted if Aggregator.SetColumns is enabled.
+// It does not know which indexes exist or the selectivity of columns, so
+// check the suggestions with EXPLAIN.
+type ColumnAdvisor struct {
+	MinFullScanPct   float64 // Full_scan TruePct to suggest an index (default: DEFAULT_FULL_SCAN_PCT)
+	MinExaminedRatio float64 // Rows_examined / Rows_sent to suggest an index (default: DEFAULT_EXAMINED_RATIO)
+}
+
+// Advise returns an index on the class TopColumns if the Full_scan TruePct
+// or the ratio of rows examined to rows sent is at least the minimum.
+func (a ColumnAdvisor) Advise(c *Class) []IndexSuggestion {
+	if len(c.TopColumns) == 0 {
+		return nil
+	}
+	reason := a.reason(c.Metrics)
+	if reason == "" {
+		return nil
+	}
+
+	columns := []string{}
+	seen := map[string]bool{}
+	table := ""
+	for _, clause := range []ColumnClause{CLAUSE_WHERE, CLAUSE_GROUP_BY, CLAUSE_ORDER_BY} {
+		for _, col := range c.TopColumns {
+			if col.Clause != clause || seen[col.Column] || len(columns) == MAX_INDEX_COLUMNS {
+				continue
+			}
+			seen[col.Column] = true
+			name := col.Column
+			if n := strings.LastIndexByte(name, '.'); n > -1 {
+				name = name[n+1:] // t.id => id
+			}
+			columns = append(columns, name)
+		}
+	}
+	if c.Example != nil {
+		table = singleTable(c.Example.Query)
+	}
+	return []IndexSuggestion{{Table: table, Columns: columns, Reason: reason}}
+}
+
+// reason returns why the class needs an index, or "" if it does not.
+func (a ColumnAdvisor) reason(m Metrics) string {
+	minPct := a.MinFullScanPct
+	if minPct == 0 {
+		minPct = DEFAULT_FULL_SCAN_PCT
+	}
+	minRatio := a.MinExaminedRatio
+	if minRatio == 0 {
+		minRatio = DEFAULT_EXAMINED_RATIO
+	}
+	if s, ok := m.BoolMetrics["Full_scan"]; ok && s.Sum > 0 && s.TruePct >= minPct {
+		return fmt.Sprintf("Full_scan in %.0f%% of queries", s.TruePct)
+	}
+	examined, ok := m.NumberMetrics["Rows_examined"]
+	if !ok || examined.Sum == 0 {
+		return ""
+	}
+	sent := uint64(0)
+	if s, ok := m.NumberMetrics["Rows_sent"]; ok {
+		sent = s.Sum
+	}
+	if sent == 0 {
+		sent = 1
+	}
+	if ratio := float64(examined.Sum) / float64(sent); ratio >= minRatio {
+		return fmt.Sprintf("Rows_examined is %.0f times Rows_sent", ratio)
+	}
+	return ""
+}
+
+// singleTable returns the table name if the query reads from only one table,
+// like "SELECT ... FROM t WHERE ...", else "".
+func singleTable(query string) string {
+	tokens := tokenize(query)
+	table := ""
+	for i := 0; i < len(tokens); i++ {
+		t := tokens[i]
+		if t == "(" && nextWord(tokens, i) == "SELECT" {
+			return "" // subquery or derived table
+		}
+		word := strings.ToUpper(t)
+		if word == "JOIN" || joinKeywords[word] {
+			return ""
+		}
+		if word != "FROM" && word != "UPDATE" {
+			continue
+		}
+		if table != "" {
+			return ""
+		}
+		next := i + 1
+		for next < len(tokens) && tokens[next] == " " {
+			next++
+		}
+		if next == len(tokens) || (tokens[next][0] != '`' && !isWordChar(tokens[next][0])) {
+			return ""
+		}
+		table, i = identifier(tokens, next)
+		if nextToken(tokens, i-1) == "," {
+			return "" // FROM a, b
+		}
+	}
+	return strings.ToLower(table)
+}
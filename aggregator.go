@@ -6,28 +6,73 @@
 package slowlog
 
 import (
+	"sort"
 	"time"
 )
 
 // A Result contains a global class and per-ID classes with finalized metric
 // statistics. The classes are keyed on class ID.
 type Result struct {
-	Global    *Class            // all classes
-	Class     map[string]*Class // keyed on class ID
-	RateLimit uint
-	Error     string
+	Global      *Class            // all classes
+	Class       map[string]*Class // keyed on class ID
+	RateLimit   uint
+	Error       string
+	Collisions  map[string][]string `json:",omitempty"` // class ID => other fingerprints with same ID
+	Meta        Meta
+	Connections *ConnectionStats `json:",omitempty"` // if Aggregator.SetConnections
 }
 
+// Meta is information about a Result that is not a metric statistic.
+type Meta struct {
+	UnknownMetrics []string `json:",omitempty"` // metrics not in KnownMetrics, sorted
+	Duplicates     uint64   `json:",omitempty"` // events not aggregated, see Aggregator.SetDedup
+	ZeroMetrics    []string `json:",omitempty"` // metrics omitted from a class, see Aggregator.SetOmitZeroMetrics
+	Replicated     uint64   `json:",omitempty"` // events excluded or separated, see Aggregator.SetReplication
+	Ignored        uint64   `json:",omitempty"` // classes removed by IgnoreList.Filter
+}
+
+// Replication is how an Aggregator handles events with Event.FromReplication,
+// see Aggregator.SetReplication.
+type Replication int
+
+const (
+	REPLICATION_INCLUDE  Replication = iota // aggregate like other events (default)
+	REPLICATION_EXCLUDE                     // do not aggregate
+	REPLICATION_SEPARATE                    // aggregate in classes with ID and fingerprint prefixed by REPLICATION_PREFIX
+)
+
+// REPLICATION_PREFIX prefixes the class ID and fingerprint of replicated
+// events if REPLICATION_SEPARATE.
+const REPLICATION_PREFIX = "replication:"
+
 // An Aggregator groups events by class ID. When there are no more events,
 // a call to Finalize computes all metric statistics and returns a Result.
 type Aggregator struct {
 	samples     bool
 	utcOffset   time.Duration
 	outlierTime float64
+	newSampler  func() Sampler
+	slo         *SLO
+	format      func(string) string
+	dedup       *dedup
+	cost        CostModel
+	exclude     map[string]bool
+	omitZero    bool
+	maxClasses  uint
+	maxExample  int
+	columns     bool
+	advisor     IndexAdvisor
+	burst       *Burst
+	conns       *connections
+	replication Replication
+	aliases     []Alias
+	aliasId     func(fingerprint string) string
 	// --
-	global    *Class
-	classes   map[string]*Class
-	rateLimit uint
+	global     *Class
+	classes    map[string]*Class
+	rateLimit  uint
+	collisions map[string]map[string]bool
+	replicated uint64
 }
 
 // NewAggregator returns a new Aggregator.
@@ -37,15 +82,164 @@ func NewAggregator(samples bool, utcOffset time.Duration, outlierTime float64) *
 		utcOffset:   utcOffset,
 		outlierTime: outlierTime,
 		// --
-		global:  NewClass("", "", false),
-		classes: map[string]*Class{},
+		global:     NewClass("", "", false),
+		classes:    map[string]*Class{},
+		collisions: map[string]map[string]bool{},
 	}
 	return a
 }
 
+// SetSampler sets a function that returns a new Sampler for each class.
+// Call this function before adding events.
+func (a *Aggregator) SetSampler(newSampler func() Sampler) {
+	a.newSampler = newSampler
+}
+
+// SetSLO sets a latency SLO for every class, including the global class.
+// Each class reports its compliance in Class.SLO. Call this function before
+// adding events.
+func (a *Aggregator) SetSLO(slo SLO) {
+	a.slo = &slo
+	a.global.slo = a.slo
+}
+
+// SetCostModel sets a cost model to estimate the cost of every class,
+// including the global class, in Class.Cost. Call this function before
+// adding events.
+func (a *Aggregator) SetCostModel(m CostModel) {
+	a.cost = m
+	a.global.cost = m
+}
+
+// SetExcludeMetrics sets metrics, like QC_Hit, that are not aggregated.
+// Call this function before adding events.
+func (a *Aggregator) SetExcludeMetrics(metrics ...string) {
+	a.exclude = map[string]bool{}
+	for _, metric := range metrics {
+		a.exclude[metric] = true
+	}
+}
+
+// SetOmitZeroMetrics makes Finalize remove the time and number metrics of a
+// class, including the global class, if all their values are zero, like
+// InnoDB waits when they are not measured. This makes Results smaller.
+// The names of the metrics removed from any class are listed in
+// Result.Meta.ZeroMetrics.
+func (a *Aggregator) SetOmitZeroMetrics(omit bool) {
+	a.omitZero = omit
+}
+
+// SetMaxClasses limits the number of classes to bound memory use. Events of new
+// classes after the limit are added to one class with ID and fingerprint
+// MISC_CLASS_ID, so the sum of the classes still equals the global class.
+// Aggregators merged by Merge are not limited. Call this function before
+// adding events.
+func (a *Aggregator) SetMaxClasses(n uint) {
+	a.maxClasses = n
+}
+
+// SetMaxExampleBytes sets the max size of Example.Query, which is
+// MAX_EXAMPLE_BYTES by default. Call this function before adding events.
+func (a *Aggregator) SetMaxExampleBytes(n int) {
+	a.maxExample = n
+}
+
+// SetColumns makes every class count the columns referenced in the WHERE,
+// GROUP BY, and ORDER BY clauses of its queries, see Columns. The most
+// frequent columns are reported in Class.TopColumns, which helps choose
+// indexes. This tokenizes every query, so it makes aggregating slower.
+// Call this function before adding events.
+func (a *Aggregator) SetColumns(columns bool) {
+	a.columns = columns
+}
+
+// SetBurst makes every class, except the global class, count its events by
+// Event.Time to detect if it is bursty. Bursty classes have Class.Burst, see
+// BurstyClasses. Events without a time are not counted. Call this function
+// before adding events.
+func (a *Aggregator) SetBurst(b Burst) {
+	a.burst = &b
+}
+
+// SetConnections makes the aggregator count Connect and Quit admin events per
+// user and host, and per interval if interval is not zero, in
+// Result.Connections. The events are still aggregated in classes. Call this
+// function before adding events.
+func (a *Aggregator) SetConnections(interval time.Duration) {
+	a.conns = newConnections(interval)
+}
+
+// SetReplication sets how events applied by a replica SQL thread, which have
+// Event.FromReplication, are aggregated. They are usually not application
+// queries, so they can be excluded, or separated into their own classes.
+// Separated events are still in the global class. Excluded and separated
+// events are counted in Result.Meta.Replicated. Call this function before
+// adding events.
+func (a *Aggregator) SetReplication(r Replication) {
+	a.replication = r
+}
+
+// SetAliases makes the aggregator add events with a fingerprint that matches
+// an alias to the class of the aliased fingerprint, which has class ID
+// id(fingerprint), like go-mysql/query.Id. Only the first matching alias
+// applies. The original fingerprints of an aliased class are reported in
+// Class.Aliases. Call this function before adding events.
+func (a *Aggregator) SetAliases(id func(fingerprint string) string, aliases ...Alias) {
+	a.aliasId = id
+	a.aliases = aliases
+}
+
+// SetIndexAdvisor sets an IndexAdvisor that annotates every class, except
+// the global class, with suggested indexes in Class.Indexes on Finalize.
+func (a *Aggregator) SetIndexAdvisor(advisor IndexAdvisor) {
+	a.advisor = advisor
+}
+
+// SetFormatter sets a function, like FormatQuery, applied to the query of
+// every class example and sample on Finalize.
+func (a *Aggregator) SetFormatter(format func(query string) string) {
+	a.format = format
+}
+
+// SetDedup makes the aggregator ignore duplicate events, like events parsed
+// again after resuming from an old offset. An event is a duplicate if it has
+// the same key as one of the last window events. Duplicates are counted in
+// Result.Meta.Duplicates. Aggregators merged by Merge do not dedup events
+// between them. Call this function before adding events.
+func (a *Aggregator) SetDedup(key DedupKey, window uint) {
+	a.dedup = newDedup(key, window)
+}
+
 // AddEvent adds the event to the aggregator, automatically creating new classes
-// as needed.
+// as needed. If the class ID already exists with a different fingerprint, the
+// IDs collide: the event is added to the existing class and the collision is
+// reported in Result.Collisions.
 func (a *Aggregator) AddEvent(event Event, id, fingerprint string) {
+	if a.dedup != nil && a.dedup.duplicate(event) {
+		return
+	}
+
+	original, aliased := fingerprint, false
+	if len(a.aliases) > 0 {
+		id, fingerprint, aliased = a.alias(id, fingerprint)
+	}
+
+	if event.FromReplication && a.replication != REPLICATION_INCLUDE {
+		a.replicated++
+		if a.replication == REPLICATION_EXCLUDE {
+			return
+		}
+		id, fingerprint = REPLICATION_PREFIX+id, REPLICATION_PREFIX+fingerprint
+	}
+
+	if a.conns != nil {
+		a.conns.addEvent(event)
+	}
+
+	if len(a.exclude) > 0 {
+		event = a.excludeMetrics(event)
+	}
+
 	if a.rateLimit != event.RateLimit {
 		a.rateLimit = event.RateLimit
 	}
@@ -58,13 +252,123 @@ func (a *Aggregator) AddEvent(event Event, id, fingerprint string) {
 	a.global.AddEvent(event, outlier)
 
 	class, ok := a.classes[id]
+	if !ok && a.full() {
+		id, fingerprint = MISC_CLASS_ID, MISC_CLASS_ID
+		class, ok = a.classes[id]
+	}
 	if !ok {
 		class = NewClass(id, fingerprint, a.samples)
+		if a.newSampler != nil {
+			class.sampler = a.newSampler()
+		}
+		class.slo = a.slo
+		class.cost = a.cost
+		class.exBytes = a.maxExample
+		if a.columns {
+			class.columns = map[ColumnRef]uint64{}
+		}
+		if a.burst != nil {
+			class.burst = a.burst
+			class.buckets = map[int64]uint64{}
+		}
 		a.classes[id] = class
+	} else if fingerprint != class.Fingerprint {
+		if a.collisions[id] == nil {
+			a.collisions[id] = map[string]bool{}
+		}
+		a.collisions[id][fingerprint] = true
+	}
+	if aliased {
+		class.addAlias(original)
 	}
 	class.AddEvent(event, outlier)
 }
 
+// full returns true if there are SetMaxClasses classes, not counting the
+// MISC_CLASS_ID class.
+func (a *Aggregator) full() bool {
+	if a.maxClasses == 0 {
+		return false
+	}
+	n := len(a.classes)
+	if _, ok := a.classes[MISC_CLASS_ID]; ok {
+		n--
+	}
+	return uint(n) >= a.maxClasses
+}
+
+// excludeMetrics returns the event without excluded metrics. The event
+// metric maps are copied, not changed, because the caller owns them.
+func (a *Aggregator) excludeMetrics(e Event) Event {
+	timeMetrics := make(map[string]float64, len(e.TimeMetrics))
+	for metric, val := range e.TimeMetrics {
+		if !a.exclude[metric] {
+			timeMetrics[metric] = val
+		}
+	}
+	numberMetrics := make(map[string]uint64, len(e.NumberMetrics))
+	for metric, val := range e.NumberMetrics {
+		if !a.exclude[metric] {
+			numberMetrics[metric] = val
+		}
+	}
+	boolMetrics := make(map[string]bool, len(e.BoolMetrics))
+	for metric, val := range e.BoolMetrics {
+		if !a.exclude[metric] {
+			boolMetrics[metric] = val
+		}
+	}
+	e.TimeMetrics = timeMetrics
+	e.NumberMetrics = numberMetrics
+	e.BoolMetrics = boolMetrics
+	return e
+}
+
+// Merge adds the events of aggregator b to the aggregator. Both aggregators
+// must not be finalized, and b must not be used after. Classes are merged by
+// class ID. This is used to aggregate in parallel, like DigestFiles.
+func (a *Aggregator) Merge(b *Aggregator) {
+	if b.rateLimit != 0 {
+		a.rateLimit = b.rateLimit
+	}
+	if b.dedup != nil {
+		if a.dedup == nil {
+			a.dedup = newDedup(b.dedup.key, 0)
+		}
+		a.dedup.n += b.dedup.n
+	}
+	if b.conns != nil {
+		if a.conns == nil {
+			a.conns = newConnections(b.conns.interval)
+		}
+		a.conns.merge(b.conns)
+	}
+	a.replicated += b.replicated
+	a.global.merge(b.global)
+	for id, bc := range b.classes {
+		class, ok := a.classes[id]
+		if !ok {
+			a.classes[id] = bc
+			continue
+		}
+		if bc.Fingerprint != class.Fingerprint {
+			if a.collisions[id] == nil {
+				a.collisions[id] = map[string]bool{}
+			}
+			a.collisions[id][bc.Fingerprint] = true
+		}
+		class.merge(bc)
+	}
+	for id, fingerprints := range b.collisions {
+		if a.collisions[id] == nil {
+			a.collisions[id] = map[string]bool{}
+		}
+		for f := range fingerprints {
+			a.collisions[id][f] = true
+		}
+	}
+}
+
 // Finalize calculates all metric statistics and returns a Result.
 // Call this function when done adding events to the aggregator.
 func (a *Aggregator) Finalize() Result {
@@ -73,17 +377,224 @@ func (a *Aggregator) Finalize() Result {
 	for _, class := range a.classes {
 		class.Finalize(a.rateLimit)
 		class.UniqueQueries = 1
-		if class.Example != nil && class.Example.Ts != "" {
-			if t, err := time.Parse("060102 15:04:05", class.Example.Ts); err != nil {
-				class.Example.Ts = ""
-			} else {
-				class.Example.Ts = t.Add(a.utcOffset).Format("2006-01-02 15:04:05")
+		if class.Example != nil {
+			a.finalizeExample(class.Example)
+		}
+		for i := range class.Samples {
+			a.finalizeExample(&class.Samples[i])
+		}
+		if a.advisor != nil {
+			class.Indexes = a.advisor.Advise(class)
+		}
+	}
+	var collisions map[string][]string
+	if len(a.collisions) > 0 {
+		collisions = map[string][]string{}
+		for id, fingerprints := range a.collisions {
+			for f := range fingerprints {
+				collisions[id] = append(collisions[id], f)
 			}
+			sort.Strings(collisions[id])
+		}
+	}
+	meta := a.meta()
+	if a.omitZero {
+		omitted := map[string]bool{}
+		a.global.Metrics.omitZero(omitted)
+		for _, class := range a.classes {
+			class.Metrics.omitZero(omitted)
+		}
+		for metric := range omitted {
+			meta.ZeroMetrics = append(meta.ZeroMetrics, metric)
+		}
+		sort.Strings(meta.ZeroMetrics)
+	}
+	r := Result{
+		Global:     a.global,
+		Class:      a.classes,
+		RateLimit:  a.rateLimit,
+		Collisions: collisions,
+		Meta:       meta,
+	}
+	if a.conns != nil {
+		r.Connections = a.conns.finalize()
+	}
+	return r
+}
+
+// KilledClasses returns the classes in the finalized Result in which at least
+// minFraction (e.g. 0.1) of queries were killed, like by max_execution_time or
+// pt-kill, sorted by KilledQueries descending. Queries are often killed
+// because they are too slow, so these classes are likely problems.
+func KilledClasses(r Result, minFraction float64) []*Class {
+	killed := []*Class{}
+	for _, class := range r.Class {
+		if class.KilledQueries == 0 || class.TotalQueries == 0 {
+			continue
+		}
+		if float64(class.KilledQueries)/float64(class.TotalQueries) >= minFraction {
+			killed = append(killed, class)
+		}
+	}
+	sort.Slice(killed, func(i, j int) bool {
+		if killed[i].KilledQueries == killed[j].KilledQueries {
+			return killed[i].Id < killed[j].Id
+		}
+		return killed[i].KilledQueries > killed[j].KilledQueries
+	})
+	return killed
+}
+
+// MemoryClasses returns the classes in the finalized Result in which a query
+// used at least minBytes of memory, by the Max of MEMORY_METRICS, sorted by
+// that Max descending. A class can be fast and still use a lot of memory,
+// like a query that sorts or groups many rows in memory.
+func MemoryClasses(r Result, minBytes uint64) []*Class {
+	hungry := []*Class{}
+	for _, class := range r.Class {
+		if m := maxMemory(class); m > 0 && m >= minBytes {
+			hungry = append(hungry, class)
+		}
+	}
+	sort.Slice(hungry, func(i, j int) bool {
+		mi, mj := maxMemory(hungry[i]), maxMemory(hungry[j])
+		if mi == mj {
+			return hungry[i].Id < hungry[j].Id
+		}
+		return mi > mj
+	})
+	return hungry
+}
+
+// maxMemory returns the greatest Max of the MEMORY_METRICS of the class, or 0
+// if it has none.
+func maxMemory(class *Class) uint64 {
+	max := uint64(0)
+	for name := range MEMORY_METRICS {
+		if s, ok := class.Metrics.NumberMetrics[name]; ok && s.Max > max {
+			max = s.Max
+		}
+	}
+	return max
+}
+
+// MISC_CLASS_ID is the reserved ID and fingerprint of the class that
+// aggregates other classes: classes over Aggregator.SetMaxClasses, and classes
+// not in TopClasses.
+const MISC_CLASS_ID = "MISC"
+
+// BurstyClasses returns the classes in the finalized Result that have
+// Class.Burst, sorted by Burst.Fraction descending. It is empty unless
+// Aggregator.SetBurst was called. Bursty classes are usually periodic jobs
+// which are fixed differently than classes with queries all the time.
+func BurstyClasses(r Result) []*Class {
+	bursty := []*Class{}
+	for _, class := range r.Class {
+		if class.Burst != nil {
+			bursty = append(bursty, class)
+		}
+	}
+	sort.Slice(bursty, func(i, j int) bool {
+		if bursty[i].Burst.Fraction == bursty[j].Burst.Fraction {
+			return bursty[i].Id < bursty[j].Id
+		}
+		return bursty[i].Burst.Fraction > bursty[j].Burst.Fraction
+	})
+	return bursty
+}
+
+// TopClasses returns a copy of the finalized Result with only the fewest
+// classes, by Query_time sum descending, that account for at least pct (e.g.
+// 95) percent of the total Query_time, like pt-query-digest --limit 95%.
+// The other classes, and the MISC_CLASS_ID class if any, are aggregated into
+// one class with ID and fingerprint MISC_CLASS_ID. The global class is not
+// changed.
+func TopClasses(r Result, pct float64) Result {
+	classes := make([]*Class, 0, len(r.Class))
+	total := 0.0
+	for id, class := range r.Class {
+		total += queryTime(class)
+		if id != MISC_CLASS_ID {
+			classes = append(classes, class)
+		}
+	}
+	sort.Slice(classes, func(i, j int) bool {
+		ti, tj := queryTime(classes[i]), queryTime(classes[j])
+		if ti == tj {
+			return classes[i].Id < classes[j].Id
+		}
+		return ti > tj
+	})
+
+	top := r
+	top.Class = map[string]*Class{}
+	sum := 0.0
+	n := 0
+	for ; n < len(classes) && sum < total*pct/100; n++ {
+		top.Class[classes[n].Id] = classes[n]
+		sum += queryTime(classes[n])
+	}
+	rest := classes[n:]
+	if misc, ok := r.Class[MISC_CLASS_ID]; ok {
+		rest = append(rest, misc)
+	}
+	if len(rest) > 0 {
+		top.Class[MISC_CLASS_ID] = NewAggregateClass(MISC_CLASS_ID, MISC_CLASS_ID, rest)
+	}
+	return top
+}
+
+// queryTime returns the Query_time sum of the class.
+func queryTime(c *Class) float64 {
+	if s, ok := c.Metrics.TimeMetrics["Query_time"]; ok {
+		return s.Sum
+	}
+	return 0
+}
+
+// finalizeExample formats the time of the example, adjusted by the UTC offset,
+// as its timestamp, and formats the query. If the event has no Time, like an
+// event not from a parser, the raw timestamp is parsed as UTC, or set empty if
+// it's not valid.
+func (a *Aggregator) finalizeExample(ex *Example) {
+	if ex.Ts != "" {
+		t := ex.time
+		if t.IsZero() {
+			t, _, _ = parseTs(ex.Ts, time.UTC, DST_EARLIEST) // zero if not valid
+		}
+		if t.IsZero() {
+			ex.Ts = ""
+		} else {
+			ex.Ts = t.Add(a.utcOffset).Format("2006-01-02 15:04:05")
+		}
+	}
+	if a.format != nil {
+		ex.Query = a.format(ex.Query)
+	}
+}
+
+// meta returns the Meta of the finalized global class.
+func (a *Aggregator) meta() Meta {
+	m := Meta{}
+	for metric := range a.global.Metrics.TimeMetrics {
+		if !knownMetric(metric) {
+			m.UnknownMetrics = append(m.UnknownMetrics, metric)
+		}
+	}
+	for metric := range a.global.Metrics.NumberMetrics {
+		if !knownMetric(metric) {
+			m.UnknownMetrics = append(m.UnknownMetrics, metric)
+		}
+	}
+	for metric := range a.global.Metrics.BoolMetrics {
+		if !knownMetric(metric) {
+			m.UnknownMetrics = append(m.UnknownMetrics, metric)
 		}
 	}
-	return Result{
-		Global:    a.global,
-		Class:     a.classes,
-		RateLimit: a.rateLimit,
+	sort.Strings(m.UnknownMetrics)
+	if a.dedup != nil {
+		m.Duplicates = a.dedup.n
 	}
+	m.Replicated = a.replicated
+	return m
 }
@@ -7,9 +7,13 @@ package slowlog_test
 
 import (
 	"encoding/json"
+	"fmt"
 	"io/ioutil"
 	"os"
 	"path"
+	"regexp"
+	"sort"
+	"sync/atomic"
 	"testing"
 	"time"
 
@@ -95,6 +99,57 @@ func TestSlow001WithTzOffset(t *testing.T) {
 	}
 }
 
+func TestExampleTs(t *testing.T) {
+	// Every Time format, including ISO 8601, is formatted from Event.Time.
+	got := []string{}
+	for _, e := range parseSlowLog(t, "slow036.log", noOptions) {
+		a := slowlog.NewAggregator(examples, -1*time.Hour, 10)
+		a.AddEvent(e, "1", "select c from t where id = ?")
+		got = append(got, a.Finalize().Class["1"].Example.Ts)
+	}
+	expect := []string{
+		"2023-02-05 01:46:47",
+		"2023-02-05 09:46:48",
+		"2023-02-04 18:46:49",
+		"2023-02-04 18:46:50",
+		"2023-02-04 08:46:51",
+	}
+	if diff := deep.Equal(got, expect); diff != nil {
+		t.Error(diff)
+	}
+
+	// Ts is parsed if the event has no Time.
+	e := slowlog.NewEvent()
+	e.Ts = "2023-02-05T02:46:47.273786Z"
+	e.TimeMetrics["Query_time"] = 1
+	a := slowlog.NewAggregator(examples, 0, 10)
+	a.AddEvent(*e, "1", "select 1")
+	if ts := a.Finalize().Class["1"].Example.Ts; ts != "2023-02-05 02:46:47" {
+		t.Errorf("got Ts %s, expected 2023-02-05 02:46:47", ts)
+	}
+}
+
+func TestExampleTimeOffset(t *testing.T) {
+	// Class examples are corrected by Options.TimeOffset, like Event.Time.
+	a := slowlog.NewAggregator(examples, 0, 10)
+	for _, e := range parseSlowLog(t, "slow001.log", slowlog.Options{TimeOffset: -1 * time.Hour}) {
+		f := query.Fingerprint(e.Query)
+		a.AddEvent(e, query.Id(f), f)
+	}
+	got := a.Finalize()
+	expect := map[string]string{
+		"7F7D57ACDD8A346E": "2007-10-15 20:43:52",
+		"3A99CC42AEDCCFCD": "2007-10-15 20:45:10",
+	}
+	for id, ts := range expect {
+		if got.Class[id] == nil || got.Class[id].Example == nil {
+			t.Errorf("no example for class %s", id)
+		} else if got.Class[id].Example.Ts != ts {
+			t.Errorf("class %s: got Ts %s, expected %s", id, got.Class[id].Example.Ts, ts)
+		}
+	}
+}
+
 func TestSlow001NoExamples(t *testing.T) {
 	examples = false
 	defer func() { examples = true }()
@@ -151,3 +206,903 @@ func TestOutlierSlow025(t *testing.T) {
 		t.Error(diff)
 	}
 }
+
+// firstSampler saves the first example per Last_errno.
+type firstSampler struct {
+	samples map[uint64]slowlog.Example
+	errnos  []uint64
+}
+
+func (s *firstSampler) OnEvent(e slowlog.Event) {
+	errno := e.NumberMetrics["Last_errno"]
+	if _, ok := s.samples[errno]; ok {
+		return
+	}
+	s.samples[errno] = slowlog.NewExample(e)
+	s.errnos = append(s.errnos, errno)
+}
+
+func (s *firstSampler) Samples() []slowlog.Example {
+	samples := make([]slowlog.Example, len(s.errnos))
+	for i, errno := range s.errnos {
+		samples[i] = s.samples[errno]
+	}
+	return samples
+}
+
+func TestSampler(t *testing.T) {
+	a := slowlog.NewAggregator(true, -1*time.Hour, 0)
+	a.SetSampler(func() slowlog.Sampler {
+		return &firstSampler{samples: map[uint64]slowlog.Example{}}
+	})
+	for i, errno := range []uint64{0, 1062, 0, 1062} {
+		e := slowlog.NewEvent()
+		e.Ts = "071015 21:43:52"
+		e.Db = "db1"
+		e.Query = fmt.Sprintf("insert into t values (%d)", i)
+		e.TimeMetrics["Query_time"] = float64(i + 1)
+		e.NumberMetrics["Last_errno"] = errno
+		a.AddEvent(*e, "111", "insert into t values (?)")
+	}
+	got := a.Finalize()
+	expect := []slowlog.Example{
+		{QueryTime: 1, Db: "db1", Query: "insert into t values (0)", Ts: "2007-10-15 20:43:52"},
+		{QueryTime: 2, Db: "db1", Query: "insert into t values (1)", Ts: "2007-10-15 20:43:52"},
+	}
+	if diff := deep.Equal(got.Class["111"].Samples, expect); diff != nil {
+		t.Error(diff)
+	}
+	if got.Class["111"].Example.Query != "insert into t values (3)" {
+		t.Errorf("got Example.Query %s, expected max Query_time query", got.Class["111"].Example.Query)
+	}
+}
+
+func TestCollisions(t *testing.T) {
+	a := slowlog.NewAggregator(false, 0, 0)
+	e := slowlog.NewEvent()
+	e.TimeMetrics["Query_time"] = 1
+	a.AddEvent(*e, "111", "select a")
+	a.AddEvent(*e, "111", "select c")
+	a.AddEvent(*e, "111", "select b")
+	a.AddEvent(*e, "111", "select a")
+	a.AddEvent(*e, "222", "select d")
+	got := a.Finalize()
+	expect := map[string][]string{
+		"111": {"select b", "select c"},
+	}
+	if diff := deep.Equal(got.Collisions, expect); diff != nil {
+		t.Error(diff)
+	}
+	if got.Class["111"].TotalQueries != 4 {
+		t.Errorf("got %d queries in class 111, expected 4", got.Class["111"].TotalQueries)
+	}
+}
+
+func TestSLO(t *testing.T) {
+	a := slowlog.NewAggregator(false, 0, 0)
+	a.SetSLO(slowlog.SLO{Threshold: 0.2, Target: 0.9})
+	for i, qt := range []float64{0.1, 0.2, 0.3, 0.1, 0.1, 0.1, 0.1, 0.1, 0.1, 0.5} {
+		e := slowlog.NewEvent()
+		e.TimeMetrics["Query_time"] = qt
+		id := "111"
+		if i%2 == 1 {
+			id = "222"
+		}
+		a.AddEvent(*e, id, "select "+id)
+	}
+	got := a.Finalize()
+	expect := map[string]*slowlog.SLOStats{
+		"":    {Compliance: 0.8, BurnRate: 2},
+		"111": {Compliance: 0.8, BurnRate: 2},
+		"222": {Compliance: 0.8, BurnRate: 2},
+	}
+	if diff := deep.Equal(got.Global.SLO, expect[""]); diff != nil {
+		t.Error(diff)
+	}
+	for id, class := range got.Class {
+		if diff := deep.Equal(class.SLO, expect[id]); diff != nil {
+			t.Error(id, diff)
+		}
+	}
+}
+
+func TestCostModel(t *testing.T) {
+	a := slowlog.NewAggregator(false, 0, 0)
+	a.SetCostModel(slowlog.CostModel{
+		"Query_time":    0.5,
+		"Rows_examined": 0.01,
+		"Full_scan":     2,
+	})
+	e := slowlog.NewEvent()
+	e.TimeMetrics["Query_time"] = 2
+	e.NumberMetrics["Rows_examined"] = 100
+	e.NumberMetrics["Rows_sent"] = 10 // no cost
+	e.BoolMetrics["Full_scan"] = true
+	a.AddEvent(*e, "1", "select 1")
+	e.BoolMetrics["Full_scan"] = false
+	a.AddEvent(*e, "1", "select 1")
+	e.NumberMetrics["Rows_examined"] = 0
+	a.AddEvent(*e, "2", "select 2")
+	got := a.Finalize()
+	// 2 * (2 * 0.5 + 100 * 0.01) + 2 = 6
+	if got.Class["1"].Cost != 6 {
+		t.Errorf("class 1: got cost %f, expected 6", got.Class["1"].Cost)
+	}
+	// 2 * 0.5 = 1
+	if got.Class["2"].Cost != 1 {
+		t.Errorf("class 2: got cost %f, expected 1", got.Class["2"].Cost)
+	}
+	if got.Global.Cost != 7 {
+		t.Errorf("global: got cost %f, expected 7", got.Global.Cost)
+	}
+}
+
+func TestFormatter(t *testing.T) {
+	a := slowlog.NewAggregator(true, 0, 0)
+	a.SetFormatter(slowlog.FormatQuery)
+	e := slowlog.NewEvent()
+	e.Query = "select c from t where id = 1"
+	e.TimeMetrics["Query_time"] = 1
+	a.AddEvent(*e, "111", "select c from t where id = ?")
+	got := a.Finalize()
+	expect := "select c\nfrom t\nwhere id = 1"
+	if got.Class["111"].Example.Query != expect {
+		t.Errorf("got %s, expected %s", got.Class["111"].Example.Query, expect)
+	}
+}
+
+func TestDigestFiles(t *testing.T) {
+	files := []string{"slow001.log", "slow002.log", "slow010.log", "slow019.log"}
+	paths := []string{}
+	expect := slowlog.NewAggregator(false, 0, 0)
+	for _, f := range files {
+		paths = append(paths, path.Join("test", "slow-logs", f))
+		file, err := os.Open(path.Join("test", "slow-logs", f))
+		if err != nil {
+			t.Fatal(err)
+		}
+		p := slowlog.NewFileParser(file)
+		if err := p.Start(noOptions); err != nil {
+			t.Fatal(err)
+		}
+		for e := range p.Events() {
+			f := query.Fingerprint(e.Query)
+			expect.AddEvent(e, query.Id(f), f)
+		}
+		file.Close()
+	}
+
+	opt := slowlog.DigestOptions{
+		Class: func(e slowlog.Event) (string, string) {
+			f := query.Fingerprint(e.Query)
+			return query.Id(f), f
+		},
+	}
+	got, err := slowlog.DigestFiles(paths, 3, opt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := deep.Equal(got, expect.Finalize()); diff != nil {
+		t.Error(diff)
+	}
+
+	_, err = slowlog.DigestFiles(append(paths, "does-not-exist.log"), 2, opt)
+	if err == nil {
+		t.Error("no error for file that does not exist")
+	}
+}
+
+// countingStorage counts Puts.
+type countingStorage struct {
+	*slowlog.MemoryStorage
+	puts int64
+}
+
+func (s *countingStorage) Put(key string, r slowlog.Result) error {
+	atomic.AddInt64(&s.puts, 1)
+	return s.MemoryStorage.Put(key, r)
+}
+
+func TestDigestFilesCache(t *testing.T) {
+	paths := []string{}
+	for _, f := range []string{"slow001.log", "slow002.log", "slow010.log"} {
+		paths = append(paths, path.Join("test", "slow-logs", f))
+	}
+	cache := &countingStorage{MemoryStorage: slowlog.NewMemoryStorage()}
+	opt := slowlog.DigestOptions{
+		Class: func(e slowlog.Event) (string, string) {
+			f := query.Fingerprint(e.Query)
+			return query.Id(f), f
+		},
+		Cache: cache,
+	}
+	first, err := slowlog.DigestFiles(paths, 2, opt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cache.puts != int64(len(paths)) {
+		t.Errorf("got %d cached Results, expected %d", cache.puts, len(paths))
+	}
+	second, err := slowlog.DigestFiles(paths, 2, opt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cache.puts != int64(len(paths)) {
+		t.Errorf("got %d cached Results after second digest, expected %d", cache.puts, len(paths))
+	}
+	if diff := deep.Equal(second, first); diff != nil {
+		t.Error(diff)
+	}
+
+	opt.Cache = nil
+	uncached, err := slowlog.DigestFiles(paths, 2, opt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if first.Global.TotalQueries != uncached.Global.TotalQueries {
+		t.Errorf("got %d queries, expected %d", first.Global.TotalQueries, uncached.Global.TotalQueries)
+	}
+	if len(first.Class) != len(uncached.Class) {
+		t.Errorf("got %d classes, expected %d", len(first.Class), len(uncached.Class))
+	}
+	for id, c := range uncached.Class {
+		got := first.Class[id]
+		if got == nil {
+			t.Errorf("class %s not in cached Result", id)
+			continue
+		}
+		if got.TotalQueries != c.TotalQueries || got.Metrics.TimeMetrics["Query_time"].Sum != c.Metrics.TimeMetrics["Query_time"].Sum {
+			t.Errorf("class %s: got %d queries and %f Query_time, expected %d and %f", id,
+				got.TotalQueries, got.Metrics.TimeMetrics["Query_time"].Sum,
+				c.TotalQueries, c.Metrics.TimeMetrics["Query_time"].Sum)
+		}
+	}
+}
+
+func TestMergeResults(t *testing.T) {
+	result := func(queryTimes ...float64) slowlog.Result {
+		a := slowlog.NewAggregator(false, 0, 0)
+		for _, qt := range queryTimes {
+			e := slowlog.NewEvent()
+			e.Query = "select 1"
+			e.TimeMetrics["Query_time"] = qt
+			e.NumberMetrics["Rows_sent"] = 1
+			a.AddEvent(*e, "1", "select ?")
+		}
+		return a.Finalize()
+	}
+	got := slowlog.MergeResults(result(1, 3), result(2, 4, 6, 8))
+	class := got.Class["1"]
+	if class.TotalQueries != 6 {
+		t.Errorf("got %d queries, expected 6", class.TotalQueries)
+	}
+	expect := &slowlog.TimeStats{
+		Sum: 24,
+		Min: 1,
+		Avg: 4,
+		Med: (2*3 + 6*4) / 6.0, // weighted medians
+		P95: 8,
+		Max: 8,
+	}
+	if diff := deep.Equal(class.Metrics.TimeMetrics["Query_time"], expect); diff != nil {
+		t.Error(diff)
+	}
+	if s := class.Metrics.NumberMetrics["Rows_sent"]; s.Sum != 6 || s.Avg != 1 {
+		t.Errorf("got Rows_sent %+v, expected Sum 6 and Avg 1", s)
+	}
+	if got.Global.TotalQueries != 6 {
+		t.Errorf("got %d global queries, expected 6", got.Global.TotalQueries)
+	}
+}
+
+func TestDedup(t *testing.T) {
+	file, err := os.Open(path.Join("test", "slow-logs", "slow001.log"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	p := slowlog.NewFileParser(file)
+	if err := p.Start(noOptions); err != nil {
+		t.Fatal(err)
+	}
+	events := []slowlog.Event{}
+	for e := range p.Events() {
+		events = append(events, e)
+	}
+
+	expect := slowlog.NewAggregator(false, 0, 0)
+	for _, e := range events {
+		f := query.Fingerprint(e.Query)
+		expect.AddEvent(e, query.Id(f), f)
+	}
+	expectResult := expect.Finalize()
+
+	for _, key := range []slowlog.DedupKey{slowlog.DEDUP_OFFSET, slowlog.DEDUP_CONTENT} {
+		a := slowlog.NewAggregator(false, 0, 0)
+		a.SetDedup(key, 10)
+		for i := 0; i < 3; i++ {
+			for _, e := range events {
+				if key == slowlog.DEDUP_CONTENT {
+					e.Source = fmt.Sprintf("rotated-%d.log", i)
+					e.Offset += uint64(i)
+				}
+				f := query.Fingerprint(e.Query)
+				a.AddEvent(e, query.Id(f), f)
+			}
+		}
+		got := a.Finalize()
+		if got.Meta.Duplicates != 4 {
+			t.Errorf("key %d: got %d duplicates, expected 4", key, got.Meta.Duplicates)
+		}
+		got.Meta.Duplicates = 0
+		if diff := deep.Equal(got, expectResult); diff != nil {
+			t.Errorf("key %d: %v", key, diff)
+		}
+	}
+
+	// Window of 1 only remembers the last event.
+	a := slowlog.NewAggregator(false, 0, 0)
+	a.SetDedup(slowlog.DEDUP_OFFSET, 1)
+	for _, e := range append(events, events...) {
+		a.AddEvent(e, "1", "select")
+	}
+	if got := a.Finalize(); got.Meta.Duplicates != 0 {
+		t.Errorf("got %d duplicates, expected 0", got.Meta.Duplicates)
+	}
+}
+
+func TestKilledClasses(t *testing.T) {
+	a := slowlog.NewAggregator(false, 0, 0)
+	e := slowlog.NewEvent()
+	e.TimeMetrics["Query_time"] = 1
+	add := func(id string, n int, killed uint64) {
+		e.NumberMetrics["Killed"] = killed
+		for i := 0; i < n; i++ {
+			a.AddEvent(*e, id, "select "+id)
+		}
+	}
+	add("1", 9, 0)
+	add("1", 1, 1317) // 10% killed
+	add("2", 1, 0)
+	add("2", 2, 3024) // 67% killed
+	add("3", 5, 0)
+	got := a.Finalize()
+
+	if got.Class["1"].KilledQueries != 1 || got.Class["2"].KilledQueries != 2 || got.Class["3"].KilledQueries != 0 {
+		t.Errorf("got KilledQueries %d, %d, %d, expected 1, 2, 0",
+			got.Class["1"].KilledQueries, got.Class["2"].KilledQueries, got.Class["3"].KilledQueries)
+	}
+	if got.Global.KilledQueries != 3 {
+		t.Errorf("got global KilledQueries %d, expected 3", got.Global.KilledQueries)
+	}
+
+	ids := []string{}
+	for _, class := range slowlog.KilledClasses(got, 0.1) {
+		ids = append(ids, class.Id)
+	}
+	if diff := deep.Equal(ids, []string{"2", "1"}); diff != nil {
+		t.Error(diff)
+	}
+	if n := len(slowlog.KilledClasses(got, 0.5)); n != 1 {
+		t.Errorf("got %d classes at least 50%% killed, expected 1", n)
+	}
+}
+
+func TestMemoryClasses(t *testing.T) {
+	a := slowlog.NewAggregator(false, 0, 0)
+	add := func(id string, memory uint64) {
+		e := slowlog.NewEvent()
+		e.TimeMetrics["Query_time"] = 0.01
+		if memory > 0 {
+			e.NumberMetrics["Max_used_memory"] = memory
+		}
+		a.AddEvent(*e, id, "select "+id)
+	}
+	add("1", 1<<20)
+	add("1", 512<<20)
+	add("2", 1<<30)
+	add("3", 4<<10)
+	add("4", 0) // not logged
+	got := a.Finalize()
+
+	ids := []string{}
+	for _, class := range slowlog.MemoryClasses(got, 256<<20) {
+		ids = append(ids, class.Id)
+	}
+	if diff := deep.Equal(ids, []string{"2", "1"}); diff != nil {
+		t.Error(diff)
+	}
+	if n := len(slowlog.MemoryClasses(got, 0)); n != 3 {
+		t.Errorf("got %d classes with memory metrics, expected 3", n)
+	}
+}
+
+func TestCoverage(t *testing.T) {
+	a := slowlog.NewAggregator(false, 0, 0)
+	e := slowlog.NewEvent()
+	e.TimeMetrics["Query_time"] = 1
+	for i := 0; i < 3; i++ {
+		a.AddEvent(*e, "1", "select 1")
+	}
+	r := a.Finalize()
+	got := slowlog.Coverage(r,
+		slowlog.ServerCounters{SlowQueries: 10, Questions: 100},
+		slowlog.ServerCounters{SlowQueries: 14, Questions: 180},
+	)
+	expect := slowlog.CoverageStats{
+		SlowQueries:  4,
+		Questions:    80,
+		Parsed:       3,
+		Coverage:     0.75,
+		SlowFraction: 0.05,
+	}
+	if diff := deep.Equal(got, expect); diff != nil {
+		t.Error(diff)
+	}
+
+	// Server restarted.
+	got = slowlog.Coverage(r, slowlog.ServerCounters{SlowQueries: 10}, slowlog.ServerCounters{SlowQueries: 2})
+	if got.SlowQueries != 0 || got.Coverage != 0 {
+		t.Errorf("got %+v after restart, expected 0 SlowQueries and Coverage", got)
+	}
+}
+
+func TestBoolMetrics(t *testing.T) {
+	a := slowlog.NewAggregator(false, 0, 0)
+	a.SetExcludeMetrics("QC_Hit", "Lock_time")
+	e := slowlog.NewEvent()
+	e.TimeMetrics["Query_time"] = 1
+	e.TimeMetrics["Lock_time"] = 1
+	e.BoolMetrics["QC_Hit"] = true
+	for _, fullScan := range []bool{true, false, false, false} {
+		e.BoolMetrics["Full_scan"] = fullScan
+		a.AddEvent(*e, "1", "select 1")
+	}
+	got := a.Finalize()
+	expect := map[string]*slowlog.BoolStats{
+		"Full_scan": {Sum: 1, Cnt: 4, TruePct: 25},
+	}
+	if diff := deep.Equal(got.Class["1"].Metrics.BoolMetrics, expect); diff != nil {
+		t.Error(diff)
+	}
+	if _, ok := got.Global.Metrics.TimeMetrics["Lock_time"]; ok {
+		t.Error("excluded Lock_time aggregated")
+	}
+	if _, ok := e.BoolMetrics["QC_Hit"]; !ok {
+		t.Error("excluded QC_Hit deleted from event")
+	}
+}
+
+func TestMissingMetrics(t *testing.T) {
+	a := slowlog.NewAggregator(false, 0, 0)
+	e := slowlog.NewEvent()
+	e.TimeMetrics["Query_time"] = 1
+	a.AddEvent(*e, "1", "select 1")
+	e.NumberMetrics["InnoDB_IO_r_ops"] = 2
+	e.BoolMetrics["Full_scan"] = true
+	a.AddEvent(*e, "1", "select 1")
+	a.AddEvent(*e, "1", "select 1")
+	got := a.Finalize()
+	m := got.Class["1"].Metrics
+	if n := m.TimeMetrics["Query_time"].Missing; n != 0 {
+		t.Errorf("Query_time: got %d missing, expected 0", n)
+	}
+	if n := m.NumberMetrics["InnoDB_IO_r_ops"].Missing; n != 1 {
+		t.Errorf("InnoDB_IO_r_ops: got %d missing, expected 1", n)
+	}
+	if n := m.BoolMetrics["Full_scan"].Missing; n != 1 {
+		t.Errorf("Full_scan: got %d missing, expected 1", n)
+	}
+	// Avg is of events with the metric.
+	if avg := m.NumberMetrics["InnoDB_IO_r_ops"].Avg; avg != 2 {
+		t.Errorf("InnoDB_IO_r_ops: got avg %d, expected 2", avg)
+	}
+}
+
+func TestMetaUnknownMetrics(t *testing.T) {
+	a := slowlog.NewAggregator(false, 0, 0)
+	e := slowlog.NewEvent()
+	e.TimeMetrics["Query_time"] = 1
+	e.TimeMetrics["New_time"] = 1
+	e.NumberMetrics["Rows_sent"] = 1
+	e.NumberMetrics["New_rows"] = 1
+	e.BoolMetrics["New_flag"] = true
+	a.AddEvent(*e, "111", "select 1")
+	got := a.Finalize()
+	expect := slowlog.Meta{
+		UnknownMetrics: []string{"New_flag", "New_rows", "New_time"},
+	}
+	if diff := deep.Equal(got.Meta, expect); diff != nil {
+		t.Error(diff)
+	}
+}
+
+func TestOmitZeroMetrics(t *testing.T) {
+	a := slowlog.NewAggregator(false, 0, 0)
+	a.SetOmitZeroMetrics(true)
+	e := slowlog.NewEvent()
+	e.TimeMetrics["Query_time"] = 1
+	e.TimeMetrics["InnoDB_queue_wait"] = 0
+	e.NumberMetrics["Rows_sent"] = 0
+	e.NumberMetrics["Rows_examined"] = 0
+	a.AddEvent(*e, "1", "select 1")
+	e.NumberMetrics["Rows_examined"] = 5
+	a.AddEvent(*e, "2", "select 2")
+	got := a.Finalize()
+
+	names := func(m slowlog.Metrics) []string {
+		n := []string{}
+		for metric := range m.TimeMetrics {
+			n = append(n, metric)
+		}
+		for metric := range m.NumberMetrics {
+			n = append(n, metric)
+		}
+		sort.Strings(n)
+		return n
+	}
+	if diff := deep.Equal(names(got.Class["1"].Metrics), []string{"Query_time"}); diff != nil {
+		t.Error(diff)
+	}
+	if diff := deep.Equal(names(got.Class["2"].Metrics), []string{"Query_time", "Rows_examined"}); diff != nil {
+		t.Error(diff)
+	}
+	if diff := deep.Equal(names(got.Global.Metrics), []string{"Query_time", "Rows_examined"}); diff != nil {
+		t.Error(diff)
+	}
+	expect := []string{"InnoDB_queue_wait", "Rows_examined", "Rows_sent"}
+	if diff := deep.Equal(got.Meta.ZeroMetrics, expect); diff != nil {
+		t.Error(diff)
+	}
+}
+
+func TestTopClasses(t *testing.T) {
+	a := slowlog.NewAggregator(false, 0, 0)
+	add := func(id string, queryTime float64, n int) {
+		e := slowlog.NewEvent()
+		e.TimeMetrics["Query_time"] = queryTime
+		for i := 0; i < n; i++ {
+			a.AddEvent(*e, id, "select "+id)
+		}
+	}
+	add("1", 10, 6) // 60s, 60%
+	add("2", 3, 10) // 30s, 30%
+	add("3", 1, 6)  // 6s
+	add("4", 2, 2)  // 4s
+	got := a.Finalize()
+
+	top := slowlog.TopClasses(got, 95)
+	ids := []string{}
+	for id := range top.Class {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	if diff := deep.Equal(ids, []string{"1", "2", "3", slowlog.MISC_CLASS_ID}); diff != nil {
+		t.Error(diff)
+	}
+	misc := top.Class[slowlog.MISC_CLASS_ID]
+	if misc.TotalQueries != 2 || misc.Metrics.TimeMetrics["Query_time"].Sum != 4 {
+		t.Errorf("got MISC %d queries %f Query_time, expected 2 and 4",
+			misc.TotalQueries, misc.Metrics.TimeMetrics["Query_time"].Sum)
+	}
+	if top.Global != got.Global {
+		t.Error("global class changed")
+	}
+	if len(got.Class) != 4 {
+		t.Errorf("original Result changed: got %d classes, expected 4", len(got.Class))
+	}
+
+	// 100% is all classes, no MISC.
+	if top := slowlog.TopClasses(got, 100); len(top.Class) != 4 || top.Class[slowlog.MISC_CLASS_ID] != nil {
+		t.Errorf("got %d classes for 100%%, expected 4 without MISC", len(top.Class))
+	}
+}
+
+func TestMaxClasses(t *testing.T) {
+	a := slowlog.NewAggregator(false, 0, 0)
+	a.SetMaxClasses(2)
+	add := func(id string, queryTime float64) {
+		e := slowlog.NewEvent()
+		e.TimeMetrics["Query_time"] = queryTime
+		a.AddEvent(*e, id, "select "+id)
+	}
+	add("1", 1)
+	add("2", 2)
+	add("3", 3) // MISC
+	add("1", 1)
+	add("4", 4) // MISC
+	got := a.Finalize()
+
+	ids := []string{}
+	total := uint64(0)
+	for id, class := range got.Class {
+		ids = append(ids, id)
+		total += class.TotalQueries
+	}
+	sort.Strings(ids)
+	if diff := deep.Equal(ids, []string{"1", "2", slowlog.MISC_CLASS_ID}); diff != nil {
+		t.Error(diff)
+	}
+	if total != got.Global.TotalQueries {
+		t.Errorf("got %d queries in classes, expected %d", total, got.Global.TotalQueries)
+	}
+	misc := got.Class[slowlog.MISC_CLASS_ID]
+	if misc.Fingerprint != slowlog.MISC_CLASS_ID || misc.Metrics.TimeMetrics["Query_time"].Sum != 7 {
+		t.Errorf("got MISC fingerprint %q Query_time %f, expected MISC and 7",
+			misc.Fingerprint, misc.Metrics.TimeMetrics["Query_time"].Sum)
+	}
+
+	// TopClasses adds the MISC class to its MISC class.
+	top := slowlog.TopClasses(got, 10)
+	if len(top.Class) != 2 || top.Class[slowlog.MISC_CLASS_ID].Metrics.TimeMetrics["Query_time"].Sum != 9 {
+		t.Errorf("got %d classes, expected 1 and MISC with Query_time 9", len(top.Class))
+	}
+}
+
+func TestAggregatorColumns(t *testing.T) {
+	a := slowlog.NewAggregator(false, 0, 0)
+	a.SetColumns(true)
+	for _, query := range []string{
+		"SELECT * FROM t WHERE a = 1 ORDER BY b",
+		"SELECT * FROM t WHERE a = 2 AND c = 3 ORDER BY b",
+		"SELECT * FROM t WHERE a = 3",
+	} {
+		e := slowlog.NewEvent()
+		e.Query = query
+		e.TimeMetrics["Query_time"] = 1
+		a.AddEvent(*e, "1", "select * from t where a = ?")
+	}
+	got := a.Finalize()
+	expect := []slowlog.ColumnCount{
+		{Clause: slowlog.CLAUSE_WHERE, Column: "a", Count: 3},
+		{Clause: slowlog.CLAUSE_ORDER_BY, Column: "b", Count: 2},
+		{Clause: slowlog.CLAUSE_WHERE, Column: "c", Count: 1},
+	}
+	if diff := deep.Equal(got.Class["1"].TopColumns, expect); diff != nil {
+		t.Error(diff)
+	}
+	if got.Global.TopColumns != nil {
+		t.Errorf("got global TopColumns %v, expected nil", got.Global.TopColumns)
+	}
+}
+
+func TestColumnAdvisor(t *testing.T) {
+	a := slowlog.NewAggregator(true, 0, 0)
+	a.SetColumns(true)
+	a.SetIndexAdvisor(slowlog.ColumnAdvisor{})
+	add := func(id, query string, examined, sent uint64, fullScan bool) {
+		e := slowlog.NewEvent()
+		e.Query = query
+		e.TimeMetrics["Query_time"] = 1
+		e.NumberMetrics["Rows_examined"] = examined
+		e.NumberMetrics["Rows_sent"] = sent
+		e.BoolMetrics["Full_scan"] = fullScan
+		a.AddEvent(*e, id, "")
+	}
+	add("1", "SELECT * FROM `Orders` o WHERE o.customer_id = 1 AND status IN ('a', 'b') ORDER BY o.created DESC LIMIT 10", 5000, 10, false)
+	add("1", "SELECT * FROM `Orders` o WHERE o.customer_id = 2 ORDER BY o.created DESC LIMIT 10", 5000, 10, false)
+	add("2", "SELECT * FROM t JOIN u ON t.id = u.id WHERE u.x = 1", 10, 10, true)
+	add("3", "SELECT * FROM t WHERE id = 1", 1, 1, false)
+	got := a.Finalize()
+
+	expect := map[string][]slowlog.IndexSuggestion{
+		"1": {{
+			Table:   "orders",
+			Columns: []string{"customer_id", "status", "created"},
+			Reason:  "Rows_examined is 500 times Rows_sent",
+		}},
+		"2": {{
+			Columns: []string{"x"},
+			Reason:  "Full_scan in 100% of queries",
+		}},
+		"3": nil,
+	}
+	for id, indexes := range expect {
+		if diff := deep.Equal(got.Class[id].Indexes, indexes); diff != nil {
+			t.Errorf("class %s: %v", id, diff)
+		}
+	}
+}
+
+func TestBurstyClasses(t *testing.T) {
+	a := slowlog.NewAggregator(false, 0, 0)
+	a.SetBurst(slowlog.Burst{Window: 2 * time.Minute, Fraction: 0.9, MinEvents: 5})
+	start := time.Date(2023, 2, 5, 3, 0, 0, 0, time.UTC)
+	add := func(id string, ts time.Time) {
+		e := slowlog.NewEvent()
+		e.Time = ts
+		e.TimeMetrics["Query_time"] = 1
+		a.AddEvent(*e, id, "select "+id)
+	}
+	// cron: 10 events in 1m40s, then 1 event an hour later
+	for i := 0; i < 10; i++ {
+		add("cron", start.Add(time.Duration(i*10+35)*time.Second))
+	}
+	add("cron", start.Add(time.Hour))
+	// steady: 1 event every 10 minutes
+	for i := 0; i < 12; i++ {
+		add("steady", start.Add(time.Duration(i)*10*time.Minute))
+	}
+	// few: too few events
+	add("few", start)
+	add("few", start)
+	got := a.Finalize()
+
+	bursty := slowlog.BurstyClasses(got)
+	if len(bursty) != 1 || bursty[0].Id != "cron" {
+		t.Fatalf("got %d bursty classes, expected cron", len(bursty))
+	}
+	expect := &slowlog.BurstStats{
+		Start:    start.Add(30 * time.Second),
+		End:      start.Add(2*time.Minute + 30*time.Second),
+		Fraction: 10.0 / 11.0,
+	}
+	if diff := deep.Equal(bursty[0].Burst, expect); diff != nil {
+		t.Error(diff)
+	}
+}
+
+func TestConnections(t *testing.T) {
+	a := slowlog.NewAggregator(false, 0, 0)
+	a.SetConnections(time.Minute)
+	start := time.Date(2023, 2, 5, 3, 0, 0, 0, time.UTC)
+	add := func(user, cmd string, secs int) {
+		e := slowlog.NewEvent()
+		e.Time = start.Add(time.Duration(secs) * time.Second)
+		e.User = user
+		e.Host = "10.0.0.1"
+		e.Admin = true
+		e.Query = cmd
+		e.TimeMetrics["Query_time"] = 0.1
+		a.AddEvent(*e, cmd, cmd)
+	}
+	add("app", "Connect", 0)
+	add("app", "Quit", 10)
+	add("app", "Connect", 70)
+	add("app", "Connect", 80)
+	add("app", "Quit", 90)
+	add("cron", "Connect", 100)
+	add("cron", "Ping", 120)
+	got := a.Finalize()
+
+	expect := &slowlog.ConnectionStats{
+		Start:    start,
+		End:      start.Add(120 * time.Second),
+		Interval: time.Minute,
+		Users: []slowlog.UserConnections{
+			{
+				User:     "app",
+				Host:     "10.0.0.1",
+				Connects: 3,
+				Quits:    2,
+				Rate:     3.0 / 120,
+				Series: []slowlog.ConnectionPoint{
+					{Start: start, Connects: 1, Quits: 1},
+					{Start: start.Add(time.Minute), Connects: 2, Quits: 1},
+				},
+			},
+			{
+				User:     "cron",
+				Host:     "10.0.0.1",
+				Connects: 1,
+				Rate:     1.0 / 120,
+				Series: []slowlog.ConnectionPoint{
+					{Start: start.Add(time.Minute), Connects: 1},
+				},
+			},
+		},
+	}
+	if diff := deep.Equal(got.Connections, expect); diff != nil {
+		t.Error(diff)
+	}
+	if got.Global.TotalQueries != 7 {
+		t.Errorf("got %d queries, expected 7", got.Global.TotalQueries)
+	}
+}
+
+func TestReplication(t *testing.T) {
+	aggregate := func(r slowlog.Replication) slowlog.Result {
+		a := slowlog.NewAggregator(false, 0, 0)
+		a.SetReplication(r)
+		for _, user := range []string{"app", "[SQL_SLAVE]", "app"} {
+			e := slowlog.NewEvent()
+			e.User = user
+			e.FromReplication = slowlog.REPLICATION_USERS[user]
+			e.TimeMetrics["Query_time"] = 1
+			a.AddEvent(*e, "1", "select 1")
+		}
+		return a.Finalize()
+	}
+
+	got := aggregate(slowlog.REPLICATION_INCLUDE)
+	if len(got.Class) != 1 || got.Class["1"].TotalQueries != 3 || got.Meta.Replicated != 0 {
+		t.Errorf("include: got %d classes, %d queries, %d replicated; expected 1, 3, 0",
+			len(got.Class), got.Class["1"].TotalQueries, got.Meta.Replicated)
+	}
+
+	got = aggregate(slowlog.REPLICATION_EXCLUDE)
+	if len(got.Class) != 1 || got.Global.TotalQueries != 2 || got.Meta.Replicated != 1 {
+		t.Errorf("exclude: got %d classes, %d queries, %d replicated; expected 1, 2, 1",
+			len(got.Class), got.Global.TotalQueries, got.Meta.Replicated)
+	}
+
+	got = aggregate(slowlog.REPLICATION_SEPARATE)
+	repl := got.Class[slowlog.REPLICATION_PREFIX+"1"]
+	if repl == nil || repl.TotalQueries != 1 || repl.Fingerprint != "replication:select 1" {
+		t.Fatalf("separate: got replication class %+v, expected 1 query", repl)
+	}
+	if got.Class["1"].TotalQueries != 2 || got.Global.TotalQueries != 3 || got.Meta.Replicated != 1 {
+		t.Errorf("separate: got %d app queries, %d global queries, %d replicated; expected 2, 3, 1",
+			got.Class["1"].TotalQueries, got.Global.TotalQueries, got.Meta.Replicated)
+	}
+}
+
+func TestAggregatorAliases(t *testing.T) {
+	a := slowlog.NewAggregator(false, 0, 0)
+	a.SetAliases(query.Id, slowlog.Alias{Pattern: regexp.MustCompile(`\b(orders)_v\d+\b`), Replace: "$1"})
+	for _, q := range []string{
+		"SELECT * FROM orders_v1 WHERE id = 1",
+		"SELECT * FROM orders_v2 WHERE id = 2",
+		"SELECT * FROM orders_v2 WHERE id = 3",
+		"SELECT * FROM orders WHERE id = 4",
+		"SELECT * FROM customers WHERE id = 5",
+	} {
+		e := slowlog.NewEvent()
+		e.Query = q
+		e.TimeMetrics["Query_time"] = 1
+		f := query.Fingerprint(q)
+		a.AddEvent(*e, query.Id(f), f)
+	}
+	got := a.Finalize()
+
+	orders := got.Class[query.Id("select * from orders where id = ?")]
+	if orders == nil {
+		t.Fatalf("no orders class in %v", got.Class)
+	}
+	if orders.TotalQueries != 4 {
+		t.Errorf("got %d orders queries, expected 4", orders.TotalQueries)
+	}
+	expect := []string{
+		"select * from orders_v1 where id = ?",
+		"select * from orders_v2 where id = ?",
+	}
+	if diff := deep.Equal(orders.Aliases, expect); diff != nil {
+		t.Error(diff)
+	}
+	if len(got.Class) != 2 {
+		t.Errorf("got %d classes, expected 2", len(got.Class))
+	}
+	customers := got.Class[query.Id("select * from customers where id = ?")]
+	if customers == nil || customers.Aliases != nil {
+		t.Errorf("got customers class %v, expected no aliases", customers)
+	}
+}
+
+func TestAggregatorNoopAlias(t *testing.T) {
+	// An alias that matches but does not change the fingerprint does not
+	// stop the next alias.
+	a := slowlog.NewAggregator(false, 0, 0)
+	a.SetAliases(query.Id,
+		slowlog.Alias{Pattern: regexp.MustCompile(`\bwhere\b`), Replace: "where"},
+		slowlog.Alias{Pattern: regexp.MustCompile(`\b(orders)_v\d+\b`), Replace: "$1"},
+	)
+	for _, q := range []string{
+		"SELECT * FROM orders_v1 WHERE id = 1",
+		"SELECT * FROM orders WHERE id = 2",
+	} {
+		e := slowlog.NewEvent()
+		e.Query = q
+		e.TimeMetrics["Query_time"] = 1
+		f := query.Fingerprint(q)
+		a.AddEvent(*e, query.Id(f), f)
+	}
+	got := a.Finalize()
+
+	orders := got.Class[query.Id("select * from orders where id = ?")]
+	if orders == nil || len(got.Class) != 1 {
+		t.Fatalf("got classes %v, expected only orders", got.Class)
+	}
+	if diff := deep.Equal(orders.Aliases, []string{"select * from orders_v1 where id = ?"}); diff != nil {
+		t.Error(diff)
+	}
+}
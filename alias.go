@@ -0,0 +1,58 @@
+/*
+	Copyright 2017 Daniel Nichter
+	Copyright 2014-2016 Percona LLC and/or its affiliates
+*/
+
+package slowlog
+
+import (
+	"regexp"
+	"sort"
+)
+
+// An Alias maps fingerprints that match Pattern to the fingerprint of one
+// logical class, like Regexp.ReplaceAllString(fingerprint, Replace). For
+// example, to aggregate queries on tables orders_v1, orders_v2, and so on as
+// queries on orders:
+//
+//	Alias{Pattern: regexp.MustCompile(`\b(orders)_v\d+\b`), Replace: "$1"}
+type Alias struct {
+	Pattern *regexp.Regexp
+	Replace string
+}
+
+// alias returns the class ID and fingerprint of the first alias that matches
+// the fingerprint and changes it, and true. Else, it returns the ID and
+// fingerprint unchanged and false.
+func (a *Aggregator) alias(id, fingerprint string) (string, string, bool) {
+	for _, al := range a.aliases {
+		if !al.Pattern.MatchString(fingerprint) {
+			continue
+		}
+		f := al.Pattern.ReplaceAllString(fingerprint, al.Replace)
+		if f == fingerprint {
+			continue
+		}
+		return a.aliasId(f), f, true
+	}
+	return id, fingerprint, false
+}
+
+// addAlias saves the original fingerprint of an aliased event.
+func (c *Class) addAlias(fingerprint string) {
+	if c.aliases == nil {
+		c.aliases = map[string]bool{}
+	}
+	c.aliases[fingerprint] = true
+}
+
+func (c *Class) finalizeAliases() {
+	if len(c.aliases) == 0 {
+		return
+	}
+	c.Aliases = make([]string, 0, len(c.aliases))
+	for f := range c.aliases {
+		c.Aliases = append(c.Aliases, f)
+	}
+	sort.Strings(c.Aliases)
+}
@@ -0,0 +1,92 @@
+/*
+	Copyright 2017 Daniel Nichter
+	Copyright 2014-2016 Percona LLC and/or its affiliates
+*/
+
+package slowlog
+
+import (
+	"sort"
+	"time"
+)
+
+// BURST_BUCKETS is the number of buckets per Burst.Window in which events are
+// counted by time. More buckets make Burst.Window more precise but use more
+// memory.
+const BURST_BUCKETS = 4
+
+// A Burst defines a class that is bursty: at least Fraction (e.g. 0.9) of its
+// events are within any Window (e.g. 2 minutes), like a cron job, as opposed
+// to a class with events spread over time, like a hot path. Classes with
+// fewer than MinEvents events are not bursty.
+type Burst struct {
+	Window    time.Duration
+	Fraction  float64
+	MinEvents uint64
+}
+
+// BurstStats are the burst of a bursty class, see Aggregator.SetBurst.
+type BurstStats struct {
+	Start    time.Time // start of the first bucket in the window with the most events
+	End      time.Time // end of the last bucket in the window
+	Fraction float64   // fraction of class events in the window
+}
+
+// addBurst counts the event in the bucket of its time. Events without a
+// time are not counted.
+func (c *Class) addBurst(e Event) {
+	if e.Time.IsZero() {
+		return
+	}
+	c.buckets[e.Time.Truncate(c.bucketSize()).Unix()]++
+}
+
+func (c *Class) bucketSize() time.Duration {
+	size := (c.burst.Window / BURST_BUCKETS).Truncate(time.Second)
+	if size < time.Second {
+		size = time.Second
+	}
+	return size
+}
+
+// finalizeBurst sets Class.Burst if the class is bursty: the most events in
+// any BURST_BUCKETS consecutive buckets are at least Burst.Fraction of all
+// events with a time.
+func (c *Class) finalizeBurst() {
+	total := uint64(0)
+	starts := make([]int64, 0, len(c.buckets))
+	for start, n := range c.buckets {
+		starts = append(starts, start)
+		total += n
+	}
+	if total == 0 || total < c.burst.MinEvents {
+		return
+	}
+	sort.Slice(starts, func(i, j int) bool { return starts[i] < starts[j] })
+
+	size := int64(c.bucketSize() / time.Second)
+	max, maxStart, maxEnd := uint64(0), int64(0), int64(0)
+	sum := uint64(0)
+	first := 0 // first bucket in window
+	for _, start := range starts {
+		sum += c.buckets[start]
+		for starts[first] <= start-size*BURST_BUCKETS {
+			sum -= c.buckets[starts[first]]
+			first++
+		}
+		if sum > max {
+			max = sum
+			maxStart = starts[first]
+			maxEnd = start + size
+		}
+	}
+	fraction := float64(max) / float64(total)
+	if fraction < c.burst.Fraction {
+		return
+	}
+	c.Burst = &BurstStats{
+		Start:    time.Unix(maxStart, 0).UTC(),
+		End:      time.Unix(maxEnd, 0).UTC(),
+		Fraction: fraction,
+	}
+}
@@ -0,0 +1,243 @@
+/*
+	Copyright 2017 Daniel Nichter
+	Copyright 2014-2016 Percona LLC and/or its affiliates
+*/
+
+package slowlog
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+)
+
+// CacheKey is how DigestFiles identifies an unchanged file in
+// DigestOptions.Cache.
+type CacheKey int
+
+const (
+	CACHE_KEY_STAT    CacheKey = iota // size, modification time, and hash of the first CACHE_KEY_BYTES (default)
+	CACHE_KEY_CONTENT                 // hash of the whole file
+)
+
+// CACHE_KEY_BYTES is the number of bytes at the start of a file hashed by
+// CACHE_KEY_STAT, so the key does not change when a rotated file is renamed.
+const CACHE_KEY_BYTES = 4096
+
+// FileCacheKey returns the cache key of the file, see DigestOptions.Cache.
+func FileCacheKey(path string, key CacheKey) (string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+	h := sha256.New()
+	if key == CACHE_KEY_CONTENT {
+		if _, err := io.Copy(h, file); err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("%x", h.Sum(nil)), nil
+	}
+	fi, err := file.Stat()
+	if err != nil {
+		return "", err
+	}
+	if _, err := io.CopyN(h, file, CACHE_KEY_BYTES); err != nil && err != io.EOF {
+		return "", err
+	}
+	return fmt.Sprintf("%x-%d-%d", h.Sum(nil)[0:16], fi.Size(), fi.ModTime().UnixNano()), nil
+}
+
+// MergeResults returns one Result from finalized Results, like the Results of
+// several files. Counts, sums, minimums, and maximums are exact. Percentiles
+// cannot be merged exactly: Med is the mean of the medians weighted by the
+// number of values, and P95 is the max of the P95s, which is an upper bound.
+// The Example with the max Query_time is kept. Other class fields, like
+// TopParams and Samples, and Result.Connections are not merged.
+func MergeResults(results ...Result) Result {
+	m := Result{
+		Class:      map[string]*Class{},
+		Collisions: map[string][]string{},
+	}
+	unknown := map[string]bool{}
+	zero := map[string]bool{}
+	for _, r := range results {
+		if r.Global != nil {
+			if m.Global == nil {
+				m.Global = newMergedClass(r.Global)
+			}
+			m.Global.mergeFinalized(r.Global)
+		}
+		for id, class := range r.Class {
+			c, ok := m.Class[id]
+			if !ok {
+				c = newMergedClass(class)
+				m.Class[id] = c
+			}
+			c.mergeFinalized(class)
+		}
+		for id, fingerprints := range r.Collisions {
+			m.Collisions[id] = append(m.Collisions[id], fingerprints...)
+		}
+		if r.RateLimit > m.RateLimit {
+			m.RateLimit = r.RateLimit
+		}
+		if m.Error == "" {
+			m.Error = r.Error
+		}
+		for _, name := range r.Meta.UnknownMetrics {
+			unknown[name] = true
+		}
+		for _, name := range r.Meta.ZeroMetrics {
+			zero[name] = true
+		}
+		m.Meta.Duplicates += r.Meta.Duplicates
+		m.Meta.Replicated += r.Meta.Replicated
+		m.Meta.Ignored += r.Meta.Ignored
+	}
+	if m.Global == nil {
+		m.Global = NewAggregator(false, 0, 0).Finalize().Global
+	}
+	for id, fingerprints := range m.Collisions {
+		m.Collisions[id] = uniqueSorted(fingerprints)
+	}
+	if len(m.Collisions) == 0 {
+		m.Collisions = nil
+	}
+	m.Meta.UnknownMetrics = sortedKeys(unknown)
+	m.Meta.ZeroMetrics = sortedKeys(zero)
+	return m
+}
+
+func newMergedClass(c *Class) *Class {
+	return &Class{
+		Id:          c.Id,
+		Fingerprint: c.Fingerprint,
+		Metrics:     NewMetrics(),
+	}
+}
+
+// mergeFinalized adds the finalized class o to the merged class c, see
+// MergeResults.
+func (c *Class) mergeFinalized(o *Class) {
+	for name, s := range o.Metrics.TimeMetrics {
+		n := o.TotalQueries - s.Missing // values of the metric
+		t, ok := c.Metrics.TimeMetrics[name]
+		if !ok {
+			t = &TimeStats{Min: s.Min, Missing: c.TotalQueries}
+			c.Metrics.TimeMetrics[name] = t
+		}
+		prev := c.TotalQueries - t.Missing
+		t.Sum += s.Sum
+		if s.Min < t.Min {
+			t.Min = s.Min
+		}
+		if s.Max > t.Max {
+			t.Max = s.Max
+		}
+		if s.P95 > t.P95 {
+			t.P95 = s.P95
+		}
+		if prev+n > 0 {
+			t.Med = (t.Med*float64(prev) + s.Med*float64(n)) / float64(prev+n)
+			t.Avg = t.Sum / float64(prev+n)
+		}
+		t.Missing += s.Missing
+	}
+	for name, s := range o.Metrics.NumberMetrics {
+		n := o.TotalQueries - s.Missing
+		t, ok := c.Metrics.NumberMetrics[name]
+		if !ok {
+			t = &NumberStats{Min: s.Min, Missing: c.TotalQueries}
+			c.Metrics.NumberMetrics[name] = t
+		}
+		prev := c.TotalQueries - t.Missing
+		t.Sum += s.Sum
+		if s.Min < t.Min {
+			t.Min = s.Min
+		}
+		if s.Max > t.Max {
+			t.Max = s.Max
+		}
+		if s.P95 > t.P95 {
+			t.P95 = s.P95
+		}
+		if prev+n > 0 {
+			t.Med = (t.Med*prev + s.Med*n) / (prev + n)
+			t.Avg = t.Sum / (prev + n)
+		}
+		t.Missing += s.Missing
+	}
+	for name, s := range o.Metrics.BoolMetrics {
+		t, ok := c.Metrics.BoolMetrics[name]
+		if !ok {
+			t = &BoolStats{Missing: c.TotalQueries}
+			c.Metrics.BoolMetrics[name] = t
+		}
+		t.Sum += s.Sum
+		t.Cnt += s.Cnt
+		t.Missing += s.Missing
+		if t.Cnt > 0 {
+			t.TruePct = float64(t.Sum) / float64(t.Cnt) * 100
+		}
+	}
+	// Metrics not in o are missing from all of its queries.
+	for name, t := range c.Metrics.TimeMetrics {
+		if _, ok := o.Metrics.TimeMetrics[name]; !ok {
+			t.Missing += o.TotalQueries
+		}
+	}
+	for name, t := range c.Metrics.NumberMetrics {
+		if _, ok := o.Metrics.NumberMetrics[name]; !ok {
+			t.Missing += o.TotalQueries
+		}
+	}
+	for name, t := range c.Metrics.BoolMetrics {
+		if _, ok := o.Metrics.BoolMetrics[name]; !ok {
+			t.Missing += o.TotalQueries
+		}
+	}
+
+	c.TotalQueries += o.TotalQueries
+	c.KilledQueries += o.KilledQueries
+	for errno, n := range o.KilledErrnos {
+		c.KilledErrnos = addErrno(c.KilledErrnos, errno, n)
+	}
+	for errno, n := range o.LastErrnos {
+		c.LastErrnos = addErrno(c.LastErrnos, errno, n)
+	}
+	for a, n := range o.AccessPatterns {
+		c.addAccessPattern(a, n)
+	}
+	if o.UniqueQueries > c.UniqueQueries {
+		c.UniqueQueries = o.UniqueQueries
+	}
+	c.Cost += o.Cost
+	if o.Example != nil && (c.Example == nil || o.Example.QueryTime > c.Example.QueryTime) {
+		ex := *o.Example
+		c.Example = &ex
+	}
+}
+
+func uniqueSorted(vals []string) []string {
+	seen := map[string]bool{}
+	for _, v := range vals {
+		seen[v] = true
+	}
+	return sortedKeys(seen)
+}
+
+// sortedKeys returns the keys sorted, or nil if there are none.
+func sortedKeys(m map[string]bool) []string {
+	if len(m) == 0 {
+		return nil
+	}
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -5,25 +5,115 @@
 
 package slowlog
 
+import (
+	"sort"
+	"time"
+)
+
 const (
 	// MAX_EXAMPLE_BYTES defines the maximum Example.Query size.
 	MAX_EXAMPLE_BYTES = 1024 * 10
+
+	// TOP_PARAM_VALUES is the number of most frequent values per parameter
+	// position in Class.TopParams.
+	TOP_PARAM_VALUES = 10
+
+	// MAX_PARAM_VALUES is the number of distinct values counted per parameter
+	// position. When more are seen, the least frequent value is replaced
+	// (Space-Saving algorithm), so counts are approximate.
+	MAX_PARAM_VALUES = 100
+
+	// MAX_PARAM_POSITIONS is the number of parameter positions counted, e.g.
+	// for an INSERT with many values, only the first positions are counted.
+	MAX_PARAM_POSITIONS = 20
+
+	// TOP_COLUMNS is the number of most frequent columns in Class.TopColumns.
+	TOP_COLUMNS = 20
 )
 
 // A Class represents all events with the same fingerprint and class ID.
 // This is only enforced by convention, so be careful not to mix events from
 // different classes.
 type Class struct {
-	Id            string   // 32-character hex checksum of fingerprint
-	Fingerprint   string   // canonical form of query: values replaced with "?"
-	Metrics       Metrics  // statistics for each metric, e.g. max Query_time
-	TotalQueries  uint64   // total number of queries in class
-	UniqueQueries uint     // unique number of queries in class
-	Example       *Example `json:",omitempty"` // sample query with max Query_time
+	Id             string            // 32-character hex checksum of fingerprint
+	Fingerprint    string            // canonical form of query: values replaced with "?"
+	Metrics        Metrics           // statistics for each metric, e.g. max Query_time
+	TotalQueries   uint64            // total number of queries in class
+	UniqueQueries  uint              // unique number of queries in class
+	KilledQueries  uint64            `json:",omitempty"` // number of queries with Killed metric not 0 (error code)
+	KilledErrnos   map[uint64]uint64 `json:",omitempty"` // number of killed queries by Event.Killed error code
+	LastErrnos     map[uint64]uint64 `json:",omitempty"` // number of queries by Event.LastErrno error code, if not 0
+	Example        *Example          `json:",omitempty"` // sample query with max Query_time
+	TopParams      [][]ParamValue    `json:",omitempty"` // most frequent Event.Params values by position
+	TopColumns     []ColumnCount     `json:",omitempty"` // if Aggregator.SetColumns
+	Samples        []Example         `json:",omitempty"` // from Sampler, if any
+	SLO            *SLOStats         `json:",omitempty"` // if Aggregator.SetSLO
+	Cost           float64           `json:",omitempty"` // if Aggregator.SetCostModel
+	Indexes        []IndexSuggestion `json:",omitempty"` // if Aggregator.SetIndexAdvisor
+	Burst          *BurstStats       `json:",omitempty"` // if Aggregator.SetBurst and class is bursty
+	Aliases        []string          `json:",omitempty"` // original fingerprints, if Aggregator.SetAliases
+	AccessPatterns map[string]uint64 `json:",omitempty"` // number of queries by AccessPattern, if MySQL log_slow_extra
 	// --
 	outliers uint64
 	lastDb   string
 	sample   bool
+	params   []map[string]uint64
+	sampler  Sampler
+	slo      *SLO
+	sloGood  uint64
+	sloTotal uint64
+	cost     CostModel
+	exBytes  int // max Example.Query bytes if not MAX_EXAMPLE_BYTES
+	columns  map[ColumnRef]uint64
+	burst    *Burst
+	buckets  map[int64]uint64 // Unix time => events, if burst
+	aliases  map[string]bool  // original fingerprints
+
+	killedOut  uint64            // KilledQueries of outliers, not scaled by the rate limit
+	killedErrs map[uint64]uint64 // KilledErrnos of outliers
+	errnoOut   map[uint64]uint64 // LastErrnos of outliers
+}
+
+// An SLO is a latency service level objective: Target fraction (e.g. 0.99)
+// of queries have Query_time less than or equal to Threshold seconds.
+type SLO struct {
+	Threshold float64
+	Target    float64
+}
+
+// SLOStats are the SLO compliance of a class.
+type SLOStats struct {
+	Compliance float64 // fraction of queries within SLO threshold
+	BurnRate   float64 // error rate / error budget (1 - Target); > 1 exhausts budget
+}
+
+// A CostModel is the cost of one unit of each metric, like 0.0001 per second
+// of Query_time or 0.000001 per row of Rows_examined, keyed on metric name.
+// A bool metric costs per true value, like Full_scan. The cost of a class is
+// the sum of each metric's Sum times its unit cost. The unit of cost, like
+// dollars or core-seconds, is up to the model.
+type CostModel map[string]float64
+
+// cost returns the cost of the finalized metrics.
+func (m CostModel) cost(metrics Metrics) float64 {
+	cost := 0.0
+	for name, s := range metrics.TimeMetrics {
+		cost += s.Sum * m[name]
+	}
+	for name, s := range metrics.NumberMetrics {
+		cost += float64(s.Sum) * m[name]
+	}
+	for name, s := range metrics.BoolMetrics {
+		cost += float64(s.Sum) * m[name]
+	}
+	return cost
+}
+
+// A ParamValue is a literal value and the number of times it occurred at
+// a parameter position in a class.
+type ParamValue struct {
+	Value string
+	Count uint64
 }
 
 // A Example is a real query and its database, timestamp, and Query_time.
@@ -34,6 +124,45 @@ type Example struct {
 	Db        string  // Schema: <db> or USE <db>
 	Query     string  // truncated to MAX_EXAMPLE_BYTES
 	Ts        string  `json:",omitempty"` // in MySQL time zone
+	// --
+	time time.Time // Event.Time, formatted as Ts when finalized
+}
+
+// A Sampler saves example queries for a class. Set a Sampler for every class
+// with Aggregator.SetSampler to keep examples other than the one with the
+// greatest Query_time, like the first example per error code.
+type Sampler interface {
+	// OnEvent is called for every event added to the class.
+	OnEvent(Event)
+
+	// Samples returns the saved examples. It is called once when the class
+	// is finalized.
+	Samples() []Example
+}
+
+// NewExample returns an Example for the event, truncating the query if it
+// is larger than MAX_EXAMPLE_BYTES.
+func NewExample(e Event) Example {
+	ex := Example{
+		QueryTime: e.TimeMetrics["Query_time"],
+		Db:        e.Db,
+		Query:     truncateQuery(e.Query, MAX_EXAMPLE_BYTES),
+		Ts:        e.Ts,
+		time:      e.Time,
+	}
+	return ex
+}
+
+// truncateQuery returns the query truncated to max bytes if it is larger. It
+// ends with "...", unless max is less than 4, which leaves no room for it.
+func truncateQuery(query string, max int) string {
+	if len(query) <= max {
+		return query
+	}
+	if max < 4 {
+		return query[0:max]
+	}
+	return query[0:max-3] + "..."
 }
 
 // NewClass returns a new Class for the class ID and fingerprint.
@@ -58,6 +187,53 @@ func (c *Class) AddEvent(e Event, outlier bool) {
 	}
 
 	c.Metrics.AddEvent(e, outlier)
+	// Events not from a parser might have only the metrics.
+	killed, errno := e.Killed, e.LastErrno
+	if killed == 0 {
+		killed = e.NumberMetrics["Killed"]
+	}
+	if errno == 0 {
+		errno = e.NumberMetrics["Last_errno"]
+	}
+	if killed != 0 {
+		if outlier {
+			c.killedOut++
+			c.killedErrs = addErrno(c.killedErrs, killed, 1)
+		} else {
+			c.KilledQueries++
+			c.KilledErrnos = addErrno(c.KilledErrnos, killed, 1)
+		}
+	}
+	if errno != 0 {
+		if outlier {
+			c.errnoOut = addErrno(c.errnoOut, errno, 1)
+		} else {
+			c.LastErrnos = addErrno(c.LastErrnos, errno, 1)
+		}
+	}
+	if e.SlowExtra != nil {
+		c.addAccessPattern(e.SlowExtra.AccessPattern().String(), 1)
+	}
+	c.addParams(e.Params)
+	if c.columns != nil {
+		for _, ref := range Columns(e.Query) {
+			c.columns[ref]++
+		}
+	}
+	if c.burst != nil {
+		c.addBurst(e)
+	}
+	if c.sampler != nil {
+		c.sampler.OnEvent(e)
+	}
+	if c.slo != nil {
+		if n, ok := e.TimeMetrics["Query_time"]; ok {
+			c.sloTotal++
+			if n <= c.slo.Threshold {
+				c.sloGood++
+			}
+		}
+	}
 
 	// Save last db seen for this query. This helps ensure the sample query
 	// has a db.
@@ -73,28 +249,219 @@ func (c *Class) AddEvent(e Event, outlier bool) {
 				} else {
 					c.Example.Db = c.lastDb
 				}
-				if len(e.Query) > MAX_EXAMPLE_BYTES {
-					c.Example.Query = e.Query[0:MAX_EXAMPLE_BYTES-3] + "..."
-				} else {
-					c.Example.Query = e.Query
-				}
+				c.Example.Query = truncateQuery(e.Query, c.maxExampleBytes())
 				c.Example.Ts = e.Ts
+				c.Example.time = e.Time
 			}
 		}
 	}
 }
 
+// maxExampleBytes returns the max size of Example.Query.
+func (c *Class) maxExampleBytes() int {
+	if c.exBytes > 0 {
+		return c.exBytes
+	}
+	return MAX_EXAMPLE_BYTES
+}
+
 // Finalize calculates all metric statistics. Call this function when done
 // adding events to the class.
 func (c *Class) Finalize(rateLimit uint) {
 	if rateLimit == 0 {
 		rateLimit = 1
 	}
+	c.Metrics.setMissing(c.TotalQueries + c.outliers)
 	c.Metrics.Finalize(rateLimit)
 	c.TotalQueries = (c.TotalQueries * uint64(rateLimit)) + c.outliers
+	c.KilledQueries = (c.KilledQueries * uint64(rateLimit)) + c.killedOut
+	c.KilledErrnos = finalizeErrnos(c.KilledErrnos, c.killedErrs, rateLimit)
+	c.LastErrnos = finalizeErrnos(c.LastErrnos, c.errnoOut, rateLimit)
 	if c.Example.QueryTime == 0 {
 		c.Example = nil
 	}
+	c.finalizeParams()
+	c.finalizeColumns()
+	c.finalizeAliases()
+	if c.burst != nil {
+		c.finalizeBurst()
+	}
+	if c.sampler != nil {
+		c.Samples = c.sampler.Samples()
+	}
+	if c.slo != nil && c.sloTotal > 0 {
+		c.SLO = &SLOStats{
+			Compliance: float64(c.sloGood) / float64(c.sloTotal),
+		}
+		if c.slo.Target < 1 {
+			c.SLO.BurnRate = (1 - c.SLO.Compliance) / (1 - c.slo.Target)
+		}
+	}
+	if c.cost != nil {
+		c.Cost = c.cost.cost(c.Metrics)
+	}
+}
+
+func (c *Class) addAccessPattern(a string, n uint64) {
+	if c.AccessPatterns == nil {
+		c.AccessPatterns = map[string]uint64{}
+	}
+	c.AccessPatterns[a] += n
+}
+
+// addErrno adds n queries with the error code to the counts, which are made
+// if nil.
+func addErrno(counts map[uint64]uint64, errno, n uint64) map[uint64]uint64 {
+	if counts == nil {
+		counts = map[uint64]uint64{}
+	}
+	counts[errno] += n
+	return counts
+}
+
+// finalizeErrnos returns the counts scaled by the rate limit plus the outlier
+// counts.
+func finalizeErrnos(counts, outliers map[uint64]uint64, rateLimit uint) map[uint64]uint64 {
+	for errno, n := range counts {
+		counts[errno] = n * uint64(rateLimit)
+	}
+	for errno, n := range outliers {
+		counts = addErrno(counts, errno, n)
+	}
+	return counts
+}
+
+func (c *Class) addParams(params []Param) {
+	for i, p := range params {
+		if i == MAX_PARAM_POSITIONS {
+			break
+		}
+		c.countParam(i, p.Value, 1)
+	}
+}
+
+func (c *Class) countParam(pos int, val string, n uint64) {
+	for pos >= len(c.params) {
+		c.params = append(c.params, map[string]uint64{})
+	}
+	counts := c.params[pos]
+	if _, ok := counts[val]; ok || len(counts) < MAX_PARAM_VALUES {
+		counts[val] += n
+		return
+	}
+	// Replace the least frequent value; the new value inherits its count.
+	minVal := ""
+	minCnt := ^uint64(0)
+	for v, cnt := range counts {
+		if cnt < minCnt || (cnt == minCnt && v < minVal) {
+			minVal = v
+			minCnt = cnt
+		}
+	}
+	delete(counts, minVal)
+	counts[val] = minCnt + n
+}
+
+// merge adds the events of class o, which must not be finalized, to the
+// class. Samplers are not merged: if both classes have one, the samples of
+// class o are lost.
+func (c *Class) merge(o *Class) {
+	c.outliers += o.outliers
+	c.TotalQueries += o.TotalQueries
+	c.KilledQueries += o.KilledQueries
+	for errno, n := range o.KilledErrnos {
+		c.KilledErrnos = addErrno(c.KilledErrnos, errno, n)
+	}
+	for errno, n := range o.LastErrnos {
+		c.LastErrnos = addErrno(c.LastErrnos, errno, n)
+	}
+	c.killedOut += o.killedOut
+	for errno, n := range o.killedErrs {
+		c.killedErrs = addErrno(c.killedErrs, errno, n)
+	}
+	for errno, n := range o.errnoOut {
+		c.errnoOut = addErrno(c.errnoOut, errno, n)
+	}
+	for a, n := range o.AccessPatterns {
+		c.addAccessPattern(a, n)
+	}
+	c.Metrics.merge(o.Metrics)
+	if o.lastDb != "" {
+		c.lastDb = o.lastDb
+	}
+	if c.sample && o.Example != nil && o.Example.QueryTime > c.Example.QueryTime {
+		ex := *o.Example
+		c.Example = &ex
+	}
+	for pos, counts := range o.params {
+		for val, n := range counts {
+			c.countParam(pos, val, n)
+		}
+	}
+	if c.buckets != nil {
+		for start, n := range o.buckets {
+			c.buckets[start] += n
+		}
+	}
+	if c.columns != nil {
+		for ref, n := range o.columns {
+			c.columns[ref] += n
+		}
+	}
+	for f := range o.aliases {
+		c.addAlias(f)
+	}
+	if c.sampler == nil {
+		c.sampler = o.sampler
+	}
+	c.sloGood += o.sloGood
+	c.sloTotal += o.sloTotal
+}
+
+func (c *Class) finalizeParams() {
+	if len(c.params) == 0 {
+		return
+	}
+	c.TopParams = make([][]ParamValue, len(c.params))
+	for i, counts := range c.params {
+		top := make([]ParamValue, 0, len(counts))
+		for val, cnt := range counts {
+			top = append(top, ParamValue{Value: val, Count: cnt})
+		}
+		sort.Slice(top, func(i, j int) bool {
+			if top[i].Count == top[j].Count {
+				return top[i].Value < top[j].Value
+			}
+			return top[i].Count > top[j].Count // descending order
+		})
+		if len(top) > TOP_PARAM_VALUES {
+			top = top[0:TOP_PARAM_VALUES]
+		}
+		c.TopParams[i] = top
+	}
+}
+
+func (c *Class) finalizeColumns() {
+	if len(c.columns) == 0 {
+		return
+	}
+	top := make([]ColumnCount, 0, len(c.columns))
+	for ref, cnt := range c.columns {
+		top = append(top, ColumnCount{Clause: ref.Clause, Column: ref.Column, Count: cnt})
+	}
+	sort.Slice(top, func(i, j int) bool {
+		if top[i].Count != top[j].Count {
+			return top[i].Count > top[j].Count // descending order
+		}
+		if top[i].Clause != top[j].Clause {
+			return top[i].Clause < top[j].Clause
+		}
+		return top[i].Column < top[j].Column
+	})
+	if len(top) > TOP_COLUMNS {
+		top = top[0:TOP_COLUMNS]
+	}
+	c.TopColumns = top
 }
 
 // NewAggregateClass makes a new Class from the given member classes.
@@ -153,6 +520,14 @@ func NewAggregateClass(id, fingerprint string, members []*Class) *Class {
 				stats.Sum += newStats.Sum
 			}
 		}
+
+		aggClass.KilledQueries += memberClass.KilledQueries
+		for errno, n := range memberClass.KilledErrnos {
+			aggClass.KilledErrnos = addErrno(aggClass.KilledErrnos, errno, n)
+		}
+		for errno, n := range memberClass.LastErrnos {
+			aggClass.LastErrnos = addErrno(aggClass.LastErrnos, errno, n)
+		}
 	}
 
 	return aggClass
@@ -69,3 +69,216 @@ func TestAggregateClass(t *testing.T) {
 		t.Error(diff)
 	}
 }
+
+func TestAggregateClassErrnos(t *testing.T) {
+	// Killed queries and error codes of the members are summed.
+	c1 := &slowlog.Class{
+		Id:            "111",
+		TotalQueries:  5,
+		Metrics:       slowlog.NewMetrics(),
+		KilledQueries: 1,
+		KilledErrnos:  map[uint64]uint64{1317: 1},
+		LastErrnos:    map[uint64]uint64{1317: 1, 1146: 2},
+	}
+	c2 := &slowlog.Class{
+		Id:            "222",
+		TotalQueries:  4,
+		Metrics:       slowlog.NewMetrics(),
+		KilledQueries: 2,
+		KilledErrnos:  map[uint64]uint64{1317: 2},
+	}
+	got := slowlog.NewAggregateClass("anId", "aFingerprint", []*slowlog.Class{c1, c2})
+	if got.KilledQueries != 3 {
+		t.Errorf("got KilledQueries %d, expected 3", got.KilledQueries)
+	}
+	if diff := deep.Equal(got.KilledErrnos, map[uint64]uint64{1317: 3}); diff != nil {
+		t.Error(diff)
+	}
+	if diff := deep.Equal(got.LastErrnos, map[uint64]uint64{1317: 1, 1146: 2}); diff != nil {
+		t.Error(diff)
+	}
+}
+
+func TestClassTopParams(t *testing.T) {
+	c := slowlog.NewClass("111", "select c from t where id = ? and name = ?", false)
+	for i, id := range []string{"1", "2", "1", "3", "1", "2"} {
+		e := slowlog.NewEvent()
+		e.TimeMetrics["Query_time"] = 1
+		e.Params = []slowlog.Param{
+			{Type: slowlog.PARAM_INT, Value: id},
+		}
+		if i%2 == 0 {
+			e.Params = append(e.Params, slowlog.Param{Type: slowlog.PARAM_STRING, Value: "a"})
+		}
+		c.AddEvent(*e, false)
+	}
+	c.Finalize(1)
+	expect := [][]slowlog.ParamValue{
+		{
+			{Value: "1", Count: 3},
+			{Value: "2", Count: 2},
+			{Value: "3", Count: 1},
+		},
+		{
+			{Value: "a", Count: 3},
+		},
+	}
+	if diff := deep.Equal(c.TopParams, expect); diff != nil {
+		t.Error(diff)
+	}
+}
+
+// More values than SAMPLE_BLOCK_SIZE are compressed, but percentiles are the
+// same.
+func TestClassManyValues(t *testing.T) {
+	n := slowlog.SAMPLE_BLOCK_SIZE*3 + 10
+	a1 := slowlog.NewAggregator(false, 0, 0)
+	a2 := slowlog.NewAggregator(false, 0, 0)
+	e := slowlog.NewEvent()
+	// Add values in reverse order, half to each aggregator, to test merging.
+	for i := n; i > 0; i-- {
+		e.TimeMetrics["Query_time"] = float64(i) / 1000
+		e.TimeMetrics["Lock_time"] = -float64(i) / 1000
+		e.NumberMetrics["Rows_sent"] = uint64(i)
+		if i%2 == 0 {
+			a1.AddEvent(*e, "1", "select 1")
+		} else {
+			a2.AddEvent(*e, "1", "select 1")
+		}
+	}
+	a1.Merge(a2)
+	got := a1.Finalize().Class["1"].Metrics
+
+	qt := got.TimeMetrics["Query_time"]
+	if qt.Min != 0.001 || qt.Med != float64(n/2+1)/1000 || qt.P95 != float64(95*n/100+1)/1000 || qt.Max != float64(n)/1000 {
+		t.Errorf("Query_time: got %+v", qt)
+	}
+	lt := got.TimeMetrics["Lock_time"]
+	if lt.Min != -float64(n)/1000 || lt.Max != -0.001 {
+		t.Errorf("Lock_time: got %+v", lt)
+	}
+	rs := got.NumberMetrics["Rows_sent"]
+	if rs.Min != 1 || rs.Med != uint64(n/2+1) || rs.P95 != uint64(95*n/100+1) || rs.Max != uint64(n) {
+		t.Errorf("Rows_sent: got %+v", rs)
+	}
+}
+
+func TestAccessPattern(t *testing.T) {
+	tests := []struct {
+		s      slowlog.SlowExtra
+		expect slowlog.AccessPattern
+	}{
+		{slowlog.SlowExtra{}, slowlog.ACCESS_NONE},
+		{slowlog.SlowExtra{ReadKey: 1}, slowlog.ACCESS_POINT},
+		{slowlog.SlowExtra{ReadKey: 1, ReadNext: 50}, slowlog.ACCESS_RANGE},
+		{slowlog.SlowExtra{ReadFirst: 1, ReadNext: 999}, slowlog.ACCESS_INDEX_SCAN},
+		{slowlog.SlowExtra{ReadFirst: 1, ReadKey: 1, ReadRndNext: 1001}, slowlog.ACCESS_FULL_SCAN},
+		{slowlog.SlowExtra{ReadKey: 100, ReadRndNext: 10}, slowlog.ACCESS_POINT}, // small scan in a join
+	}
+	for _, test := range tests {
+		if got := test.s.AccessPattern(); got != test.expect {
+			t.Errorf("%+v: got %s, expected %s", test.s, got, test.expect)
+		}
+	}
+}
+
+func TestClassAccessPatterns(t *testing.T) {
+	c := slowlog.NewClass("1", "select", false)
+	add := func(s *slowlog.SlowExtra) {
+		e := slowlog.NewEvent()
+		e.TimeMetrics["Query_time"] = 1
+		e.SlowExtra = s
+		c.AddEvent(*e, false)
+	}
+	add(&slowlog.SlowExtra{ReadKey: 1})
+	add(&slowlog.SlowExtra{ReadKey: 1})
+	add(&slowlog.SlowExtra{ReadRndNext: 100})
+	add(nil) // no log_slow_extra
+	c.Finalize(1)
+	expect := map[string]uint64{"point": 2, "full_scan": 1}
+	if diff := deep.Equal(c.AccessPatterns, expect); diff != nil {
+		t.Error(diff)
+	}
+}
+
+func TestClassErrnos(t *testing.T) {
+	c := slowlog.NewClass("1", "select", false)
+	add := func(killed, errno uint64) {
+		e := slowlog.NewEvent()
+		e.TimeMetrics["Query_time"] = 1
+		e.Killed = killed
+		e.LastErrno = errno
+		c.AddEvent(*e, false)
+	}
+	add(0, 0)
+	add(0, 1146)
+	add(0, 1146)
+	add(1317, 1317)
+	add(3024, 3024)
+
+	// An event with only the metrics, not made by a parser.
+	e := slowlog.NewEvent()
+	e.TimeMetrics["Query_time"] = 1
+	e.NumberMetrics["Killed"] = 1317
+	e.NumberMetrics["Last_errno"] = 1317
+	c.AddEvent(*e, false)
+
+	c.Finalize(1)
+	if c.KilledQueries != 3 {
+		t.Errorf("got KilledQueries %d, expected 3", c.KilledQueries)
+	}
+	if diff := deep.Equal(c.KilledErrnos, map[uint64]uint64{1317: 2, 3024: 1}); diff != nil {
+		t.Error(diff)
+	}
+	if diff := deep.Equal(c.LastErrnos, map[uint64]uint64{1146: 2, 1317: 2, 3024: 1}); diff != nil {
+		t.Error(diff)
+	}
+}
+
+func TestClassMaxExampleBytes(t *testing.T) {
+	for _, test := range []struct {
+		max    int
+		expect string
+	}{
+		{1, "s"},
+		{3, "sel"},
+		{4, "s..."},
+		{8, "selec..."},
+		{100, "select 1 from t"},
+	} {
+		a := slowlog.NewAggregator(true, 0, 0)
+		a.SetMaxExampleBytes(test.max)
+		e := slowlog.NewEvent()
+		e.Query = "select 1 from t"
+		e.TimeMetrics["Query_time"] = 1
+		a.AddEvent(*e, "1", "select ? from t")
+		got := a.Finalize().Class["1"].Example.Query
+		if got != test.expect {
+			t.Errorf("max %d: got %q, expected %q", test.max, got, test.expect)
+		}
+	}
+}
+
+func TestClassErrnosRateLimit(t *testing.T) {
+	c := slowlog.NewClass("1", "select", false)
+	add := func(killed uint64, outlier bool) {
+		e := slowlog.NewEvent()
+		e.TimeMetrics["Query_time"] = 1
+		e.Killed = killed
+		e.LastErrno = killed
+		c.AddEvent(*e, outlier)
+	}
+	add(0, false)
+	add(1317, false)
+	add(1317, true) // outliers are logged regardless of the rate limit
+	c.Finalize(10)
+	if c.TotalQueries != 21 || c.KilledQueries != 11 {
+		t.Errorf("got TotalQueries %d, KilledQueries %d, expected 21, 11", c.TotalQueries, c.KilledQueries)
+	}
+	if diff := deep.Equal(c.KilledErrnos, map[uint64]uint64{1317: 11}); diff != nil {
+		t.Error(diff)
+	}
+	if diff := deep.Equal(c.LastErrnos, map[uint64]uint64{1317: 11}); diff != nil {
+		t.Error(diff)
+	}
+}
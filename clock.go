@@ -0,0 +1,96 @@
+/*
+	Copyright 2017 Daniel Nichter
+	Copyright 2014-2016 Percona LLC and/or its affiliates
+*/
+
+package slowlog
+
+import (
+	"sync"
+	"time"
+)
+
+// A Clock tells the time and makes timers for the parser, see Options.Clock.
+// A Clock other than WallClock, like a ManualClock, makes parsing
+// deterministic in tests and simulations.
+type Clock interface {
+	Now() time.Time
+	After(d time.Duration) <-chan time.Time
+}
+
+// WallClock is the system clock, the default Clock.
+var WallClock Clock = wallClock{}
+
+type wallClock struct{}
+
+func (wallClock) Now() time.Time                         { return time.Now() }
+func (wallClock) After(d time.Duration) <-chan time.Time { return time.After(d) }
+
+// ManualClock is a Clock whose time changes only when it is set or advanced.
+// Timers made by After fire when the time reaches or passes them. It is safe
+// for concurrent use.
+type ManualClock struct {
+	now    time.Time
+	timers []manualTimer
+	*sync.Mutex
+}
+
+type manualTimer struct {
+	at time.Time
+	c  chan time.Time
+}
+
+// NewManualClock returns a new ManualClock set to now.
+func NewManualClock(now time.Time) *ManualClock {
+	return &ManualClock{
+		now:   now,
+		Mutex: &sync.Mutex{},
+	}
+}
+
+func (c *ManualClock) Now() time.Time {
+	c.Lock()
+	defer c.Unlock()
+	return c.now
+}
+
+func (c *ManualClock) After(d time.Duration) <-chan time.Time {
+	c.Lock()
+	defer c.Unlock()
+	t := manualTimer{at: c.now.Add(d), c: make(chan time.Time, 1)}
+	if d <= 0 {
+		t.c <- c.now
+	} else {
+		c.timers = append(c.timers, t)
+	}
+	return t.c
+}
+
+// Set sets the time and fires the timers at or before it.
+func (c *ManualClock) Set(now time.Time) {
+	c.Lock()
+	defer c.Unlock()
+	c.now = now
+	pending := c.timers[:0]
+	for _, t := range c.timers {
+		if t.at.After(now) {
+			pending = append(pending, t)
+		} else {
+			t.c <- now
+		}
+	}
+	c.timers = pending
+}
+
+// Advance adds d to the time and fires the timers at or before it.
+func (c *ManualClock) Advance(d time.Duration) {
+	c.Set(c.Now().Add(d))
+}
+
+// Timers returns the number of timers that have not fired, so a test can wait
+// until the parser is waiting before advancing the time.
+func (c *ManualClock) Timers() int {
+	c.Lock()
+	defer c.Unlock()
+	return len(c.timers)
+}
@@ -0,0 +1,88 @@
+/*
+	Copyright 2017 Daniel Nichter
+	Copyright 2014-2016 Percona LLC and/or its affiliates
+*/
+
+package slowlog_test
+
+import (
+	"os"
+	"path"
+	"testing"
+	"time"
+
+	"github.com/go-mysql/slowlog"
+)
+
+func TestManualClock(t *testing.T) {
+	start := time.Date(2019, 1, 1, 0, 0, 0, 0, time.UTC)
+	c := slowlog.NewManualClock(start)
+	t1 := c.After(time.Second)
+	t2 := c.After(2 * time.Second)
+	if n := c.Timers(); n != 2 {
+		t.Errorf("got %d timers, expected 2", n)
+	}
+	c.Advance(time.Second)
+	select {
+	case now := <-t1:
+		if !now.Equal(start.Add(time.Second)) {
+			t.Errorf("got time %s, expected %s", now, start.Add(time.Second))
+		}
+	default:
+		t.Error("timer 1 did not fire")
+	}
+	select {
+	case <-t2:
+		t.Error("timer 2 fired early")
+	default:
+	}
+	if n := c.Timers(); n != 1 {
+		t.Errorf("got %d timers, expected 1", n)
+	}
+	c.Set(start.Add(time.Hour))
+	<-t2
+	if !c.Now().Equal(start.Add(time.Hour)) {
+		t.Errorf("got time %s, expected %s", c.Now(), start.Add(time.Hour))
+	}
+}
+
+// With a ManualClock, rate limits wait only for the clock, not real time.
+func TestParserClock(t *testing.T) {
+	file, err := os.Open(path.Join("test", "slow-logs", "slow001.log"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	c := slowlog.NewManualClock(time.Date(2019, 1, 1, 0, 0, 0, 0, time.UTC))
+	p := slowlog.NewFileParser(file)
+	opt := slowlog.Options{
+		MaxEventsPerSecond: 0.001, // 1 event per 1000s
+		EventBurst:         1,
+		Clock:              c,
+	}
+	if err := p.Start(opt); err != nil {
+		t.Fatal(err)
+	}
+	defer p.Stop()
+
+	if _, ok := <-p.Events(); !ok {
+		t.Fatal("no first event")
+	}
+	for c.Timers() == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	select {
+	case <-p.Events():
+		t.Fatal("got second event before clock advanced")
+	case <-time.After(20 * time.Millisecond):
+	}
+	c.Advance(1000 * time.Second)
+	select {
+	case _, ok := <-p.Events():
+		if !ok {
+			t.Fatal("no second event")
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("timeout waiting for second event")
+	}
+}
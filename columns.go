@@ -0,0 +1,205 @@
+/*
+	Copyright 2017 Daniel Nichter
+	Copyright 2014-2016 Percona LLC and/or its affiliates
+*/
+
+package slowlog
+
+import (
+	"strings"
+)
+
+// ColumnClause is the clause in which a column is referenced, see Columns.
+type ColumnClause int
+
+const (
+	CLAUSE_WHERE    ColumnClause = iota // WHERE
+	CLAUSE_GROUP_BY                     // GROUP BY
+	CLAUSE_ORDER_BY                     // ORDER BY
+	clauseNone
+)
+
+func (c ColumnClause) String() string {
+	switch c {
+	case CLAUSE_WHERE:
+		return "WHERE"
+	case CLAUSE_GROUP_BY:
+		return "GROUP BY"
+	case CLAUSE_ORDER_BY:
+		return "ORDER BY"
+	}
+	return ""
+}
+
+// A ColumnRef is a column referenced in a clause. Column is lowercase, without
+// quotes, and qualified if the query qualifies it, like "t.id".
+type ColumnRef struct {
+	Clause ColumnClause
+	Column string
+}
+
+// A ColumnCount is the number of queries in a class that reference a column
+// in a clause, see Aggregator.SetColumns.
+type ColumnCount struct {
+	Clause ColumnClause
+	Column string
+	Count  uint64
+}
+
+// Words in a WHERE, GROUP BY, or ORDER BY clause that are not columns.
+var columnKeywords = map[string]bool{
+	"AGAINST":     true,
+	"ALL":         true,
+	"AND":         true,
+	"ANY":         true,
+	"AS":          true,
+	"ASC":         true,
+	"BETWEEN":     true,
+	"BINARY":      true,
+	"BY":          true,
+	"CASE":        true,
+	"COLLATE":     true,
+	"DAY":         true,
+	"DESC":        true,
+	"DISTINCT":    true,
+	"DIV":         true,
+	"ELSE":        true,
+	"END":         true,
+	"ESCAPE":      true,
+	"EXISTS":      true,
+	"FALSE":       true,
+	"HOUR":        true,
+	"IN":          true,
+	"INTERVAL":    true,
+	"IS":          true,
+	"LIKE":        true,
+	"MICROSECOND": true,
+	"MINUTE":      true,
+	"MOD":         true,
+	"MONTH":       true,
+	"NOT":         true,
+	"NULL":        true,
+	"OR":          true,
+	"QUARTER":     true,
+	"REGEXP":      true,
+	"RLIKE":       true,
+	"ROLLUP":      true,
+	"SECOND":      true,
+	"SOME":        true,
+	"SOUNDS":      true,
+	"THEN":        true,
+	"TRUE":        true,
+	"UNKNOWN":     true,
+	"WEEK":        true,
+	"WHEN":        true,
+	"WITH":        true,
+	"XOR":         true,
+	"YEAR":        true,
+}
+
+// Words that end a WHERE, GROUP BY, or ORDER BY clause, in addition to
+// clauseKeywords.
+var columnEndKeywords = map[string]bool{
+	"FOR":       true,
+	"INTO":      true,
+	"LOCK":      true,
+	"PROCEDURE": true,
+	"WINDOW":    true,
+}
+
+// Columns returns the unique columns referenced in the WHERE, GROUP BY, and
+// ORDER BY clauses of the query, including subqueries, in order. Functions,
+// keywords, literals, and user variables are skipped. Like FormatQuery, the
+// query is not parsed, so the columns are a good guess, not exact: an alias
+// in ORDER BY, for example, is returned like a column.
+func Columns(query string) []ColumnRef {
+	tokens := tokenize(query)
+	refs := []ColumnRef{}
+	seen := map[ColumnRef]bool{}
+	clause := clauseNone
+	outer := []ColumnClause{} // clause of each enclosing parenthesis
+	prev := ""                // previous token, not space
+	for i := 0; i < len(tokens); {
+		t := tokens[i]
+		if t == " " || t[0] == '#' || strings.HasPrefix(t, "--") || strings.HasPrefix(t, "/*") {
+			i++
+			continue
+		}
+		if t == "(" {
+			outer = append(outer, clause)
+		} else if t == ")" && len(outer) > 0 {
+			clause = outer[len(outer)-1]
+			outer = outer[0 : len(outer)-1]
+		}
+		if t[0] != '`' && !isWordChar(t[0]) {
+			prev = t
+			i++
+			continue
+		}
+
+		word := strings.ToUpper(t)
+		function := nextToken(tokens, i) == "("
+		if t[0] != '`' && (clauseKeywords[word] || columnEndKeywords[word]) && !function {
+			switch word {
+			case "WHERE":
+				clause = CLAUSE_WHERE
+			case "GROUP":
+				clause = CLAUSE_GROUP_BY
+			case "ORDER":
+				clause = CLAUSE_ORDER_BY
+			default:
+				clause = clauseNone
+			}
+			prev = t
+			i++
+			continue
+		}
+
+		name, next := identifier(tokens, i)
+		column := clause != clauseNone && prev != "@" && nextToken(tokens, next-1) != "(" &&
+			!(t[0] >= '0' && t[0] <= '9') && !(t[0] != '`' && columnKeywords[word])
+		if column {
+			ref := ColumnRef{Clause: clause, Column: strings.ToLower(name)}
+			if !seen[ref] {
+				seen[ref] = true
+				refs = append(refs, ref)
+			}
+		}
+		prev = tokens[next-1]
+		i = next
+	}
+	return refs
+}
+
+// identifier returns the identifier that begins at tokens[i], like a.`b`,
+// without quotes, and the index of the token after it.
+func identifier(tokens []string, i int) (string, int) {
+	name := ""
+	for i < len(tokens) {
+		t := tokens[i]
+		if t[0] == '`' {
+			val, _ := quoted(t)
+			name += val
+		} else {
+			name += t
+		}
+		i++
+		if i == len(tokens) || (!strings.HasSuffix(name, ".") && tokens[i] != ".") {
+			break
+		}
+		if n := tokens[i]; n != "." && n[0] != '`' && !isWordChar(n[0]) {
+			break
+		}
+	}
+	return name, i
+}
+
+// nextToken returns the next token after tokens[i] that is not space, if any.
+func nextToken(tokens []string, i int) string {
+	for _, t := range tokens[i+1:] {
+		if t != " " {
+			return t
+		}
+	}
+	return ""
+}
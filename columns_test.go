@@ -0,0 +1,67 @@
+/*
+	Copyright 2017 Daniel Nichter
+	Copyright 2014-2016 Percona LLC and/or its affiliates
+*/
+
+package slowlog_test
+
+import (
+	"testing"
+
+	"github.com/go-mysql/slowlog"
+	"github.com/go-test/deep"
+)
+
+func TestColumns(t *testing.T) {
+	where := slowlog.CLAUSE_WHERE
+	group := slowlog.CLAUSE_GROUP_BY
+	order := slowlog.CLAUSE_ORDER_BY
+	tests := []struct {
+		query  string
+		expect []slowlog.ColumnRef
+	}{
+		{
+			query:  "SELECT c FROM t",
+			expect: []slowlog.ColumnRef{},
+		},
+		{
+			query: "SELECT a, b FROM t WHERE a = 1 AND (B > 2 OR c IS NOT NULL) AND a < 5 ORDER BY b DESC, `c` LIMIT 10",
+			expect: []slowlog.ColumnRef{
+				{Clause: where, Column: "a"},
+				{Clause: where, Column: "b"},
+				{Clause: where, Column: "c"},
+				{Clause: order, Column: "b"},
+				{Clause: order, Column: "c"},
+			},
+		},
+		{
+			query: "select t.x, count(*) from t join u on t.id = u.id where `u`.`y` in (select y from v where z like 'a%') and date(t.ts) >= '2017-01-02' group by t.x with rollup",
+			expect: []slowlog.ColumnRef{
+				{Clause: where, Column: "u.y"},
+				{Clause: where, Column: "z"},
+				{Clause: where, Column: "t.ts"},
+				{Clause: group, Column: "t.x"},
+			},
+		},
+		{
+			query: "UPDATE t SET a = 1 WHERE id = @id AND ts > NOW() - INTERVAL 1 DAY -- id\n",
+			expect: []slowlog.ColumnRef{
+				{Clause: where, Column: "id"},
+				{Clause: where, Column: "ts"},
+			},
+		},
+		{
+			query: "SELECT * FROM t WHERE a BETWEEN 1.5 AND 2 ORDER BY FIELD(b, 'x', 'y') FOR UPDATE",
+			expect: []slowlog.ColumnRef{
+				{Clause: where, Column: "a"},
+				{Clause: order, Column: "b"},
+			},
+		},
+	}
+	for _, test := range tests {
+		got := slowlog.Columns(test.query)
+		if diff := deep.Equal(got, test.expect); diff != nil {
+			t.Errorf("%s: %v", test.query, diff)
+		}
+	}
+}
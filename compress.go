@@ -0,0 +1,168 @@
+/*
+	Copyright 2017 Daniel Nichter
+	Copyright 2014-2016 Percona LLC and/or its affiliates
+*/
+
+package slowlog
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"sync"
+)
+
+// Compression is the compression or encryption of a slow log, see
+// Options.Compression. Offsets, like Options.StartOffset and Event.Offset, are
+// in decompressed bytes, and a compressed file is not seeked: the parser reads
+// and discards StartOffset bytes. Encrypted logs are decrypted as they are
+// read by Options.Decrypt, so the plain text is never written to disk.
+type Compression int
+
+const (
+	COMPRESSION_NONE Compression = iota // plain text (default)
+	COMPRESSION_GZIP                    // gzip, like slow.log.gz
+	COMPRESSION_AUTO                    // detect compression by magic number, else plain text
+	COMPRESSION_ZSTD                    // zstd, requires RegisterDecompressor
+	COMPRESSION_XZ                      // xz, requires RegisterDecompressor
+	COMPRESSION_AGE                     // age encryption, requires Options.Decrypt
+	COMPRESSION_PGP                     // OpenPGP encryption, requires Options.Decrypt
+)
+
+func (c Compression) String() string {
+	switch c {
+	case COMPRESSION_NONE:
+		return "none"
+	case COMPRESSION_GZIP:
+		return "gzip"
+	case COMPRESSION_AUTO:
+		return "auto"
+	case COMPRESSION_ZSTD:
+		return "zstd"
+	case COMPRESSION_XZ:
+		return "xz"
+	case COMPRESSION_AGE:
+		return "age"
+	case COMPRESSION_PGP:
+		return "pgp"
+	}
+	return fmt.Sprintf("Compression(%d)", int(c))
+}
+
+// magic numbers of compression formats, for COMPRESSION_AUTO. Binary OpenPGP
+// messages do not have one, only ASCII armored messages.
+var magic = map[Compression][][]byte{
+	COMPRESSION_GZIP: {{0x1f, 0x8b}},
+	COMPRESSION_ZSTD: {{0x28, 0xb5, 0x2f, 0xfd}},
+	COMPRESSION_XZ:   {{0xfd, '7', 'z', 'X', 'Z', 0x00}},
+	COMPRESSION_AGE:  {[]byte("age-encryption.org/v1\n"), []byte("-----BEGIN AGE ENCRYPTED FILE-----")},
+	COMPRESSION_PGP:  {[]byte("-----BEGIN PGP MESSAGE-----")},
+}
+
+// MAX_DECOMPRESS_LAYERS is the max number of compression or encryption layers
+// detected by COMPRESSION_AUTO, like a gzip log encrypted with age.
+const MAX_DECOMPRESS_LAYERS = 2
+
+// A Decompressor returns a reader that decompresses or decrypts r.
+type Decompressor func(r io.Reader) (io.Reader, error)
+
+var decompressorsMu = &sync.Mutex{}
+var decompressors = map[Compression]Decompressor{
+	COMPRESSION_GZIP: func(r io.Reader) (io.Reader, error) { return gzip.NewReader(r) },
+}
+
+// RegisterDecompressor registers the Decompressor for the compression. The
+// standard library only has gzip, so zstd and xz require registering a
+// Decompressor from another package, like:
+//
+//	slowlog.RegisterDecompressor(slowlog.COMPRESSION_ZSTD, func(r io.Reader) (io.Reader, error) {
+//	    return zstd.NewReader(r)
+//	})
+//
+// Decryption needs a key, so it is not registered: a Decompressor registered
+// for COMPRESSION_AGE or COMPRESSION_PGP is not used. Set Options.Decrypt for
+// each parser instead, like:
+//
+//	opt.Decrypt = func(r io.Reader) (io.Reader, error) {
+//	    return age.Decrypt(r, identity)
+//	}
+//
+// An ASCII armored age file must be read with armor.NewReader first, and an
+// OpenPGP message is read with openpgp.ReadMessage and the keyring.
+func RegisterDecompressor(c Compression, d Decompressor) {
+	decompressorsMu.Lock()
+	defer decompressorsMu.Unlock()
+	decompressors[c] = d
+}
+
+// decompress wraps the reader to decompress it according to opt.Compression.
+// With COMPRESSION_AUTO, the decompressed data is detected again, up to
+// MAX_DECOMPRESS_LAYERS, so an encrypted gzip log is decrypted then
+// decompressed. It must be called before reading. The caller must hold the
+// lock.
+func (p *ReaderParser) decompress() error {
+	c := p.opt.Compression
+	if c == COMPRESSION_NONE {
+		return nil
+	}
+	auto := c == COMPRESSION_AUTO
+	for layer := 0; layer < MAX_DECOMPRESS_LAYERS; layer++ {
+		if auto {
+			var err error
+			if c, err = p.detectCompression(); err != nil {
+				return err
+			}
+			if c == COMPRESSION_NONE {
+				return nil
+			}
+		}
+		var d Decompressor
+		if encrypted(c) {
+			if d = p.opt.Decrypt; d == nil {
+				return fmt.Errorf("no Decrypt for %s, see Options.Decrypt", c)
+			}
+		} else {
+			decompressorsMu.Lock()
+			d = decompressors[c]
+			decompressorsMu.Unlock()
+			if d == nil {
+				return fmt.Errorf("no decompressor for %s, see RegisterDecompressor", c)
+			}
+		}
+		r, err := d(p.reader)
+		if err != nil {
+			return err
+		}
+		p.reader = bufio.NewReader(r)
+		p.compressed = true
+		if !auto {
+			break
+		}
+	}
+	return nil
+}
+
+// encrypted returns true if the compression is encryption, which is decrypted
+// by Options.Decrypt.
+func encrypted(c Compression) bool {
+	return c == COMPRESSION_AGE || c == COMPRESSION_PGP
+}
+
+// detectCompression returns the compression with a magic number at the start
+// of the reader, else COMPRESSION_NONE.
+func (p *ReaderParser) detectCompression() (Compression, error) {
+	for c, numbers := range magic {
+		for _, m := range numbers {
+			buf, err := p.reader.Peek(len(m))
+			if err != nil && err != io.EOF {
+				return COMPRESSION_NONE, err
+			}
+			if bytes.Equal(buf, m) {
+				return c, nil
+			}
+		}
+	}
+	return COMPRESSION_NONE, nil
+}
@@ -0,0 +1,197 @@
+/*
+	Copyright 2017 Daniel Nichter
+	Copyright 2014-2016 Percona LLC and/or its affiliates
+*/
+
+package slowlog_test
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+
+	"github.com/go-mysql/slowlog"
+	"github.com/go-test/deep"
+)
+
+func TestCompression(t *testing.T) {
+	data, err := ioutil.ReadFile(path.Join("test", "slow-logs", "slow001.log"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmp, err := ioutil.TempFile("", "slowlog-test-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(tmp.Name())
+	zw := gzip.NewWriter(tmp)
+	zw.Write(data)
+	zw.Close()
+	tmp.Close()
+
+	parse := func(file string, opt slowlog.Options) []slowlog.Event {
+		f, err := os.Open(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer f.Close()
+		p := slowlog.NewFileParser(f)
+		if err := p.Start(opt); err != nil {
+			t.Fatal(err)
+		}
+		got := []slowlog.Event{}
+		for e := range p.Events() {
+			e.Source = ""
+			e.EndOffset = 0
+			got = append(got, e)
+		}
+		if err := p.Error(); err != nil {
+			t.Error(err)
+		}
+		return got
+	}
+
+	for _, opt := range []slowlog.Options{
+		{Compression: slowlog.COMPRESSION_GZIP},
+		{Compression: slowlog.COMPRESSION_AUTO},
+		{Compression: slowlog.COMPRESSION_AUTO, StartOffset: 359},
+	} {
+		got := parse(tmp.Name(), opt)
+		expect := parseSlowLog(t, "slow001.log", slowlog.Options{StartOffset: opt.StartOffset})
+		if diff := deep.Equal(got, expect); diff != nil {
+			t.Errorf("%+v: %v", opt, diff)
+		}
+	}
+
+	// Auto is plain text if not gzip.
+	got := parse(path.Join("test", "slow-logs", "slow001.log"), slowlog.Options{Compression: slowlog.COMPRESSION_AUTO})
+	if diff := deep.Equal(got, parseSlowLog(t, "slow001.log", noOptions)); diff != nil {
+		t.Error(diff)
+	}
+}
+
+func TestRegisterDecompressor(t *testing.T) {
+	data, err := ioutil.ReadFile(path.Join("test", "slow-logs", "slow001.log"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Fake zstd: magic number followed by plain text.
+	zstdMagic := []byte{0x28, 0xb5, 0x2f, 0xfd}
+	slowlog.RegisterDecompressor(slowlog.COMPRESSION_ZSTD, func(r io.Reader) (io.Reader, error) {
+		magic := make([]byte, len(zstdMagic))
+		if _, err := io.ReadFull(r, magic); err != nil {
+			return nil, err
+		}
+		return r, nil
+	})
+
+	for _, c := range []slowlog.Compression{slowlog.COMPRESSION_ZSTD, slowlog.COMPRESSION_AUTO} {
+		p := slowlog.NewParser(bytes.NewReader(append(zstdMagic, data...)))
+		if err := p.Start(slowlog.Options{Compression: c}); err != nil {
+			t.Fatal(err)
+		}
+		got := []slowlog.Event{}
+		for e := range p.Events() {
+			e.EndOffset = 0
+			got = append(got, e)
+		}
+		if err := p.Error(); err != nil {
+			t.Error(err)
+		}
+		if diff := deep.Equal(got, parseSlowLog(t, "slow001.log", noOptions)); diff != nil {
+			t.Errorf("%s: %v", c, diff)
+		}
+	}
+
+	// No xz decompressor is registered.
+	xz := append([]byte{0xfd, '7', 'z', 'X', 'Z', 0x00}, data...)
+	p := slowlog.NewParser(bytes.NewReader(xz))
+	err = p.Start(slowlog.Options{Compression: slowlog.COMPRESSION_AUTO})
+	if err == nil || err.Error() != "no decompressor for xz, see RegisterDecompressor" {
+		t.Errorf("got error %v, expected no decompressor for xz", err)
+	}
+}
+
+func TestEncryptedLog(t *testing.T) {
+	data, err := ioutil.ReadFile(path.Join("test", "slow-logs", "slow001.log"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Fake age: header followed by data with every byte inverted.
+	header := []byte("age-encryption.org/v1\n")
+	decrypt := func(r io.Reader) (io.Reader, error) {
+		if _, err := io.ReadFull(r, make([]byte, len(header))); err != nil {
+			return nil, err
+		}
+		return invertReader{r}, nil
+	}
+	encrypt := func(plain []byte) []byte {
+		enc := append([]byte{}, header...)
+		for _, b := range plain {
+			enc = append(enc, ^b)
+		}
+		return enc
+	}
+	var gz bytes.Buffer
+	zw := gzip.NewWriter(&gz)
+	zw.Write(data)
+	zw.Close()
+
+	for _, test := range []struct {
+		name string
+		data []byte
+		opt  slowlog.Options
+	}{
+		{"age", encrypt(data), slowlog.Options{Compression: slowlog.COMPRESSION_AGE, Decrypt: decrypt}},
+		{"auto", encrypt(data), slowlog.Options{Compression: slowlog.COMPRESSION_AUTO, Decrypt: decrypt}},
+		{"gzip then age", encrypt(gz.Bytes()), slowlog.Options{Compression: slowlog.COMPRESSION_AUTO, Decrypt: decrypt}},
+	} {
+		p := slowlog.NewParser(bytes.NewReader(test.data))
+		if err := p.Start(test.opt); err != nil {
+			t.Fatal(err)
+		}
+		got := []slowlog.Event{}
+		for e := range p.Events() {
+			e.EndOffset = 0
+			got = append(got, e)
+		}
+		if err := p.Error(); err != nil {
+			t.Error(err)
+		}
+		if diff := deep.Equal(got, parseSlowLog(t, "slow001.log", noOptions)); diff != nil {
+			t.Errorf("%s: %v", test.name, diff)
+		}
+	}
+
+	// Decryption is not global: a registered Decompressor is not used, and
+	// a parser without Decrypt cannot read the log.
+	slowlog.RegisterDecompressor(slowlog.COMPRESSION_AGE, decrypt)
+	p := slowlog.NewParser(bytes.NewReader(encrypt(data)))
+	err = p.Start(slowlog.Options{Compression: slowlog.COMPRESSION_AUTO})
+	if err == nil || err.Error() != "no Decrypt for age, see Options.Decrypt" {
+		t.Errorf("got error %v, expected no Decrypt for age", err)
+	}
+	p = slowlog.NewParser(bytes.NewReader(append([]byte("-----BEGIN PGP MESSAGE-----\n"), data...)))
+	err = p.Start(slowlog.Options{Compression: slowlog.COMPRESSION_AUTO})
+	if err == nil || err.Error() != "no Decrypt for pgp, see Options.Decrypt" {
+		t.Errorf("got error %v, expected no Decrypt for pgp", err)
+	}
+}
+
+type invertReader struct {
+	r io.Reader
+}
+
+func (r invertReader) Read(b []byte) (int, error) {
+	n, err := r.r.Read(b)
+	for i := range b[0:n] {
+		b[i] = ^b[i]
+	}
+	return n, err
+}
@@ -0,0 +1,163 @@
+/*
+	Copyright 2017 Daniel Nichter
+	Copyright 2014-2016 Percona LLC and/or its affiliates
+*/
+
+package slowlog
+
+import (
+	"sort"
+	"time"
+)
+
+// ConnectionStats are the connections and disconnections of each user and
+// host from Connect and Quit admin events, see Aggregator.SetConnections.
+// Slow logs have these events if log_slow_admin_statements is enabled.
+// Many connections per second, or connection churn, usually means that an
+// application does not pool connections.
+type ConnectionStats struct {
+	Start    time.Time         // Event.Time of first event, zero if none
+	End      time.Time         // Event.Time of last event, zero if none
+	Interval time.Duration     // of UserConnections.Series
+	Users    []UserConnections // sorted by Connects descending
+}
+
+// UserConnections are the connections of one user and host.
+type UserConnections struct {
+	User     string
+	Host     string
+	Connects uint64            // Connect admin events
+	Quits    uint64            // Quit admin events
+	Rate     float64           // Connects per second from ConnectionStats Start to End
+	Series   []ConnectionPoint `json:",omitempty"` // per Interval, without empty intervals
+}
+
+// A ConnectionPoint is the connections of a user and host in one interval.
+type ConnectionPoint struct {
+	Start    time.Time
+	Connects uint64
+	Quits    uint64
+}
+
+type connections struct {
+	interval time.Duration
+	users    map[[2]string]*UserConnections
+	points   map[[2]string]map[int64]*ConnectionPoint // user@host => interval start (Unix) => point
+	start    time.Time
+	end      time.Time
+}
+
+func newConnections(interval time.Duration) *connections {
+	return &connections{
+		interval: interval,
+		users:    map[[2]string]*UserConnections{},
+		points:   map[[2]string]map[int64]*ConnectionPoint{},
+	}
+}
+
+// addEvent counts the event if it's a Connect or Quit admin event. The time
+// of every event is used for the Start and End of the stats.
+func (c *connections) addEvent(e Event) {
+	if !e.Time.IsZero() {
+		if c.start.IsZero() || e.Time.Before(c.start) {
+			c.start = e.Time
+		}
+		if e.Time.After(c.end) {
+			c.end = e.Time
+		}
+	}
+	if !e.Admin || (e.Query != "Connect" && e.Query != "Quit") {
+		return
+	}
+	key := [2]string{e.User, e.Host}
+	u, ok := c.users[key]
+	if !ok {
+		u = &UserConnections{User: e.User, Host: e.Host}
+		c.users[key] = u
+	}
+	var p *ConnectionPoint
+	if c.interval > 0 && !e.Time.IsZero() {
+		start := e.Time.Truncate(c.interval)
+		if c.points[key] == nil {
+			c.points[key] = map[int64]*ConnectionPoint{}
+		}
+		if p = c.points[key][start.Unix()]; p == nil {
+			p = &ConnectionPoint{Start: start}
+			c.points[key][start.Unix()] = p
+		}
+	}
+	if e.Query == "Connect" {
+		u.Connects++
+		if p != nil {
+			p.Connects++
+		}
+	} else {
+		u.Quits++
+		if p != nil {
+			p.Quits++
+		}
+	}
+}
+
+// merge adds the counts of o, which must not be finalized.
+func (c *connections) merge(o *connections) {
+	if !o.start.IsZero() && (c.start.IsZero() || o.start.Before(c.start)) {
+		c.start = o.start
+	}
+	if o.end.After(c.end) {
+		c.end = o.end
+	}
+	for key, ou := range o.users {
+		u, ok := c.users[key]
+		if !ok {
+			c.users[key] = ou
+			continue
+		}
+		u.Connects += ou.Connects
+		u.Quits += ou.Quits
+	}
+	for key, points := range o.points {
+		if c.points[key] == nil {
+			c.points[key] = map[int64]*ConnectionPoint{}
+		}
+		for start, op := range points {
+			p, ok := c.points[key][start]
+			if !ok {
+				c.points[key][start] = op
+				continue
+			}
+			p.Connects += op.Connects
+			p.Quits += op.Quits
+		}
+	}
+}
+
+func (c *connections) finalize() *ConnectionStats {
+	s := &ConnectionStats{
+		Start:    c.start,
+		End:      c.end,
+		Interval: c.interval,
+		Users:    make([]UserConnections, 0, len(c.users)),
+	}
+	secs := c.end.Sub(c.start).Seconds()
+	for key, u := range c.users {
+		if secs > 0 {
+			u.Rate = float64(u.Connects) / secs
+		}
+		for _, p := range c.points[key] {
+			u.Series = append(u.Series, *p)
+		}
+		sort.Slice(u.Series, func(i, j int) bool { return u.Series[i].Start.Before(u.Series[j].Start) })
+		s.Users = append(s.Users, *u)
+	}
+	sort.Slice(s.Users, func(i, j int) bool {
+		if s.Users[i].Connects != s.Users[j].Connects {
+			return s.Users[i].Connects > s.Users[j].Connects // descending order
+		}
+		if s.Users[i].User != s.Users[j].User {
+			return s.Users[i].User < s.Users[j].User
+		}
+		return s.Users[i].Host < s.Users[j].Host
+	})
+	return s
+}
@@ -0,0 +1,83 @@
+/*
+	Copyright 2017 Daniel Nichter
+	Copyright 2014-2016 Percona LLC and/or its affiliates
+*/
+
+package slowlog
+
+import (
+	"database/sql"
+	"strconv"
+	"strings"
+)
+
+// ServerCounters are global status counters of a MySQL server, see
+// GlobalStatus. Take them at the start and end of the time window of
+// the slow log to compute its Coverage.
+type ServerCounters struct {
+	SlowQueries uint64 // Slow_queries
+	Questions   uint64 // Questions
+}
+
+// CoverageStats are how many of the server's slow queries a Result covered.
+type CoverageStats struct {
+	SlowQueries  uint64  // Slow_queries in window
+	Questions    uint64  // Questions in window
+	Parsed       uint64  // Result.Global.TotalQueries
+	Coverage     float64 // Parsed / SlowQueries; < 1 if events are missing, like a partially rotated log
+	SlowFraction float64 // SlowQueries / Questions
+	RateLimited  bool    // Result.RateLimit > 1, so Parsed is estimated
+}
+
+// GlobalStatus returns the ServerCounters from SHOW GLOBAL STATUS. The db
+// must use a MySQL driver, like github.com/go-sql-driver/mysql.
+func GlobalStatus(db *sql.DB) (ServerCounters, error) {
+	c := ServerCounters{}
+	rows, err := db.Query("SHOW GLOBAL STATUS WHERE Variable_name IN ('Slow_queries', 'Questions')")
+	if err != nil {
+		return c, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var name, val string
+		if err := rows.Scan(&name, &val); err != nil {
+			return c, err
+		}
+		n, err := strconv.ParseUint(val, 10, 64)
+		if err != nil {
+			return c, err
+		}
+		switch strings.ToLower(name) {
+		case "slow_queries":
+			c.SlowQueries = n
+		case "questions":
+			c.Questions = n
+		}
+	}
+	return c, rows.Err()
+}
+
+// Coverage returns the coverage of the finalized Result of the slow log
+// written between the start and end counters. Counters that decreased, like
+// after a server restart, are treated as 0.
+func Coverage(r Result, start, end ServerCounters) CoverageStats {
+	s := CoverageStats{
+		RateLimited: r.RateLimit > 1,
+	}
+	if end.SlowQueries > start.SlowQueries {
+		s.SlowQueries = end.SlowQueries - start.SlowQueries
+	}
+	if end.Questions > start.Questions {
+		s.Questions = end.Questions - start.Questions
+	}
+	if r.Global != nil {
+		s.Parsed = r.Global.TotalQueries
+	}
+	if s.SlowQueries > 0 {
+		s.Coverage = float64(s.Parsed) / float64(s.SlowQueries)
+	}
+	if s.Questions > 0 {
+		s.SlowFraction = float64(s.SlowQueries) / float64(s.Questions)
+	}
+	return s
+}
@@ -0,0 +1,109 @@
+/*
+	Copyright 2017 Daniel Nichter
+	Copyright 2014-2016 Percona LLC and/or its affiliates
+*/
+
+package slowlog
+
+import (
+	"hash/fnv"
+	"sort"
+	"strconv"
+)
+
+// DedupKey determines which events are duplicates, see Aggregator.SetDedup.
+type DedupKey int
+
+const (
+	DEDUP_OFFSET  DedupKey = iota // same Source and Offset, like re-reading part of a file
+	DEDUP_CONTENT                 // same Time, User, Host, Db, Query, and metrics, like re-reading a rotated file
+)
+
+// dedup remembers the keys of the last window events.
+type dedup struct {
+	key  DedupKey
+	seen map[uint64]bool
+	keys []uint64 // ring buffer of seen keys, oldest at next
+	next int
+	n    uint64 // duplicates
+}
+
+func newDedup(key DedupKey, window uint) *dedup {
+	return &dedup{
+		key:  key,
+		seen: map[uint64]bool{},
+		keys: make([]uint64, 0, window),
+	}
+}
+
+// duplicate returns true if the event was seen in the window. Else the event
+// is added to the window, evicting the oldest event if the window is full.
+func (d *dedup) duplicate(e Event) bool {
+	k := d.hash(e)
+	if d.seen[k] {
+		d.n++
+		return true
+	}
+	if cap(d.keys) == 0 {
+		return false
+	}
+	if len(d.keys) < cap(d.keys) {
+		d.keys = append(d.keys, k)
+	} else {
+		delete(d.seen, d.keys[d.next])
+		d.keys[d.next] = k
+		d.next = (d.next + 1) % len(d.keys)
+	}
+	d.seen[k] = true
+	return false
+}
+
+func (d *dedup) hash(e Event) uint64 {
+	h := fnv.New64a()
+	write := func(s string) {
+		h.Write([]byte(s))
+		h.Write([]byte{0})
+	}
+	if d.key == DEDUP_OFFSET {
+		write(e.Source)
+		write(strconv.FormatUint(e.Offset, 10))
+		return h.Sum64()
+	}
+	if e.Time.IsZero() {
+		write(e.Ts)
+	} else {
+		write(strconv.FormatInt(e.Time.UnixNano(), 10))
+	}
+	write(e.User)
+	write(e.Host)
+	write(e.Db)
+	write(e.Query)
+	names := []string{}
+	for name := range e.TimeMetrics {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		write(name)
+		write(strconv.FormatFloat(e.TimeMetrics[name], 'g', -1, 64))
+	}
+	names = names[:0]
+	for name := range e.NumberMetrics {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		write(name)
+		write(strconv.FormatUint(e.NumberMetrics[name], 10))
+	}
+	names = names[:0]
+	for name := range e.BoolMetrics {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		write(name)
+		write(strconv.FormatBool(e.BoolMetrics[name]))
+	}
+	return h.Sum64()
+}
@@ -0,0 +1,128 @@
+/*
+	Copyright 2017 Daniel Nichter
+	Copyright 2014-2016 Percona LLC and/or its affiliates
+*/
+
+package slowlog
+
+import (
+	"compress/gzip"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// DEFAULT_DEMUX_MAX_OPEN is the default Demux.MaxOpen.
+const DEFAULT_DEMUX_MAX_OPEN = 100
+
+// A Demux writes events to one slow log file per class, named by class ID,
+// like "3A99CC42AEDCCFCD.log", so all events of a class can be shared without
+// sharing the whole log. Events are written by WriteEvent. Files are appended
+// to if they exist.
+type Demux struct {
+	MaxOpen int // maximum open files (default: DEFAULT_DEMUX_MAX_OPEN)
+	// --
+	dir   string
+	class ClassFunc
+	gzip  bool
+	open  map[string]*demuxFile
+	n     uint64 // to close the least recently used file
+}
+
+type demuxFile struct {
+	file *os.File
+	w    io.Writer
+	gz   *gzip.Writer
+	used uint64
+}
+
+// NewDemux returns a new Demux that writes files in dir, which must exist.
+// If compress is true, files are gzip-compressed and named with suffix
+// ".log.gz". A file that is closed and reopened to append more events has
+// several gzip members, which gzip tools and gzip.Reader read as one file.
+func NewDemux(dir string, class ClassFunc, compress bool) *Demux {
+	return &Demux{
+		MaxOpen: DEFAULT_DEMUX_MAX_OPEN,
+		dir:     dir,
+		class:   class,
+		gzip:    compress,
+		open:    map[string]*demuxFile{},
+	}
+}
+
+// AddEvent writes the event to the file of its class.
+func (d *Demux) AddEvent(e Event) error {
+	id, _ := d.class(e)
+	if id == "" || strings.ContainsAny(id, `/\`) || id == "." || id == ".." {
+		return errors.New("invalid class ID: " + id)
+	}
+	f, ok := d.open[id]
+	if !ok {
+		if len(d.open) >= d.MaxOpen && d.MaxOpen > 0 {
+			if err := d.closeLRU(); err != nil {
+				return err
+			}
+		}
+		var err error
+		if f, err = d.openFile(id); err != nil {
+			return err
+		}
+		d.open[id] = f
+	}
+	d.n++
+	f.used = d.n
+	return WriteEvent(f.w, e)
+}
+
+// Close closes all files. Call it when done adding events.
+func (d *Demux) Close() error {
+	var firstErr error
+	for id, f := range d.open {
+		if err := f.close(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+		delete(d.open, id)
+	}
+	return firstErr
+}
+
+func (d *Demux) openFile(id string) (*demuxFile, error) {
+	name := id + ".log"
+	if d.gzip {
+		name += ".gz"
+	}
+	file, err := os.OpenFile(filepath.Join(d.dir, name), os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, err
+	}
+	f := &demuxFile{file: file, w: file}
+	if d.gzip {
+		f.gz = gzip.NewWriter(file)
+		f.w = f.gz
+	}
+	return f, nil
+}
+
+func (d *Demux) closeLRU() error {
+	lru := ""
+	for id, f := range d.open {
+		if lru == "" || f.used < d.open[lru].used {
+			lru = id
+		}
+	}
+	f := d.open[lru]
+	delete(d.open, lru)
+	return f.close()
+}
+
+func (f *demuxFile) close() error {
+	if f.gz != nil {
+		if err := f.gz.Close(); err != nil {
+			f.file.Close()
+			return err
+		}
+	}
+	return f.file.Close()
+}
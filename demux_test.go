@@ -0,0 +1,105 @@
+/*
+	Copyright 2017 Daniel Nichter
+	Copyright 2014-2016 Percona LLC and/or its affiliates
+*/
+
+package slowlog_test
+
+import (
+	"compress/gzip"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/go-mysql/slowlog"
+	"github.com/go-test/deep"
+)
+
+func TestDemux(t *testing.T) {
+	dir, err := ioutil.TempDir("", "slowlog-test-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	// Class is first word of query, lowercase.
+	class := func(e slowlog.Event) (string, string) {
+		w := strings.ToLower(strings.Fields(e.Query)[0])
+		return w, w
+	}
+	events := parseSlowLog(t, "slow002.log", noOptions)
+	expect := map[string][]slowlog.Event{}
+	for _, e := range events {
+		id, _ := class(e)
+		expect[id] = append(expect[id], e)
+	}
+	if len(expect) < 2 {
+		t.Fatalf("got %d classes, expected more", len(expect))
+	}
+
+	for _, compress := range []bool{false, true} {
+		d := slowlog.NewDemux(dir, class, compress)
+		d.MaxOpen = 1 // reopen files
+		for _, e := range events {
+			if err := d.AddEvent(e); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err := d.Close(); err != nil {
+			t.Fatal(err)
+		}
+
+		for id := range expect {
+			name := filepath.Join(dir, id+".log")
+			if compress {
+				name += ".gz"
+			}
+			file, err := os.Open(name)
+			if err != nil {
+				t.Fatal(err)
+			}
+			tmp, err := ioutil.TempFile(dir, "tmp-")
+			if err != nil {
+				t.Fatal(err)
+			}
+			var data []byte
+			if compress {
+				gz, err := gzip.NewReader(file)
+				if err != nil {
+					t.Fatal(err)
+				}
+				data, err = ioutil.ReadAll(gz)
+			} else {
+				data, err = ioutil.ReadAll(file)
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			file.Close()
+			tmp.Write(data)
+			tmp.Seek(0, os.SEEK_SET)
+
+			p := slowlog.NewFileParser(tmp)
+			if err := p.Start(noOptions); err != nil {
+				t.Fatal(err)
+			}
+			got := []string{}
+			for e := range p.Events() {
+				got = append(got, e.Query)
+			}
+			tmp.Close()
+			os.Remove(tmp.Name())
+			os.Remove(name)
+
+			queries := []string{}
+			for _, e := range expect[id] {
+				queries = append(queries, e.Query)
+			}
+			if diff := deep.Equal(got, queries); diff != nil {
+				t.Errorf("gzip %t class %s: %v", compress, id, diff)
+			}
+		}
+	}
+}
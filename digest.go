@@ -0,0 +1,191 @@
+/*
+	Copyright 2017 Daniel Nichter
+	Copyright 2014-2016 Percona LLC and/or its affiliates
+*/
+
+package slowlog
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+)
+
+// A ClassFunc returns the class ID and fingerprint of an event, e.g. using
+// go-mysql/query:
+//
+//	func(e Event) (string, string) {
+//	    f := query.Fingerprint(e.Query)
+//	    return query.Id(f), f
+//	}
+type ClassFunc func(Event) (id, fingerprint string)
+
+// DigestOptions are options for DigestFiles.
+type DigestOptions struct {
+	Options               // parser options; StartOffset, Source, Follow, and PoolEvents are ignored
+	Class       ClassFunc // required
+	Samples     bool      // save example queries
+	UTCOffset   time.Duration
+	OutlierTime float64
+	Cache       Storage  // cache the Result of each file, see DigestFiles
+	CacheKey    CacheKey // how to identify unchanged files in Cache
+}
+
+// DigestFiles parses and aggregates the slow log files in parallel and returns
+// the finalized Result. At most concurrency files are parsed at once, each by
+// a worker with its own Aggregator. The aggregators are merged when all files
+// are parsed. The first error stops all workers and is returned.
+//
+// If opt.Cache is set, the Result of each file is stored in the cache, keyed
+// by FileCacheKey, and files with a Result in the cache are not parsed, like
+// rotated files that were digested before. The Results of all files are
+// merged with MergeResults, so percentiles are approximate. The cache key
+// does not include the options, so use a different cache for different
+// options, like a DirStorage per ClassFunc.
+func DigestFiles(paths []string, concurrency int, opt DigestOptions) (Result, error) {
+	if opt.Class == nil {
+		return Result{}, errors.New("DigestOptions.Class is nil")
+	}
+	if concurrency < 1 {
+		concurrency = 1
+	}
+	if concurrency > len(paths) {
+		concurrency = len(paths)
+	}
+
+	pathChan := make(chan string, len(paths))
+	for _, path := range paths {
+		pathChan <- path
+	}
+	close(pathChan)
+
+	stopChan := make(chan struct{})
+	var stopOnce sync.Once
+	var firstErr error
+	fail := func(err error) {
+		stopOnce.Do(func() {
+			firstErr = err
+			close(stopChan)
+		})
+	}
+
+	aggs := make([]*Aggregator, concurrency)
+	results := make([]Result, 0, len(paths)) // if opt.Cache
+	var resultsMu sync.Mutex
+	var wg sync.WaitGroup
+	for i := range aggs {
+		aggs[i] = NewAggregator(opt.Samples, opt.UTCOffset, opt.OutlierTime)
+		wg.Add(1)
+		go func(a *Aggregator) {
+			defer wg.Done()
+			for path := range pathChan {
+				select {
+				case <-stopChan:
+					return
+				default:
+				}
+				if opt.Cache == nil {
+					if err := digestFile(path, a, opt, stopChan); err != nil {
+						fail(err)
+						return
+					}
+					continue
+				}
+				r, err := digestCachedFile(path, opt, stopChan)
+				if err != nil {
+					fail(err)
+					return
+				}
+				resultsMu.Lock()
+				results = append(results, r)
+				resultsMu.Unlock()
+			}
+		}(aggs[i])
+	}
+	wg.Wait()
+	if firstErr != nil {
+		return Result{}, firstErr
+	}
+	if opt.Cache != nil {
+		return MergeResults(results...), nil
+	}
+
+	if len(aggs) == 0 {
+		return NewAggregator(opt.Samples, opt.UTCOffset, opt.OutlierTime).Finalize(), nil
+	}
+	for _, a := range aggs[1:] {
+		aggs[0].Merge(a)
+	}
+	return aggs[0].Finalize(), nil
+}
+
+// digestCachedFile returns the Result of the file from opt.Cache, else it
+// digests the file and stores its Result in the cache.
+func digestCachedFile(path string, opt DigestOptions, stopChan chan struct{}) (Result, error) {
+	key, err := FileCacheKey(path, opt.CacheKey)
+	if err != nil {
+		return Result{}, err
+	}
+	r, err := opt.Cache.Get(key)
+	if err == nil {
+		if l := logger(opt.Options, LOG_DEBUG); l != nil {
+			l.Printf("%s: cached %s", path, key)
+		}
+		return r, nil
+	}
+	if err != ErrNotFound {
+		return Result{}, err
+	}
+	a := NewAggregator(opt.Samples, opt.UTCOffset, opt.OutlierTime)
+	if err := digestFile(path, a, opt, stopChan); err != nil {
+		return Result{}, err
+	}
+	select {
+	case <-stopChan:
+		return Result{}, nil // partial Result, not cached
+	default:
+	}
+	r = a.Finalize()
+	if err := opt.Cache.Put(key, r); err != nil {
+		return Result{}, err
+	}
+	return r, nil
+}
+
+func digestFile(path string, a *Aggregator, opt DigestOptions, stopChan chan struct{}) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	popt := opt.Options
+	popt.StartOffset = 0
+	popt.Source = ""
+	popt.Follow = false
+	popt.PoolEvents = false
+	p := NewFileParser(file)
+	if err := p.Start(popt); err != nil {
+		return err
+	}
+	defer p.Stop()
+
+	events := p.Events()
+	for {
+		select {
+		case e, ok := <-events:
+			if !ok {
+				if err := p.Error(); err != nil {
+					return fmt.Errorf("%s: %s", path, err)
+				}
+				return nil
+			}
+			id, fingerprint := opt.Class(e)
+			a.AddEvent(e, id, fingerprint)
+		case <-stopChan:
+			return nil
+		}
+	}
+}
@@ -0,0 +1,253 @@
+/*
+	Copyright 2017 Daniel Nichter
+	Copyright 2014-2016 Percona LLC and/or its affiliates
+*/
+
+package slowlog
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"time"
+)
+
+// NewDriver returns a database/sql driver that wraps d, like the MySQL driver
+// from github.com/go-sql-driver/mysql, and calls f with an Event for every
+// query that takes at least longQueryTime seconds, like the server slow log.
+// Query_time is measured by the client: for queries that return rows, from
+// the start of the query until the rows are closed. Exec queries have the
+// Rows_affected metric and other queries have the Rows_sent metric. Register
+// the driver with sql.Register, then use it with sql.Open. f must be safe to
+// call concurrently. Optional interfaces of the wrapped driver's rows, like
+// driver.RowsColumnTypeScanType, are not available.
+func NewDriver(d driver.Driver, longQueryTime float64, f func(Event)) driver.Driver {
+	return &slowDriver{
+		d:             d,
+		longQueryTime: longQueryTime,
+		f:             f,
+	}
+}
+
+type slowDriver struct {
+	d             driver.Driver
+	longQueryTime float64
+	f             func(Event)
+}
+
+func (d *slowDriver) Open(name string) (driver.Conn, error) {
+	c, err := d.d.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	return &slowConn{Conn: c, d: d}, nil
+}
+
+// event calls f with an Event for the query if it took long enough.
+func (d *slowDriver) event(query string, start time.Time, metric string, n uint64) {
+	t := time.Now().Sub(start).Seconds()
+	if t < d.longQueryTime {
+		return
+	}
+	e := NewEvent()
+	e.Ts = start.Format("060102 15:04:05")
+	e.Time = start
+	e.Query = query
+	e.TimeMetrics["Query_time"] = t
+	e.NumberMetrics[metric] = n
+	d.f(*e)
+}
+
+type slowConn struct {
+	driver.Conn
+	d *slowDriver
+}
+
+func (c *slowConn) Prepare(query string) (driver.Stmt, error) {
+	s, err := c.Conn.Prepare(query)
+	if err != nil {
+		return nil, err
+	}
+	return &slowStmt{Stmt: s, d: c.d, query: query}, nil
+}
+
+func (c *slowConn) PrepareContext(ctx context.Context, query string) (driver.Stmt, error) {
+	pc, ok := c.Conn.(driver.ConnPrepareContext)
+	if !ok {
+		return c.Prepare(query)
+	}
+	s, err := pc.PrepareContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	return &slowStmt{Stmt: s, d: c.d, query: query}, nil
+}
+
+func (c *slowConn) BeginTx(ctx context.Context, opts driver.TxOptions) (driver.Tx, error) {
+	if bc, ok := c.Conn.(driver.ConnBeginTx); ok {
+		return bc.BeginTx(ctx, opts)
+	}
+	return c.Conn.Begin()
+}
+
+func (c *slowConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	ec, ok := c.Conn.(driver.ExecerContext)
+	if !ok {
+		return nil, driver.ErrSkip // prepare and exec statement
+	}
+	start := time.Now()
+	res, err := ec.ExecContext(ctx, query, args)
+	if err != nil {
+		return nil, err
+	}
+	c.d.event(query, start, "Rows_affected", rowsAffected(res))
+	return res, nil
+}
+
+func (c *slowConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	qc, ok := c.Conn.(driver.QueryerContext)
+	if !ok {
+		return nil, driver.ErrSkip // prepare and query statement
+	}
+	start := time.Now()
+	rows, err := qc.QueryContext(ctx, query, args)
+	if err != nil {
+		return nil, err
+	}
+	return &slowRows{Rows: rows, d: c.d, query: query, start: start}, nil
+}
+
+func (c *slowConn) Ping(ctx context.Context) error {
+	if p, ok := c.Conn.(driver.Pinger); ok {
+		return p.Ping(ctx)
+	}
+	return nil
+}
+
+func (c *slowConn) ResetSession(ctx context.Context) error {
+	if r, ok := c.Conn.(driver.SessionResetter); ok {
+		return r.ResetSession(ctx)
+	}
+	return nil
+}
+
+func (c *slowConn) CheckNamedValue(v *driver.NamedValue) error {
+	if nc, ok := c.Conn.(driver.NamedValueChecker); ok {
+		return nc.CheckNamedValue(v)
+	}
+	return driver.ErrSkip // default conversion
+}
+
+type slowStmt struct {
+	driver.Stmt
+	d     *slowDriver
+	query string
+}
+
+func (s *slowStmt) Exec(args []driver.Value) (driver.Result, error) {
+	start := time.Now()
+	res, err := s.Stmt.Exec(args)
+	if err != nil {
+		return nil, err
+	}
+	s.d.event(s.query, start, "Rows_affected", rowsAffected(res))
+	return res, nil
+}
+
+func (s *slowStmt) Query(args []driver.Value) (driver.Rows, error) {
+	start := time.Now()
+	rows, err := s.Stmt.Query(args)
+	if err != nil {
+		return nil, err
+	}
+	return &slowRows{Rows: rows, d: s.d, query: s.query, start: start}, nil
+}
+
+func (s *slowStmt) ExecContext(ctx context.Context, args []driver.NamedValue) (driver.Result, error) {
+	ec, ok := s.Stmt.(driver.StmtExecContext)
+	if !ok {
+		vals, err := values(args)
+		if err != nil {
+			return nil, err
+		}
+		return s.Exec(vals)
+	}
+	start := time.Now()
+	res, err := ec.ExecContext(ctx, args)
+	if err != nil {
+		return nil, err
+	}
+	s.d.event(s.query, start, "Rows_affected", rowsAffected(res))
+	return res, nil
+}
+
+func (s *slowStmt) QueryContext(ctx context.Context, args []driver.NamedValue) (driver.Rows, error) {
+	qc, ok := s.Stmt.(driver.StmtQueryContext)
+	if !ok {
+		vals, err := values(args)
+		if err != nil {
+			return nil, err
+		}
+		return s.Query(vals)
+	}
+	start := time.Now()
+	rows, err := qc.QueryContext(ctx, args)
+	if err != nil {
+		return nil, err
+	}
+	return &slowRows{Rows: rows, d: s.d, query: s.query, start: start}, nil
+}
+
+func (s *slowStmt) CheckNamedValue(v *driver.NamedValue) error {
+	if nc, ok := s.Stmt.(driver.NamedValueChecker); ok {
+		return nc.CheckNamedValue(v)
+	}
+	return driver.ErrSkip // default conversion
+}
+
+type slowRows struct {
+	driver.Rows
+	d      *slowDriver
+	query  string
+	start  time.Time
+	n      uint64
+	closed bool
+}
+
+func (r *slowRows) Next(dest []driver.Value) error {
+	err := r.Rows.Next(dest)
+	if err == nil {
+		r.n++
+	}
+	return err
+}
+
+func (r *slowRows) Close() error {
+	err := r.Rows.Close()
+	if !r.closed {
+		r.closed = true
+		r.d.event(r.query, r.start, "Rows_sent", r.n)
+	}
+	return err
+}
+
+func rowsAffected(res driver.Result) uint64 {
+	n, err := res.RowsAffected()
+	if err != nil || n < 0 {
+		return 0
+	}
+	return uint64(n)
+}
+
+// values returns the ordinal values of args for drivers without context
+// support, which don't support named args.
+func values(args []driver.NamedValue) ([]driver.Value, error) {
+	vals := make([]driver.Value, len(args))
+	for i, arg := range args {
+		if arg.Name != "" {
+			return nil, errors.New("driver does not support named args")
+		}
+		vals[i] = arg.Value
+	}
+	return vals, nil
+}
@@ -0,0 +1,101 @@
+/*
+	Copyright 2017 Daniel Nichter
+	Copyright 2014-2016 Percona LLC and/or its affiliates
+*/
+
+package slowlog_test
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"io"
+	"sync"
+	"testing"
+
+	"github.com/go-mysql/slowlog"
+	"github.com/go-test/deep"
+)
+
+// fakeDriver returns 2 rows for every query and 3 rows affected for every exec.
+type fakeDriver struct{}
+
+func (fakeDriver) Open(name string) (driver.Conn, error) { return fakeConn{}, nil }
+
+type fakeConn struct{}
+
+func (fakeConn) Prepare(query string) (driver.Stmt, error) { return fakeStmt{}, nil }
+func (fakeConn) Close() error                              { return nil }
+func (fakeConn) Begin() (driver.Tx, error)                 { return nil, driver.ErrSkip }
+
+type fakeStmt struct{}
+
+func (fakeStmt) Close() error  { return nil }
+func (fakeStmt) NumInput() int { return -1 }
+func (fakeStmt) Exec(args []driver.Value) (driver.Result, error) {
+	return driver.RowsAffected(3), nil
+}
+func (fakeStmt) Query(args []driver.Value) (driver.Rows, error) {
+	return &fakeRows{}, nil
+}
+
+type fakeRows struct{ n int }
+
+func (r *fakeRows) Columns() []string { return []string{"a"} }
+func (r *fakeRows) Close() error      { return nil }
+func (r *fakeRows) Next(dest []driver.Value) error {
+	if r.n == 2 {
+		return io.EOF
+	}
+	r.n++
+	dest[0] = int64(r.n)
+	return nil
+}
+
+func TestNewDriver(t *testing.T) {
+	var mu sync.Mutex
+	events := []slowlog.Event{}
+	sql.Register("slowlog-test", slowlog.NewDriver(fakeDriver{}, 0, func(e slowlog.Event) {
+		mu.Lock()
+		events = append(events, e)
+		mu.Unlock()
+	}))
+	db, err := sql.Open("slowlog-test", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	if _, err := db.Exec("update t set a = ?", 1); err != nil {
+		t.Fatal(err)
+	}
+	rows, err := db.Query("select a from t where b = ?", 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for rows.Next() {
+	}
+	rows.Close()
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(events) != 2 {
+		t.Fatalf("got %d events, expected 2", len(events))
+	}
+	got := []interface{}{}
+	for _, e := range events {
+		if _, ok := e.TimeMetrics["Query_time"]; !ok {
+			t.Errorf("no Query_time: %+v", e)
+		}
+		if e.Time.IsZero() {
+			t.Errorf("no Time: %+v", e)
+		}
+		got = append(got, e.Query, e.NumberMetrics)
+	}
+	expect := []interface{}{
+		"update t set a = ?", map[string]uint64{"Rows_affected": 3},
+		"select a from t where b = ?", map[string]uint64{"Rows_sent": 2},
+	}
+	if diff := deep.Equal(got, expect); diff != nil {
+		t.Error(diff)
+	}
+}
@@ -0,0 +1,104 @@
+/*
+	Copyright 2017 Daniel Nichter
+	Copyright 2014-2016 Percona LLC and/or its affiliates
+*/
+
+package slowlog
+
+import (
+	"encoding/json"
+	"io"
+	"strings"
+	"time"
+)
+
+// NewErrorLogParser returns a LineParser for the MySQL JSON error log
+// (log_sink_json) that sends the records which are slow queries. A record is
+// a slow query if it has a query and Query_time, either as fields (query,
+// query_time, and optionally lock_time, rows_sent, rows_examined, user, host,
+// and db), or in msg as slow log text: "# User@Host" and "# Query_time"
+// lines followed by the query. Other records are ignored. Event.Time is the
+// time of the record, and the thread field is the Thread_id metric.
+func NewErrorLogParser(r io.Reader) *LineParser {
+	return newLineParser(r, decodeErrorLog)
+}
+
+func decodeErrorLog(line []byte, opt Options) (*Event, error) {
+	var rec map[string]interface{}
+	if err := json.Unmarshal(line, &rec); err != nil {
+		return nil, err
+	}
+	str := func(key string) string {
+		s, _ := rec[key].(string)
+		return s
+	}
+	num := func(key string) (float64, bool) {
+		n, ok := rec[key].(float64)
+		return n, ok
+	}
+
+	e := NewEvent()
+	if qt, ok := num("query_time"); ok && str("query") != "" {
+		e.Query = str("query")
+		e.User = str("user")
+		e.Host = str("host")
+		e.Db = str("db")
+		e.TimeMetrics["Query_time"] = qt
+		if lt, ok := num("lock_time"); ok {
+			e.TimeMetrics["Lock_time"] = lt
+		}
+		if n, ok := num("rows_sent"); ok {
+			e.NumberMetrics["Rows_sent"] = uint64(n)
+		}
+		if n, ok := num("rows_examined"); ok {
+			e.NumberMetrics["Rows_examined"] = uint64(n)
+		}
+	} else if !parseSlowLogText(e, str("msg")) {
+		return nil, nil
+	}
+
+	e.Ts = str("time")
+	if t, err := time.Parse(time.RFC3339Nano, e.Ts); err == nil {
+		e.Time = t.In(opt.Location)
+	}
+	if n, ok := num("thread"); ok && n > 0 {
+		e.NumberMetrics["Thread_id"] = uint64(n)
+		e.ThreadId = uint64(n)
+	}
+	return e, nil
+}
+
+// parseSlowLogText parses the header and query of one slow log event in
+// text into e. It returns false if text has no Query_time or query.
+func parseSlowLogText(e *Event, text string) bool {
+	query := []string{}
+	for _, line := range strings.Split(strings.TrimSpace(text), "\n") {
+		if !isHeader(line) {
+			query = append(query, line)
+			continue
+		}
+		if strings.HasPrefix(line, "# User") {
+			if user, host, ok := scanUserHost(line); ok {
+				e.User = user
+				e.Host = host
+			}
+			continue
+		}
+		if strings.HasPrefix(line, "# Time") {
+			continue
+		}
+		scanMetrics(line, func(name, val string) {
+			setMetric(e, name, val)
+		})
+	}
+	if len(query) > 0 {
+		if useRe.MatchString(query[0]) && len(query) > 1 {
+			db := strings.TrimPrefix(query[0], useRe.FindString(query[0]))
+			e.Db = strings.Trim(strings.TrimRight(db, ";"), "`")
+			query = query[1:]
+		}
+		e.Query = strings.TrimSuffix(strings.Join(query, "\n"), ";")
+	}
+	_, ok := e.TimeMetrics["Query_time"]
+	return ok && e.Query != ""
+}
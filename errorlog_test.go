@@ -0,0 +1,74 @@
+/*
+	Copyright 2017 Daniel Nichter
+	Copyright 2014-2016 Percona LLC and/or its affiliates
+*/
+
+package slowlog_test
+
+import (
+	"os"
+	"path"
+	"testing"
+	"time"
+
+	"github.com/go-mysql/slowlog"
+	"github.com/go-test/deep"
+)
+
+func TestErrorLogParser(t *testing.T) {
+	file, err := os.Open(path.Join("test", "proxy-logs", "error.log.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	got := parseLineLog(t, slowlog.NewErrorLogParser(file), slowlog.Options{Source: "db1"})
+	expect := []slowlog.Event{
+		{
+			Offset:    342,
+			EndOffset: 675,
+			Source:    "db1",
+			Ts:        "2021-03-01T10:00:05.500000Z",
+			Time:      time.Date(2021, 3, 1, 10, 0, 5, 500000000, time.UTC),
+			Query:     "SELECT * FROM orders WHERE total > 100",
+			User:      "app",
+			Host:      "db1",
+			Db:        "shop",
+			TimeMetrics: map[string]float64{
+				"Query_time": 2.5,
+				"Lock_time":  0.25,
+			},
+			ThreadId: 12,
+			NumberMetrics: map[string]uint64{
+				"Rows_sent":     1,
+				"Rows_examined": 5000,
+				"Thread_id":     12,
+			},
+			BoolMetrics: map[string]bool{},
+		},
+		{
+			Offset:    675,
+			EndOffset: 1029,
+			Source:    "db1",
+			Ts:        "2021-03-01T10:00:06.000000Z",
+			Time:      time.Date(2021, 3, 1, 10, 0, 6, 0, time.UTC),
+			Query:     "UPDATE stock SET n = n - 1 WHERE id = 7",
+			User:      "app",
+			Host:      "10.0.0.8",
+			Db:        "shop",
+			TimeMetrics: map[string]float64{
+				"Query_time": 1.5,
+				"Lock_time":  0.5,
+			},
+			ThreadId: 13,
+			NumberMetrics: map[string]uint64{
+				"Rows_sent":     0,
+				"Rows_examined": 1,
+				"Thread_id":     13,
+			},
+			BoolMetrics: map[string]bool{},
+		},
+	}
+	if diff := deep.Equal(got, expect); diff != nil {
+		t.Error(diff)
+	}
+}
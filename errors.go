@@ -0,0 +1,43 @@
+/*
+	Copyright 2017 Daniel Nichter
+	Copyright 2014-2016 Percona LLC and/or its affiliates
+*/
+
+package slowlog
+
+import (
+	"errors"
+	"fmt"
+)
+
+// ERRORS_BUFFER is the size of the ReaderParser.Errors channel buffer.
+const ERRORS_BUFFER = 100
+
+// Non-fatal parse errors, the ParseError.Err of errors sent to
+// ReaderParser.Errors, and the Stats counter of each. An invalid Ts is sent
+// with the error parsing it.
+var (
+	ErrRunawayHeader = errors.New("runaway header")                           // Stats.RunawayHeaders
+	ErrUnclosedQuote = errors.New("unclosed quote")                           // Stats.UnclosedQuotes
+	ErrNoQueryTime   = errors.New("no Query_time")                            // Stats.Dropped
+	ErrOutOfBounds   = errors.New("metric value out of Options.MetricBounds") // Stats.RejectedEvents
+)
+
+// A ParseError is where and why parsing failed or an event was dropped.
+// Errors about an event, like ErrNoQueryTime, are at the first line of the
+// event and have no Text.
+type ParseError struct {
+	Offset uint64 // byte offset of the line
+	Line   uint64 // line number, counting from Options.StartOffset
+	Text   string // the line, truncated to 1 KiB
+	Err    error
+}
+
+func (e *ParseError) Error() string {
+	return fmt.Sprintf("line %d at offset %d: %s", e.Line, e.Offset, e.Err)
+}
+
+// Unwrap returns Err.
+func (e *ParseError) Unwrap() error {
+	return e.Err
+}
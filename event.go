@@ -5,6 +5,11 @@
 
 package slowlog
 
+import (
+	"sync"
+	"time"
+)
+
 // An Event is a query like "SELECT col FROM t WHERE id = 1", some metrics like
 // Query_time (slow log) or SUM_TIMER_WAIT (Performance Schema), and other
 // metadata like default database, timestamp, etc. Metrics and metadata are not
@@ -12,18 +17,40 @@ package slowlog
 // event is expected to define the query and Query_time metric. Other metrics
 // and metadata vary according to MySQL version, distro, and configuration.
 type Event struct {
-	Offset        uint64 // byte offset in file at which event starts
-	Ts            string // raw timestamp of event
-	Admin         bool   // true if Query is admin command
-	Query         string // SQL query or admin command
-	User          string
-	Host          string
-	Db            string
-	TimeMetrics   map[string]float64 // *_time and *_wait metrics
-	NumberMetrics map[string]uint64  // most metrics
-	BoolMetrics   map[string]bool    // yes/no metrics
-	RateType      string             // Percona Server rate limit type
-	RateLimit     uint               // Percona Server rate limit value
+	Offset          uint64    // byte offset in file at which event starts
+	EndOffset       uint64    // byte offset in file after event: Options.StartOffset to resume parsing after it
+	Source          string    // where event came from, e.g. file name or instance
+	Ts              string    // raw timestamp of event
+	Time            time.Time // Ts parsed, in Options.Location if Ts has no time zone; zero if no Ts
+	TimeAmbiguous   bool      // Ts is ambiguous or invalid due to DST; see Options.DST
+	StartTs         string    // raw Start timestamp (MySQL 8.0 log_slow_extra)
+	EndTs           string    // raw End timestamp (MySQL 8.0 log_slow_extra)
+	Admin           bool      // true if Query is admin command
+	Query           string    // SQL query or admin command
+	Truncated       bool      // Query truncated to Options.MaxQueryBytes
+	User            string
+	Host            string
+	Db              string
+	ThreadId        uint64             // Thread_id metric, also in NumberMetrics; 0 if not logged
+	Killed          uint64             // Killed metric, also in NumberMetrics: error code if killed, else 0
+	LastErrno       uint64             // Last_errno metric, also in NumberMetrics: statement error code, else 0
+	TimeMetrics     map[string]float64 // *_time and *_wait metrics
+	NumberMetrics   map[string]uint64  // most metrics
+	BoolMetrics     map[string]bool    // yes/no metrics
+	RateType        string             // Percona Server rate limit type, or "sample" if sampled by Options.SampleRate or EveryNth
+	RateLimit       uint               // Percona Server rate limit value, times the Options.SampleRate and EveryNth factor
+	Params          []Param            // literal values in Query if Options.ExtractParams
+	Extra           map[string]string  // header fields that are not metrics, like InnoDB_trx_id; nil if none
+	FromReplication bool               // applied by a replica SQL thread: User is REPLICATION_USERS
+	Explain         []ExplainRow       // from "# explain:" lines (MariaDB, Percona Server); nil if none
+	SlowExtra       *SlowExtra         // MySQL 8.0 log_slow_extra fields; nil if not logged
+}
+
+// REPLICATION_USERS are the Event.User of statements applied by a replica SQL
+// thread, not by a client.
+var REPLICATION_USERS = map[string]bool{
+	"[SQL_SLAVE]":   true,
+	"[SQL_REPLICA]": true,
 }
 
 // NewEvent returns a new Event with initialized metric maps.
@@ -34,3 +61,37 @@ func NewEvent() *Event {
 		BoolMetrics:   map[string]bool{},
 	}
 }
+
+// eventPool are events released by Release, reused by parsers with
+// Options.PoolEvents.
+var eventPool = sync.Pool{
+	New: func() interface{} { return NewEvent() },
+}
+
+// getEvent returns an empty event from the pool.
+func getEvent() *Event {
+	return eventPool.Get().(*Event)
+}
+
+// Release resets the event and returns it to the pool of events, to be reused
+// by a parser with Options.PoolEvents. Release events from
+// ReaderParser.PooledEvents when done with them. The event, including its
+// maps, must not be used after it is released; copy values to keep them.
+func (e *Event) Release() {
+	tm, nm, bm := e.TimeMetrics, e.NumberMetrics, e.BoolMetrics
+	for k := range tm {
+		delete(tm, k)
+	}
+	for k := range nm {
+		delete(nm, k)
+	}
+	for k := range bm {
+		delete(bm, k)
+	}
+	*e = Event{
+		TimeMetrics:   tm,
+		NumberMetrics: nm,
+		BoolMetrics:   bm,
+	}
+	eventPool.Put(e)
+}
@@ -0,0 +1,205 @@
+/*
+	Copyright 2017 Daniel Nichter
+	Copyright 2014-2016 Percona LLC and/or its affiliates
+*/
+
+package slowlog
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// An ExplainRow is one row of EXPLAIN output logged with the query by MariaDB
+// or Percona Server log_slow_verbosity=explain, or returned by Explain. Columns are all columns by
+// name, including those not in other fields, like filtered or, for MariaDB
+// ANALYZE, r_rows. NULL values are empty.
+type ExplainRow struct {
+	Table   string
+	Type    string // access type, like ALL (full table scan) or ref
+	Key     string // index used
+	Rows    uint64 // estimated rows examined
+	Extra   string
+	Columns map[string]string
+}
+
+// parseExplain parses "# explain:" lines, without the prefix, separated by
+// newlines: a header line of column names, then one line per row. Columns
+// are separated by tabs. If the header has no tabs, columns are separated by
+// spaces and the last column gets the rest of the line, because Extra has
+// spaces.
+func parseExplain(lines string) []ExplainRow {
+	all := strings.Split(lines, "\n")
+	if len(all) < 2 {
+		return nil
+	}
+	split := func(line string, n int) []string {
+		if strings.Contains(all[0], "\t") {
+			return strings.Split(line, "\t")
+		}
+		fields := strings.Fields(line)
+		if n > 0 && len(fields) > n {
+			last := strings.Join(fields[n-1:], " ")
+			fields = append(fields[0:n-1], last)
+		}
+		return fields
+	}
+	header := split(all[0], 0)
+	rows := []ExplainRow{}
+	for _, line := range all[1:] {
+		vals := split(line, len(header))
+		for i := range vals {
+			if vals[i] == "NULL" {
+				vals[i] = ""
+			}
+		}
+		rows = append(rows, newExplainRow(header, vals))
+	}
+	return rows
+}
+
+// newExplainRow returns the row of EXPLAIN output with the column names and
+// values. NULL values must be empty.
+func newExplainRow(header, vals []string) ExplainRow {
+	row := ExplainRow{Columns: map[string]string{}}
+	for i, name := range header {
+		val := ""
+		if i < len(vals) {
+			val = strings.TrimSpace(vals[i])
+		}
+		row.Columns[name] = val
+		switch name {
+		case "table":
+			row.Table = val
+		case "type":
+			row.Type = val
+		case "key":
+			row.Key = val
+		case "rows":
+			row.Rows, _ = strconv.ParseUint(val, 10, 64)
+		case "Extra":
+			row.Extra = val
+		}
+	}
+	return row
+}
+
+// A Querier runs queries, like *sql.Conn. Explain uses the same connection
+// for USE and EXPLAIN, so use a *sql.Conn, not a *sql.DB, if events have a Db.
+type Querier interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+}
+
+// Explain returns the EXPLAIN output of the query of the event, using the
+// Db of the event if set. EXPLAIN does not execute the query, so it does not
+// change data, even for an UPDATE or DELETE, and it can be run on a replica
+// or a copy of the server to dry-run the queries of a slow log.
+func Explain(ctx context.Context, q Querier, e Event) ([]ExplainRow, error) {
+	if e.Admin {
+		return nil, fmt.Errorf("cannot EXPLAIN admin command %s", e.Query)
+	}
+	if e.Db != "" {
+		if _, err := q.ExecContext(ctx, "USE `"+strings.Replace(e.Db, "`", "``", -1)+"`"); err != nil {
+			return nil, err
+		}
+	}
+	rows, err := q.QueryContext(ctx, "EXPLAIN "+e.Query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	header, err := rows.Columns()
+	if err != nil {
+		return nil, err
+	}
+	explain := []ExplainRow{}
+	for rows.Next() {
+		raw := make([]sql.NullString, len(header))
+		dest := make([]interface{}, len(header))
+		for i := range raw {
+			dest[i] = &raw[i]
+		}
+		if err := rows.Scan(dest...); err != nil {
+			return nil, err
+		}
+		vals := make([]string, len(header))
+		for i := range raw {
+			vals[i] = raw[i].String // empty if NULL
+		}
+		explain = append(explain, newExplainRow(header, vals))
+	}
+	return explain, rows.Err()
+}
+
+// A PlanEstimate compares the rows the optimizer estimates a class examines
+// with the rows it examined, see ExplainClasses. A large difference means the
+// optimizer is wrong, usually because index statistics are stale.
+type PlanEstimate struct {
+	Id            string
+	Fingerprint   string
+	Explain       []ExplainRow `json:",omitempty"`
+	EstimatedRows uint64       // product of Explain Rows, the estimate for a join
+	ActualRows    uint64       // Rows_examined Avg of the class
+	Error         string       `json:",omitempty"` // if EXPLAIN failed
+}
+
+// ExplainClasses runs Explain for the Example of each class in the finalized
+// Result, which requires an Aggregator that samples, and returns the plan
+// estimates sorted by class ID. Classes without an Example are skipped.
+// EXPLAIN errors are set in PlanEstimate.Error, but if ctx is done, it
+// returns the estimates so far and the error of ctx.
+func ExplainClasses(ctx context.Context, q Querier, r Result) ([]PlanEstimate, error) {
+	ids := make([]string, 0, len(r.Class))
+	for id := range r.Class {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	estimates := []PlanEstimate{}
+	for _, id := range ids {
+		class := r.Class[id]
+		if class.Example == nil || class.Example.Query == "" {
+			continue
+		}
+		if err := ctx.Err(); err != nil {
+			return estimates, err
+		}
+		est := PlanEstimate{
+			Id:          class.Id,
+			Fingerprint: class.Fingerprint,
+		}
+		if s, ok := class.Metrics.NumberMetrics["Rows_examined"]; ok {
+			est.ActualRows = s.Avg
+		}
+		e := Event{Db: class.Example.Db, Query: class.Example.Query}
+		explain, err := Explain(ctx, q, e)
+		if err != nil {
+			est.Error = err.Error()
+		} else {
+			est.Explain = explain
+			est.EstimatedRows = estimatedRows(explain)
+		}
+		estimates = append(estimates, est)
+	}
+	return estimates, nil
+}
+
+// estimatedRows returns the product of the rows of the EXPLAIN output, not
+// counting rows without an estimate, like a derived table, or 0 if none.
+func estimatedRows(explain []ExplainRow) uint64 {
+	n := uint64(0)
+	for _, row := range explain {
+		if row.Rows == 0 {
+			continue
+		}
+		if n == 0 {
+			n = 1
+		}
+		n *= row.Rows
+	}
+	return n
+}
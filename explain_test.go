@@ -0,0 +1,137 @@
+/*
+	Copyright 2017 Daniel Nichter
+	Copyright 2014-2016 Percona LLC and/or its affiliates
+*/
+
+package slowlog_test
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"io"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/go-mysql/slowlog"
+	"github.com/go-test/deep"
+)
+
+// explainDriver returns the same EXPLAIN output for every EXPLAIN, an error
+// for EXPLAIN of a query on table bad, and records the queries.
+type explainDriver struct {
+	mu      sync.Mutex
+	queries []string
+}
+
+func (d *explainDriver) Open(name string) (driver.Conn, error) { return explainConn{d}, nil }
+
+type explainConn struct{ d *explainDriver }
+
+func (c explainConn) Prepare(query string) (driver.Stmt, error) {
+	c.d.mu.Lock()
+	c.d.queries = append(c.d.queries, query)
+	c.d.mu.Unlock()
+	if strings.Contains(query, " bad") {
+		return nil, io.ErrUnexpectedEOF
+	}
+	return explainStmt{}, nil
+}
+func (explainConn) Close() error              { return nil }
+func (explainConn) Begin() (driver.Tx, error) { return nil, driver.ErrSkip }
+
+type explainStmt struct{}
+
+func (explainStmt) Close() error  { return nil }
+func (explainStmt) NumInput() int { return -1 }
+func (explainStmt) Exec(args []driver.Value) (driver.Result, error) {
+	return driver.RowsAffected(0), nil
+}
+func (explainStmt) Query(args []driver.Value) (driver.Rows, error) {
+	return &explainRows{}, nil
+}
+
+type explainRows struct{ n int }
+
+var explainOutput = [][]driver.Value{
+	{int64(1), "SIMPLE", "t1", "ALL", nil, int64(1000), "Using where"},
+	{int64(1), "SIMPLE", "t2", "ref", "idx_a", int64(5), nil},
+}
+
+func (r *explainRows) Columns() []string {
+	return []string{"id", "select_type", "table", "type", "key", "rows", "Extra"}
+}
+func (r *explainRows) Close() error { return nil }
+func (r *explainRows) Next(dest []driver.Value) error {
+	if r.n == len(explainOutput) {
+		return io.EOF
+	}
+	copy(dest, explainOutput[r.n])
+	r.n++
+	return nil
+}
+
+func TestExplainClasses(t *testing.T) {
+	d := &explainDriver{}
+	sql.Register("slowlog-explain-test", d)
+	db, err := sql.Open("slowlog-explain-test", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	db.SetMaxOpenConns(1)
+	conn, err := db.Conn(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	a := slowlog.NewAggregator(true, 0, 0)
+	add := func(id, query string, rows uint64) {
+		e := slowlog.NewEvent()
+		e.Db = "shop"
+		e.Query = query
+		e.TimeMetrics["Query_time"] = 1
+		e.NumberMetrics["Rows_examined"] = rows
+		a.AddEvent(*e, id, query)
+	}
+	add("1", "select * from t1 join t2 using (a)", 4000)
+	add("1", "select * from t1 join t2 using (a)", 6000)
+	add("2", "delete from bad where id = 1", 1)
+	got, err := slowlog.ExplainClasses(context.Background(), conn, a.Finalize())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 2 {
+		t.Fatalf("got %d estimates, expected 2", len(got))
+	}
+	if got[0].EstimatedRows != 5000 || got[0].ActualRows != 5000 || got[0].Error != "" {
+		t.Errorf("got estimate %+v, expected 5000 rows estimated and actual", got[0])
+	}
+	expect := []slowlog.ExplainRow{
+		{
+			Table: "t1", Type: "ALL", Rows: 1000, Extra: "Using where",
+			Columns: map[string]string{"id": "1", "select_type": "SIMPLE", "table": "t1", "type": "ALL", "key": "", "rows": "1000", "Extra": "Using where"},
+		},
+		{
+			Table: "t2", Type: "ref", Key: "idx_a", Rows: 5,
+			Columns: map[string]string{"id": "1", "select_type": "SIMPLE", "table": "t2", "type": "ref", "key": "idx_a", "rows": "5", "Extra": ""},
+		},
+	}
+	if diff := deep.Equal(got[0].Explain, expect); diff != nil {
+		t.Error(diff)
+	}
+	if got[1].Error == "" || got[1].Explain != nil {
+		t.Errorf("got estimate %+v, expected an error", got[1])
+	}
+
+	// USE the db, then EXPLAIN, never the query itself.
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	for _, q := range d.queries {
+		if !strings.HasPrefix(q, "USE `shop`") && !strings.HasPrefix(q, "EXPLAIN ") {
+			t.Errorf("ran query %q", q)
+		}
+	}
+}
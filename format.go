@@ -0,0 +1,171 @@
+/*
+	Copyright 2017 Daniel Nichter
+	Copyright 2014-2016 Percona LLC and/or its affiliates
+*/
+
+package slowlog
+
+import (
+	"strings"
+)
+
+// Keywords that begin a new line in FormatQuery.
+var clauseKeywords = map[string]bool{
+	"SELECT": true,
+	"FROM":   true,
+	"WHERE":  true,
+	"GROUP":  true,
+	"ORDER":  true,
+	"HAVING": true,
+	"LIMIT":  true,
+	"UNION":  true,
+	"SET":    true,
+	"VALUES": true,
+	"VALUE":  true,
+	"ON":     true, // only ON DUPLICATE KEY UPDATE, see below
+	"JOIN":   true,
+}
+
+// Keywords that can come before JOIN, like "LEFT OUTER JOIN".
+var joinKeywords = map[string]bool{
+	"LEFT":          true,
+	"RIGHT":         true,
+	"INNER":         true,
+	"CROSS":         true,
+	"OUTER":         true,
+	"NATURAL":       true,
+	"STRAIGHT_JOIN": true,
+}
+
+// FormatQuery returns the query formatted for reading: whitespace is collapsed
+// and major clauses (FROM, WHERE, JOIN, etc.) and WHERE conditions begin new
+// lines, indented by subquery depth. Strings, quoted identifiers, and comments
+// are not changed. The formatting is only cosmetic; the query is not parsed.
+func FormatQuery(query string) string {
+	tokens := tokenize(query)
+	var out strings.Builder
+	depth := 0
+	clause := ""        // current clause keyword, like WHERE
+	between := false    // in BETWEEN, so next AND is not a condition
+	joinPrefix := false // previous word is LEFT, OUTER, etc.
+	space := false      // need a space before next token
+	bol := true         // at beginning of line
+	newline := func() {
+		out.WriteString("\n")
+		out.WriteString(strings.Repeat("  ", depth))
+		space = false
+		bol = true
+	}
+	for i, t := range tokens {
+		if t == " " {
+			space = !bol
+			continue
+		}
+		word := strings.ToUpper(t)
+		brk := false
+		switch {
+		case word == "ON":
+			brk = nextWord(tokens, i) == "DUPLICATE"
+		case word == "JOIN":
+			brk = !joinPrefix
+		case joinKeywords[word]:
+			if !joinPrefix {
+				next := nextWord(tokens, i)
+				brk = next == "JOIN" || joinKeywords[next]
+			}
+		case word == "AND" || word == "OR":
+			if between && word == "AND" {
+				between = false
+			} else {
+				brk = clause == "WHERE" || clause == "HAVING"
+			}
+		case word == "BETWEEN":
+			between = true
+		case clauseKeywords[word]:
+			// Not a function like VALUES(col).
+			brk = i+1 == len(tokens) || tokens[i+1] != "("
+		}
+		joinPrefix = joinKeywords[word]
+		if clauseKeywords[word] {
+			clause = word
+		}
+
+		if brk && !bol {
+			newline()
+		}
+		if brk {
+			if word == "AND" || word == "OR" {
+				out.WriteString("  ")
+			}
+		} else if space {
+			out.WriteString(" ")
+		}
+		space = false
+		bol = false
+		out.WriteString(t)
+
+		// A line comment ends at the end of the line.
+		if t[0] == '#' || strings.HasPrefix(t, "--") {
+			newline()
+			continue
+		}
+
+		switch t {
+		case "(":
+			depth++
+		case ")":
+			if depth > 0 {
+				depth--
+			}
+		}
+	}
+	return out.String()
+}
+
+// nextWord returns the uppercase next word token after tokens[i], if any.
+func nextWord(tokens []string, i int) string {
+	for _, t := range tokens[i+1:] {
+		if t != " " {
+			return strings.ToUpper(t)
+		}
+	}
+	return ""
+}
+
+// tokenize splits the query into words, quoted strings and identifiers,
+// comments, and single punctuation chars. Runs of whitespace become " ".
+func tokenize(query string) []string {
+	tokens := []string{}
+	for i := 0; i < len(query); {
+		c := query[i]
+		n := 1
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			for i+n < len(query) && strings.IndexByte(" \t\n\r", query[i+n]) > -1 {
+				n++
+			}
+			tokens = append(tokens, " ")
+			i += n
+			continue
+		case c == '\'' || c == '"' || c == '`':
+			_, n = quoted(query[i:])
+		case c == '#' || (c == '-' && strings.HasPrefix(query[i:], "-- ")):
+			n = strings.IndexByte(query[i:], '\n')
+			if n < 0 {
+				n = len(query) - i
+			}
+		case c == '/' && strings.HasPrefix(query[i:], "/*"):
+			n = strings.Index(query[i+2:], "*/") + 4
+			if n < 4 {
+				n = len(query) - i
+			}
+		case isWordChar(c):
+			for i+n < len(query) && (isWordChar(query[i+n]) || query[i+n] == '.') {
+				n++
+			}
+		}
+		tokens = append(tokens, query[i:i+n])
+		i += n
+	}
+	return tokens
+}
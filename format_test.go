@@ -0,0 +1,56 @@
+/*
+	Copyright 2017 Daniel Nichter
+	Copyright 2014-2016 Percona LLC and/or its affiliates
+*/
+
+package slowlog_test
+
+import (
+	"testing"
+
+	"github.com/go-mysql/slowlog"
+)
+
+func TestFormatQuery(t *testing.T) {
+	tests := []struct {
+		query  string
+		expect string
+	}{
+		{
+			query:  "select 1",
+			expect: "select 1",
+		},
+		{
+			query: "SELECT a.c, b.c FROM a LEFT OUTER JOIN b ON a.id=b.id   WHERE a.x = 'FROM  x' AND a.y BETWEEN 1 AND 2 OR b.z IN (SELECT z FROM c WHERE d = 1) ORDER BY a.c LIMIT 10",
+			expect: `SELECT a.c, b.c
+FROM a
+LEFT OUTER JOIN b ON a.id=b.id
+WHERE a.x = 'FROM  x'
+  AND a.y BETWEEN 1 AND 2
+  OR b.z IN (
+  SELECT z
+  FROM c
+  WHERE d = 1)
+ORDER BY a.c
+LIMIT 10`,
+		},
+		{
+			query: "insert into t (a, b) values (1, 2) on duplicate key update b = values(b)",
+			expect: `insert into t (a, b)
+values (1, 2)
+on duplicate key update b = values(b)`,
+		},
+		{
+			query: "update t # comment\nset a = 1 where id = 2",
+			expect: `update t # comment
+set a = 1
+where id = 2`,
+		},
+	}
+	for _, test := range tests {
+		got := slowlog.FormatQuery(test.query)
+		if got != test.expect {
+			t.Errorf("got:\n%s\nexpected:\n%s", got, test.expect)
+		}
+	}
+}
@@ -0,0 +1,115 @@
+/*
+	Copyright 2017 Daniel Nichter
+	Copyright 2014-2016 Percona LLC and/or its affiliates
+*/
+
+package slowlog
+
+import (
+	"encoding/json"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// A StatsParser is a parser that reports Stats, like ReaderParser.
+type StatsParser interface {
+	Stats() Stats
+}
+
+// HealthOptions configure a Health check.
+type HealthOptions struct {
+	MaxBytesBehind uint64        // not ready if Stats.BytesBehind is greater (default: 0, no max)
+	MaxStall       time.Duration // not live if behind and no bytes are read for this long (default: 0, no max)
+	Clock          Clock         // time for MaxStall (default: WallClock)
+}
+
+// HealthStatus is the health of a parser, served as JSON by Health.
+type HealthStatus struct {
+	Live          bool      // parser has not failed or stalled
+	Ready         bool      // live and not more than HealthOptions.MaxBytesBehind behind
+	BytesBehind   uint64    // Stats.BytesBehind
+	LastEventTime time.Time // Stats.LastEventTime
+	Errors        uint64    // Stats.Errors
+	Failed        bool      // Stats.Failed
+	Stalled       bool      // behind and no bytes read for HealthOptions.MaxStall
+}
+
+// Health serves liveness and readiness endpoints for a parser, so
+// orchestration systems, like Kubernetes probes, can detect and restart a
+// stuck tailer:
+//
+//	h := slowlog.NewHealth(p, slowlog.HealthOptions{MaxStall: time.Minute})
+//	http.Handle("/healthz", h.Live())
+//	http.Handle("/readyz", h.Ready())
+//
+// Each endpoint responds 200 OK if the check passes, else 503 Service
+// Unavailable, with the HealthStatus as JSON. Parser runtime metrics, like
+// PARSER_ERRORS, are exported by a MetricsSink, like PrometheusMetrics.
+type Health struct {
+	p   StatsParser
+	opt HealthOptions
+	// --
+	bytesRead  uint64
+	progressTs time.Time // when bytesRead last changed
+	*sync.Mutex
+}
+
+// NewHealth returns a new Health check of the parser.
+func NewHealth(p StatsParser, opt HealthOptions) *Health {
+	if opt.Clock == nil {
+		opt.Clock = WallClock
+	}
+	return &Health{
+		p:     p,
+		opt:   opt,
+		Mutex: &sync.Mutex{},
+	}
+}
+
+// Status returns the health of the parser. The parser is stalled if it's
+// behind and BytesRead has not changed since MaxStall before now; the first
+// call starts the stall timer.
+func (h *Health) Status() HealthStatus {
+	s := h.p.Stats()
+	now := h.opt.Clock.Now()
+	h.Lock()
+	if h.progressTs.IsZero() || s.BytesRead != h.bytesRead {
+		h.bytesRead = s.BytesRead
+		h.progressTs = now
+	}
+	stalled := h.opt.MaxStall > 0 && s.BytesBehind > 0 && now.Sub(h.progressTs) >= h.opt.MaxStall
+	h.Unlock()
+
+	st := HealthStatus{
+		BytesBehind:   s.BytesBehind,
+		LastEventTime: s.LastEventTime,
+		Errors:        s.Errors,
+		Failed:        s.Failed,
+		Stalled:       stalled,
+	}
+	st.Live = !st.Failed && !st.Stalled
+	st.Ready = st.Live && (h.opt.MaxBytesBehind == 0 || st.BytesBehind <= h.opt.MaxBytesBehind)
+	return st
+}
+
+// Live returns the liveness endpoint: OK unless the parser failed or stalled.
+func (h *Health) Live() http.Handler {
+	return h.handler(func(st HealthStatus) bool { return st.Live })
+}
+
+// Ready returns the readiness endpoint: OK if live and not too far behind.
+func (h *Health) Ready() http.Handler {
+	return h.handler(func(st HealthStatus) bool { return st.Ready })
+}
+
+func (h *Health) handler(ok func(HealthStatus) bool) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		st := h.Status()
+		w.Header().Set("Content-Type", "application/json")
+		if !ok(st) {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+		json.NewEncoder(w).Encode(st)
+	})
+}
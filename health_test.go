@@ -0,0 +1,83 @@
+/*
+	Copyright 2017 Daniel Nichter
+	Copyright 2014-2016 Percona LLC and/or its affiliates
+*/
+
+package slowlog_test
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/go-mysql/slowlog"
+)
+
+type statsParser struct {
+	stats slowlog.Stats
+}
+
+func (p *statsParser) Stats() slowlog.Stats {
+	return p.stats
+}
+
+func TestHealth(t *testing.T) {
+	c := slowlog.NewManualClock(time.Date(2019, 1, 1, 0, 0, 0, 0, time.UTC))
+	p := &statsParser{slowlog.Stats{BytesRead: 100, BytesBehind: 10, Errors: 2}}
+	h := slowlog.NewHealth(p, slowlog.HealthOptions{MaxBytesBehind: 50, MaxStall: time.Minute, Clock: c})
+
+	check := func(name string, live, ready bool) {
+		t.Helper()
+		for _, test := range []struct {
+			endpoint string
+			ok       bool
+		}{
+			{"live", live},
+			{"ready", ready},
+		} {
+			handler := h.Live()
+			if test.endpoint == "ready" {
+				handler = h.Ready()
+			}
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, httptest.NewRequest("GET", "/", nil))
+			expect := 200
+			if !test.ok {
+				expect = 503
+			}
+			if w.Code != expect {
+				t.Errorf("%s: %s: got status %d, expected %d", name, test.endpoint, w.Code, expect)
+			}
+			var st slowlog.HealthStatus
+			if err := json.Unmarshal(w.Body.Bytes(), &st); err != nil {
+				t.Fatal(err)
+			}
+			if st.Live != live || st.Ready != ready || st.Errors != p.stats.Errors {
+				t.Errorf("%s: %s: got status %+v", name, test.endpoint, st)
+			}
+		}
+	}
+
+	check("ok", true, true)
+
+	// Too far behind.
+	p.stats.BytesRead, p.stats.BytesBehind = 110, 60
+	check("behind", true, false)
+
+	// Stalled: still behind and no bytes read for MaxStall.
+	c.Advance(time.Minute)
+	check("stalled", false, false)
+
+	// Reading again.
+	p.stats.BytesRead, p.stats.BytesBehind = 150, 20
+	check("reading", true, true)
+
+	// Not behind is not stalled.
+	p.stats.BytesBehind = 0
+	c.Advance(time.Hour)
+	check("caught up", true, true)
+
+	p.stats.Failed = true
+	check("failed", false, false)
+}
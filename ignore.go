@@ -0,0 +1,127 @@
+/*
+	Copyright 2017 Daniel Nichter
+	Copyright 2014-2016 Percona LLC and/or its affiliates
+*/
+
+package slowlog
+
+import (
+	"encoding/json"
+	"io"
+	"sort"
+	"sync"
+	"time"
+)
+
+// An IgnoredClass is a class acknowledged as a known issue, see IgnoreList.
+type IgnoredClass struct {
+	Id     string    // class ID
+	Reason string    `json:",omitempty"` // why the class is ignored, like a ticket
+	Until  time.Time `json:",omitempty"` // when the class is no longer ignored, zero for never
+}
+
+// IgnoreList is a list of ignored classes, like classes acknowledged by a
+// team, so reports, like a daily digest email, show only new or unacknowledged
+// classes. An ignored class expires at IgnoredClass.Until, so a known issue
+// is reported again if it is not fixed. Use Save and Load to persist the list
+// between reports. It is safe for concurrent use.
+type IgnoreList struct {
+	classes map[string]IgnoredClass
+	*sync.Mutex
+}
+
+// NewIgnoreList returns a new, empty IgnoreList.
+func NewIgnoreList() *IgnoreList {
+	return &IgnoreList{
+		classes: map[string]IgnoredClass{},
+		Mutex:   &sync.Mutex{},
+	}
+}
+
+// Ignore adds the class to the list, or replaces it if the class ID is
+// already in the list.
+func (l *IgnoreList) Ignore(c IgnoredClass) {
+	l.Lock()
+	defer l.Unlock()
+	l.classes[c.Id] = c
+}
+
+// Unignore removes the class from the list.
+func (l *IgnoreList) Unignore(id string) {
+	l.Lock()
+	defer l.Unlock()
+	delete(l.classes, id)
+}
+
+// Ignored returns true if the class is in the list and not expired at now.
+func (l *IgnoreList) Ignored(id string, now time.Time) bool {
+	l.Lock()
+	defer l.Unlock()
+	c, ok := l.classes[id]
+	return ok && !c.expired(now)
+}
+
+// Classes returns the classes in the list, including expired classes, sorted
+// by class ID.
+func (l *IgnoreList) Classes() []IgnoredClass {
+	l.Lock()
+	defer l.Unlock()
+	classes := make([]IgnoredClass, 0, len(l.classes))
+	for _, c := range l.classes {
+		classes = append(classes, c)
+	}
+	sort.Slice(classes, func(i, j int) bool { return classes[i].Id < classes[j].Id })
+	return classes
+}
+
+// Expire removes the classes expired at now.
+func (l *IgnoreList) Expire(now time.Time) {
+	l.Lock()
+	defer l.Unlock()
+	for id, c := range l.classes {
+		if c.expired(now) {
+			delete(l.classes, id)
+		}
+	}
+}
+
+// Filter returns a copy of the finalized Result without the classes ignored at
+// now. The number of classes removed is Result.Meta.Ignored. The global class
+// is not changed.
+func (l *IgnoreList) Filter(r Result, now time.Time) Result {
+	l.Lock()
+	defer l.Unlock()
+	filtered := r
+	filtered.Class = make(map[string]*Class, len(r.Class))
+	for id, class := range r.Class {
+		if c, ok := l.classes[id]; ok && !c.expired(now) {
+			filtered.Meta.Ignored++
+			continue
+		}
+		filtered.Class[id] = class
+	}
+	return filtered
+}
+
+// Save writes the list as JSON to w.
+func (l *IgnoreList) Save(w io.Writer) error {
+	return json.NewEncoder(w).Encode(l.Classes())
+}
+
+// Load reads a list written by Save and adds its classes to the list.
+func (l *IgnoreList) Load(r io.Reader) error {
+	saved := []IgnoredClass{}
+	if err := json.NewDecoder(r).Decode(&saved); err != nil {
+		return err
+	}
+	l.Lock()
+	defer l.Unlock()
+	for _, c := range saved {
+		l.classes[c.Id] = c
+	}
+	return nil
+}
+
+func (c IgnoredClass) expired(now time.Time) bool {
+	return !c.Until.IsZero() && !now.Before(c.Until)
+}
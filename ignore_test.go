@@ -0,0 +1,76 @@
+/*
+	Copyright 2017 Daniel Nichter
+	Copyright 2014-2016 Percona LLC and/or its affiliates
+*/
+
+package slowlog_test
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/go-mysql/slowlog"
+	"github.com/go-test/deep"
+)
+
+func TestIgnoreList(t *testing.T) {
+	now := time.Date(2019, 1, 1, 0, 0, 0, 0, time.UTC)
+	l := slowlog.NewIgnoreList()
+	l.Ignore(slowlog.IgnoredClass{Id: "1", Reason: "known"})
+	l.Ignore(slowlog.IgnoredClass{Id: "2", Until: now.Add(24 * time.Hour)})
+
+	a := slowlog.NewAggregator(false, 0, 0)
+	for _, id := range []string{"1", "2", "3"} {
+		e := slowlog.NewEvent()
+		e.Query = "select " + id
+		e.TimeMetrics["Query_time"] = 1
+		a.AddEvent(*e, id, "select ?")
+	}
+	r := a.Finalize()
+
+	got := l.Filter(r, now)
+	if len(got.Class) != 1 || got.Class["3"] == nil {
+		t.Errorf("got classes %v, expected only class 3", got.Class)
+	}
+	if got.Meta.Ignored != 2 {
+		t.Errorf("got %d ignored, expected 2", got.Meta.Ignored)
+	}
+	if got.Global.TotalQueries != 3 {
+		t.Errorf("got %d global queries, expected 3", got.Global.TotalQueries)
+	}
+	if len(r.Class) != 3 {
+		t.Errorf("Filter changed the Result: %d classes, expected 3", len(r.Class))
+	}
+
+	// Class 2 expires, so it is reported again.
+	later := now.Add(24 * time.Hour)
+	if l.Ignored("2", later) {
+		t.Error("class 2 ignored after it expired")
+	}
+	if got := l.Filter(r, later); len(got.Class) != 2 {
+		t.Errorf("got %d classes after expiry, expected 2", len(got.Class))
+	}
+
+	var buf bytes.Buffer
+	if err := l.Save(&buf); err != nil {
+		t.Fatal(err)
+	}
+	loaded := slowlog.NewIgnoreList()
+	if err := loaded.Load(&buf); err != nil {
+		t.Fatal(err)
+	}
+	if diff := deep.Equal(loaded.Classes(), l.Classes()); diff != nil {
+		t.Error(diff)
+	}
+
+	loaded.Expire(later)
+	expect := []slowlog.IgnoredClass{{Id: "1", Reason: "known"}}
+	if diff := deep.Equal(loaded.Classes(), expect); diff != nil {
+		t.Error(diff)
+	}
+	loaded.Unignore("1")
+	if loaded.Ignored("1", now) {
+		t.Error("class 1 ignored after Unignore")
+	}
+}
@@ -0,0 +1,148 @@
+/*
+	Copyright 2017 Daniel Nichter
+	Copyright 2014-2016 Percona LLC and/or its affiliates
+*/
+
+package slowlog
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"time"
+)
+
+// JobState is the state of DigestJob between runs, saved as JSON in the state
+// file. Head is the hash of the first HeadBytes of the log file, which
+// changes if the file is rotated, so a new file is digested from the start
+// even if it is already larger than Offset.
+type JobState struct {
+	Offset    uint64    // Event.EndOffset of the last event digested, where the next run starts
+	HeadBytes int64     // min(file size, CACHE_KEY_BYTES) when Head was hashed
+	Head      string    // hash of the first HeadBytes of the file
+	Time      time.Time // when the last run finished, by Options.Clock
+	Events    uint64    // events digested by the last run
+}
+
+// DigestJob parses and aggregates the events written to the slow log since
+// the previous run, like a collector run by cron, and returns the finalized
+// Result. The state file, which is created if it does not exist, records
+// where the run stopped: the next run starts there. The state file is written
+// atomically, only if the run succeeds, so a failed run is retried by the next
+// run.
+//
+// The first run, without a state file, digests the whole file. If the file is
+// rotated or truncated since the previous run, it is digested from the start.
+// Events written to the old file after the previous run and before rotation
+// are not digested; digest the rotated file with DigestFiles to include them.
+//
+// opt.StartOffset, Source, Follow, and PoolEvents are ignored. opt.MaxBytes limits the
+// bytes digested per run; the next run continues where it stopped.
+func DigestJob(statePath, logPath string, opt DigestOptions) (Result, error) {
+	if opt.Class == nil {
+		return Result{}, errors.New("DigestOptions.Class is nil")
+	}
+
+	var state JobState
+	bytes, err := ioutil.ReadFile(statePath)
+	if err == nil {
+		if err := json.Unmarshal(bytes, &state); err != nil {
+			return Result{}, fmt.Errorf("%s: %s", statePath, err)
+		}
+	} else if !os.IsNotExist(err) {
+		return Result{}, err
+	}
+
+	file, err := os.Open(logPath)
+	if err != nil {
+		return Result{}, err
+	}
+	defer file.Close()
+	fi, err := file.Stat()
+	if err != nil {
+		return Result{}, err
+	}
+
+	start := state.Offset
+	if start > 0 {
+		if uint64(fi.Size()) < start {
+			if l := logger(opt.Options, LOG_DEBUG); l != nil {
+				l.Printf("%s: truncated, size %d < offset %d", logPath, fi.Size(), start)
+			}
+			start = 0
+		} else if head, err := hashHead(file, state.HeadBytes); err != nil {
+			return Result{}, err
+		} else if head != state.Head {
+			if l := logger(opt.Options, LOG_DEBUG); l != nil {
+				l.Printf("%s: rotated", logPath)
+			}
+			start = 0
+		}
+	}
+
+	popt := opt.Options
+	popt.StartOffset = start
+	popt.Source = ""
+	popt.Follow = false
+	popt.PoolEvents = false
+	p := NewFileParser(file)
+	if err := p.Start(popt); err != nil {
+		return Result{}, err
+	}
+	a := NewAggregator(opt.Samples, opt.UTCOffset, opt.OutlierTime)
+	next := JobState{Offset: start}
+	for e := range p.Events() {
+		id, fingerprint := opt.Class(e)
+		a.AddEvent(e, id, fingerprint)
+		next.Offset = e.EndOffset
+		next.Events++
+	}
+	if err := p.Error(); err != nil {
+		return Result{}, fmt.Errorf("%s: %s", logPath, err)
+	}
+
+	// Hash the head of the file as of now; if it was shorter than
+	// CACHE_KEY_BYTES, the next run hashes the same bytes.
+	next.HeadBytes = fi.Size()
+	if next.HeadBytes > CACHE_KEY_BYTES {
+		next.HeadBytes = CACHE_KEY_BYTES
+	}
+	if next.Head, err = hashHead(file, next.HeadBytes); err != nil {
+		return Result{}, err
+	}
+	if opt.Clock != nil {
+		next.Time = opt.Clock.Now()
+	} else {
+		next.Time = WallClock.Now()
+	}
+	if err := writeJobState(statePath, next); err != nil {
+		return Result{}, err
+	}
+	return a.Finalize(), nil
+}
+
+// hashHead returns the hash of the first n bytes of the file.
+func hashHead(file *os.File, n int64) (string, error) {
+	h := sha256.New()
+	if _, err := io.Copy(h, io.NewSectionReader(file, 0, n)); err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%x", h.Sum(nil)[0:16]), nil
+}
+
+func writeJobState(path string, state JobState) error {
+	bytes, err := json.Marshal(state)
+	if err != nil {
+		return err
+	}
+	// Write and rename so the state is never partially written.
+	tmp := path + ".tmp"
+	if err := ioutil.WriteFile(tmp, bytes, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
@@ -0,0 +1,84 @@
+/*
+	Copyright 2017 Daniel Nichter
+	Copyright 2014-2016 Percona LLC and/or its affiliates
+*/
+
+package slowlog_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"testing"
+
+	"github.com/go-mysql/slowlog"
+)
+
+func TestDigestJob(t *testing.T) {
+	dir, err := ioutil.TempDir("", "slowlog-test-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	logPath := filepath.Join(dir, "slow.log")
+	statePath := filepath.Join(dir, "state.json")
+
+	slow001, err := ioutil.ReadFile(path.Join("test", "slow-logs", "slow001.log"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	slow002, err := ioutil.ReadFile(path.Join("test", "slow-logs", "slow002.log"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	events := parseSlowLog(t, "slow002.log", noOptions)
+
+	opt := slowlog.DigestOptions{
+		Class: func(e slowlog.Event) (string, string) { return "1", "select ?" },
+	}
+	run := func(expect uint64) {
+		t.Helper()
+		r, err := slowlog.DigestJob(statePath, logPath, opt)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got uint64
+		if r.Global != nil {
+			got = r.Global.TotalQueries
+		}
+		if got != expect {
+			t.Errorf("got %d events, expected %d", got, expect)
+		}
+	}
+
+	// First run digests the first 3 events of the log.
+	if err := ioutil.WriteFile(logPath, slow002[:events[3].Offset], 0644); err != nil {
+		t.Fatal(err)
+	}
+	run(3)
+
+	// Next run digests only the events appended since.
+	f, err := os.OpenFile(logPath, os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.Write(slow002[events[3].Offset:])
+	f.Close()
+	run(uint64(len(events) - 3))
+	run(0)
+
+	// Truncated: the new, smaller file is digested from the start.
+	if err := ioutil.WriteFile(logPath, slow001, 0644); err != nil {
+		t.Fatal(err)
+	}
+	run(2)
+
+	// Rotated: the new file is larger than the offset but different, so it is
+	// digested from the start, too.
+	if err := ioutil.WriteFile(logPath, slow002, 0644); err != nil {
+		t.Fatal(err)
+	}
+	run(uint64(len(events)))
+	run(0)
+}
@@ -0,0 +1,138 @@
+/*
+	Copyright 2017 Daniel Nichter
+	Copyright 2014-2016 Percona LLC and/or its affiliates
+*/
+
+package slowlog
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"sort"
+)
+
+// A Check is a query performance check of every class in a Result, like a
+// CI gate that fails if a class exhausts its SLO error budget. Fail returns
+// why the finalized class fails the check, or an empty string if it passes.
+type Check struct {
+	Name string
+	Fail func(c *Class) string
+}
+
+// SLOCheck fails classes with an SLO BurnRate greater than maxBurnRate, like
+// 1 to fail classes that exhaust their error budget. It requires
+// Aggregator.SetSLO.
+func SLOCheck(maxBurnRate float64) Check {
+	return Check{
+		Name: "slo",
+		Fail: func(c *Class) string {
+			if c.SLO == nil || c.SLO.BurnRate <= maxBurnRate {
+				return ""
+			}
+			return fmt.Sprintf("SLO burn rate %.2f > %.2f (compliance %.4f)", c.SLO.BurnRate, maxBurnRate, c.SLO.Compliance)
+		},
+	}
+}
+
+// KilledCheck fails classes in which at least minFraction of queries were
+// killed, like KilledClasses.
+func KilledCheck(minFraction float64) Check {
+	return Check{
+		Name: "killed",
+		Fail: func(c *Class) string {
+			if c.KilledQueries == 0 || c.TotalQueries == 0 {
+				return ""
+			}
+			if f := float64(c.KilledQueries) / float64(c.TotalQueries); f >= minFraction {
+				return fmt.Sprintf("%d of %d queries killed (%.1f%%)", c.KilledQueries, c.TotalQueries, f*100)
+			}
+			return ""
+		},
+	}
+}
+
+// MemoryCheck fails classes in which a query used at least minBytes of
+// memory, like MemoryClasses.
+func MemoryCheck(minBytes uint64) Check {
+	return Check{
+		Name: "memory",
+		Fail: func(c *Class) string {
+			if m := maxMemory(c); m > 0 && m >= minBytes {
+				return fmt.Sprintf("max memory %d bytes >= %d", m, minBytes)
+			}
+			return ""
+		},
+	}
+}
+
+type junitTestSuites struct {
+	XMLName xml.Name         `xml:"testsuites"`
+	Suites  []junitTestSuite `xml:"testsuite"`
+}
+
+type junitTestSuite struct {
+	Name     string          `xml:"name,attr"`
+	Tests    int             `xml:"tests,attr"`
+	Failures int             `xml:"failures,attr"`
+	Cases    []junitTestCase `xml:"testcase"`
+}
+
+type junitTestCase struct {
+	Classname string        `xml:"classname,attr"`
+	Name      string        `xml:"name,attr"`
+	Time      float64       `xml:"time,attr"` // Query_time sum
+	Failure   *junitFailure `xml:"failure,omitempty"`
+}
+
+type junitFailure struct {
+	Message string `xml:"message,attr"`
+	Body    string `xml:",chardata"`
+}
+
+// WriteJUnit writes the checks of every class in the finalized Result to w as
+// JUnit XML, which CI systems show in their test report. Each check is a test
+// suite and each class is a test case named by its ID, with the Query_time sum
+// of the class as the time. A failed test case has the Fail message and the
+// fingerprint of the class.
+func WriteJUnit(w io.Writer, r Result, checks ...Check) error {
+	ids := make([]string, 0, len(r.Class))
+	for id := range r.Class {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	suites := junitTestSuites{Suites: make([]junitTestSuite, 0, len(checks))}
+	for _, check := range checks {
+		suite := junitTestSuite{
+			Name:  check.Name,
+			Tests: len(ids),
+			Cases: make([]junitTestCase, 0, len(ids)),
+		}
+		for _, id := range ids {
+			class := r.Class[id]
+			tc := junitTestCase{
+				Classname: check.Name,
+				Name:      id,
+				Time:      queryTime(class),
+			}
+			if msg := check.Fail(class); msg != "" {
+				tc.Failure = &junitFailure{Message: msg, Body: class.Fingerprint}
+				suite.Failures++
+			}
+			suite.Cases = append(suite.Cases, tc)
+		}
+		suites.Suites = append(suites.Suites, suite)
+	}
+
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	if err := enc.Encode(suites); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, "\n")
+	return err
+}
@@ -0,0 +1,72 @@
+/*
+	Copyright 2017 Daniel Nichter
+	Copyright 2014-2016 Percona LLC and/or its affiliates
+*/
+
+package slowlog_test
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/go-mysql/slowlog"
+)
+
+func TestWriteJUnit(t *testing.T) {
+	a := slowlog.NewAggregator(false, 0, 0)
+	add := func(id string, killed uint64) {
+		e := slowlog.NewEvent()
+		e.TimeMetrics["Query_time"] = 1.5
+		e.NumberMetrics["Killed"] = killed
+		a.AddEvent(*e, id, "select <"+id+">")
+	}
+	add("A", 0)
+	add("B", 0)
+	add("B", 3024)
+	r := a.Finalize()
+
+	var buf bytes.Buffer
+	if err := slowlog.WriteJUnit(&buf, r, slowlog.KilledCheck(0.1)); err != nil {
+		t.Fatal(err)
+	}
+	expect := `<?xml version="1.0" encoding="UTF-8"?>
+<testsuites>
+  <testsuite name="killed" tests="2" failures="1">
+    <testcase classname="killed" name="A" time="1.5"></testcase>
+    <testcase classname="killed" name="B" time="3">
+      <failure message="1 of 2 queries killed (50.0%)">select &lt;B&gt;</failure>
+    </testcase>
+  </testsuite>
+</testsuites>
+`
+	if got := buf.String(); got != expect {
+		t.Errorf("got:\n%s\nexpected:\n%s", got, expect)
+	}
+}
+
+func TestChecks(t *testing.T) {
+	c := &slowlog.Class{
+		TotalQueries: 10,
+		SLO:          &slowlog.SLOStats{Compliance: 0.98, BurnRate: 2},
+		Metrics: slowlog.Metrics{
+			NumberMetrics: map[string]*slowlog.NumberStats{
+				"Max_used_memory": {Max: 1 << 30},
+			},
+		},
+	}
+	tests := []struct {
+		check slowlog.Check
+		fail  bool
+	}{
+		{slowlog.SLOCheck(1), true},
+		{slowlog.SLOCheck(2), false},
+		{slowlog.MemoryCheck(1 << 30), true},
+		{slowlog.MemoryCheck(2 << 30), false},
+		{slowlog.KilledCheck(0), false},
+	}
+	for _, test := range tests {
+		if msg := test.check.Fail(c); (msg != "") != test.fail {
+			t.Errorf("%s: got failure %q, expected fail %t", test.check.Name, msg, test.fail)
+		}
+	}
+}
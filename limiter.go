@@ -0,0 +1,75 @@
+/*
+	Copyright 2017 Daniel Nichter
+	Copyright 2014-2016 Percona LLC and/or its affiliates
+*/
+
+package slowlog
+
+import (
+	"math"
+	"time"
+)
+
+// limiter is a token bucket that throttles to rate tokens per second. It
+// holds at most burst tokens. A wait for more tokens than the bucket holds
+// borrows them, so the next wait is longer, instead of waiting forever.
+type limiter struct {
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+	clock  Clock
+}
+
+// newLimiter returns a limiter with a full bucket. If burst is 0, it is one
+// second of tokens, but at least 1 so take(1) succeeds at rates below 1.
+func newLimiter(rate, burst float64, clock Clock) *limiter {
+	if burst <= 0 {
+		burst = math.Max(rate, 1)
+	}
+	return &limiter{
+		rate:   rate,
+		burst:  burst,
+		tokens: burst,
+		last:   clock.Now(),
+		clock:  clock,
+	}
+}
+
+// take takes n tokens if they are available, without waiting. It returns
+// false if they are not.
+func (l *limiter) take(n float64) bool {
+	l.refill()
+	if l.tokens < n {
+		return false
+	}
+	l.tokens -= n
+	return true
+}
+
+// refill adds the tokens since the last refill.
+func (l *limiter) refill() {
+	now := l.clock.Now()
+	l.tokens += now.Sub(l.last).Seconds() * l.rate
+	if l.tokens > l.burst {
+		l.tokens = l.burst
+	}
+	l.last = now
+}
+
+// wait takes n tokens, waiting until they are available. It returns false if
+// stopChan is closed while waiting.
+func (l *limiter) wait(n float64, stopChan chan struct{}) bool {
+	l.refill()
+	l.tokens -= n
+	if l.tokens >= 0 {
+		return true
+	}
+	d := time.Duration(-l.tokens / l.rate * float64(time.Second))
+	select {
+	case <-l.clock.After(d):
+		return true
+	case <-stopChan:
+		return false
+	}
+}
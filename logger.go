@@ -0,0 +1,57 @@
+/*
+	Copyright 2017 Daniel Nichter
+	Copyright 2014-2016 Percona LLC and/or its affiliates
+*/
+
+package slowlog
+
+import (
+	"fmt"
+	"log"
+)
+
+// A Logger logs parser diagnostics, see Options.Logger. A *log.Logger is a
+// Logger, so each parser can log with its own prefix, like the name of the
+// MySQL instance, to tell apart the output of concurrent parsers.
+type Logger interface {
+	Printf(format string, v ...interface{})
+}
+
+// LogLevel is what a parser logs to Options.Logger.
+type LogLevel int
+
+const (
+	LOG_ANOMALIES LogLevel = iota // anomalies, like runaway headers and dropped events (default)
+	LOG_DEBUG                     // every line and how it is parsed, like Debug
+)
+
+func (l LogLevel) String() string {
+	switch l {
+	case LOG_ANOMALIES:
+		return "anomalies"
+	case LOG_DEBUG:
+		return "debug"
+	}
+	return fmt.Sprintf("LogLevel(%d)", int(l))
+}
+
+// stdLogger logs to the log package, for Debug.
+type stdLogger struct{}
+
+func (stdLogger) Printf(format string, v ...interface{}) { log.Printf(format, v...) }
+
+// logger returns the Logger of the options for messages at the level, or nil
+// if they are not logged. Without Options.Logger, everything is logged to the
+// log package if Debug is true.
+func logger(opt Options, level LogLevel) Logger {
+	if opt.Logger != nil {
+		if level <= opt.LogLevel {
+			return opt.Logger
+		}
+		return nil
+	}
+	if Debug {
+		return stdLogger{}
+	}
+	return nil
+}
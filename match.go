@@ -0,0 +1,70 @@
+/*
+	Copyright 2017 Daniel Nichter
+	Copyright 2014-2016 Percona LLC and/or its affiliates
+*/
+
+package slowlog
+
+import (
+	"regexp"
+	"strings"
+)
+
+// An EventMatch matches events by User, Host, and Db, like to digest the
+// queries of one application user with Options.Include. A nil field matches
+// any value, and an event matches if all non-nil fields match. Patterns match
+// anywhere in the value unless anchored, like ^app$. Use Glob for shell-style
+// patterns.
+type EventMatch struct {
+	User *regexp.Regexp
+	Host *regexp.Regexp
+	Db   *regexp.Regexp
+}
+
+// Match returns true if the event matches.
+func (m EventMatch) Match(e Event) bool {
+	return (m.User == nil || m.User.MatchString(e.User)) &&
+		(m.Host == nil || m.Host.MatchString(e.Host)) &&
+		(m.Db == nil || m.Db.MatchString(e.Db))
+}
+
+// Glob returns a regexp that matches the whole value like the shell-style
+// pattern: * matches any characters and ? matches one character. For example,
+// Glob("app_*") matches app_ro and app_rw but not my_app_ro.
+func Glob(pattern string) *regexp.Regexp {
+	re := regexp.QuoteMeta(pattern)
+	re = strings.Replace(re, `\*`, ".*", -1)
+	re = strings.Replace(re, `\?`, ".", -1)
+	return regexp.MustCompile("^" + re + "$")
+}
+
+// matchEvent returns true if the event matches one of include, or include is
+// empty, and none of exclude.
+func matchEvent(e Event, include, exclude []EventMatch) bool {
+	for _, m := range exclude {
+		if m.Match(e) {
+			return false
+		}
+	}
+	if len(include) == 0 {
+		return true
+	}
+	for _, m := range include {
+		if m.Match(e) {
+			return true
+		}
+	}
+	return false
+}
+
+// matchesDb returns true if one of the matches has a Db pattern.
+func matchesDb(matches ...[]EventMatch) bool {
+	for _, ms := range matches {
+		for _, m := range ms {
+			if m.Db != nil {
+				return true
+			}
+		}
+	}
+	return false
+}
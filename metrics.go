@@ -7,8 +7,105 @@ package slowlog
 
 import (
 	"sort"
+	"strings"
 )
 
+// KnownMetrics are the header metrics and values logged by MySQL, Percona
+// Server, and MariaDB that the parser knows. Other metrics are parsed by their
+// value and name suffix, but they're reported as unknown by Parser.Stats and
+// Result.Meta because they might be parsed wrong. Add metrics to make them
+// known. Percona Server profiling metrics, which begin with PROFILE_PREFIX,
+// are known too.
+var KnownMetrics = map[string]bool{
+	// MySQL
+	"Query_time":    true,
+	"Lock_time":     true,
+	"Rows_sent":     true,
+	"Rows_examined": true,
+	"Thread_id":     true,
+	"Errno":         true,
+	"Killed":        true,
+	"Start":         true,
+	"End":           true,
+	// MySQL 8.0 log_slow_extra
+	"Bytes_received":           true,
+	"Bytes_sent":               true,
+	"Read_first":               true,
+	"Read_last":                true,
+	"Read_key":                 true,
+	"Read_next":                true,
+	"Read_prev":                true,
+	"Read_rnd":                 true,
+	"Read_rnd_next":            true,
+	"Sort_merge_passes":        true,
+	"Sort_range_count":         true,
+	"Sort_rows":                true,
+	"Sort_scan_count":          true,
+	"Created_tmp_disk_tables":  true,
+	"Created_tmp_tables":       true,
+	"Count_hit_tmp_table_size": true,
+	// Percona Server and MariaDB
+	"Schema":                true,
+	"Last_errno":            true,
+	"Rows_affected":         true,
+	"Rows_read":             true,
+	"Tmp_tables":            true,
+	"Tmp_disk_tables":       true,
+	"Tmp_table_sizes":       true,
+	"QC_Hit":                true,
+	"QC_hit":                true,
+	"Full_scan":             true,
+	"Full_join":             true,
+	"Tmp_table":             true,
+	"Tmp_table_on_disk":     true,
+	"Filesort":              true,
+	"Filesort_on_disk":      true,
+	"Merge_passes":          true,
+	"Priority_queue":        true,
+	"InnoDB_trx_id":         true,
+	"InnoDB_IO_r_ops":       true,
+	"InnoDB_IO_r_bytes":     true,
+	"InnoDB_IO_r_wait":      true,
+	"InnoDB_rec_lock_wait":  true,
+	"InnoDB_queue_wait":     true,
+	"InnoDB_pages_distinct": true,
+	// Same as InnoDB_*, as capitalized by some versions
+	"Innodb_trx_id":         true,
+	"Innodb_IO_r_ops":       true,
+	"Innodb_IO_r_bytes":     true,
+	"Innodb_IO_r_wait":      true,
+	"Innodb_rec_lock_wait":  true,
+	"Innodb_queue_wait":     true,
+	"Innodb_pages_distinct": true,
+	"Log_slow_rate_type":    true,
+	"Log_slow_rate_limit":   true,
+	"Max_used_memory":       true,
+	// Options.InsertRows
+	"Insert_rows": true,
+}
+
+// PROFILE_PREFIX begins the name of Percona Server log_slow_verbosity=profiling
+// metrics: the time of each query execution state, like Profile_init, and its
+// CPU time, like Profile_init_cpu, and the total, Profile_total. The names are
+// the state names, with spaces replaced by underscores, so they vary by
+// version. They are time metrics.
+const PROFILE_PREFIX = "Profile_"
+
+// MEMORY_METRICS are the number metrics of memory used by a query, in bytes,
+// like Max_used_memory logged by Percona Server 8.0. They're parsed and
+// aggregated like other number metrics, but MemoryClasses reports classes by
+// them because memory-hungry queries cause other problems than slow queries,
+// like swapping or the server being killed when it's out of memory.
+var MEMORY_METRICS = map[string]bool{
+	"Max_used_memory": true,
+}
+
+// knownMetric returns true if the metric is in KnownMetrics or is a profiling
+// metric.
+func knownMetric(name string) bool {
+	return KnownMetrics[name] || strings.HasPrefix(name, PROFILE_PREFIX)
+}
+
 // Metrics encapsulate the metrics of an event like Query_time and Rows_sent.
 type Metrics struct {
 	TimeMetrics   map[string]*TimeStats   `json:",omitempty"`
@@ -18,32 +115,38 @@ type Metrics struct {
 
 // TimeStats are microsecond-based metrics like Query_time and Lock_time.
 type TimeStats struct {
-	vals       []float64
+	vals       samples // timeBits
 	Sum        float64
 	Min        float64 `json:",omitempty"`
 	Avg        float64 `json:",omitempty"`
 	Med        float64 `json:",omitempty"` // median
 	P95        float64 `json:",omitempty"` // 95th percentile
 	Max        float64 `json:",omitempty"`
+	Missing    uint64  `json:",omitempty"` // events without the metric
 	outlierSum float64
 }
 
 // NumberStats are integer-based metrics like Rows_sent and Merge_passes.
 type NumberStats struct {
-	vals       []uint64
+	vals       samples
 	Sum        uint64
 	Min        uint64 `json:",omitempty"`
 	Avg        uint64 `json:",omitempty"`
 	Med        uint64 `json:",omitempty"` // median
 	P95        uint64 `json:",omitempty"` // 95th percentile
 	Max        uint64 `json:",omitempty"`
+	Missing    uint64 `json:",omitempty"` // events without the metric
 	outlierSum uint64
 }
 
 // BoolStats are boolean-based metrics like QC_Hit and Filesort.
 type BoolStats struct {
-	Sum        uint64 // %true = Sum/Cnt
+	Sum        uint64  // number of true values
+	Cnt        uint64  // number of values
+	TruePct    float64 // percentage of true values: Sum / Cnt * 100
+	Missing    uint64  `json:",omitempty"` // events without the metric
 	outlierSum uint64
+	outlierCnt uint64
 }
 
 // NewMetrics returns a pointer to an initialized Metrics structure.
@@ -61,9 +164,7 @@ func (m *Metrics) AddEvent(e Event, outlier bool) {
 	for metric, val := range e.TimeMetrics {
 		stats, seenMetric := m.TimeMetrics[metric]
 		if !seenMetric {
-			m.TimeMetrics[metric] = &TimeStats{
-				vals: []float64{},
-			}
+			m.TimeMetrics[metric] = &TimeStats{}
 			stats = m.TimeMetrics[metric]
 		}
 		if outlier {
@@ -71,15 +172,13 @@ func (m *Metrics) AddEvent(e Event, outlier bool) {
 		} else {
 			stats.Sum += val
 		}
-		stats.vals = append(stats.vals, float64(val))
+		stats.vals.add(timeBits(val))
 	}
 
 	for metric, val := range e.NumberMetrics {
 		stats, seenMetric := m.NumberMetrics[metric]
 		if !seenMetric {
-			m.NumberMetrics[metric] = &NumberStats{
-				vals: []uint64{},
-			}
+			m.NumberMetrics[metric] = &NumberStats{}
 			stats = m.NumberMetrics[metric]
 		}
 		if outlier {
@@ -87,7 +186,7 @@ func (m *Metrics) AddEvent(e Event, outlier bool) {
 		} else {
 			stats.Sum += val
 		}
-		stats.vals = append(stats.vals, val)
+		stats.vals.add(val)
 	}
 
 	for metric, val := range e.BoolMetrics {
@@ -96,6 +195,11 @@ func (m *Metrics) AddEvent(e Event, outlier bool) {
 			m.BoolMetrics[metric] = &BoolStats{}
 			stats = m.BoolMetrics[metric]
 		}
+		if outlier {
+			stats.outlierCnt++
+		} else {
+			stats.Cnt++
+		}
 		if val {
 			if outlier {
 				stats.outlierSum += 1
@@ -106,6 +210,76 @@ func (m *Metrics) AddEvent(e Event, outlier bool) {
 	}
 }
 
+// merge adds the metrics of o, which must not be finalized.
+func (m *Metrics) merge(o Metrics) {
+	for metric, os := range o.TimeMetrics {
+		s, ok := m.TimeMetrics[metric]
+		if !ok {
+			m.TimeMetrics[metric] = os
+			continue
+		}
+		s.Sum += os.Sum
+		s.outlierSum += os.outlierSum
+		s.vals.merge(&os.vals)
+	}
+
+	for metric, os := range o.NumberMetrics {
+		s, ok := m.NumberMetrics[metric]
+		if !ok {
+			m.NumberMetrics[metric] = os
+			continue
+		}
+		s.Sum += os.Sum
+		s.outlierSum += os.outlierSum
+		s.vals.merge(&os.vals)
+	}
+
+	for metric, os := range o.BoolMetrics {
+		s, ok := m.BoolMetrics[metric]
+		if !ok {
+			m.BoolMetrics[metric] = os
+			continue
+		}
+		s.Sum += os.Sum
+		s.Cnt += os.Cnt
+		s.outlierSum += os.outlierSum
+		s.outlierCnt += os.outlierCnt
+	}
+}
+
+// setMissing sets the Missing count of every metric given the number of
+// events added. Call it before Finalize. Missing counts are the number of
+// events, not scaled by rate limit, so stats like Avg are of events minus
+// Missing.
+func (m *Metrics) setMissing(events uint64) {
+	for _, s := range m.TimeMetrics {
+		s.Missing = events - uint64(s.vals.len())
+	}
+	for _, s := range m.NumberMetrics {
+		s.Missing = events - uint64(s.vals.len())
+	}
+	for _, s := range m.BoolMetrics {
+		s.Missing = events - (s.Cnt + s.outlierCnt)
+	}
+}
+
+// omitZero removes finalized time and number metrics whose values are all
+// zero and adds their names to omitted.
+func (m *Metrics) omitZero(omitted map[string]bool) {
+	for metric, s := range m.TimeMetrics {
+		if s.Max == 0 {
+			delete(m.TimeMetrics, metric)
+			omitted[metric] = true
+		}
+	}
+	for metric, s := range m.NumberMetrics {
+		if s.Max == 0 {
+			delete(m.NumberMetrics, metric)
+			omitted[metric] = true
+		}
+	}
+}
+
 type byUint64 []uint64
 
 func (a byUint64) Len() int      { return len(a) }
@@ -122,28 +296,34 @@ func (m *Metrics) Finalize(rateLimit uint) {
 	}
 
 	for _, s := range m.TimeMetrics {
-		sort.Float64s(s.vals)
-		cnt := len(s.vals)
+		bits := s.vals.values()
+		vals := make([]float64, len(bits))
+		for i, b := range bits {
+			vals[i] = bitsTime(b)
+		}
+		sort.Float64s(vals)
+		cnt := len(vals)
 
-		s.Min = s.vals[0]
+		s.Min = vals[0]
 		s.Avg = (s.Sum + s.outlierSum) / float64(cnt)
-		s.Med = s.vals[(50*cnt)/100] // median = 50th percentile
-		s.P95 = s.vals[(95*cnt)/100]
-		s.Max = s.vals[cnt-1]
+		s.Med = vals[(50*cnt)/100] // median = 50th percentile
+		s.P95 = vals[(95*cnt)/100]
+		s.Max = vals[cnt-1]
 
 		// Update sum last because avg ^ needs the original value.
 		s.Sum = (s.Sum * float64(rateLimit)) + s.outlierSum
 	}
 
 	for _, s := range m.NumberMetrics {
-		sort.Sort(byUint64(s.vals))
-		cnt := len(s.vals)
+		vals := s.vals.values()
+		sort.Sort(byUint64(vals))
+		cnt := len(vals)
 
-		s.Min = s.vals[0]
+		s.Min = vals[0]
 		s.Avg = (s.Sum + s.outlierSum) / uint64(cnt)
-		s.Med = s.vals[(50*cnt)/100] // median = 50th percentile
-		s.P95 = s.vals[(95*cnt)/100]
-		s.Max = s.vals[cnt-1]
+		s.Med = vals[(50*cnt)/100] // median = 50th percentile
+		s.P95 = vals[(95*cnt)/100]
+		s.Max = vals[cnt-1]
 
 		// Update sum last because avg ^ needs the original value.
 		s.Sum = (s.Sum * uint64(rateLimit)) + s.outlierSum
@@ -152,6 +332,10 @@ func (m *Metrics) Finalize(rateLimit uint) {
 	if len(m.BoolMetrics) > 0 {
 		for _, s := range m.BoolMetrics {
 			s.Sum = (s.Sum * uint64(rateLimit)) + s.outlierSum
+			s.Cnt = (s.Cnt * uint64(rateLimit)) + s.outlierCnt
+			if s.Cnt > 0 {
+				s.TruePct = float64(s.Sum) / float64(s.Cnt) * 100
+			}
 		}
 	} else {
 		m.BoolMetrics = nil
@@ -0,0 +1,23 @@
+//go:build !darwin && !dragonfly && !freebsd && !linux && !netbsd && !openbsd
+// +build !darwin,!dragonfly,!freebsd,!linux,!netbsd,!openbsd
+
+/*
+	Copyright 2017 Daniel Nichter
+	Copyright 2014-2016 Percona LLC and/or its affiliates
+*/
+
+package slowlog
+
+import (
+	"os"
+)
+
+// mmapFile returns nil because files are not mapped on this platform, so
+// Options.Mmap is ignored.
+func mmapFile(file *os.File, size int) ([]byte, error) {
+	return nil, nil
+}
+
+func munmapFile(data []byte) error {
+	return nil
+}
@@ -0,0 +1,258 @@
+/*
+	Copyright 2017 Daniel Nichter
+	Copyright 2014-2016 Percona LLC and/or its affiliates
+*/
+
+package slowlog
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+// MultiFileParser is a Parser that parses several slow log files, like rotated
+// logs slow.log, slow.log.1, slow.log.2.gz, as one stream of events. The files
+// are parsed in order of the time of their first event. Event.Source is the
+// file path and Event.Offset is the offset in that file.
+type MultiFileParser struct {
+	patterns []string
+	// --
+	files     []string
+	opt       Options
+	stopChan  chan struct{}
+	eventChan chan Event
+	doneChan  chan struct{}
+	started   bool
+	err       error
+	*sync.Mutex
+}
+
+// NewMultiFileParser returns a new MultiFileParser for the files matched by
+// the patterns, which are file paths or filepath.Glob patterns like
+// "/var/log/mysql/slow.log*".
+func NewMultiFileParser(patterns ...string) *MultiFileParser {
+	p := &MultiFileParser{
+		patterns: patterns,
+		// --
+		stopChan:  make(chan struct{}),
+		eventChan: make(chan Event),
+		doneChan:  make(chan struct{}),
+		Mutex:     &sync.Mutex{},
+	}
+	return p
+}
+
+// Start orders the files by the time of their first event, then starts
+// parsing them one after another. It returns an error if a pattern is invalid
+// or a file cannot be read. Options.StartOffset, Source, and PoolEvents are
+// ignored. Options.Follow applies only to the last file. If
+// Options.Compression is COMPRESSION_NONE, it is COMPRESSION_AUTO so gzip
+// files are decompressed.
+//
+// Like ReaderParser, the parser can be started again after parsing stops,
+// which parses all files again.
+func (p *MultiFileParser) Start(opt Options) error {
+	p.Lock()
+	defer p.Unlock()
+	if p.started {
+		select {
+		case <-p.stopChan:
+			<-p.doneChan // wait for parse to return
+		case <-p.doneChan:
+		default:
+			return ErrStarted
+		}
+		p.stopChan = make(chan struct{})
+		p.eventChan = make(chan Event)
+		p.doneChan = make(chan struct{})
+		p.err = nil
+	}
+
+	opt.StartOffset = 0
+	opt.Source = ""
+	opt.PoolEvents = false
+	if opt.Compression == COMPRESSION_NONE {
+		opt.Compression = COMPRESSION_AUTO
+	}
+	files, err := p.orderFiles(opt)
+	if err != nil {
+		return err
+	}
+	p.files = files
+	p.opt = opt
+
+	go p.parse()
+	p.started = true
+
+	return nil
+}
+
+// Events returns the channel to which events from all files are sent. The
+// channel is closed when there are no more events.
+func (p *MultiFileParser) Events() <-chan Event {
+	return p.eventChan
+}
+
+// Stop stops the parser before parsing the next event or while blocked on
+// sending the current event to the event channel.
+func (p *MultiFileParser) Stop() {
+	p.Lock()
+	defer p.Unlock()
+	if !p.started {
+		return
+	}
+	select {
+	case <-p.stopChan:
+		// already stopped
+	default:
+		close(p.stopChan)
+	}
+}
+
+// Error returns the first error, if any, encountered while parsing the files.
+// The error includes the file path.
+func (p *MultiFileParser) Error() error {
+	return p.err
+}
+
+// Files returns the file paths in the order that they are parsed. It is empty
+// until Start is called.
+func (p *MultiFileParser) Files() []string {
+	p.Lock()
+	defer p.Unlock()
+	files := make([]string, len(p.files))
+	copy(files, p.files)
+	return files
+}
+
+// --------------------------------------------------------------------------
+
+func (p *MultiFileParser) parse() {
+	defer close(p.doneChan)
+	defer close(p.eventChan)
+	for i, path := range p.files {
+		opt := p.opt
+		opt.Follow = opt.Follow && i == len(p.files)-1
+		if err := p.parseFile(path, opt); err != nil {
+			p.err = fmt.Errorf("%s: %s", path, err)
+			return
+		}
+		select {
+		case <-p.stopChan:
+			return
+		default:
+		}
+	}
+}
+
+func (p *MultiFileParser) parseFile(path string, opt Options) error {
+	if l := logger(p.opt, LOG_DEBUG); l != nil {
+		l.Printf("parsing %s", path)
+	}
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	fp := NewFileParser(file)
+	if err := fp.Start(opt); err != nil {
+		return err
+	}
+	defer func() {
+		fp.Stop()
+		for range fp.Events() {
+		}
+	}()
+	events := fp.Events()
+	for {
+		select {
+		case e, ok := <-events:
+			if !ok {
+				return fp.Error()
+			}
+			select {
+			case p.eventChan <- e:
+			case <-p.stopChan:
+				return nil
+			}
+		case <-p.stopChan:
+			return nil
+		}
+	}
+}
+
+// orderFiles returns the unique files matched by the patterns sorted by the
+// time of their first event, then by path. Files without event times are
+// last.
+func (p *MultiFileParser) orderFiles(opt Options) ([]string, error) {
+	files := []string{}
+	seen := map[string]bool{}
+	for _, pattern := range p.patterns {
+		matches, err := filepath.Glob(pattern)
+		if err != nil {
+			return nil, err
+		}
+		if len(matches) == 0 {
+			return nil, fmt.Errorf("no files match %s", pattern)
+		}
+		for _, path := range matches {
+			if !seen[path] {
+				seen[path] = true
+				files = append(files, path)
+			}
+		}
+	}
+
+	first := map[string]time.Time{}
+	for _, path := range files {
+		t, err := firstEventTime(path, opt)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %s", path, err)
+		}
+		first[path] = t
+	}
+	sort.Slice(files, func(i, j int) bool {
+		ti, tj := first[files[i]], first[files[j]]
+		if ti.Equal(tj) {
+			return files[i] < files[j]
+		}
+		if ti.IsZero() || tj.IsZero() {
+			return tj.IsZero()
+		}
+		return ti.Before(tj)
+	})
+	return files, nil
+}
+
+// firstEventTime returns the time of the first event in the file with a time,
+// or zero time if no event has one.
+func firstEventTime(path string, opt Options) (time.Time, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return time.Time{}, err
+	}
+	defer file.Close()
+
+	opt.Follow = false
+	opt.MetricsSink = nil
+	opt.MaxEventsPerSecond = 0
+	opt.MaxBytesPerSecond = 0
+	opt.HeaderFilter = func(e Event) bool { return !e.Time.IsZero() }
+	fp := NewFileParser(file)
+	if err := fp.Start(opt); err != nil {
+		return time.Time{}, err
+	}
+	e, ok := <-fp.Events()
+	fp.Stop()
+	for range fp.Events() {
+	}
+	if !ok {
+		return time.Time{}, fp.Error()
+	}
+	return e.Time, nil
+}
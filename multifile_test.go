@@ -0,0 +1,94 @@
+/*
+	Copyright 2017 Daniel Nichter
+	Copyright 2014-2016 Percona LLC and/or its affiliates
+*/
+
+package slowlog_test
+
+import (
+	"compress/gzip"
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+
+	"github.com/go-mysql/slowlog"
+	"github.com/go-test/deep"
+)
+
+func TestMultiFileParser(t *testing.T) {
+	dir, err := ioutil.TempDir("", "slowlog-test-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	// Rotated logs, newest first: slow009 is 2009, slow002 is 2007-12,
+	// and slow001 is 2007-10.
+	copyFile := func(src, dst string, compress bool) {
+		data, err := ioutil.ReadFile(path.Join("test", "slow-logs", src))
+		if err != nil {
+			t.Fatal(err)
+		}
+		f, err := os.Create(path.Join(dir, dst))
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer f.Close()
+		if compress {
+			zw := gzip.NewWriter(f)
+			zw.Write(data)
+			zw.Close()
+		} else {
+			f.Write(data)
+		}
+	}
+	copyFile("slow009.log", "slow.log", false)
+	copyFile("slow002.log", "slow.log.1", false)
+	copyFile("slow001.log", "slow.log.2.gz", true)
+
+	p := slowlog.NewMultiFileParser(path.Join(dir, "slow.log*"))
+	if err := p.Start(noOptions); err != nil {
+		t.Fatal(err)
+	}
+	got := []slowlog.Event{}
+	sources := map[string]int{}
+	for e := range p.Events() {
+		sources[e.Source]++
+		e.Source = ""
+		e.EndOffset = 0
+		got = append(got, e)
+	}
+	if err := p.Error(); err != nil {
+		t.Error(err)
+	}
+
+	expectFiles := []string{
+		path.Join(dir, "slow.log.2.gz"),
+		path.Join(dir, "slow.log.1"),
+		path.Join(dir, "slow.log"),
+	}
+	if diff := deep.Equal(p.Files(), expectFiles); diff != nil {
+		t.Error(diff)
+	}
+
+	expect := []slowlog.Event{}
+	expectSources := map[string]int{}
+	for i, file := range []string{"slow001.log", "slow002.log", "slow009.log"} {
+		events := parseSlowLog(t, file, noOptions)
+		expect = append(expect, events...)
+		expectSources[expectFiles[i]] = len(events)
+	}
+	if diff := deep.Equal(got, expect); diff != nil {
+		t.Error(diff)
+	}
+	if diff := deep.Equal(sources, expectSources); diff != nil {
+		t.Error(diff)
+	}
+
+	// No files is an error.
+	p = slowlog.NewMultiFileParser(path.Join(dir, "nothing*"))
+	if err := p.Start(noOptions); err == nil {
+		t.Error("no error, expected no files match")
+	}
+}
@@ -0,0 +1,187 @@
+/*
+	Copyright 2017 Daniel Nichter
+	Copyright 2014-2016 Percona LLC and/or its affiliates
+*/
+
+package slowlog
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+)
+
+// Mux is a Parser that merges the events of several parsers, like one per
+// MySQL instance, into one stream. Each parser is a source added by name,
+// which is the Event.Source of its events.
+//
+// Sources are served fairly: when several sources have an event ready, they
+// are received in turn, so a busy source cannot starve the others. A source
+// that stops or fails does not stop the others. Stop stops all parsers, and
+// the Events channel is closed when every parser is done.
+type Mux struct {
+	names   []string
+	parsers []Parser
+	// --
+	stopChan  chan struct{}
+	eventChan chan Event
+	doneChan  chan struct{}
+	started   bool
+	err       error
+	*sync.Mutex
+}
+
+// NewMux returns a new Mux without sources. Call Add to add sources.
+func NewMux() *Mux {
+	m := &Mux{
+		stopChan:  make(chan struct{}),
+		eventChan: make(chan Event),
+		doneChan:  make(chan struct{}),
+		Mutex:     &sync.Mutex{},
+	}
+	return m
+}
+
+// Add adds the parser as the source with the name, which must be unique. The
+// parser must not be started: Start starts it. It returns ErrStarted if the
+// Mux was started.
+func (m *Mux) Add(name string, p Parser) error {
+	m.Lock()
+	defer m.Unlock()
+	if m.started {
+		return ErrStarted
+	}
+	for _, n := range m.names {
+		if n == name {
+			return errors.New("duplicate source: " + name)
+		}
+	}
+	m.names = append(m.names, name)
+	m.parsers = append(m.parsers, p)
+	return nil
+}
+
+// Start starts every parser with the options, with Options.Source set to the
+// name of the source and PoolEvents false, then merges their events. If a
+// parser cannot start, the parsers already started are stopped and the error,
+// which includes the source name, is returned.
+//
+// Like ReaderParser, the Mux can be started again after parsing stops, which
+// starts every parser again.
+func (m *Mux) Start(opt Options) error {
+	m.Lock()
+	defer m.Unlock()
+	if m.started {
+		select {
+		case <-m.stopChan:
+			<-m.doneChan // wait for parse to return
+		case <-m.doneChan:
+		default:
+			return ErrStarted
+		}
+		m.stopChan = make(chan struct{})
+		m.eventChan = make(chan Event)
+		m.doneChan = make(chan struct{})
+		m.err = nil
+	}
+
+	for i, p := range m.parsers {
+		o := opt
+		o.Source = m.names[i]
+		o.PoolEvents = false
+		if err := p.Start(o); err != nil {
+			for _, started := range m.parsers[:i] {
+				started.Stop()
+				for range started.Events() {
+				}
+			}
+			return fmt.Errorf("%s: %s", m.names[i], err)
+		}
+	}
+
+	go m.parse()
+	m.started = true
+
+	return nil
+}
+
+// Events returns the channel to which events from all sources are sent. The
+// channel is closed when there are no more events.
+func (m *Mux) Events() <-chan Event {
+	return m.eventChan
+}
+
+// Stop stops all parsers. The Events channel is closed when they are done.
+func (m *Mux) Stop() {
+	m.Lock()
+	defer m.Unlock()
+	if !m.started {
+		return
+	}
+	select {
+	case <-m.stopChan:
+		// already stopped
+	default:
+		close(m.stopChan)
+	}
+	for _, p := range m.parsers {
+		p.Stop()
+	}
+}
+
+// Error returns the first error, if any, of the parsers. The error includes
+// the source name. Parsing the other sources continues after an error.
+func (m *Mux) Error() error {
+	m.Lock()
+	defer m.Unlock()
+	return m.err
+}
+
+// Sources returns the source names in the order they were added.
+func (m *Mux) Sources() []string {
+	m.Lock()
+	defer m.Unlock()
+	names := make([]string, len(m.names))
+	copy(names, m.names)
+	return names
+}
+
+// --------------------------------------------------------------------------
+
+func (m *Mux) parse() {
+	defer close(m.doneChan)
+	defer close(m.eventChan)
+	var wg sync.WaitGroup
+	for i := range m.parsers {
+		wg.Add(1)
+		go func(name string, p Parser) {
+			defer wg.Done()
+			m.forward(name, p)
+		}(m.names[i], m.parsers[i])
+	}
+	wg.Wait()
+}
+
+// forward sends the events of the parser until it is done or the Mux is
+// stopped. Senders blocked on the unbuffered event channel are served in the
+// order they blocked, which makes sources take turns.
+func (m *Mux) forward(name string, p Parser) {
+	events := p.Events()
+	for e := range events {
+		e.Source = name
+		select {
+		case m.eventChan <- e:
+		case <-m.stopChan:
+			// Stop stops the parser; drain its events until it's done.
+			for range events {
+			}
+		}
+	}
+	if err := p.Error(); err != nil {
+		m.Lock()
+		if m.err == nil {
+			m.err = fmt.Errorf("%s: %s", name, err)
+		}
+		m.Unlock()
+	}
+}
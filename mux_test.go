@@ -0,0 +1,86 @@
+/*
+	Copyright 2017 Daniel Nichter
+	Copyright 2014-2016 Percona LLC and/or its affiliates
+*/
+
+package slowlog_test
+
+import (
+	"os"
+	"path"
+	"testing"
+	"time"
+
+	"github.com/go-mysql/slowlog"
+	"github.com/go-test/deep"
+)
+
+func TestMux(t *testing.T) {
+	m := slowlog.NewMux()
+	expect := map[string][]string{}
+	for _, name := range []string{"slow001.log", "slow002.log", "slow009.log"} {
+		file, err := os.Open(path.Join("test", "slow-logs", name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer file.Close()
+		if err := m.Add(name, slowlog.NewFileParser(file)); err != nil {
+			t.Fatal(err)
+		}
+		for _, e := range parseSlowLog(t, name, noOptions) {
+			expect[name] = append(expect[name], e.Query)
+		}
+	}
+	if err := m.Add("slow001.log", slowlog.NewParser(nil)); err == nil {
+		t.Error("added duplicate source, expected error")
+	}
+
+	// Events of each source are in order, labeled by source.
+	if err := m.Start(noOptions); err != nil {
+		t.Fatal(err)
+	}
+	got := map[string][]string{}
+	for e := range m.Events() {
+		got[e.Source] = append(got[e.Source], e.Query)
+	}
+	if err := m.Error(); err != nil {
+		t.Error(err)
+	}
+	if diff := deep.Equal(got, expect); diff != nil {
+		t.Error(diff)
+	}
+	if err := m.Add("slow010.log", slowlog.NewParser(nil)); err != slowlog.ErrStarted {
+		t.Errorf("got error %v, expected ErrStarted", err)
+	}
+}
+
+func TestMuxStop(t *testing.T) {
+	m := slowlog.NewMux()
+	for _, name := range []string{"slow001.log", "slow002.log"} {
+		file, err := os.Open(path.Join("test", "slow-logs", name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer file.Close()
+		m.Add(name, slowlog.NewFileParser(file))
+	}
+
+	// Following, the parsers never stop on their own, so Stop stops them.
+	opt := slowlog.Options{Follow: true, FollowInterval: 10 * time.Millisecond}
+	if err := m.Start(opt); err != nil {
+		t.Fatal(err)
+	}
+	<-m.Events()
+	m.Stop()
+	done := make(chan struct{})
+	go func() {
+		for range m.Events() {
+		}
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(2 * time.Second):
+		t.Fatal("Events not closed after Stop")
+	}
+}
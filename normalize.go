@@ -0,0 +1,72 @@
+/*
+	Copyright 2017 Daniel Nichter
+	Copyright 2014-2016 Percona LLC and/or its affiliates
+*/
+
+package slowlog
+
+import (
+	"regexp"
+	"strings"
+)
+
+// NormalizeLevel is how much Normalize changes a query. Higher levels make
+// more queries the same, at the cost of readability.
+type NormalizeLevel int
+
+const (
+	NORMALIZE_WHITESPACE NormalizeLevel = iota // collapse whitespace
+	NORMALIZE_LITERALS                         // and replace literal values with "?"
+	NORMALIZE_FULL                             // and remove comments, lowercase, remove spaces around punctuation, and collapse lists of "?"
+)
+
+var paramListRe = regexp.MustCompile(`\?(?:,\?)+`)
+
+// Normalize returns the query normalized to the level. Use it to make example
+// queries readable, like with Aggregator.SetFormatter, or to make fingerprints
+// in a ClassFunc. Strings and quoted identifiers are not changed, except that
+// NORMALIZE_LITERALS and NORMALIZE_FULL replace strings with "?".
+func Normalize(query string, level NormalizeLevel) string {
+	if level >= NORMALIZE_LITERALS {
+		query = MaskLiterals(query)
+	}
+	tokens := tokenize(strings.TrimSpace(query))
+	var out strings.Builder
+	prev := "" // previous token output, not space
+	space := false
+	for _, t := range tokens {
+		if t == " " {
+			space = true
+			continue
+		}
+		comment := t[0] == '#' || strings.HasPrefix(t, "--") || strings.HasPrefix(t, "/*")
+		if level == NORMALIZE_FULL {
+			if comment {
+				space = true
+				continue
+			}
+			if isWordChar(t[0]) {
+				t = strings.ToLower(t)
+			}
+			// Only words need a space between them.
+			space = space && isWord(prev) && isWord(t)
+		}
+		if prev != "" && (prev[0] == '#' || strings.HasPrefix(prev, "--")) {
+			out.WriteString("\n") // end of line comment
+		} else if space && prev != "" {
+			out.WriteString(" ")
+		}
+		out.WriteString(t)
+		prev = t
+		space = false
+	}
+	if level == NORMALIZE_FULL {
+		return paramListRe.ReplaceAllString(out.String(), "?+")
+	}
+	return out.String()
+}
+
+// isWord returns true if the token is a word, quoted, or "?".
+func isWord(t string) bool {
+	return t != "" && (isWordChar(t[0]) || strings.IndexByte("`'\"?", t[0]) > -1)
+}
@@ -0,0 +1,57 @@
+/*
+	Copyright 2017 Daniel Nichter
+	Copyright 2014-2016 Percona LLC and/or its affiliates
+*/
+
+package slowlog_test
+
+import (
+	"testing"
+
+	"github.com/go-mysql/slowlog"
+)
+
+func TestNormalize(t *testing.T) {
+	tests := []struct {
+		query  string
+		level  slowlog.NormalizeLevel
+		expect string
+	}{
+		{
+			query:  "  SELECT a.x,  b.y\n\tFROM  a  JOIN b ON a.id=b.id WHERE a.s = 'x  y' AND b.n IN (1, 2,3)  ",
+			level:  slowlog.NORMALIZE_WHITESPACE,
+			expect: "SELECT a.x, b.y FROM a JOIN b ON a.id=b.id WHERE a.s = 'x  y' AND b.n IN (1, 2,3)",
+		},
+		{
+			query:  "  SELECT a.x,  b.y\n\tFROM  a  JOIN b ON a.id=b.id WHERE a.s = 'x  y' AND b.n IN (1, 2,3)  ",
+			level:  slowlog.NORMALIZE_LITERALS,
+			expect: "SELECT a.x, b.y FROM a JOIN b ON a.id=b.id WHERE a.s = ? AND b.n IN (?, ?,?)",
+		},
+		{
+			query:  "  SELECT a.x,  b.y\n\tFROM  a  JOIN b ON a.id=b.id WHERE a.s = 'x  y' AND b.n IN (1, 2,3)  ",
+			level:  slowlog.NORMALIZE_FULL,
+			expect: "select a.x,b.y from a join b on a.id=b.id where a.s=? and b.n in(?+)",
+		},
+		{
+			query:  "select `My Col` from t -- comment\nwhere id = 1",
+			level:  slowlog.NORMALIZE_WHITESPACE,
+			expect: "select `My Col` from t -- comment\nwhere id = 1",
+		},
+		{
+			query:  "select `My Col` from t -- comment\nwhere id = 1 /* x */",
+			level:  slowlog.NORMALIZE_FULL,
+			expect: "select `My Col` from t where id=?",
+		},
+		{
+			query:  "INSERT INTO t (a, b) VALUES (1, 'a'), (2, 'b')",
+			level:  slowlog.NORMALIZE_FULL,
+			expect: "insert into t(a,b)values(?+),(?+)",
+		},
+	}
+	for _, test := range tests {
+		got := slowlog.Normalize(test.query, test.level)
+		if got != test.expect {
+			t.Errorf("level %d: %q\n   got: %q\nexpect: %q", test.level, test.query, got, test.expect)
+		}
+	}
+}
@@ -0,0 +1,121 @@
+/*
+	Copyright 2017 Daniel Nichter
+	Copyright 2014-2016 Percona LLC and/or its affiliates
+*/
+
+package slowlog
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// WriteOpenMetrics writes the classes of the finalized Result to w in the
+// OpenMetrics text format, like for the node_exporter textfile collector or
+// a Pushgateway. Every sample has a class label (Class.Id) and a fingerprint
+// label, and metric samples have a metric label (like Query_time). The global
+// class is not written because it is the sum of the classes.
+func WriteOpenMetrics(w io.Writer, r Result) error {
+	ids := make([]string, 0, len(r.Class))
+	hasCost := false
+	for id, class := range r.Class {
+		ids = append(ids, id)
+		if class.Cost != 0 {
+			hasCost = true
+		}
+	}
+	sort.Strings(ids)
+
+	b := bufio.NewWriter(w)
+	family := func(name, typ, help string) {
+		fmt.Fprintf(b, "# TYPE %s %s\n# HELP %s %s\n", name, typ, name, help)
+	}
+	sample := func(name string, class *Class, metric string, val float64) {
+		fmt.Fprintf(b, "%s{class=\"%s\",fingerprint=\"%s\"", name, escapeLabel(class.Id), escapeLabel(class.Fingerprint))
+		if metric != "" {
+			fmt.Fprintf(b, ",metric=\"%s\"", escapeLabel(metric))
+		}
+		fmt.Fprintf(b, "} %s\n", strconv.FormatFloat(val, 'g', -1, 64))
+	}
+	// eachMetric calls f for every class and metric name, sorted by name.
+	eachMetric := func(names func(*Class) []string, f func(*Class, string)) {
+		for _, id := range ids {
+			class := r.Class[id]
+			metrics := names(class)
+			sort.Strings(metrics)
+			for _, metric := range metrics {
+				f(class, metric)
+			}
+		}
+	}
+	timeMetrics := func(c *Class) []string {
+		names := []string{}
+		for name := range c.Metrics.TimeMetrics {
+			names = append(names, name)
+		}
+		return names
+	}
+
+	family("slowlog_queries", "counter", "Number of queries.")
+	for _, id := range ids {
+		sample("slowlog_queries_total", r.Class[id], "", float64(r.Class[id].TotalQueries))
+	}
+
+	family("slowlog_time_seconds", "counter", "Sum of time metrics.")
+	eachMetric(timeMetrics, func(c *Class, metric string) {
+		sample("slowlog_time_seconds_total", c, metric, c.Metrics.TimeMetrics[metric].Sum)
+	})
+
+	family("slowlog_time_p95_seconds", "gauge", "95th percentile of time metrics.")
+	eachMetric(timeMetrics, func(c *Class, metric string) {
+		sample("slowlog_time_p95_seconds", c, metric, c.Metrics.TimeMetrics[metric].P95)
+	})
+
+	family("slowlog_time_max_seconds", "gauge", "Maximum of time metrics.")
+	eachMetric(timeMetrics, func(c *Class, metric string) {
+		sample("slowlog_time_max_seconds", c, metric, c.Metrics.TimeMetrics[metric].Max)
+	})
+
+	family("slowlog_metric", "counter", "Sum of number metrics.")
+	eachMetric(func(c *Class) []string {
+		names := []string{}
+		for name := range c.Metrics.NumberMetrics {
+			names = append(names, name)
+		}
+		return names
+	}, func(c *Class, metric string) {
+		sample("slowlog_metric_total", c, metric, float64(c.Metrics.NumberMetrics[metric].Sum))
+	})
+
+	family("slowlog_flag", "counter", "Number of queries with bool metrics true.")
+	eachMetric(func(c *Class) []string {
+		names := []string{}
+		for name := range c.Metrics.BoolMetrics {
+			names = append(names, name)
+		}
+		return names
+	}, func(c *Class, metric string) {
+		sample("slowlog_flag_total", c, metric, float64(c.Metrics.BoolMetrics[metric].Sum))
+	})
+
+	if hasCost {
+		family("slowlog_cost", "gauge", "Estimated cost from the Aggregator cost model.")
+		for _, id := range ids {
+			sample("slowlog_cost", r.Class[id], "", r.Class[id].Cost)
+		}
+	}
+
+	b.WriteString("# EOF\n")
+	return b.Flush()
+}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+// escapeLabel escapes an OpenMetrics label value.
+func escapeLabel(s string) string {
+	return labelEscaper.Replace(s)
+}
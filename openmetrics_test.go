@@ -0,0 +1,65 @@
+/*
+	Copyright 2017 Daniel Nichter
+	Copyright 2014-2016 Percona LLC and/or its affiliates
+*/
+
+package slowlog_test
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/go-mysql/slowlog"
+	"github.com/go-test/deep"
+)
+
+func TestWriteOpenMetrics(t *testing.T) {
+	a := slowlog.NewAggregator(false, 0, 0)
+	a.SetCostModel(slowlog.CostModel{"Query_time": 0.5})
+	e := slowlog.NewEvent()
+	e.TimeMetrics["Query_time"] = 2
+	e.NumberMetrics["Rows_sent"] = 1
+	e.BoolMetrics["Full_scan"] = true
+	a.AddEvent(*e, "2", "select \"b\"")
+	e.TimeMetrics["Query_time"] = 0.25
+	delete(e.BoolMetrics, "Full_scan")
+	a.AddEvent(*e, "1", "select a")
+
+	var got bytes.Buffer
+	if err := slowlog.WriteOpenMetrics(&got, a.Finalize()); err != nil {
+		t.Fatal(err)
+	}
+	expect := `# TYPE slowlog_queries counter
+# HELP slowlog_queries Number of queries.
+slowlog_queries_total{class="1",fingerprint="select a"} 1
+slowlog_queries_total{class="2",fingerprint="select \"b\""} 1
+# TYPE slowlog_time_seconds counter
+# HELP slowlog_time_seconds Sum of time metrics.
+slowlog_time_seconds_total{class="1",fingerprint="select a",metric="Query_time"} 0.25
+slowlog_time_seconds_total{class="2",fingerprint="select \"b\"",metric="Query_time"} 2
+# TYPE slowlog_time_p95_seconds gauge
+# HELP slowlog_time_p95_seconds 95th percentile of time metrics.
+slowlog_time_p95_seconds{class="1",fingerprint="select a",metric="Query_time"} 0.25
+slowlog_time_p95_seconds{class="2",fingerprint="select \"b\"",metric="Query_time"} 2
+# TYPE slowlog_time_max_seconds gauge
+# HELP slowlog_time_max_seconds Maximum of time metrics.
+slowlog_time_max_seconds{class="1",fingerprint="select a",metric="Query_time"} 0.25
+slowlog_time_max_seconds{class="2",fingerprint="select \"b\"",metric="Query_time"} 2
+# TYPE slowlog_metric counter
+# HELP slowlog_metric Sum of number metrics.
+slowlog_metric_total{class="1",fingerprint="select a",metric="Rows_sent"} 1
+slowlog_metric_total{class="2",fingerprint="select \"b\"",metric="Rows_sent"} 1
+# TYPE slowlog_flag counter
+# HELP slowlog_flag Number of queries with bool metrics true.
+slowlog_flag_total{class="2",fingerprint="select \"b\"",metric="Full_scan"} 1
+# TYPE slowlog_cost gauge
+# HELP slowlog_cost Estimated cost from the Aggregator cost model.
+slowlog_cost{class="1",fingerprint="select a"} 0.125
+slowlog_cost{class="2",fingerprint="select \"b\""} 1
+# EOF
+`
+	if diff := deep.Equal(got.String(), expect); diff != nil {
+		t.Error(diff)
+		t.Log(got.String())
+	}
+}
@@ -0,0 +1,238 @@
+/*
+	Copyright 2017 Daniel Nichter
+	Copyright 2014-2016 Percona LLC and/or its affiliates
+*/
+
+package slowlog
+
+import (
+	"regexp"
+	"strings"
+)
+
+// ParamType is the type of a Param.
+type ParamType int
+
+const (
+	PARAM_INT    ParamType = iota // 1, -1
+	PARAM_FLOAT                   // 1.5, 1e3
+	PARAM_STRING                  // 'foo', "foo"
+	PARAM_DATE                    // '2017-01-02', '2017-01-02 15:04:05'
+)
+
+// A Param is a literal value in a query, like 1 or 'foo'. Value is the literal
+// without quotes. Params are the values that a fingerprint replaces with "?".
+type Param struct {
+	Type  ParamType
+	Value string
+}
+
+var intRe = regexp.MustCompile(`^[0-9]+$`)
+var floatRe = regexp.MustCompile(`^([0-9]+\.[0-9]*|\.[0-9]+|[0-9]+)([eE][+-]?[0-9]+)?$`)
+var dateRe = regexp.MustCompile(`^[0-9]{4}-[0-9]{2}-[0-9]{2}( [0-9]{2}:[0-9]{2}:[0-9]{2}(\.[0-9]+)?)?$`)
+
+// Params returns the literal values in the query, in order. Identifiers,
+// including quoted identifiers, and comments are skipped.
+func Params(query string) []Param {
+	params := []Param{}
+	scan(query, func(start, end int, p Param) {
+		params = append(params, p)
+	}, nil)
+	return params
+}
+
+// MaskLiterals returns the query with every literal value replaced by "?".
+func MaskLiterals(query string) string {
+	masked := make([]byte, 0, len(query))
+	last := 0
+	scan(query, func(start, end int, p Param) {
+		masked = append(masked, query[last:start]...)
+		masked = append(masked, '?')
+		last = end
+	}, nil)
+	return string(append(masked, query[last:]...))
+}
+
+// references returns true if the query references one of the identifiers,
+// like table or column names. The identifiers must be lowercase.
+func references(query string, identifiers map[string]bool) bool {
+	found := false
+	scan(query, nil, func(name string) {
+		if identifiers[strings.ToLower(name)] {
+			found = true
+		}
+	})
+	return found
+}
+
+// scan calls literal for every literal value in the query, with its start and
+// end offsets, and ident for every identifier. Either func can be nil.
+func scan(query string, literal func(start, end int, p Param), ident func(name string)) {
+	prev := -1 // index of last non-space char, to detect unary minus
+	for i := 0; i < len(query); {
+		c := query[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			i++
+			continue
+		case c == '\'' || c == '"':
+			val, n := quoted(query[i:])
+			t := PARAM_STRING
+			if dateRe.MatchString(val) {
+				t = PARAM_DATE
+			}
+			if literal != nil {
+				literal(i, i+n, Param{Type: t, Value: val})
+			}
+			i += n
+		case c == '`':
+			val, n := quoted(query[i:])
+			if ident != nil {
+				ident(val)
+			}
+			i += n
+		case c == '#' || (c == '-' && strings.HasPrefix(query[i:], "-- ")):
+			n := strings.IndexByte(query[i:], '\n')
+			if n < 0 {
+				n = len(query) - i
+			}
+			i += n
+			continue
+		case c == '/' && strings.HasPrefix(query[i:], "/*"):
+			n := strings.Index(query[i+2:], "*/")
+			if n < 0 {
+				n = len(query) - i - 4
+			}
+			i += n + 4
+			continue
+		case isWordChar(c) || c == '.':
+			j := i + 1
+			for j < len(query) && (isWordChar(query[j]) || query[j] == '.' || isExponentSign(query[i:j], query[j])) {
+				j++
+			}
+			word := query[i:j]
+			if floatRe.MatchString(word) {
+				start := i
+				if prev > -1 && query[prev] == '-' && isUnaryMinus(query[:prev]) {
+					start = prev
+					word = "-" + word
+				}
+				t := PARAM_FLOAT
+				if intRe.MatchString(strings.TrimPrefix(word, "-")) {
+					t = PARAM_INT
+				}
+				if literal != nil {
+					literal(start, j, Param{Type: t, Value: word})
+				}
+			} else if ident != nil {
+				for _, name := range strings.Split(word, ".") {
+					if name != "" {
+						ident(name)
+					}
+				}
+			}
+			i = j
+		default:
+			i++
+		}
+		prev = i - 1
+	}
+}
+
+// quoted returns the unescaped value of the string quoted by its first char,
+// and the number of bytes consumed including the quotes.
+func quoted(s string) (string, int) {
+	q := s[0]
+	val := []byte{}
+	for i := 1; i < len(s); i++ {
+		c := s[i]
+		if c == '\\' && q != '`' && i+1 < len(s) {
+			i++
+			val = append(val, s[i])
+			continue
+		}
+		if c == q {
+			if i+1 < len(s) && s[i+1] == q { // '' or ""
+				i++
+				val = append(val, q)
+				continue
+			}
+			return string(val), i + 1
+		}
+		val = append(val, c)
+	}
+	return string(val), len(s) // unterminated
+}
+
+// isUnaryMinus returns true if a minus sign after s is a sign, not subtraction.
+func isUnaryMinus(s string) bool {
+	s = strings.TrimRight(s, " \t\n\r")
+	if s == "" {
+		return true
+	}
+	return strings.IndexByte("=<>(,+-*/", s[len(s)-1]) > -1
+}
+
+// isExponentSign returns true if c is the sign of the exponent of number n,
+// like "-" in "1e-3".
+func isExponentSign(n string, c byte) bool {
+	if (c != '+' && c != '-') || !strings.HasSuffix(strings.ToLower(n), "e") {
+		return false
+	}
+	return strings.Trim(n[:len(n)-1], "0123456789.") == "" && len(n) > 1
+}
+
+func isWordChar(c byte) bool {
+	return c == '_' || c == '$' || (c >= '0' && c <= '9') ||
+		(c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || c >= 0x80
+}
+
+// insertRows returns the number of rows in the VALUES list of an INSERT or
+// REPLACE query, or false if the query doesn't have one.
+func insertRows(query string) (uint64, bool) {
+	q := strings.TrimSpace(query)
+	n := 0
+	for n < len(q) && isWordChar(q[n]) {
+		n++
+	}
+	if w := strings.ToUpper(q[0:n]); w != "INSERT" && w != "REPLACE" {
+		return 0, false
+	}
+	var rows uint64
+	depth := 0
+	inValues := false
+	for i := 0; i < len(q); {
+		c := q[i]
+		switch {
+		case c == '\'' || c == '"' || c == '`':
+			_, n := quoted(q[i:])
+			i += n
+			continue
+		case c == '(':
+			if inValues && depth == 0 {
+				rows++
+			}
+			depth++
+		case c == ')':
+			depth--
+		case isWordChar(c):
+			j := i + 1
+			for j < len(q) && isWordChar(q[j]) {
+				j++
+			}
+			if depth == 0 {
+				if inValues {
+					// End of VALUES list, e.g. ON DUPLICATE KEY UPDATE.
+					return rows, true
+				}
+				if w := strings.ToUpper(q[i:j]); w == "VALUES" || w == "VALUE" {
+					inValues = true
+				}
+			}
+			i = j
+			continue
+		}
+		i++
+	}
+	return rows, inValues
+}
@@ -0,0 +1,81 @@
+/*
+	Copyright 2017 Daniel Nichter
+	Copyright 2014-2016 Percona LLC and/or its affiliates
+*/
+
+package slowlog_test
+
+import (
+	"testing"
+
+	"github.com/go-mysql/slowlog"
+	"github.com/go-test/deep"
+)
+
+func TestParams(t *testing.T) {
+	tests := []struct {
+		query  string
+		expect []slowlog.Param
+	}{
+		{
+			query:  "SELECT c FROM t",
+			expect: []slowlog.Param{},
+		},
+		{
+			query: "SELECT c FROM t1 WHERE id = 1 AND name = 'it''s' AND x > -1.5e-3",
+			expect: []slowlog.Param{
+				{Type: slowlog.PARAM_INT, Value: "1"},
+				{Type: slowlog.PARAM_STRING, Value: "it's"},
+				{Type: slowlog.PARAM_FLOAT, Value: "-1.5e-3"},
+			},
+		},
+		{
+			query: "SELECT * FROM `t 2` /* 3 */ WHERE d >= \"2017-01-02\" AND ts < '2017-01-02 15:04:05' AND n = col-4 -- 5",
+			expect: []slowlog.Param{
+				{Type: slowlog.PARAM_DATE, Value: "2017-01-02"},
+				{Type: slowlog.PARAM_DATE, Value: "2017-01-02 15:04:05"},
+				{Type: slowlog.PARAM_INT, Value: "4"},
+			},
+		},
+		{
+			query: "INSERT INTO t VALUES (1, 'a\\'b'), (.5, NULL)",
+			expect: []slowlog.Param{
+				{Type: slowlog.PARAM_INT, Value: "1"},
+				{Type: slowlog.PARAM_STRING, Value: "a'b"},
+				{Type: slowlog.PARAM_FLOAT, Value: ".5"},
+			},
+		},
+	}
+	for _, test := range tests {
+		got := slowlog.Params(test.query)
+		if diff := deep.Equal(got, test.expect); diff != nil {
+			t.Errorf("%s: %v", test.query, diff)
+		}
+	}
+}
+
+func TestMaskLiterals(t *testing.T) {
+	tests := []struct {
+		query  string
+		expect string
+	}{
+		{
+			query:  "SELECT c FROM t",
+			expect: "SELECT c FROM t",
+		},
+		{
+			query:  "SELECT c FROM t1 WHERE id = 1 AND name = 'it''s' AND x > - 1.5e-3",
+			expect: "SELECT c FROM t1 WHERE id = ? AND name = ? AND x > ?",
+		},
+		{
+			query:  "INSERT INTO `t 2` VALUES (1, \"a\\\"b\"), (.5, NULL) -- 5",
+			expect: "INSERT INTO `t 2` VALUES (?, ?), (?, NULL) -- 5",
+		},
+	}
+	for _, test := range tests {
+		got := slowlog.MaskLiterals(test.query)
+		if got != test.expect {
+			t.Errorf("got %s, expected %s", got, test.expect)
+		}
+	}
+}
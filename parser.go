@@ -9,26 +9,167 @@ package slowlog
 
 import (
 	"bufio"
+	"bytes"
+	"context"
 	"errors"
 	"fmt"
 	"io"
+	"io/ioutil"
 	"log"
+	"math"
+	"math/rand"
 	"os"
 	"regexp"
+	"runtime/debug"
+	"sort"
 	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
+	"time"
+	"unicode/utf8"
+)
+
+const (
+	// DEFAULT_MAX_HEADER_LINES is the default Options.MaxHeaderLines.
+	DEFAULT_MAX_HEADER_LINES = 100
+
+	// DEFAULT_MAX_QUOTED_LINES is the default Options.MaxQuotedLines.
+	DEFAULT_MAX_QUOTED_LINES = 100
+
+	// DEFAULT_FOLLOW_INTERVAL is the default Options.FollowInterval.
+	DEFAULT_FOLLOW_INTERVAL = time.Second
+
+	// DEFAULT_PROGRESS_INTERVAL is the default Options.ProgressInterval.
+	DEFAULT_PROGRESS_INTERVAL = time.Second
+)
+
+// DSTResolution determines how a Ts without a time zone is resolved when it
+// is ambiguous (repeated when clocks go back) or invalid (skipped when clocks
+// go forward) in Options.Location due to a daylight saving time transition.
+type DSTResolution int
+
+const (
+	DST_EARLIEST DSTResolution = iota // earliest possible time (default)
+	DST_LATEST                        // latest possible time
+	DST_UTC                           // assume Ts is UTC
 )
 
 var (
-	// ErrStarted is returned if Parser.Start is called more than once.
+	// ErrStarted is returned if Parser.Start is called while the parser is
+	// running.
 	ErrStarted = errors.New("parser is started")
 )
 
 // Options encapsulate common options for making a new LogParser.
 type Options struct {
-	StartOffset        uint64          // byte offset in file at which to start parsing
-	FilterAdminCommand map[string]bool // admin commands to ignore
+	StartOffset            uint64          // byte offset in file at which to start parsing
+	EndOffset              uint64          // stop parsing at the first event with Event.Offset at or after this offset (default: 0, no end)
+	MaxBytes               uint64          // stop parsing at the first event this many bytes after StartOffset, like EndOffset (default: 0, no max)
+	FilterAdminCommand     map[string]bool // admin commands to ignore
+	Source                 string          // Event.Source (default: file name)
+	MaxHeaderLines         uint            // resync after this many header lines (default: DEFAULT_MAX_HEADER_LINES)
+	Location               *time.Location  // time zone of Ts without one (default: UTC)
+	DST                    DSTResolution   // how to resolve ambiguous Ts in Location
+	ExtractParams          bool            // set Event.Params
+	InheritDbPerConnection bool            // set empty Event.Db to last db of same connection (Thread_id)
+	InsertRows             bool            // set Insert_rows metric to number of rows in INSERT VALUES
+	SensitiveNames         []string        // mask literals in queries that reference these table or column names
+	Follow                 bool            // at end of file, wait for new lines until stopped, like tail -f
+	FollowInterval         time.Duration   // how often to check for new lines (default: DEFAULT_FOLLOW_INTERVAL)
+	MaxEventsPerSecond     float64         // throttle sending events (default: 0, no limit)
+	EventBurst             uint            // events sent without throttling after being idle (default: 1 second of events, at least 1)
+	MaxBytesPerSecond      float64         // throttle reading the file (default: 0, no limit)
+	ByteBurst              uint64          // bytes read without throttling after being idle (default: 1 second of bytes, at least 1)
+	QuoteAware             bool            // lines in a multi-line string literal or quoted identifier are query, even if they look like a header
+	MaxQuotedLines         uint            // if QuoteAware, quote is unclosed after this many lines (default: DEFAULT_MAX_QUOTED_LINES)
+	HeaderFilter           HeaderFilter    // skip events before parsing all metrics and query
+	Since                  time.Time       // skip events with Event.Time before this time (default: zero, no start)
+	Until                  time.Time       // stop parsing at the first event with Event.Time at or after this time (default: zero, no end)
+	MinQueryTime           time.Duration   // skip events with Query_time less than this (default: 0, no min)
+	Include                []EventMatch    // skip events that do not match one of these (default: none, all events)
+	Exclude                []EventMatch    // skip events that match one of these
+	SampleRate             float64         // keep events with this probability, like 0.01 (default: 0, all events)
+	EveryNth               uint            // keep the first of every N events (default: 0, all events)
+	Clock                  Clock           // time for Follow and rate limits (default: WallClock)
+	MetricsSink            MetricsSink     // send parser runtime metrics, like PARSER_LINES (default: none)
+	MetricBounds           MetricBounds    // clamp or reject implausible metric values
+	Compression            Compression     // decompress or decrypt the log (default: COMPRESSION_NONE)
+	Decrypt                Decompressor    // decrypt COMPRESSION_AGE and COMPRESSION_PGP logs with the key (default: none)
+	TimeOffset             time.Duration   // added to Event.Time to correct clock skew, see ClockOffsets
+	TimeUnits              TimeUnits       // unit of time metrics not logged in seconds (default: none, all in seconds)
+	BufferSize             int             // size of the read buffer, used only by the first Start (default: 4096)
+	MaxQueryBytes          uint64          // truncate Event.Query and longer lines to this many bytes (default: 0, no max)
+	Logger                 Logger          // log diagnostics of this parser (default: none, or the log package if Debug)
+	LogLevel               LogLevel        // what to log to Logger (default: LOG_ANOMALIES)
+	PoolEvents             bool            // send events to PooledEvents, not Events, see Event.Release
+	Mmap                   bool            // parse a file from a memory mapping instead of buffered reads, see ReaderParser
+	Progress               ProgressFunc    // report bytes read while parsing (default: none)
+	ProgressInterval       time.Duration   // how often to call Progress (default: DEFAULT_PROGRESS_INTERVAL)
+}
+
+// MetricBounds are MetricBound keyed on time or number metric name.
+type MetricBounds map[string]MetricBound
+
+// TimeUnits are the units in which time metrics are logged, like
+// time.Millisecond, keyed on metric name. Time metrics are in seconds: the
+// values of these metrics are converted from their unit to seconds. Metrics
+// in TimeUnits are time metrics even if their name does not end with _time or
+// _wait, like Exec_ms.
+type TimeUnits map[string]time.Duration
+
+// A MetricBound is the range of plausible values of a metric, like 0 to 86400
+// for Query_time. Values out of range, usually from corrupt lines, are clamped
+// to the range, or the event is rejected. Both are counted in Stats.
+type MetricBound struct {
+	Min    float64
+	Max    float64 // no max if 0
+	Reject bool    // skip the event instead of clamping the value
+}
+
+// A HeaderFilter returns false to skip an event early: after parsing its Ts,
+// Time, User, Host, Db if logged in the header (Percona Server and MariaDB
+// Schema), and Query_time, but before parsing its other metrics and query.
+// Skipped events are counted in Stats.Skipped. Skipped events are not seen by
+// Options.InheritDbPerConnection.
+type HeaderFilter func(e Event) bool
+
+// A ProgressFunc reports parsing progress, like a progress bar or ETA.
+// bytesRead is Stats.BytesRead, and totalBytes is the size of the file, or 0
+// if unknown, like for a compressed file or a stream. It is called at most
+// once per Options.ProgressInterval while parsing and once more when parsing
+// reaches the end of the file or range, in the parser goroutine: it must
+// return quickly.
+type ProgressFunc func(bytesRead, totalBytes uint64)
+
+// Stats are parser progress and counters of anomalies encountered while
+// parsing. Anomalies are not errors: the parser handles them and keeps parsing.
+// Progress shows if the parser is stuck or falling behind: BytesBehind is how
+// far it is from the end of the file, and LastEventTime is the time of the
+// last event it sent.
+type Stats struct {
+	BytesRead      uint64          // file offset after the last line read
+	BytesBehind    uint64          // file size minus BytesRead, when Stats was called
+	Events         uint64          // events sent
+	LastEventTime  time.Time       // Event.Time of the last event sent, zero if none
+	RunawayHeaders uint64          // headers longer than Options.MaxHeaderLines
+	UnclosedQuotes uint64          // quotes open longer than Options.MaxQuotedLines
+	Skipped        uint64          // events skipped by filters
+	ClampedValues  uint64          // metric values clamped to Options.MetricBounds
+	RejectedEvents uint64          // events skipped because a metric is out of Options.MetricBounds
+	Truncated      uint64          // queries truncated to Options.MaxQueryBytes
+	Dropped        uint64          // events without Query_time
+	Errors         uint64          // non-fatal parse errors, like ErrRunawayHeader, see ReaderParser.Errors
+	Failed         bool            // parsing stopped on an error, see ReaderParser.Error
+	UnknownMetrics []UnknownMetric // metrics not in KnownMetrics, sorted by name
+}
+
+// An UnknownMetric is a metric that is not in KnownMetrics. It is parsed like
+// other metrics by its value and name suffix, but it might be parsed wrong.
+type UnknownMetric struct {
+	Name  string
+	Value string // first value seen
+	Count uint64 // number of times seen
 }
 
 // A Parser parses events from a slow log. The canonical Parser is FileParser
@@ -42,92 +183,237 @@ type Parser interface {
 	Error() error
 }
 
-// Regular expressions to match important lines in slow log.
-var timeRe = regexp.MustCompile(`Time: (\S+\s{1,2}\S+)`)
-var userRe = regexp.MustCompile(`User@Host: ([^\[]+|\[[^[]+\]).*?@ (\S*) \[(.*)\]`)
-var schema = regexp.MustCompile(`Schema: +(.*?) +Last_errno:`)
-var headerRe = regexp.MustCompile(`^#\s+[A-Z]`)
-var metricsRe = regexp.MustCompile(`(\w+): (\S+|\z)`)
+// Regular expressions to match query and admin lines. Header lines are
+// scanned, see scan.go.
 var adminRe = regexp.MustCompile(`command: (.+)`)
 var setRe = regexp.MustCompile(`^SET (?:last_insert_id|insert_id|timestamp)`)
 var useRe = regexp.MustCompile(`^(?i)use `)
+var tsZoneRe = regexp.MustCompile(`(Z|[+-]\d\d:\d\d)$`)
 
-// FileParser represents a file-based Parser. This is the canonical Parser
-// because the slow log is a file.
-type FileParser struct {
-	file *os.File
+// ReaderParser is a Parser that reads from an io.Reader, like a network
+// stream, gzip reader, or in-memory buffer. If the reader is an io.Seeker, like
+// a file, the parser seeks to Options.StartOffset and can be restarted at any
+// offset. Else, it skips StartOffset bytes on the first Start, and a restart
+// continues where the previous parse stopped reading.
+//
+// With Options.Mmap, an uncompressed file is memory-mapped on each Start and
+// lines are copied once from the mapping, which is faster for very large
+// files and makes restarting at another offset cheap. Mmap is ignored with
+// Follow, for other readers, and on platforms without mmap. The file must not
+// be truncated while it is mapped: reading past its new end is a fatal
+// error.
+type ReaderParser struct {
+	r      io.Reader
+	reader *bufio.Reader
 	// --
 	opt         Options
 	stopChan    chan struct{}
 	eventChan   chan Event
+	pooledChan  chan *Event // if opt.PoolEvents
+	doneChan    chan struct{}
+	backfilled  chan struct{}
 	inHeader    bool
 	inQuery     bool
 	headerLines uint
 	queryLines  uint64
 	bytesRead   uint64
 	lineOffset  uint64
+	lineStart   uint64 // byte offset of the current line, unlike lineOffset
+	lineNo      uint64 // number of the current line, counting from opt.StartOffset
+	line        string // current line, for ParseError
+	eventStart  uint64 // lineStart of the first line of the event
+	eventLine   uint64 // lineNo of the first line of the event
+	errChan     chan *ParseError
 	started     bool
+	resync      bool
 	event       *Event
 	err         error
+	failed      int32 // 1 if err is set, for Stats.Failed
+	stats       Stats
+	lastEventTs atomic.Value // stats.LastEventTime
+	unknown     map[string]*UnknownMetric
+	unknownMu   *sync.Mutex
+	newOpt      *Options // from UpdateOptions
+	newOptMu    *sync.Mutex
+	hasNewOpt   int32             // 1 if newOpt is set
+	connId      uint64            // Id from User@Host line
+	connDb      map[uint64]string // last db per connection if opt.InheritDbPerConnection
+	sensitive   map[string]bool   // lowercase opt.SensitiveNames
+	quote       byte              // open quote at end of query line if opt.QuoteAware, else 0
+	quotedLines uint              // lines since quote opened
+	skip        bool              // event skipped by filters
+	eventLimit  *limiter          // nil if no opt.MaxEventsPerSecond
+	byteLimit   *limiter          // nil if no opt.MaxBytesPerSecond
+	behindTs    time.Time         // when PARSER_BYTES_BEHIND was last set
+	progressTs  time.Time         // when opt.Progress was last called
+	compressed  bool              // reader decompresses r, see decompress
+	pastEnd     bool              // event begins at or after opt.EndOffset or opt.Until
+	lastTime    time.Time         // Event.Time of the last event with Ts
+	matchDb     bool              // opt.Include or opt.Exclude has a Db pattern
+	nth         uint              // events since the last kept event if opt.EveryNth
+	sampleRand  *rand.Rand        // if opt.SampleRate
+	sampling    uint              // Event.RateLimit factor of opt.SampleRate and opt.EveryNth, see sampleFactor
+	sampleLate  bool              // sample the current event when it's sent, see keepHeader
+	truncated   bool              // current line truncated to opt.MaxQueryBytes
+	logger      Logger            // opt.Logger, or the log package if Debug; nil if not logging
+	debug       bool              // log every line: opt.LogLevel is LOG_DEBUG, or Debug
+	mapped      []byte            // file mapped if opt.Mmap, else nil
+	mapOffset   int               // offset in mapped of the next line
 	*sync.Mutex
 }
 
+// Debug logs everything that parsers without Options.Logger do to the log
+// package. Use Options.Logger to log one parser.
 var Debug = false
 
-// NewFileParser returns a new FileParser that reads from the open file.
-// The file is not closed.
-func NewFileParser(file *os.File) *FileParser {
-	p := &FileParser{
-		file: file,
+// NewParser returns a new ReaderParser that reads from r. If r is an
+// io.Closer, it is not closed.
+func NewParser(r io.Reader) *ReaderParser {
+	p := &ReaderParser{
+		r:      r,
+		reader: bufio.NewReader(r),
 		// --
 		stopChan:    make(chan struct{}),
 		eventChan:   make(chan Event),
+		pooledChan:  make(chan *Event),
+		doneChan:    make(chan struct{}),
+		backfilled:  make(chan struct{}),
+		errChan:     make(chan *ParseError, ERRORS_BUFFER),
 		inHeader:    false,
 		inQuery:     false,
 		headerLines: 0,
 		queryLines:  0,
 		lineOffset:  0,
 		event:       NewEvent(),
+		unknown:     map[string]*UnknownMetric{},
+		unknownMu:   &sync.Mutex{},
+		newOptMu:    &sync.Mutex{},
 		Mutex:       &sync.Mutex{},
 	}
 	return p
 }
 
+// FileParser represents a file-based Parser. This is the canonical Parser
+// because the slow log is a file. It is a ReaderParser for the file, so it
+// seeks to Options.StartOffset, and Stats.BytesBehind is the number of bytes
+// to the end of the file.
+type FileParser struct {
+	*ReaderParser
+}
+
+// NewFileParser returns a new FileParser that reads from the open file.
+// The file is not closed.
+func NewFileParser(file *os.File) *FileParser {
+	return &FileParser{NewParser(file)}
+}
+
 // Stop stops the parser before parsing the next event or while blocked on
 // sending the current event to the event channel.
-func (p *FileParser) Stop() {
+func (p *ReaderParser) Stop() {
 	p.Lock()
 	defer p.Unlock()
-	if Debug {
-		log.Println("stopping")
-	}
 	if !p.started {
 		return
 	}
-	close(p.stopChan)
+	select {
+	case <-p.stopChan:
+		// already stopped
+	default:
+		close(p.stopChan)
+	}
 	return
 }
 
+// StartContext starts the parser like Start and stops it like Stop when the
+// context is canceled or its deadline is exceeded. Error does not return the
+// context error; check ctx.Err.
+func (p *ReaderParser) StartContext(ctx context.Context, opt Options) error {
+	if err := p.Start(opt); err != nil {
+		return err
+	}
+	p.Lock()
+	stopChan, doneChan := p.stopChan, p.doneChan
+	p.Unlock()
+	go func() {
+		select {
+		case <-ctx.Done():
+			// Close this run's stopChan, not p.stopChan, in case the
+			// parser was restarted.
+			p.Lock()
+			select {
+			case <-stopChan:
+			default:
+				close(stopChan)
+			}
+			p.Unlock()
+		case <-doneChan:
+		}
+	}()
+	return nil
+}
+
 // Start starts the parser. Events are sent to the unbuffered Events channel.
 // Parsing stops on EOF, error, or call to Stop. The Events channel is closed
 // when parsing stops.
-func (p *FileParser) Start(opt Options) error {
+//
+// The parser can be started again after parsing stops, usually with a new
+// StartOffset, to resume parsing the same file. Each restart makes a new
+// Events channel, so call Events again after calling Start.
+func (p *ReaderParser) Start(opt Options) error {
 	p.Lock()
 	defer p.Unlock()
+	restart := false
 	if p.started {
-		return ErrStarted
+		select {
+		case <-p.stopChan:
+			<-p.doneChan // wait for parse to return
+		case <-p.doneChan:
+		default:
+			return ErrStarted
+		}
+		p.reset()
+		restart = true
 	}
 
-	p.opt = opt
+	p.setOptions(opt)
+	p.newOptMu.Lock()
+	p.newOpt = nil
+	atomic.StoreInt32(&p.hasNewOpt, 0)
+	p.newOptMu.Unlock()
 
-	// Seek to the offset, if any.
-	if p.opt.StartOffset > 0 {
-		if _, err := p.file.Seek(int64(p.opt.StartOffset), os.SEEK_SET); err != nil {
+	if !restart {
+		if opt.BufferSize > 0 {
+			p.reader = bufio.NewReaderSize(p.r, opt.BufferSize)
+		}
+		if err := p.decompress(); err != nil {
 			return err
 		}
 	}
 
-	p.bytesRead = opt.StartOffset
+	// Seek to the offset, if any. On restart, always seek because the reader
+	// has buffered past where the previous parse stopped. If the reader can't
+	// seek, or it's compressed, skip to the offset on the first start, and
+	// continue where the previous parse stopped on restart.
+	if seeker, ok := p.r.(io.Seeker); ok && !p.compressed {
+		if p.opt.StartOffset > 0 || restart {
+			if _, err := seeker.Seek(int64(p.opt.StartOffset), os.SEEK_SET); err != nil {
+				return err
+			}
+			p.reader.Reset(p.r)
+		}
+		atomic.StoreUint64(&p.bytesRead, opt.StartOffset)
+	} else if !restart {
+		if _, err := io.CopyN(ioutil.Discard, p.reader, int64(opt.StartOffset)); err != nil {
+			return err
+		}
+		atomic.StoreUint64(&p.bytesRead, opt.StartOffset)
+	}
+
+	if opt.Mmap && !opt.Follow && !p.compressed {
+		if err := p.mmap(); err != nil {
+			return err
+		}
+	}
 
 	go p.parse()
 	p.started = true
@@ -137,34 +423,160 @@ func (p *FileParser) Start(opt Options) error {
 
 // Events returns the channel to which events from the slow log are sent.
 // The channel is closed when there are no more events. Events are not sent
-// until Start is called.
-func (p *FileParser) Events() <-chan Event {
+// until Start is called. If Options.PoolEvents is true, no events are sent to
+// it and it is only closed when parsing stops, so receive from PooledEvents
+// instead.
+func (p *ReaderParser) Events() <-chan Event {
+	p.Lock()
+	defer p.Unlock()
 	return p.eventChan
 }
 
-// Error returns an error, if any, encountered while parsing the slow log.
-func (p *FileParser) Error() error {
+// PooledEvents returns the channel to which events are sent if
+// Options.PoolEvents is true, instead of Events. Events are from a pool: call
+// Release when done with each event, so the next event reuses it and its maps
+// instead of allocating new ones. The channel is closed when there are no more
+// events, like Events.
+func (p *ReaderParser) PooledEvents() <-chan *Event {
+	p.Lock()
+	defer p.Unlock()
+	return p.pooledChan
+}
+
+// Backfilled returns a channel that is closed when the parser reaches the end
+// of the file, after the last event in the file has been received from Events.
+// With Options.Follow, events received after it is closed are live: they were
+// written to the file after the parser started. Without Options.Follow, it is
+// closed just before Events is closed. It is not closed if the parser is
+// stopped or fails before reaching the end of the file.
+func (p *ReaderParser) Backfilled() <-chan struct{} {
+	p.Lock()
+	defer p.Unlock()
+	return p.backfilled
+}
+
+// Error returns an error, if any, encountered while parsing the slow log. It
+// is a *ParseError with the line at which parsing failed.
+func (p *ReaderParser) Error() error {
 	return p.err
 }
 
+// Errors returns the channel to which non-fatal parse errors, like
+// ErrRunawayHeader, are sent while parsing continues. Every error is a
+// *ParseError. Errors are dropped, not sent, if the channel buffer
+// (ERRORS_BUFFER) is full, so reading the channel is optional. The channel is
+// closed when parsing stops. Each restart makes a new channel, so call Errors
+// again after calling Start.
+func (p *ReaderParser) Errors() <-chan *ParseError {
+	p.Lock()
+	defer p.Unlock()
+	return p.errChan
+}
+
+// UpdateOptions changes the options while parsing. The new options are used
+// starting with the next event. StartOffset and PoolEvents are ignored. It is
+// safe to call at any time, but Start drops options not yet used, like options
+// updated while the parser is not running: the options passed to Start are
+// used instead.
+func (p *ReaderParser) UpdateOptions(opt Options) {
+	p.newOptMu.Lock()
+	p.newOpt = &opt
+	atomic.StoreInt32(&p.hasNewOpt, 1)
+	p.newOptMu.Unlock()
+}
+
+// Stats returns a snapshot of the parser stats. It is safe to call while
+// parsing.
+func (p *ReaderParser) Stats() Stats {
+	s := Stats{
+		BytesRead:      atomic.LoadUint64(&p.bytesRead),
+		Events:         atomic.LoadUint64(&p.stats.Events),
+		RunawayHeaders: atomic.LoadUint64(&p.stats.RunawayHeaders),
+		UnclosedQuotes: atomic.LoadUint64(&p.stats.UnclosedQuotes),
+		Skipped:        atomic.LoadUint64(&p.stats.Skipped),
+		ClampedValues:  atomic.LoadUint64(&p.stats.ClampedValues),
+		RejectedEvents: atomic.LoadUint64(&p.stats.RejectedEvents),
+		Truncated:      atomic.LoadUint64(&p.stats.Truncated),
+		Dropped:        atomic.LoadUint64(&p.stats.Dropped),
+		Errors:         atomic.LoadUint64(&p.stats.Errors),
+		Failed:         atomic.LoadInt32(&p.failed) == 1,
+	}
+	if ts, ok := p.lastEventTs.Load().(time.Time); ok {
+		s.LastEventTime = ts
+	}
+	s.BytesBehind = p.bytesBehind()
+	p.unknownMu.Lock()
+	for _, m := range p.unknown {
+		s.UnknownMetrics = append(s.UnknownMetrics, *m)
+	}
+	p.unknownMu.Unlock()
+	sort.Slice(s.UnknownMetrics, func(i, j int) bool {
+		return s.UnknownMetrics[i].Name < s.UnknownMetrics[j].Name
+	})
+	return s
+}
+
+// reset resets the parser to restart parsing. The reader is reused to keep
+// its buffer if Start does not seek. The caller must hold the lock.
+func (p *ReaderParser) reset() {
+	p.stopChan = make(chan struct{})
+	p.eventChan = make(chan Event)
+	p.pooledChan = make(chan *Event)
+	p.doneChan = make(chan struct{})
+	p.backfilled = make(chan struct{})
+	p.errChan = make(chan *ParseError, ERRORS_BUFFER)
+	p.lineNo = 0
+	p.inHeader = false
+	p.inQuery = false
+	p.headerLines = 0
+	p.queryLines = 0
+	p.lineOffset = 0
+	p.resync = false
+	p.connId = 0
+	p.quote = 0
+	p.quotedLines = 0
+	p.skip = false
+	p.sampleLate = false
+	p.pastEnd = false
+	p.lastTime = time.Time{}
+	p.nth = 0
+	p.progressTs = time.Time{}
+	p.event = NewEvent()
+	p.err = nil
+	atomic.StoreInt32(&p.failed, 0)
+}
+
 // --------------------------------------------------------------------------
 
-func (p *FileParser) parse() {
+func (p *ReaderParser) parse() {
+	defer close(p.doneChan)
+	defer close(p.errChan)
+	defer p.munmap()
 	defer func() {
 		if e := recover(); e != nil {
-			p.err = fmt.Errorf("crash: %s", e)
+			p.err = p.lineError(fmt.Errorf("crash: %s", e))
+			atomic.StoreInt32(&p.failed, 1)
 		}
 	}()
+	if p.mapped != nil {
+		// Fault, like reading a truncated file, instead of crashing.
+		debug.SetPanicOnFault(true)
+	}
 
 	defer close(p.eventChan)
+	defer close(p.pooledChan)
 
-	if Debug {
+	if Debug && p.opt.Logger == nil {
 		log.SetFlags(log.Ltime | log.Lmicroseconds)
-		fmt.Println()
-		log.Println("parsing " + p.file.Name())
+	}
+	if p.debug {
+		p.logger.Printf("parsing %s", p.name())
 	}
 
-	r := bufio.NewReader(p.file)
+	r := p.reader
+	backfilled := false
+	partial := "" // last line without newline in Follow mode
+	var partialLen uint64
 
 SCANNER_LOOP:
 	for {
@@ -174,29 +586,78 @@ SCANNER_LOOP:
 		default:
 		}
 
-		line, err := r.ReadString('\n')
+		line, n, truncated, err := p.readLine(r)
 		if err != nil {
 			if err != io.EOF {
-				p.err = fmt.Errorf("bufio.NewReader.ReadString: %s", err)
+				p.err = &ParseError{
+					Offset: atomic.LoadUint64(&p.bytesRead),
+					Line:   p.lineNo + 1,
+					Err:    fmt.Errorf("bufio.NewReader.ReadString: %s", err),
+				}
+				atomic.StoreInt32(&p.failed, 1)
 				return
 			}
-			break SCANNER_LOOP
+			if !p.opt.Follow {
+				break SCANNER_LOOP
+			}
+			// The rest of a partial line hasn't been written yet.
+			partial += line
+			partialLen += n
+			p.truncated = p.truncated || truncated
+			if !backfilled {
+				if p.debug {
+					p.logger.Printf("backfilled")
+				}
+				if p.queryLines > 0 {
+					p.sendEvent(false, false)
+				}
+				close(p.backfilled)
+				backfilled = true
+			}
+			if p.opt.MetricsSink != nil {
+				p.opt.MetricsSink.Set(PARSER_BYTES_BEHIND, float64(p.bytesBehind()))
+			}
+			p.progress(false)
+			select {
+			case <-p.stopChan:
+				return
+			case <-p.opt.Clock.After(p.opt.FollowInterval):
+			}
+			continue
 		}
+		if partial != "" {
+			line = partial + line
+			n += partialLen
+			truncated = p.truncated || truncated
+			partial = ""
+			partialLen = 0
+		}
+		p.truncated = truncated
 
-		lineLen := uint64(len(line))
-		p.bytesRead += lineLen
-		p.lineOffset = p.bytesRead - lineLen
+		if p.byteLimit != nil && !p.byteLimit.wait(float64(n), p.stopChan) {
+			return
+		}
+		atomic.AddUint64(&p.bytesRead, n)
+		p.lineStart = p.bytesRead - n
+		p.lineOffset = p.lineStart
+		p.lineNo++
+		if p.opt.MetricsSink != nil {
+			p.opt.MetricsSink.Add(PARSER_LINES, 1)
+			p.opt.MetricsSink.Add(PARSER_BYTES, float64(n))
+		}
+		p.progress(false)
 		if p.lineOffset != 0 {
 			// @todo Need to get clear on why this is needed;
 			// it does make the value correct; an off-by-one issue
 			p.lineOffset += 1
 		}
 
-		if Debug {
-			fmt.Println()
-			log.Printf("+%d line: %s", p.lineOffset, line)
+		if p.debug {
+			p.logger.Printf("+%d line: %s", p.lineOffset, line)
 		}
 
+		lineLen := uint64(len(line))
+
 		// Filter out meta lines:
 		//   /usr/local/bin/mysqld, Version: 5.6.15-62.0-tokudb-7.1.0-tokudb-log (binary). started with:
 		//   Tcp port: 3306  Unix socket: /var/lib/mysql/mysql.sock
@@ -205,135 +666,340 @@ SCANNER_LOOP:
 			(line[0:5] == "Time ") ||
 			(line[0:4] == "Tcp ") ||
 			(line[0:4] == "TCP ")) {
-			if Debug {
-				log.Println("meta")
+			if p.debug {
+				p.logger.Printf("meta")
 			}
 			continue
 		}
 
 		// Remove \n.
 		line = line[0 : lineLen-1]
+		p.line = line
+
+		// After a runaway header, skip lines until the next event.
+		if p.resync {
+			if !strings.HasPrefix(line, "# Time") && !strings.HasPrefix(line, "# User") {
+				continue
+			}
+			if p.debug {
+				p.logger.Printf("resync")
+			}
+			p.resync = false
+		}
 
 		if p.inHeader {
 			p.parseHeader(line)
 		} else if p.inQuery {
 			p.parseQuery(line)
-		} else if headerRe.MatchString(line) {
+		} else if isHeader(line) {
 			p.inHeader = true
 			p.inQuery = false
 			p.parseHeader(line)
 		}
+
+		// An event that begins before EndOffset is parsed to its end, even if
+		// it ends after EndOffset, so consecutive ranges parse every event once.
+		if p.pastEnd {
+			if p.debug {
+				p.logger.Printf("end at offset %d", p.lineOffset)
+			}
+			p.event = NewEvent()
+			p.headerLines = 0
+			break SCANNER_LOOP
+		}
 	}
 
 	if p.queryLines > 0 {
 		p.sendEvent(false, false)
 	}
+	if p.opt.MetricsSink != nil {
+		p.opt.MetricsSink.Set(PARSER_BYTES_BEHIND, float64(p.bytesBehind()))
+	}
+	p.progress(true)
+	if !backfilled {
+		close(p.backfilled)
+	}
 
-	if Debug {
-		log.Printf("\ndone")
+	if p.debug {
+		select {
+		case <-p.stopChan:
+			p.logger.Printf("stopped")
+		default:
+		}
+		p.logger.Printf("done")
 	}
 }
 
 // --------------------------------------------------------------------------
 
-func (p *FileParser) parseHeader(line string) {
-	if Debug {
-		log.Println("header")
+func (p *ReaderParser) parseHeader(line string) {
+	if p.debug {
+		p.logger.Printf("header")
 	}
 
-	if !headerRe.MatchString(line) {
+	if !isHeader(line) && !isExtHeader(line) {
 		p.inHeader = false
 		p.inQuery = true
 		p.parseQuery(line)
 		return
 	}
 
+	// A # Time line begins a new header. If we're already in a header, the
+	// previous one had no query (e.g. double headers after a flush), so throw
+	// it away and let this header be the authoritative one.
+	if p.headerLines > 0 && strings.HasPrefix(line, "# Time") {
+		if p.logger != nil {
+			p.logger.Printf("discarding header without query")
+		}
+		p.event = NewEvent()
+		p.headerLines = 0
+	}
+
 	if p.headerLines == 0 {
 		p.event.Offset = p.lineOffset
+		p.eventStart = p.lineStart
+		p.eventLine = p.lineNo
+		if end := p.endOffset(); end > 0 && p.lineOffset >= end {
+			p.pastEnd = true
+			return
+		}
 	}
 	p.headerLines++
 
+	// Too many header lines means the file is corrupt or this isn't a slow
+	// log. Throw away the event and resync on the next one.
+	if p.headerLines > p.opt.MaxHeaderLines {
+		if p.logger != nil {
+			p.logger.Printf("runaway header at %d", p.event.Offset)
+		}
+		atomic.AddUint64(&p.stats.RunawayHeaders, 1)
+		p.report(p.eventError(ErrRunawayHeader))
+		p.event = NewEvent()
+		p.headerLines = 0
+		p.inHeader = false
+		p.inQuery = false
+		p.resync = true
+		return
+	}
+
 	if strings.HasPrefix(line, "# Time") {
-		if Debug {
-			log.Println("time")
+		if p.debug {
+			p.logger.Printf("time")
 		}
-		m := timeRe.FindStringSubmatch(line)
-		if len(m) < 2 {
+		ts, ok := scanTime(line)
+		if !ok {
 			return
 		}
-		p.event.Ts = m[1]
-		if userRe.MatchString(line) {
-			if Debug {
-				log.Println("user (bad format)")
+		p.event.Ts = ts
+		if t, ambiguous, err := parseTs(p.event.Ts, p.opt.Location, p.opt.DST); err != nil {
+			if p.logger != nil {
+				p.logger.Printf("invalid time: %s", err)
 			}
-			m := userRe.FindStringSubmatch(line)
-			p.event.User = m[1]
-			p.event.Host = m[2]
+			p.report(p.lineError(err))
+		} else {
+			p.event.Time = t.Add(p.opt.TimeOffset)
+			p.event.TimeAmbiguous = ambiguous
+			p.lastTime = p.event.Time
+		}
+		if user, host, ok := scanUserHost(line); ok {
+			if p.debug {
+				p.logger.Printf("user (bad format)")
+			}
+			p.event.User = user
+			p.event.Host = host
 		}
 	} else if strings.HasPrefix(line, "# User") {
-		if Debug {
-			log.Println("user")
+		if p.debug {
+			p.logger.Printf("user")
 		}
-		m := userRe.FindStringSubmatch(line)
-		if len(m) < 3 {
+		user, host, ok := scanUserHost(line)
+		if !ok {
 			return
 		}
-		p.event.User = m[1]
-		p.event.Host = m[2]
+		p.event.User = user
+		p.event.Host = host
+		if id, ok := scanId(line); ok {
+			p.connId, _ = strconv.ParseUint(id, 10, 64)
+		}
 	} else if strings.HasPrefix(line, "# admin") {
 		p.parseAdmin(line)
+	} else if id, db, qcHit, ok := scanMariadbThread(line); ok {
+		// MariaDB: # Thread_id: 5  Schema: shop  QC_hit: No
+		// Schema is empty if there's no current db.
+		if p.debug {
+			p.logger.Printf("thread")
+		}
+		if p.skip {
+			return
+		}
+		setMetric(p.event, "Thread_id", id)
+		if db != "" {
+			p.event.Db = db
+		}
+		setMetric(p.event, "QC_hit", qcHit)
+	} else if strings.HasPrefix(line, "# Stored routine:") {
+		// MariaDB: stored procedure or function that executed the query
+		if p.debug {
+			p.logger.Printf("stored routine")
+		}
+		if !p.skip {
+			setExtra(p.event, "Stored_routine", strings.TrimSpace(strings.TrimPrefix(line, "# Stored routine:")))
+		}
+	} else if strings.HasPrefix(line, "# explain:") {
+		// MariaDB log_slow_verbosity=explain: EXPLAIN output, one row per line
+		if p.debug {
+			p.logger.Printf("explain")
+		}
+		if !p.skip {
+			setExtra(p.event, "explain", strings.TrimSpace(strings.TrimPrefix(line, "# explain:")))
+		}
 	} else {
-		if Debug {
-			log.Println("metrics")
-		}
-		submatch := schema.FindStringSubmatch(line)
-		if len(submatch) == 2 {
-			p.event.Db = submatch[1]
-		}
-
-		m := metricsRe.FindAllStringSubmatch(line, -1)
-		for _, smv := range m {
-			// [String, Metric, Value], e.g. ["Query_time: 2", "Query_time", "2"]
-			if strings.HasSuffix(smv[1], "_time") || strings.HasSuffix(smv[1], "_wait") {
-				// microsecond value
-				val, _ := strconv.ParseFloat(smv[2], 32)
-				p.event.TimeMetrics[smv[1]] = float64(val)
-			} else if smv[2] == "Yes" || smv[2] == "No" {
-				// boolean value
-				if smv[2] == "Yes" {
-					p.event.BoolMetrics[smv[1]] = true
-				} else {
-					p.event.BoolMetrics[smv[1]] = false
-				}
-			} else if smv[1] == "Schema" {
-				p.event.Db = smv[2]
-			} else if smv[1] == "Log_slow_rate_type" {
-				p.event.RateType = smv[2]
-			} else if smv[1] == "Log_slow_rate_limit" {
-				val, _ := strconv.ParseUint(smv[2], 10, 64)
-				p.event.RateLimit = uint(val)
-			} else if smv[1] == "InnoDB_trx_id" {
-				continue // ignore
-			} else {
-				// integer value
-				val, _ := strconv.ParseUint(smv[2], 10, 64)
-				p.event.NumberMetrics[smv[1]] = val
+		if p.debug {
+			p.logger.Printf("metrics")
+		}
+		if p.skip {
+			return
+		}
+		if db, ok := scanSchema(line); ok {
+			p.event.Db = db
+		}
+
+		// Filter on the header fields and Query_time before parsing the
+		// other metrics and query, which is most of the work.
+		if qt, ok := scanQueryTime(line); ok && !p.keepHeader(qt) {
+			if p.pastEnd {
+				return
+			}
+			if p.debug {
+				p.logger.Printf("skip")
 			}
+			atomic.AddUint64(&p.stats.Skipped, 1)
+			p.skip = true
+			return
 		}
+
+		scanMetrics(line, func(name, val string) {
+			// e.g. "Query_time" and "2"
+			if !knownMetric(name) {
+				p.unknownMetric(name, val)
+			}
+			if unit, ok := p.opt.TimeUnits[name]; ok {
+				setTimeMetric(p.event, name, val, unit)
+				return
+			}
+			if err := setMetric(p.event, name, val); err != nil && p.debug {
+				p.logger.Printf("extra %s: %s", name, err)
+			}
+		})
 	}
 }
 
-func (p *FileParser) parseQuery(line string) {
-	if Debug {
-		log.Println("query")
+// setMetric sets the metric in the event by its name and value, like
+// "Query_time" and "2". Time metrics are in seconds. It returns the error
+// parsing a value that is not a number, which is set in Event.Extra instead.
+func setMetric(e *Event, name, val string) error {
+	if strings.HasSuffix(name, "_time") || strings.HasSuffix(name, "_wait") ||
+		strings.HasPrefix(name, PROFILE_PREFIX) {
+		setTimeMetric(e, name, val, time.Second)
+	} else if val == "Yes" || val == "No" {
+		// boolean value
+		if val == "Yes" {
+			e.BoolMetrics[name] = true
+		} else {
+			e.BoolMetrics[name] = false
+		}
+	} else if name == "Schema" {
+		e.Db = val
+	} else if name == "Log_slow_rate_type" {
+		e.RateType = val
+	} else if name == "Log_slow_rate_limit" {
+		val, _ := strconv.ParseUint(val, 10, 64)
+		e.RateLimit = uint(val)
+	} else if name == "Start" {
+		e.StartTs = val
+	} else if name == "End" {
+		e.EndTs = val
+	} else if name == "InnoDB_trx_id" || name == "Innodb_trx_id" {
+		setExtra(e, name, val) // hex
+	} else {
+		// integer value
+		n, err := strconv.ParseUint(val, 10, 64)
+		if err != nil {
+			// Not a number, so don't pretend it's zero.
+			setExtra(e, name, val)
+			return err
+		}
+		e.NumberMetrics[name] = n
+		switch name {
+		case "Thread_id":
+			e.ThreadId = n
+		case "Killed":
+			e.Killed = n
+		case "Last_errno":
+			e.LastErrno = n
+		}
+	}
+	return nil
+}
+
+// setTimeMetric sets the time metric in the event, converting the value from
+// the unit to seconds, like "250" milliseconds to 0.25.
+func setTimeMetric(e *Event, name, val string, unit time.Duration) {
+	n, _ := strconv.ParseFloat(val, 64)
+	if unit != time.Second {
+		n *= unit.Seconds()
+	}
+	e.TimeMetrics[name] = n
+}
+
+// setExtra sets the field in Event.Extra. Values of a repeated field, like
+// "explain" lines, are joined by newlines.
+func setExtra(e *Event, name, val string) {
+	if e.Extra == nil {
+		e.Extra = map[string]string{}
+	}
+	if cur, ok := e.Extra[name]; ok {
+		val = cur + "\n" + val
+	}
+	e.Extra[name] = val
+}
+
+func (p *ReaderParser) parseQuery(line string) {
+	if p.debug {
+		p.logger.Printf("query")
+	}
+
+	if p.quote != 0 && p.quotedLines >= p.opt.MaxQuotedLines {
+		// Probably not a quote that spans lines, like a quote in a comment
+		// that spans lines, so parse the line as usual.
+		if p.logger != nil {
+			p.logger.Printf("unclosed %c quote", p.quote)
+		}
+		atomic.AddUint64(&p.stats.UnclosedQuotes, 1)
+		p.report(p.lineError(ErrUnclosedQuote))
+		p.quote = 0
+	}
+	if p.quote != 0 {
+		// In a quote that spans lines, so the line is query even if it
+		// looks like a header, like "# Query_time: 1".
+		if p.debug {
+			p.logger.Printf("in %c quote", p.quote)
+		}
+		if !p.skip {
+			p.addQuery(line)
+		}
+		p.queryLines++
+		p.quotedLines++
+		p.quote = openQuote(p.quote, line)
+		return
 	}
 
 	if strings.HasPrefix(line, "# admin") {
 		p.parseAdmin(line)
 		return
-	} else if headerRe.MatchString(line) {
-		if Debug {
-			log.Println("next event")
+	} else if isHeader(line) {
+		if p.debug {
+			p.logger.Printf("next event")
 		}
 		p.inHeader = true
 		p.inQuery = false
@@ -344,8 +1010,8 @@ func (p *FileParser) parseQuery(line string) {
 
 	isUse := useRe.FindString(line)
 	if p.queryLines == 0 && isUse != "" {
-		if Debug {
-			log.Println("use db")
+		if p.debug {
+			p.logger.Printf("use db")
 		}
 		db := strings.TrimPrefix(line, isUse)
 		db = strings.TrimRight(db, ";")
@@ -358,26 +1024,170 @@ func (p *FileParser) parseQuery(line string) {
 		// query will be "use dbnameb" since the user executed a use command
 		p.event.Query = line
 	} else if setRe.MatchString(line) {
-		if Debug {
-			log.Println("set var")
+		if p.debug {
+			p.logger.Printf("set var")
 		}
 		// @todo ignore or use these lines?
 	} else {
-		if Debug {
-			log.Println("query")
+		if p.debug {
+			p.logger.Printf("query")
 		}
-		if p.queryLines > 0 {
-			p.event.Query += "\n" + line
-		} else {
-			p.event.Query = line
+		// If skipped, don't save the query, but still count lines and
+		// track quotes.
+		if !p.skip {
+			p.addQuery(line)
 		}
 		p.queryLines++
+		if p.opt.QuoteAware {
+			p.quote = openQuote(0, line)
+			p.quotedLines = 0
+		}
 	}
 }
 
-func (p *FileParser) parseAdmin(line string) {
-	if Debug {
-		log.Println("admin")
+// addQuery adds the line to the query. If opt.MaxQueryBytes is set, the query
+// is truncated to it, and lines after truncation are ignored.
+func (p *ReaderParser) addQuery(line string) {
+	if p.event.Truncated {
+		return
+	}
+	q := p.event.Query
+	if p.queryLines > 0 {
+		line = "\n" + line
+	} else {
+		q = ""
+	}
+	truncated := p.truncated
+	if max := p.opt.MaxQueryBytes; max > 0 && uint64(len(q)+len(line)) > max {
+		line = truncate(line, int(max)-len(q))
+		truncated = true
+	}
+	p.event.Query = q + line
+	if truncated {
+		if p.logger != nil {
+			p.logger.Printf("query truncated to %d bytes", len(p.event.Query))
+		}
+		p.event.Truncated = true
+		atomic.AddUint64(&p.stats.Truncated, 1)
+	}
+}
+
+// readLine reads a line like ReadString('\n'), but if opt.MaxQueryBytes is
+// set, it keeps only that many bytes of a longer line, plus the newline, and
+// discards the rest of the line without buffering it. Lines that begin with #,
+// like headers, are not truncated. n is the number of bytes read, including
+// discarded bytes.
+func (p *ReaderParser) readLine(r *bufio.Reader) (line string, n uint64, truncated bool, err error) {
+	if p.mapped != nil {
+		return p.readMapped()
+	}
+	max := p.opt.MaxQueryBytes
+	if max == 0 {
+		line, err = r.ReadString('\n')
+		return line, uint64(len(line)), false, err
+	}
+	var buf []byte
+	for {
+		var b []byte
+		b, err = r.ReadSlice('\n')
+		if n == 0 && len(b) > 0 && b[0] == '#' {
+			max = 0 // header, not query
+		}
+		n += uint64(len(b))
+		if max == 0 || uint64(len(buf)) <= max {
+			buf = append(buf, b...)
+		}
+		if err != bufio.ErrBufferFull {
+			break
+		}
+	}
+	line = string(buf)
+	if max > 0 && (n > max+1 || (err != nil && n > max)) { // +1 for newline
+		line = truncate(line, int(max))
+		if err == nil {
+			line += "\n"
+		}
+		truncated = true
+	}
+	return line, n, truncated, err
+}
+
+// readMapped is readLine for the mapped file: it reads the line at
+// p.mapOffset, or the rest of the mapping and io.EOF if there is no newline,
+// and advances p.mapOffset past it. Only the bytes kept are copied from the
+// mapping.
+func (p *ReaderParser) readMapped() (line string, n uint64, truncated bool, err error) {
+	b := p.mapped[p.mapOffset:]
+	if i := bytes.IndexByte(b, '\n'); i >= 0 {
+		b = b[:i+1]
+	} else {
+		err = io.EOF
+	}
+	p.mapOffset += len(b)
+	n = uint64(len(b))
+	max := p.opt.MaxQueryBytes
+	if max > 0 && (n > max+1 || (err != nil && n > max)) && b[0] != '#' { // +1 for newline
+		line = truncate(string(b[:max+1]), int(max))
+		if err == nil {
+			line += "\n"
+		}
+		return line, n, true, err
+	}
+	return string(b), n, false, err
+}
+
+// mmap maps the file, if the reader is a regular file, to read lines from
+// the mapping starting at opt.StartOffset.
+func (p *ReaderParser) mmap() error {
+	file, ok := p.r.(*os.File)
+	if !ok {
+		return nil
+	}
+	fi, err := file.Stat()
+	if err != nil {
+		return err
+	}
+	size := fi.Size()
+	if !fi.Mode().IsRegular() || size == 0 || int64(int(size)) != size {
+		return nil // can't map empty files, or files larger than memory
+	}
+	data, err := mmapFile(file, int(size))
+	if err != nil {
+		return err
+	}
+	p.mapped = data
+	p.mapOffset = len(data)
+	if p.opt.StartOffset < uint64(len(data)) {
+		p.mapOffset = int(p.opt.StartOffset)
+	}
+	return nil
+}
+
+func (p *ReaderParser) munmap() {
+	if p.mapped == nil {
+		return
+	}
+	if err := munmapFile(p.mapped); err != nil && p.logger != nil {
+		p.logger.Printf("munmap: %s", err)
+	}
+	p.mapped = nil
+}
+
+// truncate returns s truncated to at most n bytes without splitting a UTF-8
+// encoded character.
+func truncate(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	for n > 0 && !utf8.RuneStart(s[n]) {
+		n--
+	}
+	return s[:n]
+}
+
+func (p *ReaderParser) parseAdmin(line string) {
+	if p.debug {
+		p.logger.Printf("admin")
 	}
 	p.event.Admin = true
 	m := adminRe.FindStringSubmatch(line)
@@ -386,45 +1196,591 @@ func (p *FileParser) parseAdmin(line string) {
 
 	// admin commands should be the last line of the event.
 	if filtered := p.opt.FilterAdminCommand[p.event.Query]; !filtered {
-		if Debug {
-			log.Println("not filtered")
+		if p.debug {
+			p.logger.Printf("not filtered")
 		}
 		p.sendEvent(false, false)
 	} else {
+		if p.opt.InheritDbPerConnection && p.event.Query == "Quit" {
+			delete(p.connDb, p.eventConnId())
+		}
 		p.inHeader = false
 		p.inQuery = false
 	}
 }
 
-func (p *FileParser) sendEvent(inHeader bool, inQuery bool) {
-	if Debug {
-		log.Println("send event")
+func (p *ReaderParser) sendEvent(inHeader bool, inQuery bool) {
+	if p.debug {
+		p.logger.Printf("send event")
 	}
 
-	// Make a new event and reset our metadata.
+	// Make a new event and reset our metadata. A pooled event that isn't sent
+	// is reused.
+	sent := false
 	defer func() {
-		p.event = NewEvent()
+		if p.opt.PoolEvents {
+			if !sent {
+				p.event.Release()
+			}
+			p.event = getEvent()
+		} else {
+			p.event = NewEvent()
+		}
+		p.connId = 0
+		p.quote = 0
+		p.quotedLines = 0
+		p.skip = false
+		p.sampleLate = false
 		p.headerLines = 0
 		p.queryLines = 0
 		p.inHeader = inHeader
 		p.inQuery = inQuery
+		if atomic.LoadInt32(&p.hasNewOpt) == 1 {
+			p.updateOptions()
+		}
 	}()
 
+	if p.skip {
+		return
+	}
+
 	if _, ok := p.event.TimeMetrics["Query_time"]; !ok {
-		if p.headerLines == 0 {
-			log.Panicf("no Query_time in event at %d: %#v", p.lineOffset, p.event)
+		// Malformed event, or started parsing in header after Query_time.
+		// Throw away event and keep parsing.
+		if p.logger != nil {
+			p.logger.Printf("no Query_time in event at %d", p.event.Offset)
 		}
-		// Started parsing in header after Query_time.  Throw away event.
+		atomic.AddUint64(&p.stats.Dropped, 1)
+		p.report(p.eventError(ErrNoQueryTime))
 		return
 	}
 
 	// Clean up the event.
+	p.event.Source = p.opt.Source
 	p.event.Db = strings.TrimSuffix(p.event.Db, ";\n")
 	p.event.Query = strings.TrimSuffix(p.event.Query, ";")
+	p.event.FromReplication = REPLICATION_USERS[p.event.User]
+	if explain, ok := p.event.Extra["explain"]; ok {
+		p.event.Explain = parseExplain(explain)
+	}
+	p.event.SlowExtra = newSlowExtra(p.event, p.opt)
+	if len(p.sensitive) > 0 && !p.event.Admin && references(p.event.Query, p.sensitive) {
+		p.event.Query = MaskLiterals(p.event.Query)
+	}
+	if p.opt.ExtractParams && !p.event.Admin {
+		p.event.Params = Params(p.event.Query)
+	}
+	if p.opt.InheritDbPerConnection {
+		p.inheritDb()
+	}
+	if p.opt.InsertRows && !p.event.Admin {
+		if n, ok := insertRows(p.event.Query); ok {
+			p.event.NumberMetrics["Insert_rows"] = n
+		}
+	}
+	if p.sampling > 1 {
+		// Like the rate limit of Percona Server, so the Aggregator multiplies
+		// counts and sums by it.
+		if p.event.RateLimit == 0 {
+			p.event.RateLimit = 1
+		}
+		p.event.RateLimit *= p.sampling
+		if p.event.RateType == "" {
+			p.event.RateType = "sample"
+		}
+	}
+	if p.matchDb && !matchEvent(*p.event, p.opt.Include, p.opt.Exclude) {
+		if p.debug {
+			p.logger.Printf("skip")
+		}
+		atomic.AddUint64(&p.stats.Skipped, 1)
+		return
+	}
+
+	if len(p.opt.MetricBounds) > 0 && !p.checkBounds() {
+		if p.logger != nil {
+			p.logger.Printf("reject event at %d", p.event.Offset)
+		}
+		atomic.AddUint64(&p.stats.RejectedEvents, 1)
+		p.report(p.eventError(ErrOutOfBounds))
+		return
+	}
+
+	if p.sampleLate && !p.sample() {
+		if p.debug {
+			p.logger.Printf("skip")
+		}
+		atomic.AddUint64(&p.stats.Skipped, 1)
+		return
+	}
+
+	if p.eventLimit != nil && !p.eventLimit.wait(1, p.stopChan) {
+		return
+	}
+
+	// The next event begins at the header line that ended this one, else
+	// after the last line read.
+	p.event.EndOffset = atomic.LoadUint64(&p.bytesRead)
+	if inHeader {
+		p.event.EndOffset = p.lineStart
+	}
+
+	// Send the event.  This will block. A pooled event belongs to the
+	// receiver once sent, so don't use it after.
+	sendStart := p.opt.Clock.Now()
+	eventTime := p.event.Time
+	if p.opt.PoolEvents {
+		select {
+		case p.pooledChan <- p.event:
+			sent = true
+		case <-p.stopChan:
+		}
+	} else {
+		select {
+		case p.eventChan <- *p.event:
+			sent = true
+		case <-p.stopChan:
+		}
+	}
+	if sent {
+		atomic.AddUint64(&p.stats.Events, 1)
+		if !eventTime.IsZero() {
+			p.lastEventTs.Store(eventTime)
+		}
+		if p.opt.MetricsSink != nil {
+			now := p.opt.Clock.Now()
+			p.opt.MetricsSink.Add(PARSER_EVENTS, 1)
+			p.opt.MetricsSink.Add(PARSER_SEND_WAIT, now.Sub(sendStart).Seconds())
+			// Stat the file at most once per second.
+			if now.Sub(p.behindTs) >= time.Second {
+				p.opt.MetricsSink.Set(PARSER_BYTES_BEHIND, float64(p.bytesBehind()))
+				p.behindTs = now
+			}
+		}
+	}
+}
+
+// checkBounds clamps the event metrics to opt.MetricBounds. It returns false,
+// without clamping, if a value is out of bounds and the bound rejects it.
+func (p *ReaderParser) checkBounds() bool {
+	clamped := map[string]float64{}
+	check := func(metric string, val float64) bool {
+		b, ok := p.opt.MetricBounds[metric]
+		if !ok || (val >= b.Min && (b.Max == 0 || val <= b.Max)) {
+			return true
+		}
+		if b.Reject {
+			return false
+		}
+		if val < b.Min {
+			clamped[metric] = b.Min
+		} else {
+			clamped[metric] = b.Max
+		}
+		return true
+	}
+	for metric, val := range p.event.TimeMetrics {
+		if !check(metric, val) {
+			return false
+		}
+	}
+	for metric, val := range p.event.NumberMetrics {
+		if !check(metric, float64(val)) {
+			return false
+		}
+	}
+	for metric, val := range clamped {
+		if _, ok := p.event.TimeMetrics[metric]; ok {
+			p.event.TimeMetrics[metric] = val
+		} else {
+			p.event.NumberMetrics[metric] = uint64(val)
+		}
+		atomic.AddUint64(&p.stats.ClampedValues, 1)
+	}
+	return true
+}
+
+func (p *ReaderParser) unknownMetric(name, val string) {
+	if p.logger != nil {
+		p.logger.Printf("unknown metric: %s", name)
+	}
+	p.unknownMu.Lock()
+	defer p.unknownMu.Unlock()
+	m, ok := p.unknown[name]
+	if !ok {
+		m = &UnknownMetric{Name: name, Value: val}
+		p.unknown[name] = m
+	}
+	m.Count++
+}
+
+// openQuote returns the quote char (', ", or `) of the string literal or
+// quoted identifier that is open at the end of the line, or 0 if none. quote
+// is the one open at the start of the line, or 0. Comments to the end of the
+// line and comments within the line are skipped.
+func openQuote(quote byte, line string) byte {
+	for i := 0; i < len(line); i++ {
+		c := line[i]
+		if quote != 0 {
+			if c == '\\' && quote != '`' {
+				i++ // escaped char
+			} else if c == quote {
+				quote = 0 // doubled quote like '' opens again on next char
+			}
+			continue
+		}
+		switch {
+		case c == '\'' || c == '"' || c == '`':
+			quote = c
+		case c == '#' || (c == '-' && strings.HasPrefix(line[i:], "-- ")):
+			return 0
+		case c == '/' && strings.HasPrefix(line[i:], "/*"):
+			n := strings.Index(line[i+2:], "*/")
+			if n < 0 {
+				return 0
+			}
+			i += n + 3
+		}
+	}
+	return quote
+}
+
+// keepHeader returns true if the event passes the filters, given the header
+// fields parsed so far and the raw Query_time value.
+func (p *ReaderParser) keepHeader(queryTime string) bool {
+	if !p.inWindow() {
+		return false
+	}
+	// MySQL logs the db in a use statement after the header, so match it
+	// when the event is sent, see matchAfterHeader.
+	if !p.matchAfterHeader() && !matchEvent(*p.event, p.opt.Include, p.opt.Exclude) {
+		return false
+	}
+	if p.opt.HeaderFilter != nil || p.opt.MinQueryTime > 0 {
+		val, _ := strconv.ParseFloat(queryTime, 64)
+		if unit, ok := p.opt.TimeUnits["Query_time"]; ok {
+			val *= unit.Seconds()
+		}
+		if val < p.opt.MinQueryTime.Seconds() {
+			return false
+		}
+		if p.opt.HeaderFilter != nil {
+			p.event.TimeMetrics["Query_time"] = val
+			if !p.opt.HeaderFilter(*p.event) {
+				return false
+			}
+		}
+	}
+	// The Db from a use statement and opt.MetricBounds are checked when the
+	// event is sent, so sample it then, after them.
+	if p.matchAfterHeader() || len(p.opt.MetricBounds) > 0 {
+		p.sampleLate = true
+		return true
+	}
+	return p.sample()
+}
+
+// sample returns true if the event is kept by opt.EveryNth and opt.SampleRate.
+// Events are sampled after the other filters, so, for example, every Nth
+// event of a user is kept, not the events of the user in every Nth event.
+// Usually that is when the header is kept, but see keepHeader.
+func (p *ReaderParser) sample() bool {
+	if p.opt.EveryNth > 1 {
+		keep := p.nth == 0
+		p.nth = (p.nth + 1) % p.opt.EveryNth
+		if !keep {
+			return false
+		}
+	}
+	return p.sampleRand == nil || p.sampleRand.Float64() < p.opt.SampleRate
+}
+
+// sampleFactor returns the number of events each kept event represents if
+// sampled by opt.SampleRate, rounded to an integer, and opt.EveryNth, or 1.
+func sampleFactor(opt Options) uint {
+	n := uint(1)
+	if opt.EveryNth > 1 {
+		n = opt.EveryNth
+	}
+	if opt.SampleRate > 0 && opt.SampleRate < 1 {
+		n *= uint(math.Round(1 / opt.SampleRate))
+	}
+	return n
+}
+
+// matchAfterHeader returns true if opt.Include or opt.Exclude match the Db
+// and the header has no Db (Percona Server and MariaDB Schema), so the event
+// is matched when it is sent.
+func (p *ReaderParser) matchAfterHeader() bool {
+	return p.matchDb && p.event.Db == ""
+}
+
+// inWindow returns true if the event is in the opt.Since to opt.Until window.
+// An event without Ts has the time of the last event with one because MySQL
+// 5.6 and older log Ts only when it changes, and an event is in the window if
+// there's no time yet. At the first event at or after Until, it sets pastEnd
+// to stop parsing because the log is in time order.
+func (p *ReaderParser) inWindow() bool {
+	if p.opt.Since.IsZero() && p.opt.Until.IsZero() {
+		return true
+	}
+	t := p.event.Time
+	if t.IsZero() {
+		t = p.lastTime
+	}
+	if t.IsZero() {
+		return true
+	}
+	if !p.opt.Until.IsZero() && !t.Before(p.opt.Until) {
+		p.pastEnd = true
+		return false
+	}
+	return p.opt.Since.IsZero() || !t.Before(p.opt.Since)
+}
+
+// endOffset returns the lesser of opt.EndOffset and opt.StartOffset plus
+// opt.MaxBytes, or 0 if neither is set.
+func (p *ReaderParser) endOffset() uint64 {
+	end := p.opt.EndOffset
+	if p.opt.MaxBytes > 0 && (end == 0 || p.opt.StartOffset+p.opt.MaxBytes < end) {
+		end = p.opt.StartOffset + p.opt.MaxBytes
+	}
+	return end
+}
+
+// bytesBehind returns the number of bytes from BytesRead to the end of the
+// reader if it's an uncompressed file, else 0.
+func (p *ReaderParser) bytesBehind() uint64 {
+	size := p.size()
+	bytesRead := atomic.LoadUint64(&p.bytesRead)
+	if size > bytesRead {
+		return size - bytesRead
+	}
+	return 0
+}
+
+// size returns the size of the reader if it's an uncompressed file, else 0.
+func (p *ReaderParser) size() uint64 {
+	f, ok := p.r.(interface{ Stat() (os.FileInfo, error) })
+	if !ok || p.compressed {
+		return 0
+	}
+	if fi, err := f.Stat(); err == nil {
+		return uint64(fi.Size())
+	}
+	return 0
+}
+
+// progress calls opt.Progress if opt.ProgressInterval has passed since the
+// last call, or if final.
+func (p *ReaderParser) progress(final bool) {
+	if p.opt.Progress == nil {
+		return
+	}
+	now := p.opt.Clock.Now()
+	if !final && now.Sub(p.progressTs) < p.opt.ProgressInterval {
+		return
+	}
+	p.progressTs = now
+	p.opt.Progress(atomic.LoadUint64(&p.bytesRead), p.size())
+}
+
+// lineError returns a ParseError at the current line.
+func (p *ReaderParser) lineError(err error) *ParseError {
+	return &ParseError{
+		Offset: p.lineStart,
+		Line:   p.lineNo,
+		Text:   truncate(p.line, 1024),
+		Err:    err,
+	}
+}
+
+// eventError returns a ParseError at the first line of the current event.
+func (p *ReaderParser) eventError(err error) *ParseError {
+	return &ParseError{
+		Offset: p.eventStart,
+		Line:   p.eventLine,
+		Err:    err,
+	}
+}
 
-	// Send the event.  This will block.
+// report sends the non-fatal error to the Errors channel, unless it's full.
+func (p *ReaderParser) report(err *ParseError) {
+	atomic.AddUint64(&p.stats.Errors, 1)
+	if p.opt.MetricsSink != nil {
+		p.opt.MetricsSink.Add(PARSER_ERRORS, 1)
+	}
 	select {
-	case p.eventChan <- *p.event:
-	case <-p.stopChan:
+	case p.errChan <- err:
+	default:
+		if p.logger != nil {
+			p.logger.Printf("errors channel full: %s", err)
+		}
+	}
+}
+
+// name returns the name of the reader if it has one, like a file, else "".
+func (p *ReaderParser) name() string {
+	if f, ok := p.r.(interface{ Name() string }); ok {
+		return f.Name()
+	}
+	return ""
+}
+
+// setOptions sets the options and their defaults.
+func (p *ReaderParser) setOptions(opt Options) {
+	p.opt = opt
+	if p.opt.Source == "" {
+		p.opt.Source = p.name()
+	}
+	if p.opt.MaxHeaderLines == 0 {
+		p.opt.MaxHeaderLines = DEFAULT_MAX_HEADER_LINES
+	}
+	if p.opt.Location == nil {
+		p.opt.Location = time.UTC
+	}
+	if p.opt.MaxQuotedLines == 0 {
+		p.opt.MaxQuotedLines = DEFAULT_MAX_QUOTED_LINES
+	}
+	if p.opt.FollowInterval == 0 {
+		p.opt.FollowInterval = DEFAULT_FOLLOW_INTERVAL
+	}
+	if p.opt.ProgressInterval == 0 {
+		p.opt.ProgressInterval = DEFAULT_PROGRESS_INTERVAL
+	}
+	if p.opt.Clock == nil {
+		p.opt.Clock = WallClock
+	}
+	p.sensitive = map[string]bool{}
+	for _, name := range p.opt.SensitiveNames {
+		p.sensitive[strings.ToLower(name)] = true
+	}
+	p.matchDb = matchesDb(p.opt.Include, p.opt.Exclude)
+	p.sampling = sampleFactor(p.opt)
+	p.sampleRand = nil
+	if p.opt.SampleRate > 0 && p.opt.SampleRate < 1 {
+		p.sampleRand = rand.New(rand.NewSource(p.opt.Clock.Now().UnixNano()))
+	}
+	p.eventLimit = nil
+	if p.opt.MaxEventsPerSecond > 0 {
+		p.eventLimit = newLimiter(p.opt.MaxEventsPerSecond, float64(p.opt.EventBurst), p.opt.Clock)
+	}
+	p.byteLimit = nil
+	if p.opt.MaxBytesPerSecond > 0 {
+		p.byteLimit = newLimiter(p.opt.MaxBytesPerSecond, float64(p.opt.ByteBurst), p.opt.Clock)
+	}
+	p.logger = logger(p.opt, LOG_ANOMALIES)
+	p.debug = logger(p.opt, LOG_DEBUG) != nil
+}
+
+// updateOptions sets the options from UpdateOptions.
+func (p *ReaderParser) updateOptions() {
+	p.newOptMu.Lock()
+	defer p.newOptMu.Unlock()
+	if p.newOpt == nil {
+		return
+	}
+	if p.debug {
+		p.logger.Printf("update options")
 	}
+	opt := *p.newOpt
+	opt.StartOffset = p.opt.StartOffset
+	opt.PoolEvents = p.opt.PoolEvents // the receiver reads only one channel
+	p.setOptions(opt)
+	p.newOpt = nil
+	atomic.StoreInt32(&p.hasNewOpt, 0)
+}
+
+// eventConnId returns the connection ID of the current event: the Thread_id
+// metric or, for MySQL 5.6 and newer, the Id on the User@Host line. It returns
+// zero if the event has neither.
+func (p *ReaderParser) eventConnId() uint64 {
+	if id, ok := p.event.NumberMetrics["Thread_id"]; ok {
+		return id
+	}
+	return p.connId
+}
+
+// inheritDb saves the db of the current event for its connection, or sets it
+// to the last db of its connection. Some servers log "use db" only once per
+// connection, so without this most events have no db.
+func (p *ReaderParser) inheritDb() {
+	id := p.eventConnId()
+	if id == 0 {
+		return
+	}
+	if p.connDb == nil {
+		p.connDb = map[uint64]string{}
+	}
+	if p.event.Db != "" {
+		p.connDb[id] = p.event.Db
+	} else {
+		p.event.Db = p.connDb[id]
+	}
+	if p.event.Admin && p.event.Query == "Quit" {
+		delete(p.connDb, id)
+	}
+}
+
+// parseTs parses the raw timestamp of an event. MySQL 5.7 and newer log
+// "2006-01-02T15:04:05.999999Z" or, if log_timestamps=SYSTEM, with a zone
+// offset like "+08:00". Older versions log "060102 15:04:05" (the hour can be
+// one digit with a leading space). Timestamps without a time zone, including
+// "2006-01-02T15:04:05.999999", are parsed in the given location and resolved
+// by dst if they're ambiguous.
+func parseTs(ts string, loc *time.Location, dst DSTResolution) (time.Time, bool, error) {
+	layout := "060102 15:04:05"
+	if strings.Contains(ts, "T") {
+		if tsZoneRe.MatchString(ts) {
+			t, err := time.Parse(time.RFC3339Nano, ts)
+			return t, false, err
+		}
+		layout = "2006-01-02T15:04:05.999999999"
+	}
+
+	// Parse the wall clock time as UTC, then find the instants in loc that
+	// have the same wall clock time. Zone offsets 12 hours before and after
+	// cover any DST transition near the time.
+	wall, err := time.Parse(layout, ts)
+	if err != nil {
+		return time.Time{}, false, err
+	}
+	_, off1 := wall.Add(-12 * time.Hour).In(loc).Zone()
+	_, off2 := wall.Add(12 * time.Hour).In(loc).Zone()
+	if off1 == off2 {
+		t, err := time.ParseInLocation(layout, ts, loc)
+		return t, false, err
+	}
+	t1 := wall.Add(-time.Duration(off1) * time.Second).In(loc)
+	t2 := wall.Add(-time.Duration(off2) * time.Second).In(loc)
+	if t1.After(t2) {
+		t1, t2 = t2, t1
+	}
+	valid1 := sameWallClock(t1, wall)
+	valid2 := sameWallClock(t2, wall)
+	if valid1 != valid2 {
+		// Near a transition but not in it, so only one is correct.
+		if valid1 {
+			return t1, false, nil
+		}
+		return t2, false, nil
+	}
+
+	// Both valid: ambiguous (clocks went back). Neither valid: invalid
+	// (clocks went forward).
+	switch dst {
+	case DST_LATEST:
+		return t2, true, nil
+	case DST_UTC:
+		return wall, true, nil
+	default:
+		return t1, true, nil
+	}
+}
+
+func sameWallClock(t, wall time.Time) bool {
+	y1, m1, d1 := t.Date()
+	y2, m2, d2 := wall.Date()
+	return y1 == y2 && m1 == m2 && d1 == d2 &&
+		t.Hour() == wall.Hour() && t.Minute() == wall.Minute() && t.Second() == wall.Second()
 }
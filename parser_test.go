@@ -6,9 +6,20 @@
 package slowlog_test
 
 import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
 	"os"
 	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/go-mysql/slowlog"
 	"github.com/go-test/deep"
@@ -27,8 +38,21 @@ func parseSlowLog(t *testing.T, filename string, o slowlog.Options) []slowlog.Ev
 		t.Fatal(err)
 	}
 	defer p.Stop()
+	source := o.Source
+	if source == "" {
+		source = file.Name()
+	}
 	got := []slowlog.Event{}
 	for e := range p.Events() {
+		if e.Source != source {
+			t.Errorf("got Source %s, expected %s", e.Source, source)
+		}
+		if e.EndOffset <= e.Offset {
+			t.Errorf("got EndOffset %d, expected greater than Offset %d", e.EndOffset, e.Offset)
+		}
+		e.Source = "" // checked above, so expected events don't need it
+		// Checked above and by TestParseEndOffsetResume.
+		e.EndOffset = 0
 		got = append(got, e)
 	}
 	return got
@@ -50,6 +74,7 @@ func TestParserSlowLog001(t *testing.T) {
 	expect := []slowlog.Event{
 		{
 			Ts:     "071015 21:43:52",
+			Time:   time.Date(2007, 10, 15, 21, 43, 52, 0, time.UTC),
 			Admin:  false,
 			Query:  `select sleep(2) from n`,
 			User:   "root",
@@ -68,6 +93,7 @@ func TestParserSlowLog001(t *testing.T) {
 		},
 		{
 			Ts:     "071015 21:45:10",
+			Time:   time.Date(2007, 10, 15, 21, 45, 10, 0, time.UTC),
 			Admin:  false,
 			Query:  `select sleep(2) from test.n`,
 			User:   "root",
@@ -98,6 +124,7 @@ func TestParseSlowLog002(t *testing.T) {
 		{
 			Query:  "BEGIN",
 			Ts:     "071218 11:48:27",
+			Time:   time.Date(2007, 12, 18, 11, 48, 27, 0, time.UTC),
 			Admin:  false,
 			User:   "[SQL_SLAVE]",
 			Host:   "",
@@ -106,6 +133,7 @@ func TestParseSlowLog002(t *testing.T) {
 				"Query_time": 0.000012,
 				"Lock_time":  0.000000,
 			},
+			ThreadId: 10,
 			NumberMetrics: map[string]uint64{
 				"Merge_passes":  0,
 				"Thread_id":     10,
@@ -121,6 +149,7 @@ func TestParseSlowLog002(t *testing.T) {
 				"Tmp_table":         false,
 				"QC_Hit":            false,
 			},
+			FromReplication: true,
 		},
 		{
 			Db: "db1",
@@ -135,6 +164,7 @@ func TestParseSlowLog002(t *testing.T) {
 				"Query_time": 0.726052,
 				"Lock_time":  0.000091,
 			},
+			ThreadId: 10,
 			NumberMetrics: map[string]uint64{
 				"Merge_passes":  0,
 				"Thread_id":     10,
@@ -150,6 +180,7 @@ func TestParseSlowLog002(t *testing.T) {
 				"Tmp_table":         false,
 				"QC_Hit":            false,
 			},
+			FromReplication: true,
 		},
 		{
 			Query: `INSERT INTO db3.vendor11gonzo (makef, bizzle)
@@ -165,6 +196,7 @@ VALUES ('', 'Exact')`,
 				"Query_time":           0.000512,
 				"InnoDB_IO_r_wait":     0.000000,
 			},
+			ThreadId: 10,
 			NumberMetrics: map[string]uint64{
 				"InnoDB_IO_r_bytes":     0,
 				"Merge_passes":          0,
@@ -183,6 +215,7 @@ VALUES ('', 'Exact')`,
 				"Tmp_table":         false,
 				"QC_Hit":            false,
 			},
+			FromReplication: true,
 		},
 		{
 			Query: `UPDATE db4.vab3concept1upload
@@ -199,6 +232,7 @@ WHERE  vab3concept1upload='6994465'`,
 				"Lock_time":            0.000028,
 				"InnoDB_rec_lock_wait": 0.000000,
 			},
+			ThreadId: 10,
 			NumberMetrics: map[string]uint64{
 				"InnoDB_IO_r_bytes":     0,
 				"Merge_passes":          0,
@@ -217,6 +251,7 @@ WHERE  vab3concept1upload='6994465'`,
 				"Tmp_table":         false,
 				"QC_Hit":            false,
 			},
+			FromReplication: true,
 		},
 		{
 			Query: `INSERT INTO db1.conch (word3, vid83)
@@ -232,6 +267,7 @@ VALUES ('211', '18')`,
 				"Lock_time":            0.000027,
 				"InnoDB_rec_lock_wait": 0.000000,
 			},
+			ThreadId: 10,
 			NumberMetrics: map[string]uint64{
 				"InnoDB_IO_r_bytes":     0,
 				"Merge_passes":          0,
@@ -250,6 +286,7 @@ VALUES ('211', '18')`,
 				"Tmp_table":         false,
 				"QC_Hit":            false,
 			},
+			FromReplication: true,
 		},
 		{
 			Query: `UPDATE foo.bar
@@ -265,6 +302,7 @@ SET    biz = '91848182522'`,
 				"Query_time":           0.000530,
 				"InnoDB_IO_r_wait":     0.000000,
 			},
+			ThreadId: 10,
 			NumberMetrics: map[string]uint64{
 				"InnoDB_IO_r_bytes":     0,
 				"Merge_passes":          0,
@@ -283,6 +321,7 @@ SET    biz = '91848182522'`,
 				"Tmp_table":         false,
 				"QC_Hit":            false,
 			},
+			FromReplication: true,
 		},
 		{
 			Query: `UPDATE bizzle.bat
@@ -299,6 +338,7 @@ WHERE  fillze='899'`,
 				"Lock_time":            0.000027,
 				"InnoDB_rec_lock_wait": 0.000000,
 			},
+			ThreadId: 10,
 			NumberMetrics: map[string]uint64{
 				"InnoDB_IO_r_bytes":     0,
 				"Merge_passes":          0,
@@ -317,6 +357,7 @@ WHERE  fillze='899'`,
 				"Tmp_table":         false,
 				"QC_Hit":            false,
 			},
+			FromReplication: true,
 		},
 		{
 			Query: `UPDATE foo.bar
@@ -332,6 +373,7 @@ SET    biz = '91848182522'`,
 				"InnoDB_queue_wait":    0.000000,
 				"InnoDB_IO_r_wait":     0.000000,
 			},
+			ThreadId: 10,
 			NumberMetrics: map[string]uint64{
 				"InnoDB_IO_r_bytes":     0,
 				"Merge_passes":          0,
@@ -350,6 +392,7 @@ SET    biz = '91848182522'`,
 				"Tmp_table":         false,
 				"QC_Hit":            false,
 			},
+			FromReplication: true,
 		},
 	}
 	if diff := deep.Equal(got, expect); diff != nil {
@@ -367,6 +410,7 @@ func TestParserSlowLog003(t *testing.T) {
 			Admin:  false,
 			Host:   "",
 			Ts:     "071218 11:48:27",
+			Time:   time.Date(2007, 12, 18, 11, 48, 27, 0, time.UTC),
 			User:   "[SQL_SLAVE]",
 			Offset: 2,
 			BoolMetrics: map[string]bool{
@@ -382,12 +426,14 @@ func TestParserSlowLog003(t *testing.T) {
 				"Lock_time":  0.000000,
 				"Query_time": 0.000012,
 			},
+			ThreadId: 10,
 			NumberMetrics: map[string]uint64{
 				"Merge_passes":  0,
 				"Rows_examined": 0,
 				"Rows_sent":     0,
 				"Thread_id":     10,
 			},
+			FromReplication: true,
 		},
 	}
 	if diff := deep.Equal(got, expect); diff != nil {
@@ -405,6 +451,7 @@ func TestParserSlowLog004(t *testing.T) {
 			Admin:       false,
 			Host:        "localhost",
 			Ts:          "071015 21:43:52",
+			Time:        time.Date(2007, 10, 15, 21, 43, 52, 0, time.UTC),
 			User:        "root",
 			Offset:      200,
 			BoolMetrics: map[string]bool{},
@@ -439,6 +486,7 @@ func TestParserSlowLog005(t *testing.T) {
 			Admin:  false,
 			Host:   "",
 			Ts:     "071218 11:48:27",
+			Time:   time.Date(2007, 12, 18, 11, 48, 27, 0, time.UTC),
 			User:   "[SQL_SLAVE]",
 			Offset: 0,
 			BoolMetrics: map[string]bool{
@@ -454,12 +502,14 @@ func TestParserSlowLog005(t *testing.T) {
 				"Query_time": 0.000012,
 				"Lock_time":  0.000000,
 			},
+			ThreadId: 10,
 			NumberMetrics: map[string]uint64{
 				"Merge_passes":  0,
 				"Rows_examined": 0,
 				"Rows_sent":     0,
 				"Thread_id":     10,
 			},
+			FromReplication: true,
 		},
 	}
 	if diff := deep.Equal(got, expect); diff != nil {
@@ -479,6 +529,7 @@ func TestParserSlowLog006(t *testing.T) {
 			Admin:  false,
 			Host:   "",
 			Ts:     "071218 11:48:27",
+			Time:   time.Date(2007, 12, 18, 11, 48, 27, 0, time.UTC),
 			User:   "[SQL_SLAVE]",
 			Offset: 0,
 			BoolMetrics: map[string]bool{
@@ -494,12 +545,14 @@ func TestParserSlowLog006(t *testing.T) {
 				"Query_time": 0.000012,
 				"Lock_time":  0.000000,
 			},
+			ThreadId: 10,
 			NumberMetrics: map[string]uint64{
 				"Merge_passes":  0,
 				"Rows_examined": 0,
 				"Rows_sent":     0,
 				"Thread_id":     10,
 			},
+			FromReplication: true,
 		},
 		{
 			Query:  "SELECT col FROM foo_tbl",
@@ -507,6 +560,7 @@ func TestParserSlowLog006(t *testing.T) {
 			Admin:  false,
 			Host:   "",
 			Ts:     "071218 11:48:57",
+			Time:   time.Date(2007, 12, 18, 11, 48, 57, 0, time.UTC),
 			User:   "[SQL_SLAVE]",
 			Offset: 369,
 			BoolMetrics: map[string]bool{
@@ -522,12 +576,14 @@ func TestParserSlowLog006(t *testing.T) {
 				"Query_time": 0.000012,
 				"Lock_time":  0.000000,
 			},
+			ThreadId: 10,
 			NumberMetrics: map[string]uint64{
 				"Merge_passes":  0,
 				"Rows_examined": 0,
 				"Rows_sent":     0,
 				"Thread_id":     10,
 			},
+			FromReplication: true,
 		},
 		{
 			Query:  "SELECT col FROM bar_tbl",
@@ -535,6 +591,7 @@ func TestParserSlowLog006(t *testing.T) {
 			Admin:  false,
 			Host:   "",
 			Ts:     "071218 11:48:57",
+			Time:   time.Date(2007, 12, 18, 11, 48, 57, 0, time.UTC),
 			User:   "[SQL_SLAVE]",
 			Offset: 737,
 			BoolMetrics: map[string]bool{
@@ -550,12 +607,14 @@ func TestParserSlowLog006(t *testing.T) {
 				"Query_time": 0.000012,
 				"Lock_time":  0.000000,
 			},
+			ThreadId: 20,
 			NumberMetrics: map[string]uint64{
 				"Merge_passes":  0,
 				"Rows_examined": 0,
 				"Rows_sent":     0,
 				"Thread_id":     20,
 			},
+			FromReplication: true,
 		},
 		{
 			Query:  "SELECT col FROM bar_tbl",
@@ -563,6 +622,7 @@ func TestParserSlowLog006(t *testing.T) {
 			Admin:  false,
 			Host:   "",
 			Ts:     "071218 11:49:05",
+			Time:   time.Date(2007, 12, 18, 11, 49, 5, 0, time.UTC),
 			User:   "[SQL_SLAVE]",
 			Offset: 1101,
 			BoolMetrics: map[string]bool{
@@ -578,12 +638,14 @@ func TestParserSlowLog006(t *testing.T) {
 				"Query_time": 0.000012,
 				"Lock_time":  0.000000,
 			},
+			ThreadId: 10,
 			NumberMetrics: map[string]uint64{
 				"Merge_passes":  0,
 				"Rows_examined": 0,
 				"Rows_sent":     0,
 				"Thread_id":     10,
 			},
+			FromReplication: true,
 		},
 		{
 			Query:  "SELECT col FROM bar_tbl",
@@ -591,6 +653,7 @@ func TestParserSlowLog006(t *testing.T) {
 			Admin:  false,
 			Host:   "",
 			Ts:     "071218 11:49:07",
+			Time:   time.Date(2007, 12, 18, 11, 49, 7, 0, time.UTC),
 			User:   "[SQL_SLAVE]",
 			Offset: 1469,
 			BoolMetrics: map[string]bool{
@@ -606,12 +669,14 @@ func TestParserSlowLog006(t *testing.T) {
 				"Query_time": 0.000012,
 				"Lock_time":  0.000000,
 			},
+			ThreadId: 20,
 			NumberMetrics: map[string]uint64{
 				"Merge_passes":  0,
 				"Rows_examined": 0,
 				"Rows_sent":     0,
 				"Thread_id":     20,
 			},
+			FromReplication: true,
 		},
 		{
 			Query:  "SELECT col FROM foo_tbl",
@@ -619,6 +684,7 @@ func TestParserSlowLog006(t *testing.T) {
 			Admin:  false,
 			Host:   "",
 			Ts:     "071218 11:49:30",
+			Time:   time.Date(2007, 12, 18, 11, 49, 30, 0, time.UTC),
 			User:   "[SQL_SLAVE]",
 			Offset: 1833,
 			BoolMetrics: map[string]bool{
@@ -634,12 +700,14 @@ func TestParserSlowLog006(t *testing.T) {
 				"Query_time": 0.000012,
 				"Lock_time":  0.000000,
 			},
+			ThreadId: 30,
 			NumberMetrics: map[string]uint64{
 				"Merge_passes":  0,
 				"Rows_examined": 0,
 				"Rows_sent":     0,
 				"Thread_id":     30,
 			},
+			FromReplication: true,
 		},
 	}
 	if diff := deep.Equal(got, expect); diff != nil {
@@ -658,6 +726,7 @@ func TestParserSlowLog007(t *testing.T) {
 			Admin:       false,
 			Host:        "",
 			Ts:          "071218 11:48:27",
+			Time:        time.Date(2007, 12, 18, 11, 48, 27, 0, time.UTC),
 			User:        "[SQL_SLAVE]",
 			Offset:      0,
 			BoolMetrics: map[string]bool{},
@@ -665,11 +734,13 @@ func TestParserSlowLog007(t *testing.T) {
 				"Query_time": 0.000012,
 				"Lock_time":  0.000000,
 			},
+			ThreadId: 3,
 			NumberMetrics: map[string]uint64{
 				"Rows_examined": 0,
 				"Rows_sent":     0,
 				"Thread_id":     3,
 			},
+			FromReplication: true,
 		},
 	}
 	if diff := deep.Equal(got, expect); diff != nil {
@@ -699,6 +770,7 @@ func TestParserSlowLog008(t *testing.T) {
 				"Query_time": 0.000002,
 				"Lock_time":  0.000000,
 			},
+			ThreadId: 5,
 			NumberMetrics: map[string]uint64{
 				"Rows_examined": 0,
 				"Rows_sent":     0,
@@ -717,6 +789,7 @@ func TestParserSlowLog008(t *testing.T) {
 				"Query_time": 0.000899,
 				"Lock_time":  0.000000,
 			},
+			ThreadId: 6,
 			NumberMetrics: map[string]uint64{
 				"Rows_examined": 0,
 				"Rows_sent":     0,
@@ -735,6 +808,7 @@ func TestParserSlowLog008(t *testing.T) {
 				"Query_time": 0.018799,
 				"Lock_time":  0.009453,
 			},
+			ThreadId: 6,
 			NumberMetrics: map[string]uint64{
 				"Rows_examined": 0,
 				"Rows_sent":     0,
@@ -765,10 +839,12 @@ func TestParserSlowLog009(t *testing.T) {
 			User:   "root",
 			Offset: 197,
 			Ts:     "090311 18:11:50",
+			Time:   time.Date(2009, 3, 11, 18, 11, 50, 0, time.UTC),
 			TimeMetrics: map[string]float64{
 				"Query_time": 0.017850,
 				"Lock_time":  0.000000,
 			},
+			ThreadId: 47,
 			NumberMetrics: map[string]uint64{
 				"Rows_examined": 0,
 				"Rows_affected": 0,
@@ -805,6 +881,7 @@ func TestParserSlowLog011(t *testing.T) {
 			Host:      "localhost",
 			User:      "user1",
 			Ts:        "131128  1:05:31",
+			Time:      time.Date(2013, 11, 28, 1, 5, 31, 0, time.UTC),
 			RateType:  "query",
 			RateLimit: 2,
 			TimeMetrics: map[string]float64{
@@ -838,6 +915,9 @@ func TestParserSlowLog011(t *testing.T) {
 				"Filesort":          false,
 				"Filesort_on_disk":  false,
 			},
+			Extra: map[string]string{
+				"InnoDB_trx_id": "1A88583F",
+			},
 		},
 		{
 			Offset:    733,
@@ -878,6 +958,9 @@ func TestParserSlowLog011(t *testing.T) {
 				"Filesort":          false,
 				"Filesort_on_disk":  false,
 			},
+			Extra: map[string]string{
+				"InnoDB_trx_id": "1A885840",
+			},
 		},
 		{
 			Offset:    1441,
@@ -918,6 +1001,9 @@ func TestParserSlowLog011(t *testing.T) {
 				"Filesort":          true,
 				"Filesort_on_disk":  false,
 			},
+			Extra: map[string]string{
+				"InnoDB_trx_id": "1A885842",
+			},
 		},
 	}
 	if diff := deep.Equal(got, expect); diff != nil {
@@ -969,6 +1055,7 @@ func TestParserSlowLog012(t *testing.T) {
 			User:   "msandbox",
 			Offset: 376,
 			Ts:     "140413 19:34:13",
+			Time:   time.Date(2014, 4, 13, 19, 34, 13, 0, time.UTC),
 			TimeMetrics: map[string]float64{
 				"Query_time": 0.000127,
 				"Lock_time":  0.000000,
@@ -993,6 +1080,7 @@ func TestParserSlowLog013(t *testing.T) {
 		{
 			Offset: 0,
 			Ts:     "140224 22:39:34",
+			Time:   time.Date(2014, 2, 24, 22, 39, 34, 0, time.UTC),
 			Query:  "select 950,q.* from qcm q INTO OUTFILE '/mnt/pct/exp/qcm_db950.txt'",
 			User:   "root",
 			Host:   "localhost",
@@ -1014,12 +1102,13 @@ func TestParserSlowLog013(t *testing.T) {
 		{
 			Offset: 354,
 			Ts:     "140224 22:39:59",
+			Time:   time.Date(2014, 2, 24, 22, 39, 59, 0, time.UTC),
 			Query:  "select 961,q.* from qcm q INTO OUTFILE '/mnt/pct/exp/qcm_db961.txt'",
 			User:   "root",
 			Host:   "localhost",
 			Db:     "db961",
 			TimeMetrics: map[string]float64{
-				"Query_time": 20.304537,
+				"Query_time": 20.304536,
 				"Lock_time":  0.103324,
 			},
 			NumberMetrics: map[string]uint64{
@@ -1035,14 +1124,16 @@ func TestParserSlowLog013(t *testing.T) {
 		{
 			Offset: 6139,
 			Ts:     "140311 16:07:40",
+			Time:   time.Date(2014, 3, 11, 16, 7, 40, 0, time.UTC),
 			Query:  "select count(*) into @discard from `information_schema`.`PARTITIONS`",
 			User:   "debian-sys-maint",
 			Host:   "localhost",
 			Db:     "",
 			TimeMetrics: map[string]float64{
-				"Query_time": 94.381439,
+				"Query_time": 94.38144,
 				"Lock_time":  0.000174,
 			},
+			LastErrno: 1146,
 			NumberMetrics: map[string]uint64{
 				"Bytes_sent":    11,
 				"Killed":        0,
@@ -1056,12 +1147,13 @@ func TestParserSlowLog013(t *testing.T) {
 		{
 			Offset: 6667,
 			Ts:     "140312 20:28:40",
+			Time:   time.Date(2014, 3, 12, 20, 28, 40, 0, time.UTC),
 			Query:  "select 1,q.* from qcm q INTO OUTFILE '/mnt/pct/exp/qcm_db1.txt'",
 			User:   "root",
 			Host:   "localhost",
 			Db:     "db1",
 			TimeMetrics: map[string]float64{
-				"Query_time": 407.540253,
+				"Query_time": 407.540262,
 				"Lock_time":  0.122377,
 			},
 			NumberMetrics: map[string]uint64{
@@ -1077,6 +1169,7 @@ func TestParserSlowLog013(t *testing.T) {
 		{
 			Offset: 7015,
 			Ts:     "140312 20:29:40",
+			Time:   time.Date(2014, 3, 12, 20, 29, 40, 0, time.UTC),
 			Query:  "select 1006,q.* from qcm q INTO OUTFILE '/mnt/pct/exp/qcm_db1006.txt'",
 			User:   "root",
 			Host:   "localhost",
@@ -1120,6 +1213,7 @@ func TestParserSlowLog014(t *testing.T) {
 				"Lock_time":            4.7e-05,
 				"Query_time":           0.000179,
 			},
+			ThreadId: 103375137,
 			NumberMetrics: map[string]uint64{
 				"Bytes_sent":            2004,
 				"InnoDB_IO_r_bytes":     0,
@@ -1146,6 +1240,9 @@ func TestParserSlowLog014(t *testing.T) {
 				"Tmp_table":         false,
 				"Tmp_table_on_disk": false,
 			},
+			Extra: map[string]string{
+				"InnoDB_trx_id": "2552F3B37",
+			},
 		},
 		{
 			//
@@ -1164,6 +1261,7 @@ func TestParserSlowLog014(t *testing.T) {
 				"Lock_time":            0.000161,
 				"Query_time":           0.000628,
 			},
+			ThreadId: 103375137,
 			NumberMetrics: map[string]uint64{
 				"Bytes_sent":            323,
 				"InnoDB_IO_r_bytes":     0,
@@ -1190,6 +1288,9 @@ func TestParserSlowLog014(t *testing.T) {
 				"Tmp_table":         true,
 				"Tmp_table_on_disk": false,
 			},
+			Extra: map[string]string{
+				"InnoDB_trx_id": "2552F3B38",
+			},
 		},
 		{
 			Offset: 2105,
@@ -1204,6 +1305,7 @@ func TestParserSlowLog014(t *testing.T) {
 				"Lock_time":            0.000116,
 				"Query_time":           0.00042,
 			},
+			ThreadId: 103375137,
 			NumberMetrics: map[string]uint64{
 				"Bytes_sent":            60,
 				"InnoDB_IO_r_bytes":     0,
@@ -1230,6 +1332,9 @@ func TestParserSlowLog014(t *testing.T) {
 				"Tmp_table":         true,
 				"Tmp_table_on_disk": false,
 			},
+			Extra: map[string]string{
+				"InnoDB_trx_id": "2552F3B39",
+			},
 		},
 		{
 			Offset: 3164,
@@ -1244,6 +1349,7 @@ func TestParserSlowLog014(t *testing.T) {
 				"Lock_time":            0.000144,
 				"Query_time":           0.000457,
 			},
+			ThreadId: 103375137,
 			NumberMetrics: map[string]uint64{
 				"Bytes_sent":            359,
 				"InnoDB_IO_r_bytes":     0,
@@ -1270,6 +1376,9 @@ func TestParserSlowLog014(t *testing.T) {
 				"Tmp_table":         true,
 				"Tmp_table_on_disk": false,
 			},
+			Extra: map[string]string{
+				"InnoDB_trx_id": "2552F3B3A",
+			},
 		},
 	}
 	if diff := deep.Equal(got, expect); diff != nil {
@@ -1385,6 +1494,7 @@ func TestParseSlow019(t *testing.T) {
 				"Lock_time":  0.0001,
 				"Query_time": 0.004599,
 			},
+			ThreadId: 37911936,
 			NumberMetrics: map[string]uint64{
 				"Bytes_sent":      70092,
 				"Killed":          0,
@@ -1419,6 +1529,7 @@ func TestParseSlow019(t *testing.T) {
 				"Lock_time":  0,
 				"Query_time": 2.2e-05,
 			},
+			ThreadId: 57434695,
 			NumberMetrics: map[string]uint64{
 				"Bytes_sent":      1333,
 				"Killed":          0,
@@ -1456,6 +1567,7 @@ func TestParseSlow019(t *testing.T) {
 				"Lock_time":            7.8e-05,
 				"Query_time":           0.005241,
 			},
+			ThreadId: 57434695,
 			NumberMetrics: map[string]uint64{
 				"Bytes_sent":            52,
 				"InnoDB_IO_r_bytes":     0,
@@ -1482,6 +1594,9 @@ func TestParseSlow019(t *testing.T) {
 				"Tmp_table":         false,
 				"Tmp_table_on_disk": false,
 			},
+			Extra: map[string]string{
+				"InnoDB_trx_id": "3AC1F89B8",
+			},
 		},
 		{
 			Query:  `SELECT TABLE_SCHEMA, TABLE_NAME, INDEX_NAME, ROWS_READ FROM INFORMATION_SCHEMA.INDEX_STATISTICS`,
@@ -1492,6 +1607,7 @@ func TestParseSlow019(t *testing.T) {
 				"Lock_time":  0.000115,
 				"Query_time": 0.011565,
 			},
+			ThreadId: 37911936,
 			NumberMetrics: map[string]uint64{
 				"Bytes_sent":      102084,
 				"Killed":          0,
@@ -1731,6 +1847,7 @@ func TestParseSlow024(t *testing.T) {
 		{
 			Offset: 200,
 			Ts:     "071015 21:43:52",
+			Time:   time.Date(2007, 10, 15, 21, 43, 52, 0, time.UTC),
 			Admin:  false,
 			Query:  "select sleep(1) from n",
 			User:   "root",
@@ -1771,6 +1888,7 @@ func TestParseSlow024(t *testing.T) {
 		{
 			Offset: 508,
 			Ts:     "071015 21:43:52",
+			Time:   time.Date(2007, 10, 15, 21, 43, 52, 0, time.UTC),
 			Admin:  false,
 			Query:  "select sleep(3) from n",
 			User:   "",
@@ -1794,3 +1912,1933 @@ func TestParseSlow024(t *testing.T) {
 		t.Error(diff)
 	}
 }
+
+// MySQL 8.0 with log_slow_extra: ISO time, Id on User@Host line, and all
+// metrics on one line including non-numeric Start and End timestamps.
+func TestParseSlow026(t *testing.T) {
+	got := parseSlowLog(t, "slow026.log", noOptions)
+	expect := []slowlog.Event{
+		{
+			Offset:  182,
+			Ts:      "2022-03-01T10:20:30.123456Z",
+			Time:    time.Date(2022, 3, 1, 10, 20, 30, 123456000, time.UTC),
+			StartTs: "2022-03-01T10:20:30.123256Z",
+			EndTs:   "2022-03-01T10:20:30.123456Z",
+			Admin:   false,
+			Query:   "SELECT c FROM t WHERE id = 1",
+			User:    "app",
+			Host:    "localhost",
+			Db:      "app",
+			TimeMetrics: map[string]float64{
+				"Query_time": 0.0002,
+				"Lock_time":  0.0001,
+			},
+			ThreadId: 8,
+			NumberMetrics: map[string]uint64{
+				"Rows_sent":                1,
+				"Rows_examined":            1,
+				"Thread_id":                8,
+				"Errno":                    0,
+				"Killed":                   0,
+				"Bytes_received":           30,
+				"Bytes_sent":               60,
+				"Read_first":               0,
+				"Read_last":                0,
+				"Read_key":                 1,
+				"Read_next":                0,
+				"Read_prev":                0,
+				"Read_rnd":                 0,
+				"Read_rnd_next":            0,
+				"Sort_merge_passes":        0,
+				"Sort_range_count":         0,
+				"Sort_rows":                0,
+				"Sort_scan_count":          0,
+				"Created_tmp_disk_tables":  0,
+				"Created_tmp_tables":       0,
+				"Count_hit_tmp_table_size": 0,
+			},
+			BoolMetrics: map[string]bool{},
+			SlowExtra: &slowlog.SlowExtra{
+				ThreadId:      8,
+				BytesReceived: 30,
+				BytesSent:     60,
+				ReadKey:       1,
+				Start:         time.Date(2022, 3, 1, 10, 20, 30, 123256000, time.UTC),
+				End:           time.Date(2022, 3, 1, 10, 20, 30, 123456000, time.UTC),
+			},
+		},
+		{
+			Offset:  784,
+			Ts:      "2022-03-01T10:20:31.000001Z",
+			Time:    time.Date(2022, 3, 1, 10, 20, 31, 1000, time.UTC),
+			StartTs: "2022-03-01T10:20:29.500001Z",
+			EndTs:   "2022-03-01T10:20:31.000001Z",
+			Admin:   false,
+			Query:   "INSERT INTO t VALUES (1, 'a')",
+			User:    "app",
+			Host:    "localhost",
+			Db:      "",
+			TimeMetrics: map[string]float64{
+				"Query_time": 1.5,
+				"Lock_time":  0.00001,
+			},
+			ThreadId: 9,
+			NumberMetrics: map[string]uint64{
+				"Rows_sent":                0,
+				"Rows_examined":            1000,
+				"Thread_id":                9,
+				"Errno":                    1062,
+				"Killed":                   0,
+				"Bytes_received":           42,
+				"Bytes_sent":               11,
+				"Read_first":               1,
+				"Read_last":                0,
+				"Read_key":                 1,
+				"Read_next":                0,
+				"Read_prev":                0,
+				"Read_rnd":                 0,
+				"Read_rnd_next":            1001,
+				"Sort_merge_passes":        0,
+				"Sort_range_count":         0,
+				"Sort_rows":                0,
+				"Sort_scan_count":          0,
+				"Created_tmp_disk_tables":  0,
+				"Created_tmp_tables":       0,
+				"Count_hit_tmp_table_size": 0,
+			},
+			BoolMetrics: map[string]bool{},
+			SlowExtra: &slowlog.SlowExtra{
+				ThreadId:      9,
+				Errno:         1062,
+				BytesReceived: 42,
+				BytesSent:     11,
+				ReadFirst:     1,
+				ReadKey:       1,
+				ReadRndNext:   1001,
+				Start:         time.Date(2022, 3, 1, 10, 20, 29, 500001000, time.UTC),
+				End:           time.Date(2022, 3, 1, 10, 20, 31, 1000, time.UTC),
+			},
+		},
+	}
+	if diff := deep.Equal(got, expect); diff != nil {
+		dump(got)
+		t.Error(diff)
+	}
+}
+
+// Second # Time line in a header is authoritative; metrics from the first
+// header (which has no query) must not be merged into the event.
+func TestParseSlow027(t *testing.T) {
+	got := parseSlowLog(t, "slow027.log", noOptions)
+	expect := []slowlog.Event{
+		{
+			Offset: 154,
+			Ts:     "071015 21:45:10",
+			Time:   time.Date(2007, 10, 15, 21, 45, 10, 0, time.UTC),
+			Query:  "select sleep(2) from n",
+			User:   "root",
+			Host:   "localhost",
+			Db:     "test",
+			TimeMetrics: map[string]float64{
+				"Query_time": 2,
+				"Lock_time":  0,
+			},
+			NumberMetrics: map[string]uint64{
+				"Rows_sent":     1,
+				"Rows_examined": 0,
+			},
+			BoolMetrics: map[string]bool{},
+		},
+		{
+			Offset: 376,
+			Ts:     "071015 21:46:01",
+			Time:   time.Date(2007, 10, 15, 21, 46, 1, 0, time.UTC),
+			Query:  "select sleep(3) from n",
+			User:   "app",
+			Host:   "localhost",
+			TimeMetrics: map[string]float64{
+				"Query_time": 3,
+				"Lock_time":  0,
+			},
+			NumberMetrics: map[string]uint64{
+				"Rows_sent":     1,
+				"Rows_examined": 0,
+			},
+			BoolMetrics: map[string]bool{},
+		},
+	}
+	if diff := deep.Equal(got, expect); diff != nil {
+		dump(got)
+		t.Error(diff)
+	}
+}
+
+// Restart the parser at a new offset without making a new parser.
+func TestParserRestart(t *testing.T) {
+	file, err := os.Open(path.Join("test", "slow-logs", "slow001.log"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	p := slowlog.NewFileParser(file)
+
+	// Parse the whole file.
+	if err := p.Start(noOptions); err != nil {
+		t.Fatal(err)
+	}
+	if err := p.Start(noOptions); err != slowlog.ErrStarted {
+		t.Errorf("got err %v, expected ErrStarted", err)
+	}
+	got := []uint64{}
+	for e := range p.Events() {
+		got = append(got, e.Offset)
+	}
+	if diff := deep.Equal(got, []uint64{200, 359}); diff != nil {
+		t.Error(diff)
+	}
+
+	// Restart at the second event.
+	if err := p.Start(slowlog.Options{StartOffset: 359}); err != nil {
+		t.Fatal(err)
+	}
+	got = []uint64{}
+	for e := range p.Events() {
+		got = append(got, e.Offset)
+	}
+	if diff := deep.Equal(got, []uint64{383}); diff != nil {
+		t.Error(diff)
+	}
+
+	// Stop while blocked on the first event, then restart from the beginning.
+	if err := p.Start(noOptions); err != nil {
+		t.Fatal(err)
+	}
+	p.Stop()
+	p.Stop() // no panic
+	if err := p.Start(noOptions); err != nil {
+		t.Fatal(err)
+	}
+	got = []uint64{}
+	for e := range p.Events() {
+		got = append(got, e.Offset)
+	}
+	if diff := deep.Equal(got, []uint64{200, 359}); diff != nil {
+		t.Error(diff)
+	}
+}
+
+func TestParserRestartChannels(t *testing.T) {
+	// Reading the channels while the parser restarts is not a race (go test
+	// -race).
+	file, err := os.Open(path.Join("test", "slow-logs", "slow001.log"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	p := slowlog.NewFileParser(file)
+
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		for {
+			select {
+			case <-done:
+				return
+			default:
+			}
+			p.Events()
+			p.PooledEvents()
+			p.Backfilled()
+			p.Errors()
+		}
+	}()
+	for i := 0; i < 10; i++ {
+		if err := p.Start(noOptions); err != nil {
+			t.Fatal(err)
+		}
+		n := 0
+		for range p.Events() {
+			n++
+		}
+		if n != 2 {
+			t.Errorf("got %d events, expected 2", n)
+		}
+	}
+}
+
+func TestNewParser(t *testing.T) {
+	data, err := ioutil.ReadFile(path.Join("test", "slow-logs", "slow001.log"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	parse := func(r io.Reader, opt slowlog.Options) []slowlog.Event {
+		p := slowlog.NewParser(r)
+		if err := p.Start(opt); err != nil {
+			t.Fatal(err)
+		}
+		got := []slowlog.Event{}
+		for e := range p.Events() {
+			e.EndOffset = 0
+			got = append(got, e)
+		}
+		if err := p.Error(); err != nil {
+			t.Error(err)
+		}
+		return got
+	}
+
+	// A gzip reader can't seek.
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	zw.Write(data)
+	zw.Close()
+	zr, err := gzip.NewReader(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := parse(zr, noOptions)
+	expect := parseSlowLog(t, "slow001.log", noOptions)
+	if diff := deep.Equal(got, expect); diff != nil {
+		t.Error(diff)
+	}
+
+	// Without seeking, StartOffset bytes are skipped.
+	got = parse(bytes.NewBuffer(data), slowlog.Options{StartOffset: 359})
+	expect = parseSlowLog(t, "slow001.log", slowlog.Options{StartOffset: 359})
+	if diff := deep.Equal(got, expect); diff != nil {
+		t.Error(diff)
+	}
+}
+
+func TestParserStartContext(t *testing.T) {
+	file, err := os.Open(path.Join("test", "slow-logs", "slow001.log"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	p := slowlog.NewFileParser(file)
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	// Follow never stops at EOF, so only the context stops it.
+	opt := slowlog.Options{Follow: true, FollowInterval: 10 * time.Millisecond}
+	if err := p.StartContext(ctx, opt); err != nil {
+		t.Fatal(err)
+	}
+	n := 0
+	timeout := time.After(2 * time.Second)
+	for {
+		select {
+		case _, ok := <-p.Events():
+			if ok {
+				n++
+				continue
+			}
+		case <-timeout:
+			t.Fatal("timeout waiting for context to stop parser")
+		}
+		break
+	}
+	if n != 2 {
+		t.Errorf("got %d events, expected 2", n)
+	}
+	if ctx.Err() != context.DeadlineExceeded {
+		t.Errorf("got context error %v, expected DeadlineExceeded", ctx.Err())
+	}
+}
+
+func TestParserSource(t *testing.T) {
+	got := parseSlowLog(t, "slow001.log", slowlog.Options{Source: "db1"})
+	if len(got) != 2 {
+		t.Errorf("got %d events, expected 2", len(got))
+	}
+}
+
+// Runaway header is thrown away and the parser resyncs on the next event.
+func TestParseSlow028(t *testing.T) {
+	file, err := os.Open(path.Join("test", "slow-logs", "slow028.log"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	p := slowlog.NewFileParser(file)
+	if err := p.Start(slowlog.Options{MaxHeaderLines: 5}); err != nil {
+		t.Fatal(err)
+	}
+	got := []string{}
+	for e := range p.Events() {
+		got = append(got, e.Query)
+	}
+	expect := []string{
+		"select sleep(2) from n",
+		"select sleep(3) from n",
+	}
+	if diff := deep.Equal(got, expect); diff != nil {
+		t.Error(diff)
+	}
+	expectStats := slowlog.Stats{
+		BytesRead:      614,
+		Events:         2,
+		LastEventTime:  time.Date(2007, 10, 15, 21, 45, 10, 0, time.UTC),
+		RunawayHeaders: 1,
+		Errors:         1,
+		UnknownMetrics: []slowlog.UnknownMetric{
+			{Name: "Garbage_1", Value: "1", Count: 1},
+			{Name: "Garbage_2", Value: "2", Count: 1},
+			{Name: "Garbage_3", Value: "3", Count: 1},
+			{Name: "Garbage_4", Value: "4", Count: 1},
+			{Name: "Garbage_5", Value: "5", Count: 1},
+		},
+	}
+	if diff := deep.Equal(p.Stats(), expectStats); diff != nil {
+		t.Error(diff)
+	}
+}
+
+type errReader struct {
+	err error
+}
+
+func (r errReader) Read(b []byte) (int, error) {
+	return 0, r.err
+}
+
+func TestParserStatsFailed(t *testing.T) {
+	p := slowlog.NewParser(errReader{errors.New("disk error")})
+	if err := p.Start(noOptions); err != nil {
+		t.Fatal(err)
+	}
+	for range p.Events() {
+	}
+	if p.Error() == nil || !p.Stats().Failed {
+		t.Errorf("got error %v and Failed %t, expected an error and Failed", p.Error(), p.Stats().Failed)
+	}
+}
+
+// Ts without a time zone is parsed in Options.Location; Ts with a time zone
+// (MySQL 5.7 and newer) is not.
+func TestParserLocation(t *testing.T) {
+	loc := time.FixedZone("UTC-7", -7*3600)
+
+	got := parseSlowLog(t, "slow001.log", slowlog.Options{Location: loc})
+	expect := time.Date(2007, 10, 15, 21, 43, 52, 0, loc)
+	if !got[0].Time.Equal(expect) {
+		t.Errorf("got Time %s, expected %s", got[0].Time, expect)
+	}
+
+	got = parseSlowLog(t, "slow026.log", slowlog.Options{Location: loc})
+	expect = time.Date(2022, 3, 1, 10, 20, 30, 123456000, time.UTC)
+	if !got[0].Time.Equal(expect) {
+		t.Errorf("got Time %s, expected %s", got[0].Time, expect)
+	}
+}
+
+// slow036 has every Ts format: MySQL 5.7+ UTC and log_timestamps=SYSTEM with
+// a zone offset, ISO without a zone, and legacy with a one digit hour.
+func TestParseSlow036Time(t *testing.T) {
+	loc := time.FixedZone("UTC-7", -7*3600)
+	got := parseSlowLog(t, "slow036.log", slowlog.Options{Location: loc})
+	expect := []struct {
+		ts string
+		t  time.Time
+	}{
+		{"2023-02-05T02:46:47.273786Z", time.Date(2023, 2, 5, 2, 46, 47, 273786000, time.UTC)},
+		{"2023-02-05T10:46:48.5+08:00", time.Date(2023, 2, 5, 2, 46, 48, 500000000, time.UTC)},
+		{"2023-02-04T19:46:49.000100", time.Date(2023, 2, 5, 2, 46, 49, 100000, time.UTC)},
+		{"230204 19:46:50", time.Date(2023, 2, 5, 2, 46, 50, 0, time.UTC)},
+		{"230204  9:46:51", time.Date(2023, 2, 4, 16, 46, 51, 0, time.UTC)},
+	}
+	if len(got) != len(expect) {
+		t.Fatalf("got %d events, expected %d", len(got), len(expect))
+	}
+	for i, e := range expect {
+		if got[i].Ts != e.ts || !got[i].Time.Equal(e.t) {
+			t.Errorf("event %d: got Ts %q Time %s, expected %q %s", i, got[i].Ts, got[i].Time, e.ts, e.t)
+		}
+	}
+}
+
+// slow029 has a Ts repeated when clocks go back in New York (ambiguous),
+// a Ts skipped when clocks go forward (invalid), and a Ts just after.
+func TestParseSlow029DST(t *testing.T) {
+	loc, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Skip(err)
+	}
+	edt := time.FixedZone("EDT", -4*3600)
+	est := time.FixedZone("EST", -5*3600)
+	tests := []struct {
+		dst       slowlog.DSTResolution
+		expect    []time.Time
+		ambiguous []bool
+	}{
+		{
+			dst: slowlog.DST_EARLIEST,
+			expect: []time.Time{
+				time.Date(2007, 11, 4, 1, 30, 0, 0, edt),
+				time.Date(2008, 3, 9, 1, 30, 0, 0, est),
+				time.Date(2008, 3, 9, 3, 30, 0, 0, edt),
+			},
+			ambiguous: []bool{true, true, false},
+		},
+		{
+			dst: slowlog.DST_LATEST,
+			expect: []time.Time{
+				time.Date(2007, 11, 4, 1, 30, 0, 0, est),
+				time.Date(2008, 3, 9, 3, 30, 0, 0, edt),
+				time.Date(2008, 3, 9, 3, 30, 0, 0, edt),
+			},
+			ambiguous: []bool{true, true, false},
+		},
+		{
+			dst: slowlog.DST_UTC,
+			expect: []time.Time{
+				time.Date(2007, 11, 4, 1, 30, 0, 0, time.UTC),
+				time.Date(2008, 3, 9, 2, 30, 0, 0, time.UTC),
+				time.Date(2008, 3, 9, 3, 30, 0, 0, edt),
+			},
+			ambiguous: []bool{true, true, false},
+		},
+	}
+	for _, test := range tests {
+		got := parseSlowLog(t, "slow029.log", slowlog.Options{Location: loc, DST: test.dst})
+		if len(got) != len(test.expect) {
+			t.Fatalf("got %d events, expected %d", len(got), len(test.expect))
+		}
+		for i := range got {
+			if !got[i].Time.Equal(test.expect[i]) {
+				t.Errorf("DST %d event %d: got Time %s, expected %s", test.dst, i, got[i].Time, test.expect[i])
+			}
+			if got[i].TimeAmbiguous != test.ambiguous[i] {
+				t.Errorf("DST %d event %d: got TimeAmbiguous %t, expected %t", test.dst, i, got[i].TimeAmbiguous, test.ambiguous[i])
+			}
+		}
+	}
+}
+
+func TestParserExtractParams(t *testing.T) {
+	got := parseSlowLog(t, "slow026.log", slowlog.Options{ExtractParams: true})
+	expect := [][]slowlog.Param{
+		{
+			{Type: slowlog.PARAM_INT, Value: "1"},
+		},
+		{
+			{Type: slowlog.PARAM_INT, Value: "1"},
+			{Type: slowlog.PARAM_STRING, Value: "a"},
+		},
+	}
+	for i := range got {
+		if diff := deep.Equal(got[i].Params, expect[i]); diff != nil {
+			t.Errorf("event %d: %v", i, diff)
+		}
+	}
+}
+
+// slow030 has "use db" only once per connection.
+func TestParseSlow030InheritDb(t *testing.T) {
+	got := parseSlowLog(t, "slow030.log", slowlog.Options{InheritDbPerConnection: true})
+	gotDb := []string{}
+	for _, e := range got {
+		gotDb = append(gotDb, e.Db)
+	}
+	expect := []string{"db1", "", "db1", "db2", "db2", "db1", ""}
+	if diff := deep.Equal(gotDb, expect); diff != nil {
+		t.Error(diff)
+	}
+
+	// Db is not inherited by default.
+	got = parseSlowLog(t, "slow030.log", noOptions)
+	gotDb = []string{}
+	for _, e := range got {
+		gotDb = append(gotDb, e.Db)
+	}
+	expect = []string{"db1", "", "", "db2", "", "", ""}
+	if diff := deep.Equal(gotDb, expect); diff != nil {
+		t.Error(diff)
+	}
+}
+
+// slow031 has INSERT and REPLACE with and without a VALUES list.
+func TestParseSlow031InsertRows(t *testing.T) {
+	got := parseSlowLog(t, "slow031.log", slowlog.Options{InsertRows: true})
+	expect := []map[string]uint64{
+		{"Rows_sent": 0, "Rows_examined": 0, "Insert_rows": 3},
+		{"Rows_sent": 0, "Rows_examined": 0, "Insert_rows": 1},
+		{"Rows_sent": 0, "Rows_examined": 0},
+		{"Rows_sent": 0, "Rows_examined": 0},
+	}
+	if len(got) != len(expect) {
+		t.Fatalf("got %d events, expected %d", len(got), len(expect))
+	}
+	for i := range got {
+		if diff := deep.Equal(got[i].NumberMetrics, expect[i]); diff != nil {
+			t.Errorf("event %d: %v", i, diff)
+		}
+	}
+}
+
+func TestParserSensitiveNames(t *testing.T) {
+	got := parseSlowLog(t, "slow031.log", slowlog.Options{SensitiveNames: []string{"T", "id"}})
+	expect := []string{
+		"INSERT INTO t (a, b) VALUES (?, ?), (?, ?), (?, NULL)",
+		"insert into t values (?, ?)\n  on duplicate key update b = values(b)",
+		"REPLACE INTO t SELECT * FROM u",
+		"SELECT * FROM t WHERE id IN (?, ?)",
+	}
+	for i := range got {
+		if got[i].Query != expect[i] {
+			t.Errorf("event %d: got %s, expected %s", i, got[i].Query, expect[i])
+		}
+	}
+
+	got = parseSlowLog(t, "slow031.log", slowlog.Options{SensitiveNames: []string{"u"}})
+	if got[0].Query != "INSERT INTO t (a, b) VALUES (1, 'x)'), (2, '('), (3, NULL)" {
+		t.Errorf("query masked but does not reference u: %s", got[0].Query)
+	}
+}
+
+// Header and admin lines in a multi-line string literal are query text
+// with Options.QuoteAware.
+func TestParseSlow032QuoteAware(t *testing.T) {
+	got := parseSlowLog(t, "slow032.log", slowlog.Options{QuoteAware: true})
+	expect := []string{
+		"insert into t values ('line 1\n# Time: 071015 21:43:53\n# Query_time: 9  Lock_time: 0  Rows_sent: 0  Rows_examined: 0\nit''s \\' here', \"a\n# admin command: Quit;\nb\")",
+		"select 'x' from n -- it's",
+		"select 1",
+	}
+	queries := []string{}
+	for _, e := range got {
+		queries = append(queries, e.Query)
+	}
+	if diff := deep.Equal(queries, expect); diff != nil {
+		t.Error(diff)
+	}
+	if got[0].TimeMetrics["Query_time"] != 2 {
+		t.Errorf("got Query_time %f, expected 2", got[0].TimeMetrics["Query_time"])
+	}
+
+	got = parseSlowLog(t, "slow032.log", noOptions)
+	if got[0].Query != "insert into t values ('line 1" {
+		t.Errorf("without QuoteAware, got query %q", got[0].Query)
+	}
+}
+
+// Quoted identifiers can span lines, too. A quote that isn't closed after
+// Options.MaxQuotedLines is ignored.
+func TestParseSlow033UnclosedQuote(t *testing.T) {
+	file, err := os.Open(path.Join("test", "slow-logs", "slow033.log"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	p := slowlog.NewFileParser(file)
+	if err := p.Start(slowlog.Options{QuoteAware: true, MaxQuotedLines: 2}); err != nil {
+		t.Fatal(err)
+	}
+	got := []slowlog.Event{}
+	for e := range p.Events() {
+		got = append(got, e)
+	}
+	expect := []string{
+		"select `a\n# Time: 1` from t",
+		"select 'unclosed from n;\nselect 2;\n# Time: 071015 21:46:00",
+		"select 1",
+	}
+	queries := []string{}
+	for _, e := range got {
+		queries = append(queries, e.Query)
+	}
+	if diff := deep.Equal(queries, expect); diff != nil {
+		t.Error(diff)
+	}
+	// Falls back to parsing the event from the User@Host line.
+	if got[2].User != "root" || got[2].TimeMetrics["Query_time"] != 4 {
+		t.Errorf("got User %q Query_time %f, expected root and 4", got[2].User, got[2].TimeMetrics["Query_time"])
+	}
+	if n := p.Stats().UnclosedQuotes; n != 1 {
+		t.Errorf("got %d UnclosedQuotes, expected 1", n)
+	}
+}
+
+func TestParserHeaderFilter(t *testing.T) {
+	file, err := os.Open(path.Join("test", "slow-logs", "slow002.log"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	p := slowlog.NewFileParser(file)
+	opt := slowlog.Options{
+		HeaderFilter: func(e slowlog.Event) bool {
+			return e.TimeMetrics["Query_time"] >= 0.5
+		},
+	}
+	if err := p.Start(opt); err != nil {
+		t.Fatal(err)
+	}
+	got := []slowlog.Event{}
+	for e := range p.Events() {
+		e.EndOffset = 0
+		got = append(got, e)
+	}
+
+	all := parseSlowLog(t, "slow002.log", noOptions)
+	expect := []slowlog.Event{}
+	for _, e := range all {
+		if e.TimeMetrics["Query_time"] >= 0.5 {
+			e.Source = file.Name()
+			expect = append(expect, e)
+		}
+	}
+	if len(expect) == 0 || len(expect) == len(all) {
+		t.Fatalf("filter keeps %d of %d events, expected some", len(expect), len(all))
+	}
+	if diff := deep.Equal(got, expect); diff != nil {
+		t.Error(diff)
+	}
+	if n := p.Stats().Skipped; n != uint64(len(all)-len(expect)) {
+		t.Errorf("got %d skipped, expected %d", n, len(all)-len(expect))
+	}
+}
+
+func TestParserUpdateOptions(t *testing.T) {
+	file, err := os.Open(path.Join("test", "slow-logs", "slow031.log"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	p := slowlog.NewFileParser(file)
+	if err := p.Start(noOptions); err != nil {
+		t.Fatal(err)
+	}
+	got := []slowlog.Event{<-p.Events()}
+	// The next event might have been parsed with the old options, but not
+	// the events after it. PoolEvents cannot change, so events are still sent
+	// to Events.
+	p.UpdateOptions(slowlog.Options{SensitiveNames: []string{"t"}, PoolEvents: true})
+	for e := range p.Events() {
+		got = append(got, e)
+	}
+	if len(got) != 4 {
+		t.Fatalf("got %d events, expected 4", len(got))
+	}
+	if got[0].Query != "INSERT INTO t (a, b) VALUES (1, 'x)'), (2, '('), (3, NULL)" {
+		t.Errorf("query masked before update: %s", got[0].Query)
+	}
+	if got[3].Query != "SELECT * FROM t WHERE id IN (?, ?)" {
+		t.Errorf("query not masked after update: %s", got[3].Query)
+	}
+	if got[3].Source != file.Name() {
+		t.Errorf("got Source %s, expected %s", got[3].Source, file.Name())
+	}
+}
+
+func TestParserUpdateOptionsBeforeStart(t *testing.T) {
+	// Start drops options updated before it.
+	file, err := os.Open(path.Join("test", "slow-logs", "slow001.log"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	p := slowlog.NewFileParser(file)
+	p.UpdateOptions(slowlog.Options{Source: "stale"})
+	if err := p.Start(slowlog.Options{Source: "fresh"}); err != nil {
+		t.Fatal(err)
+	}
+	got := []string{}
+	for e := range p.Events() {
+		got = append(got, e.Source)
+	}
+	if diff := deep.Equal(got, []string{"fresh", "fresh"}); diff != nil {
+		t.Error(diff)
+	}
+}
+
+func TestParserFollow(t *testing.T) {
+	data, err := ioutil.ReadFile(path.Join("test", "slow-logs", "slow001.log"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	file, err := ioutil.TempFile("", "slowlog-test-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(file.Name())
+	defer file.Close()
+	if _, err := file.Write(data); err != nil {
+		t.Fatal(err)
+	}
+
+	in, err := os.Open(file.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer in.Close()
+	p := slowlog.NewFileParser(in)
+	opt := slowlog.Options{Follow: true, FollowInterval: 10 * time.Millisecond}
+	if err := p.Start(opt); err != nil {
+		t.Fatal(err)
+	}
+	defer p.Stop()
+
+	got := []string{}
+	backfilled := p.Backfilled()
+	for backfilled != nil {
+		select {
+		case e := <-p.Events():
+			got = append(got, e.Query)
+		case <-backfilled:
+			backfilled = nil
+		}
+	}
+	expect := []string{"select sleep(2) from n", "select sleep(2) from test.n"}
+	if diff := deep.Equal(got, expect); diff != nil {
+		t.Error(diff)
+	}
+
+	// Write one event in two parts. It's sent when the next event begins.
+	live := "# Time: 071015 21:46:00\n# Query_time: 3  Lock_time: 0  Rows_sent: 1  Rows_examined: 0\nselect sle"
+	if _, err := file.WriteString(live); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(20 * time.Millisecond)
+	if _, err := file.WriteString("ep(3);\n# Time: 071015 21:47:00\n"); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case e := <-p.Events():
+		if e.Query != "select sleep(3)" {
+			t.Errorf("got live query %q, expected \"select sleep(3)\"", e.Query)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("timeout waiting for live event")
+	}
+
+	p.Stop()
+	if _, ok := <-p.Events(); ok {
+		t.Error("got event after Stop")
+	}
+}
+
+// With Follow, parsing stops at EndOffset after the parser is backfilled.
+func TestParserFollowEndOffset(t *testing.T) {
+	data, err := ioutil.ReadFile(path.Join("test", "slow-logs", "slow001.log"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	file, err := ioutil.TempFile("", "slowlog-test-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(file.Name())
+	defer file.Close()
+	if _, err := file.Write(data); err != nil {
+		t.Fatal(err)
+	}
+
+	in, err := os.Open(file.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer in.Close()
+	p := slowlog.NewFileParser(in)
+	opt := slowlog.Options{
+		Follow:         true,
+		FollowInterval: 10 * time.Millisecond,
+		EndOffset:      uint64(len(data)),
+	}
+	if err := p.Start(opt); err != nil {
+		t.Fatal(err)
+	}
+	defer p.Stop()
+
+	got := []string{}
+	backfilled := p.Backfilled()
+	for backfilled != nil {
+		select {
+		case e := <-p.Events():
+			got = append(got, e.Query)
+		case <-backfilled:
+			backfilled = nil
+		}
+	}
+
+	// The next event begins at EndOffset, so parsing stops.
+	live := "# Time: 071015 21:46:00\n# Query_time: 3  Lock_time: 0  Rows_sent: 1  Rows_examined: 0\nselect sleep(3);\n"
+	if _, err := file.WriteString(live); err != nil {
+		t.Fatal(err)
+	}
+	timeout := time.After(2 * time.Second)
+	for done := false; !done; {
+		select {
+		case e, ok := <-p.Events():
+			if !ok {
+				done = true
+				break
+			}
+			got = append(got, e.Query)
+		case <-timeout:
+			t.Fatal("timeout waiting for parser to stop at EndOffset")
+		}
+	}
+	if err := p.Error(); err != nil {
+		t.Error(err)
+	}
+	expect := []string{"select sleep(2) from n", "select sleep(2) from test.n"}
+	if diff := deep.Equal(got, expect); diff != nil {
+		t.Error(diff)
+	}
+}
+
+func TestParserMaxEventsPerSecond(t *testing.T) {
+	t0 := time.Now()
+	got := parseSlowLog(t, "slow001.log", slowlog.Options{MaxEventsPerSecond: 20, EventBurst: 1})
+	if len(got) != 2 {
+		t.Errorf("got %d events, expected 2", len(got))
+	}
+	// The first event is the burst, the second is throttled for 1/20s.
+	if d := time.Now().Sub(t0); d < 40*time.Millisecond {
+		t.Errorf("parsed in %s, expected at least 50ms", d)
+	}
+}
+
+func TestParserMaxBytesPerSecond(t *testing.T) {
+	t0 := time.Now()
+	got := parseSlowLog(t, "slow001.log", slowlog.Options{MaxBytesPerSecond: 10000, ByteBurst: 100})
+	if len(got) != 2 {
+		t.Errorf("got %d events, expected 2", len(got))
+	}
+	// 524 bytes less a 100 byte burst at 10,000 bytes/s is 42ms.
+	if d := time.Now().Sub(t0); d < 35*time.Millisecond {
+		t.Errorf("parsed in %s, expected at least 42ms", d)
+	}
+}
+
+// Metrics in all test slow logs are known.
+func TestParserNoUnknownMetrics(t *testing.T) {
+	files, err := filepath.Glob(path.Join("test", "slow-logs", "slow*.log"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, f := range files {
+		if strings.HasSuffix(f, "slow028.log") {
+			continue // garbage metrics
+		}
+		if strings.HasSuffix(f, "slow042.log") {
+			continue // unknown metrics for Options.TimeUnits
+		}
+		file, err := os.Open(f)
+		if err != nil {
+			t.Fatal(err)
+		}
+		p := slowlog.NewFileParser(file)
+		if err := p.Start(noOptions); err != nil {
+			t.Fatal(err)
+		}
+		for range p.Events() {
+		}
+		if s := p.Stats(); len(s.UnknownMetrics) > 0 {
+			t.Errorf("%s: unknown metrics: %+v", f, s.UnknownMetrics)
+		}
+		file.Close()
+	}
+}
+
+func TestParseSlow034Extra(t *testing.T) {
+	got := parseSlowLog(t, "slow034.log", noOptions)
+	expect := []slowlog.Event{
+		{
+			Offset: 0,
+			Ts:     "190820 10:00:00",
+			Time:   time.Date(2019, 8, 20, 10, 0, 0, 0, time.UTC),
+			Query:  "select * from orders where total > 100",
+			User:   "app",
+			Host:   "localhost",
+			Db:     "shop",
+			TimeMetrics: map[string]float64{
+				"Query_time": 1.5,
+				"Lock_time":  0.5,
+			},
+			ThreadId: 5,
+			NumberMetrics: map[string]uint64{
+				"Thread_id":     5,
+				"Rows_sent":     1,
+				"Rows_examined": 100,
+				"Rows_affected": 0,
+				"Bytes_sent":    120,
+				"Merge_passes":  0,
+			},
+			BoolMetrics: map[string]bool{
+				"QC_hit":            false,
+				"Full_scan":         true,
+				"Full_join":         false,
+				"Tmp_table":         false,
+				"Tmp_table_on_disk": false,
+				"Filesort":          false,
+				"Filesort_on_disk":  false,
+				"Priority_queue":    false,
+			},
+			Extra: map[string]string{
+				"InnoDB_trx_id": "1A2B",
+				"explain": "id\tselect_type\ttable\ttype\tpossible_keys\tkey\tkey_len\tref\trows\tr_rows\tfiltered\tr_filtered\tExtra\n" +
+					"1\tSIMPLE\torders\tALL\tNULL\tNULL\tNULL\tNULL\t100\t100.00\t100.00\t1.00\tUsing where",
+			},
+			Explain: []slowlog.ExplainRow{
+				{
+					Table: "orders",
+					Type:  "ALL",
+					Rows:  100,
+					Extra: "Using where",
+					Columns: map[string]string{
+						"id":            "1",
+						"select_type":   "SIMPLE",
+						"table":         "orders",
+						"type":          "ALL",
+						"possible_keys": "",
+						"key":           "",
+						"key_len":       "",
+						"ref":           "",
+						"rows":          "100",
+						"r_rows":        "100.00",
+						"filtered":      "100.00",
+						"r_filtered":    "1.00",
+						"Extra":         "Using where",
+					},
+				},
+			},
+		},
+	}
+	if diff := deep.Equal(got, expect); diff != nil {
+		t.Error(diff)
+		dump(got)
+	}
+}
+
+// slow037 is MariaDB with an empty Schema and a Stored routine line.
+func TestParseSlow037MariaDB(t *testing.T) {
+	got := parseSlowLog(t, "slow037.log", noOptions)
+	expect := []slowlog.Event{
+		{
+			Offset: 0,
+			Ts:     "230205  2:46:47",
+			Time:   time.Date(2023, 2, 5, 2, 46, 47, 0, time.UTC),
+			Query:  "SELECT 1",
+			User:   "app",
+			Host:   "localhost",
+			TimeMetrics: map[string]float64{
+				"Query_time": 0.25,
+				"Lock_time":  0.0001,
+			},
+			ThreadId: 12,
+			NumberMetrics: map[string]uint64{
+				"Thread_id":     12,
+				"Rows_sent":     0,
+				"Rows_examined": 0,
+				"Rows_affected": 0,
+				"Bytes_sent":    11,
+			},
+			BoolMetrics: map[string]bool{
+				"QC_hit": false,
+			},
+		},
+		{
+			Offset: 247,
+			Ts:     "230205  2:46:48",
+			Time:   time.Date(2023, 2, 5, 2, 46, 48, 0, time.UTC),
+			Query:  "UPDATE orders SET total = total + 1 WHERE id = 5",
+			User:   "app",
+			Host:   "localhost",
+			Db:     "shop",
+			TimeMetrics: map[string]float64{
+				"Query_time": 0.5,
+				"Lock_time":  0.0001,
+			},
+			ThreadId: 12,
+			NumberMetrics: map[string]uint64{
+				"Thread_id":     12,
+				"Rows_sent":     1,
+				"Rows_examined": 1000,
+				"Rows_affected": 1,
+				"Bytes_sent":    52,
+			},
+			BoolMetrics: map[string]bool{
+				"QC_hit": true,
+			},
+			Extra: map[string]string{
+				"Stored_routine": "shop.update_totals",
+			},
+		},
+	}
+	if diff := deep.Equal(got, expect); diff != nil {
+		t.Error(diff)
+		dump(got)
+	}
+}
+
+// slow038 is Percona Server with log_slow_verbosity=profiling.
+func TestParseSlow038Profile(t *testing.T) {
+	got := parseSlowLog(t, "slow038.log", noOptions)
+	expect := []slowlog.Event{
+		{
+			Offset: 0,
+			Ts:     "130601  8:00:00",
+			Time:   time.Date(2013, 6, 1, 8, 0, 0, 0, time.UTC),
+			Query:  "select * from t where id = 1",
+			User:   "root",
+			Host:   "localhost",
+			Db:     "test",
+			TimeMetrics: map[string]float64{
+				"Query_time":                       0.000286,
+				"Lock_time":                        0.000071,
+				"Profile_starting":                 0.000053,
+				"Profile_starting_cpu":             0.000052,
+				"Profile_checking_permissions":     0.000007,
+				"Profile_checking_permissions_cpu": 0.000007,
+				"Profile_Opening_tables":           0.000018,
+				"Profile_Opening_tables_cpu":       0.000017,
+				"Profile_init":                     0.000025,
+				"Profile_init_cpu":                 0.000024,
+				"Profile_end":                      0.000002,
+				"Profile_end_cpu":                  0.000002,
+				"Profile_total":                    0.000105,
+				"Profile_total_cpu":                0.000102,
+			},
+			ThreadId: 2,
+			NumberMetrics: map[string]uint64{
+				"Thread_id":       2,
+				"Last_errno":      0,
+				"Killed":          0,
+				"Rows_sent":       1,
+				"Rows_examined":   1,
+				"Rows_affected":   0,
+				"Rows_read":       1,
+				"Bytes_sent":      90,
+				"Tmp_tables":      0,
+				"Tmp_disk_tables": 0,
+				"Tmp_table_sizes": 0,
+			},
+			BoolMetrics: map[string]bool{},
+		},
+	}
+	if diff := deep.Equal(got, expect); diff != nil {
+		t.Error(diff)
+		dump(got)
+	}
+}
+
+// slow039 has "# explain:" lines separated by spaces instead of tabs.
+func TestParseSlow039Explain(t *testing.T) {
+	got := parseSlowLog(t, "slow039.log", noOptions)
+	if len(got) != 1 {
+		t.Fatalf("got %d events, expected 1", len(got))
+	}
+	expect := []slowlog.ExplainRow{
+		{
+			Table: "o",
+			Type:  "ref",
+			Key:   "customer_id",
+			Rows:  500,
+			Extra: "Using where; Using filesort",
+			Columns: map[string]string{
+				"id":            "1",
+				"select_type":   "SIMPLE",
+				"table":         "o",
+				"type":          "ref",
+				"possible_keys": "customer_id",
+				"key":           "customer_id",
+				"key_len":       "4",
+				"ref":           "const",
+				"rows":          "500",
+				"Extra":         "Using where; Using filesort",
+			},
+		},
+		{
+			Table: "c",
+			Type:  "eq_ref",
+			Key:   "PRIMARY",
+			Rows:  1,
+			Columns: map[string]string{
+				"id":            "1",
+				"select_type":   "SIMPLE",
+				"table":         "c",
+				"type":          "eq_ref",
+				"possible_keys": "PRIMARY",
+				"key":           "PRIMARY",
+				"key_len":       "4",
+				"ref":           "shop.o.customer_id",
+				"rows":          "1",
+				"Extra":         "",
+			},
+		},
+	}
+	if diff := deep.Equal(got[0].Explain, expect); diff != nil {
+		t.Error(diff)
+	}
+	if got[0].Query != "select * from orders o join customers c on c.id = o.customer_id where o.customer_id = 5 order by o.total" {
+		t.Errorf("got query %q", got[0].Query)
+	}
+}
+
+// slow035 has a Query_time and a Rows_sent that are implausible.
+func TestParseSlow035MetricBounds(t *testing.T) {
+	parse := func(opt slowlog.Options) ([]slowlog.Event, slowlog.Stats) {
+		file, err := os.Open(path.Join("test", "slow-logs", "slow035.log"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer file.Close()
+		p := slowlog.NewFileParser(file)
+		if err := p.Start(opt); err != nil {
+			t.Fatal(err)
+		}
+		got := []slowlog.Event{}
+		for e := range p.Events() {
+			got = append(got, e)
+		}
+		return got, p.Stats()
+	}
+
+	// Clamp
+	opt := slowlog.Options{
+		MetricBounds: slowlog.MetricBounds{
+			"Query_time": {Max: 86400},
+			"Rows_sent":  {Max: 1e9},
+		},
+	}
+	got, stats := parse(opt)
+	if len(got) != 3 {
+		t.Fatalf("got %d events, expected 3", len(got))
+	}
+	if v := got[1].TimeMetrics["Query_time"]; v != 86400 {
+		t.Errorf("got Query_time %f, expected 86400", v)
+	}
+	if v := got[2].NumberMetrics["Rows_sent"]; v != 1e9 {
+		t.Errorf("got Rows_sent %d, expected 1e9", v)
+	}
+	if stats.ClampedValues != 2 || stats.RejectedEvents != 0 {
+		t.Errorf("got %d clamped, %d rejected, expected 2 and 0", stats.ClampedValues, stats.RejectedEvents)
+	}
+
+	// Reject
+	opt.MetricBounds["Query_time"] = slowlog.MetricBound{Max: 86400, Reject: true}
+	got, stats = parse(opt)
+	queries := []string{}
+	for _, e := range got {
+		queries = append(queries, e.Query)
+	}
+	if diff := deep.Equal(queries, []string{"select 1", "select 3"}); diff != nil {
+		t.Error(diff)
+	}
+	if stats.ClampedValues != 1 || stats.RejectedEvents != 1 {
+		t.Errorf("got %d clamped, %d rejected, expected 1 and 1", stats.ClampedValues, stats.RejectedEvents)
+	}
+}
+
+func TestParseEndOffset(t *testing.T) {
+	all := parseSlowLog(t, "slow002.log", noOptions)
+	if len(all) < 3 {
+		t.Fatalf("got %d events, expected at least 3", len(all))
+	}
+
+	// Events before the end offset.
+	got := parseSlowLog(t, "slow002.log", slowlog.Options{EndOffset: all[2].Offset})
+	if diff := deep.Equal(got, all[0:2]); diff != nil {
+		t.Error(diff)
+	}
+
+	// An event that straddles the end offset is parsed to its end.
+	got = parseSlowLog(t, "slow002.log", slowlog.Options{EndOffset: all[2].Offset + 1})
+	if diff := deep.Equal(got, all[0:3]); diff != nil {
+		t.Error(diff)
+	}
+
+	// The range after the first range parses the rest.
+	got = parseSlowLog(t, "slow002.log", slowlog.Options{StartOffset: all[2].Offset})
+	if len(got) != len(all)-2 {
+		t.Fatalf("got %d events, expected %d", len(got), len(all)-2)
+	}
+	if got[0].Query != all[2].Query {
+		t.Errorf("got first query %q, expected %q", got[0].Query, all[2].Query)
+	}
+}
+
+func TestParseMaxBytes(t *testing.T) {
+	all := parseSlowLog(t, "slow002.log", noOptions)
+	if len(all) < 4 {
+		t.Fatalf("got %d events, expected at least 4", len(all))
+	}
+
+	// MaxBytes from the start is the same as EndOffset.
+	got := parseSlowLog(t, "slow002.log", slowlog.Options{MaxBytes: all[2].Offset})
+	if diff := deep.Equal(got, all[0:2]); diff != nil {
+		t.Error(diff)
+	}
+
+	// MaxBytes is relative to StartOffset.
+	got = parseSlowLog(t, "slow002.log", slowlog.Options{
+		StartOffset: all[1].Offset,
+		MaxBytes:    all[3].Offset - all[1].Offset,
+	})
+	if len(got) != 2 {
+		t.Fatalf("got %d events, expected 2", len(got))
+	}
+	if got[1].Query != all[2].Query {
+		t.Errorf("got last query %q, expected %q", got[1].Query, all[2].Query)
+	}
+
+	// The lesser of EndOffset and StartOffset+MaxBytes bounds parsing.
+	got = parseSlowLog(t, "slow002.log", slowlog.Options{EndOffset: all[1].Offset, MaxBytes: all[3].Offset})
+	if diff := deep.Equal(got, all[0:1]); diff != nil {
+		t.Error(diff)
+	}
+}
+
+// slow040 has MySQL 8.0 log_slow_extra fields with log_timestamps=SYSTEM,
+// including a query killed by max_execution_time (error 3024).
+func TestParseSlow040(t *testing.T) {
+	got := parseSlowLog(t, "slow040.log", noOptions)
+	if len(got) != 2 {
+		t.Fatalf("got %d events, expected 2", len(got))
+	}
+	expect := []*slowlog.SlowExtra{
+		{
+			ThreadId:             21,
+			BytesReceived:        61,
+			BytesSent:            412,
+			ReadFirst:            1,
+			ReadKey:              2,
+			ReadRnd:              10,
+			ReadRndNext:          20001,
+			SortMergePasses:      3,
+			SortRows:             10,
+			SortScanCount:        1,
+			CreatedTmpDiskTables: 1,
+			CreatedTmpTables:     1,
+			CountHitTmpTableSize: 1,
+			Start:                time.Date(2023, 6, 1, 10, 0, 0, 0, time.UTC),
+			End:                  time.Date(2023, 6, 1, 10, 0, 2, 250000000, time.UTC),
+		},
+		{
+			ThreadId:      22,
+			Errno:         3024,
+			Killed:        3024,
+			BytesReceived: 40,
+			ReadRndNext:   500,
+			Start:         time.Date(2023, 6, 1, 10, 0, 2, 0, time.UTC),
+			End:           time.Date(2023, 6, 1, 10, 0, 5, 0, time.UTC),
+		},
+	}
+	for i := range expect {
+		if got[i].SlowExtra == nil {
+			t.Fatalf("event %d: nil SlowExtra", i)
+		}
+		// Compare instants, not locations.
+		got[i].SlowExtra.Start = got[i].SlowExtra.Start.UTC()
+		got[i].SlowExtra.End = got[i].SlowExtra.End.UTC()
+		if diff := deep.Equal(got[i].SlowExtra, expect[i]); diff != nil {
+			t.Errorf("event %d: %v", i, diff)
+		}
+	}
+	if d := got[0].SlowExtra.Duration(); d != 2250*time.Millisecond {
+		t.Errorf("got Duration %s, expected 2.25s", d)
+	}
+
+	// Events without log_slow_extra have no SlowExtra.
+	got = parseSlowLog(t, "slow001.log", noOptions)
+	for i, e := range got {
+		if e.SlowExtra != nil {
+			t.Errorf("event %d: got SlowExtra %+v, expected nil", i, e.SlowExtra)
+		}
+	}
+}
+
+func TestParseSinceUntil(t *testing.T) {
+	all := parseSlowLog(t, "slow006.log", noOptions)
+	if len(all) != 6 {
+		t.Fatalf("got %d events, expected 6", len(all))
+	}
+
+	// Since is inclusive, Until is exclusive.
+	opt := slowlog.Options{
+		Since: time.Date(2007, 12, 18, 11, 48, 57, 0, time.UTC),
+		Until: time.Date(2007, 12, 18, 11, 49, 7, 0, time.UTC),
+	}
+	got := parseSlowLog(t, "slow006.log", opt)
+	if diff := deep.Equal(got, all[1:4]); diff != nil {
+		t.Error(diff)
+	}
+
+	got = parseSlowLog(t, "slow006.log", slowlog.Options{Since: opt.Until})
+	if diff := deep.Equal(got, all[4:]); diff != nil {
+		t.Error(diff)
+	}
+
+	got = parseSlowLog(t, "slow006.log", slowlog.Options{Until: opt.Since})
+	if diff := deep.Equal(got, all[0:1]); diff != nil {
+		t.Error(diff)
+	}
+}
+
+func TestParseMinQueryTime(t *testing.T) {
+	all := parseSlowLog(t, "slow013.log", noOptions)
+	if len(all) != 5 {
+		t.Fatalf("got %d events, expected 5", len(all))
+	}
+	// Query_time 21.876617, 20.304536, 94.381440, 407.540262, 60.507698
+	got := parseSlowLog(t, "slow013.log", slowlog.Options{MinQueryTime: 60507698 * time.Microsecond})
+	expect := []slowlog.Event{all[2], all[3], all[4]}
+	if diff := deep.Equal(got, expect); diff != nil {
+		t.Error(diff)
+	}
+
+	// With a HeaderFilter, both must pass.
+	opt := slowlog.Options{
+		MinQueryTime: 21 * time.Second,
+		HeaderFilter: func(e slowlog.Event) bool { return e.TimeMetrics["Query_time"] < 100 },
+	}
+	got = parseSlowLog(t, "slow013.log", opt)
+	expect = []slowlog.Event{all[0], all[2], all[4]}
+	if diff := deep.Equal(got, expect); diff != nil {
+		t.Error(diff)
+	}
+}
+
+// slow041 has Max_used_memory logged by Percona Server 8.0.
+func TestParseSlow041(t *testing.T) {
+	got := parseSlowLog(t, "slow041.log", noOptions)
+	if len(got) != 1 {
+		t.Fatalf("got %d events, expected 1", len(got))
+	}
+	if n, ok := got[0].NumberMetrics["Max_used_memory"]; !ok || n != 268435456 {
+		t.Errorf("got Max_used_memory %d (%t), expected 268435456", n, ok)
+	}
+	if !slowlog.KnownMetrics["Max_used_memory"] || !slowlog.MEMORY_METRICS["Max_used_memory"] {
+		t.Error("Max_used_memory is not a known memory metric")
+	}
+}
+
+func TestParseIncludeExclude(t *testing.T) {
+	all := parseSlowLog(t, "slow023.log", noOptions)
+	filter := func(keep func(e slowlog.Event) bool) []slowlog.Event {
+		events := []slowlog.Event{}
+		for _, e := range all {
+			if keep(e) {
+				events = append(events, e)
+			}
+		}
+		return events
+	}
+
+	opt := slowlog.Options{Include: []slowlog.EventMatch{{User: slowlog.Glob("book*")}}}
+	got := parseSlowLog(t, "slow023.log", opt)
+	expect := filter(func(e slowlog.Event) bool { return e.User == "bookblogs" })
+	if len(expect) != 5 {
+		t.Fatalf("got %d bookblogs events, expected 5", len(expect))
+	}
+	if diff := deep.Equal(got, expect); diff != nil {
+		t.Error(diff)
+	}
+
+	opt = slowlog.Options{Exclude: []slowlog.EventMatch{{User: slowlog.Glob("percona-*")}}}
+	got = parseSlowLog(t, "slow023.log", opt)
+	expect = filter(func(e slowlog.Event) bool { return e.User != "percona-agent" })
+	if diff := deep.Equal(got, expect); diff != nil {
+		t.Error(diff)
+	}
+
+	// MySQL logs the db after the header, in a use statement.
+	opt = slowlog.Options{Include: []slowlog.EventMatch{{User: regexp.MustCompile("^backup$"), Db: slowlog.Glob("dbnameb")}}}
+	got = parseSlowLog(t, "slow023.log", opt)
+	expect = filter(func(e slowlog.Event) bool { return e.User == "backup" && e.Db == "dbnameb" })
+	if len(expect) == 0 {
+		t.Fatal("no backup events with db dbnameb")
+	}
+	if diff := deep.Equal(got, expect); diff != nil {
+		t.Error(diff)
+	}
+}
+
+func TestParseSampling(t *testing.T) {
+	all := parseSlowLog(t, "slow010.log", noOptions)
+	if len(all) != 36 {
+		t.Fatalf("got %d events, expected 36", len(all))
+	}
+
+	got := parseSlowLog(t, "slow010.log", slowlog.Options{EveryNth: 10})
+	expect := []slowlog.Event{all[0], all[10], all[20], all[30]}
+	for i := range expect {
+		expect[i].RateType = "sample"
+		expect[i].RateLimit = 10
+	}
+	if diff := deep.Equal(got, expect); diff != nil {
+		t.Error(diff)
+	}
+
+	// Each kept event represents 1/SampleRate events.
+	got = parseSlowLog(t, "slow010.log", slowlog.Options{SampleRate: 0.5, EveryNth: 2})
+	if len(got) == 0 || len(got) == 18 {
+		t.Errorf("got %d events, expected some of 18", len(got))
+	}
+	for _, e := range got {
+		if e.RateType != "sample" || e.RateLimit != 4 {
+			t.Errorf("got RateType %q RateLimit %d, expected sample 4", e.RateType, e.RateLimit)
+		}
+	}
+}
+
+func TestParseSamplingUseDb(t *testing.T) {
+	// Events are sampled after matching the Db from a use statement, so
+	// every other db1 event is kept, not every db1 event of every other event.
+	opt := slowlog.Options{
+		EveryNth: 2,
+		Include:  []slowlog.EventMatch{{Db: regexp.MustCompile(`^db1$`)}},
+	}
+	got := []string{}
+	for _, e := range parseSlowLog(t, "slow044.log", opt) {
+		got = append(got, e.Query)
+	}
+	if diff := deep.Equal(got, []string{"SELECT 1", "SELECT 5"}); diff != nil {
+		t.Error(diff)
+	}
+}
+
+func TestParseEndOffsetResume(t *testing.T) {
+	parse := func(opt slowlog.Options) []slowlog.Event {
+		file, err := os.Open(path.Join("test", "slow-logs", "slow002.log"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer file.Close()
+		p := slowlog.NewFileParser(file)
+		if err := p.Start(opt); err != nil {
+			t.Fatal(err)
+		}
+		defer p.Stop()
+		got := []slowlog.Event{}
+		for e := range p.Events() {
+			got = append(got, e)
+		}
+		return got
+	}
+	all := parse(noOptions)
+	if len(all) < 2 {
+		t.Fatalf("got %d events, expected at least 2", len(all))
+	}
+	if size := uint64(3841); all[len(all)-1].EndOffset != size {
+		t.Errorf("got last EndOffset %d, expected file size %d", all[len(all)-1].EndOffset, size)
+	}
+
+	// Resuming at the EndOffset of each event parses the events after it.
+	for i, e := range all {
+		got := parse(slowlog.Options{StartOffset: e.EndOffset})
+		if diff := deep.Equal(got, all[i+1:]); diff != nil {
+			t.Errorf("resume after event %d at %d: %v", i, e.EndOffset, diff)
+		}
+	}
+}
+
+// slow042 has a long Query_time and metrics logged in milliseconds.
+func TestParseSlow042TimeUnits(t *testing.T) {
+	got := parseSlowLog(t, "slow042.log", noOptions)
+	if len(got) != 1 {
+		t.Fatalf("got %d events, expected 1", len(got))
+	}
+	expect := map[string]float64{
+		"Query_time": 12345.678901, // not rounded to 32-bit precision
+		"Lock_time":  0.000001,
+		"Queue_time": 1500,
+	}
+	if diff := deep.Equal(got[0].TimeMetrics, expect); diff != nil {
+		t.Error(diff)
+	}
+	if got[0].NumberMetrics["Exec_ms"] != 250 {
+		t.Errorf("got Exec_ms %d, expected number metric 250", got[0].NumberMetrics["Exec_ms"])
+	}
+
+	opt := slowlog.Options{
+		TimeUnits: slowlog.TimeUnits{
+			"Queue_time": time.Millisecond,
+			"Exec_ms":    time.Millisecond,
+		},
+	}
+	got = parseSlowLog(t, "slow042.log", opt)
+	expect = map[string]float64{
+		"Query_time": 12345.678901,
+		"Lock_time":  0.000001,
+		"Queue_time": 1.5,
+		"Exec_ms":    0.25,
+	}
+	if diff := deep.Equal(got[0].TimeMetrics, expect); diff != nil {
+		t.Error(diff)
+	}
+	if _, ok := got[0].NumberMetrics["Exec_ms"]; ok {
+		t.Error("Exec_ms is a number metric, expected time metric")
+	}
+}
+
+func TestParseMaxQueryBytes(t *testing.T) {
+	all := parseSlowLog(t, "slow015.log", noOptions)
+	if len(all) != 2 {
+		t.Fatalf("got %d events, expected 2", len(all))
+	}
+
+	// A small buffer and max truncate the 81,600 byte line of the first query
+	// without reading it into memory. Offsets are not changed.
+	opt := slowlog.Options{
+		BufferSize:    16,
+		MaxQueryBytes: 100,
+	}
+	got := parseSlowLog(t, "slow015.log", opt)
+	expect := all
+	expect[0].Query = all[0].Query[:100]
+	expect[0].Truncated = true
+	if diff := deep.Equal(got, expect); diff != nil {
+		t.Error(diff)
+	}
+	if !strings.HasPrefix(got[0].Query, "INSERT INTO table VALUES\n(1,1,1") {
+		t.Errorf("got query %q", got[0].Query)
+	}
+}
+
+// slow043 has an event without Query_time, which is dropped.
+func TestParseSlow043Dropped(t *testing.T) {
+	file, err := os.Open(path.Join("test", "slow-logs", "slow043.log"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	p := slowlog.NewFileParser(file)
+	if err := p.Start(noOptions); err != nil {
+		t.Fatal(err)
+	}
+	got := []string{}
+	for e := range p.Events() {
+		got = append(got, e.Query)
+	}
+	if err := p.Error(); err != nil {
+		t.Error(err)
+	}
+	if diff := deep.Equal(got, []string{"SELECT 2"}); diff != nil {
+		t.Error(diff)
+	}
+	if n := p.Stats().Dropped; n != 1 {
+		t.Errorf("got %d Dropped, expected 1", n)
+	}
+}
+
+// slow045 has InnoDB metrics capitalized Innodb_, which are known metrics.
+func TestParseSlow045Innodb(t *testing.T) {
+	file, err := os.Open(path.Join("test", "slow-logs", "slow045.log"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	p := slowlog.NewFileParser(file)
+	if err := p.Start(noOptions); err != nil {
+		t.Fatal(err)
+	}
+	got := []slowlog.Event{}
+	for e := range p.Events() {
+		got = append(got, e)
+	}
+	if len(got) != 1 {
+		t.Fatalf("got %d events, expected 1", len(got))
+	}
+	if s := p.Stats(); len(s.UnknownMetrics) > 0 {
+		t.Errorf("unknown metrics: %+v", s.UnknownMetrics)
+	}
+	expectTime := map[string]float64{
+		"Query_time":           1,
+		"Lock_time":            0.000001,
+		"Innodb_IO_r_wait":     0.000250,
+		"Innodb_rec_lock_wait": 0,
+		"Innodb_queue_wait":    0,
+	}
+	if diff := deep.Equal(got[0].TimeMetrics, expectTime); diff != nil {
+		t.Error(diff)
+	}
+	expectNumber := map[string]uint64{
+		"Rows_sent":             1,
+		"Rows_examined":         1,
+		"Innodb_IO_r_ops":       3,
+		"Innodb_IO_r_bytes":     49152,
+		"Innodb_pages_distinct": 5,
+	}
+	if diff := deep.Equal(got[0].NumberMetrics, expectNumber); diff != nil {
+		t.Error(diff)
+	}
+	if diff := deep.Equal(got[0].Extra, map[string]string{"Innodb_trx_id": "1A2B"}); diff != nil {
+		t.Error(diff)
+	}
+}
+
+func TestParserErrors(t *testing.T) {
+	parse := func(name string, opt slowlog.Options) []*slowlog.ParseError {
+		file, err := os.Open(path.Join("test", "slow-logs", name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer file.Close()
+		p := slowlog.NewFileParser(file)
+		if err := p.Start(opt); err != nil {
+			t.Fatal(err)
+		}
+		for range p.Events() {
+		}
+		if err := p.Error(); err != nil {
+			t.Error(err)
+		}
+		errs := []*slowlog.ParseError{}
+		for err := range p.Errors() {
+			errs = append(errs, err)
+		}
+		return errs
+	}
+
+	// Event errors are at the first line of the event.
+	got := parse("slow028.log", slowlog.Options{MaxHeaderLines: 5})
+	expect := []*slowlog.ParseError{
+		{Offset: 149, Line: 5, Err: slowlog.ErrRunawayHeader},
+	}
+	if diff := deep.Equal(got, expect); diff != nil {
+		t.Error(diff)
+	}
+	got = parse("slow043.log", noOptions)
+	expect = []*slowlog.ParseError{
+		{Offset: 0, Line: 1, Err: slowlog.ErrNoQueryTime},
+	}
+	if diff := deep.Equal(got, expect); diff != nil {
+		t.Error(diff)
+	}
+	if s := got[0].Error(); s != "line 1 at offset 0: no Query_time" {
+		t.Errorf("got %q", s)
+	}
+	// Line errors have the line.
+	got = parse("slow033.log", slowlog.Options{QuoteAware: true, MaxQuotedLines: 2})
+	if len(got) != 1 || got[0].Err != slowlog.ErrUnclosedQuote || got[0].Text == "" {
+		t.Errorf("got %+v, expected 1 ErrUnclosedQuote", got)
+	}
+}
+
+type testLogger struct {
+	lines []string
+}
+
+func (l *testLogger) Printf(format string, v ...interface{}) {
+	l.lines = append(l.lines, fmt.Sprintf(format, v...))
+}
+
+func TestParserLogger(t *testing.T) {
+	// Anomalies, like the runaway header and its unknown metrics, are logged
+	// by default.
+	l := &testLogger{}
+	parseSlowLog(t, "slow028.log", slowlog.Options{MaxHeaderLines: 5, Logger: l})
+	expect := []string{
+		"unknown metric: Garbage_1",
+		"unknown metric: Garbage_2",
+		"unknown metric: Garbage_3",
+		"unknown metric: Garbage_4",
+		"unknown metric: Garbage_5",
+		"runaway header at 150",
+	}
+	if diff := deep.Equal(l.lines, expect); diff != nil {
+		t.Error(diff)
+	}
+
+	// LOG_DEBUG logs every line, too.
+	l = &testLogger{}
+	parseSlowLog(t, "slow001.log", slowlog.Options{Logger: l, LogLevel: slowlog.LOG_DEBUG})
+	if len(l.lines) < 10 || !strings.HasSuffix(l.lines[0], "slow001.log") || !strings.HasPrefix(l.lines[1], "+0 line: /usr/sbin/mysqld") {
+		t.Errorf("got %q", l.lines)
+	}
+
+	// Extra fields and stopping are logged to the Logger, not the log package.
+	l = &testLogger{}
+	p := slowlog.NewParser(strings.NewReader("# Query_time: 1  Plan: full\nselect 1;\n# Query_time: 2\nselect 2;\n"))
+	if err := p.Start(slowlog.Options{Logger: l, LogLevel: slowlog.LOG_DEBUG}); err != nil {
+		t.Fatal(err)
+	}
+	<-p.Events()
+	p.Stop()
+	for range p.Events() {
+	}
+	got := []string{}
+	for _, line := range l.lines {
+		if strings.HasPrefix(line, "extra ") || line == "stopped" {
+			got = append(got, line)
+		}
+	}
+	expect = []string{
+		`extra Plan: strconv.ParseUint: parsing "full": invalid syntax`,
+		"stopped",
+	}
+	if diff := deep.Equal(got, expect); diff != nil {
+		t.Error(diff)
+	}
+}
+
+func TestParserStopUpdateOptions(t *testing.T) {
+	// Stop while the parser changes its Logger is not a race (go test -race).
+	data, err := ioutil.ReadFile(path.Join("test", "slow-logs", "slow001.log"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 10; i++ {
+		p := slowlog.NewParser(bytes.NewReader(data))
+		if err := p.Start(noOptions); err != nil {
+			t.Fatal(err)
+		}
+		p.UpdateOptions(slowlog.Options{Logger: &testLogger{}, LogLevel: slowlog.LOG_DEBUG})
+		<-p.Events() // options are updated after sending it
+		p.Stop()
+		for range p.Events() {
+		}
+	}
+}
+
+func TestParsePooledEvents(t *testing.T) {
+	expect := parseSlowLog(t, "slow002.log", noOptions)
+
+	file, err := os.Open(path.Join("test", "slow-logs", "slow002.log"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	p := slowlog.NewFileParser(file)
+	if err := p.Start(slowlog.Options{PoolEvents: true}); err != nil {
+		t.Fatal(err)
+	}
+	got := []slowlog.Event{}
+	for e := range p.PooledEvents() {
+		if len(got) == len(expect) {
+			t.Fatalf("got more than %d events", len(expect))
+		}
+		e.Source = ""
+		e.EndOffset = 0
+		if diff := deep.Equal(*e, expect[len(got)]); diff != nil {
+			t.Errorf("event %d: %s", len(got), diff)
+		}
+		got = append(got, slowlog.Event{Offset: e.Offset})
+		e.Release()
+	}
+	if len(got) != len(expect) {
+		t.Errorf("got %d events, expected %d", len(got), len(expect))
+	}
+	if _, ok := <-p.Events(); ok {
+		t.Error("got event on Events, expected it closed")
+	}
+}
+
+func TestParseMmap(t *testing.T) {
+	files, err := filepath.Glob(path.Join("test", "slow-logs", "*.log"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, file := range files {
+		name := filepath.Base(file)
+		expect := parseSlowLog(t, name, noOptions)
+		got := parseSlowLog(t, name, slowlog.Options{Mmap: true})
+		if diff := deep.Equal(got, expect); diff != nil {
+			t.Errorf("%s: %v", name, diff)
+		}
+	}
+
+	// Truncated lines are the same as with buffered reads.
+	opt := slowlog.Options{MaxQueryBytes: 100}
+	expect := parseSlowLog(t, "slow015.log", opt)
+	opt.Mmap = true
+	got := parseSlowLog(t, "slow015.log", opt)
+	if diff := deep.Equal(got, expect); diff != nil {
+		t.Error(diff)
+	}
+
+	// Restart at the offset of each event, which is mapped again.
+	file, err := os.Open(path.Join("test", "slow-logs", "slow001.log"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	p := slowlog.NewFileParser(file)
+	all := parseSlowLog(t, "slow001.log", noOptions)
+	for i := len(all) - 1; i >= 0; i-- {
+		if err := p.Start(slowlog.Options{Mmap: true, StartOffset: all[i].Offset}); err != nil {
+			t.Fatal(err)
+		}
+		n := 0
+		for e := range p.Events() {
+			if e.Query != all[i+n].Query {
+				t.Errorf("offset %d: got query %q, expected %q", all[i].Offset, e.Query, all[i+n].Query)
+			}
+			n++
+		}
+		if n != len(all)-i {
+			t.Errorf("offset %d: got %d events, expected %d", all[i].Offset, n, len(all)-i)
+		}
+	}
+}
+
+func TestParseProgress(t *testing.T) {
+	fi, err := os.Stat(path.Join("test", "slow-logs", "slow001.log"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	size := uint64(fi.Size())
+
+	// A short interval reports every line, then the end once more.
+	var got [][2]uint64
+	opt := slowlog.Options{
+		Progress: func(bytesRead, totalBytes uint64) {
+			got = append(got, [2]uint64{bytesRead, totalBytes})
+		},
+		ProgressInterval: time.Nanosecond,
+	}
+	parseSlowLog(t, "slow001.log", opt)
+	if len(got) < 3 {
+		t.Fatalf("got %d calls, expected one per line", len(got))
+	}
+	for i, g := range got {
+		if g[1] != size {
+			t.Errorf("call %d: got totalBytes %d, expected %d", i, g[1], size)
+		}
+		if i > 0 && g[0] < got[i-1][0] {
+			t.Errorf("call %d: bytesRead %d less than %d", i, g[0], got[i-1][0])
+		}
+	}
+	if last := got[len(got)-1]; last[0] != size {
+		t.Errorf("got last bytesRead %d, expected %d", last[0], size)
+	}
+
+	// The default interval reports the first line and the end, unless parsing
+	// takes seconds.
+	perLine := len(got)
+	got = nil
+	opt.ProgressInterval = 0
+	parseSlowLog(t, "slow001.log", opt)
+	if len(got) < 2 || len(got) >= perLine || got[len(got)-1][0] != size {
+		t.Errorf("got calls %v, expected fewer than %d ending at %d", got, perLine, size)
+	}
+}
+
+// BenchmarkParse parses every slow log fixture, read from memory.
+func BenchmarkParse(b *testing.B) {
+	files, err := filepath.Glob(path.Join("test", "slow-logs", "*.log"))
+	if err != nil {
+		b.Fatal(err)
+	}
+	data := []byte{}
+	for _, file := range files {
+		buf, err := ioutil.ReadFile(file)
+		if err != nil {
+			b.Fatal(err)
+		}
+		data = append(data, buf...)
+	}
+	b.SetBytes(int64(len(data)))
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		p := slowlog.NewParser(strings.NewReader(string(data)))
+		if err := p.Start(noOptions); err != nil {
+			b.Fatal(err)
+		}
+		for range p.Events() {
+		}
+	}
+}
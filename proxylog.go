@@ -0,0 +1,276 @@
+/*
+	Copyright 2017 Daniel Nichter
+	Copyright 2014-2016 Percona LLC and/or its affiliates
+*/
+
+package slowlog
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"strings"
+	"sync"
+	"time"
+)
+
+// A LineParser parses a log with one JSON event per line, like the query logs
+// of ProxySQL and Vitess, into Events so they can be aggregated like slow log
+// events. Of the Options, only StartOffset, Source, and Location are used.
+// The parser cannot be restarted.
+type LineParser struct {
+	reader     *bufio.Reader
+	decode     func(line []byte, opt Options) (*Event, error)
+	keepSource bool // keep Event.Source if Options.Source is empty
+	// --
+	opt       Options
+	stopChan  chan struct{}
+	eventChan chan Event
+	doneChan  chan struct{}
+	err       error
+	started   bool
+	*sync.Mutex
+}
+
+// NewProxySQLParser returns a LineParser for the ProxySQL JSON events log
+// (mysql-eventslog_format=2). Only COM_QUERY and COM_STMT_EXECUTE events
+// are sent. Event.Host is the client host, and duration_us is Query_time.
+func NewProxySQLParser(r io.Reader) *LineParser {
+	return newLineParser(r, decodeProxySQL)
+}
+
+// NewVitessParser returns a LineParser for the vtgate or vttablet JSON query
+// log (-querylog-format json). Event.Db is the keyspace, and TotalTime is
+// Query_time. Start is parsed in Options.Location.
+func NewVitessParser(r io.Reader) *LineParser {
+	return newLineParser(r, decodeVitess)
+}
+
+// NewJSONParser returns a LineParser for events encoded as JSON, one per
+// line, like the output of json.Encoder for each Event. It reads events that
+// were already parsed and shipped, like by Filebeat or Vector, so they can be
+// aggregated. Event.Offset is the offset of the line, so it can be used as
+// Options.StartOffset to resume. Event.Source is Options.Source if set, else
+// the Source in the JSON.
+func NewJSONParser(r io.Reader) *LineParser {
+	p := newLineParser(r, decodeEvent)
+	p.keepSource = true
+	return p
+}
+
+func newLineParser(r io.Reader, decode func([]byte, Options) (*Event, error)) *LineParser {
+	return &LineParser{
+		reader:    bufio.NewReader(r),
+		decode:    decode,
+		stopChan:  make(chan struct{}),
+		eventChan: make(chan Event),
+		doneChan:  make(chan struct{}),
+		Mutex:     &sync.Mutex{},
+	}
+}
+
+// Start starts the parser. Events are sent to the unbuffered Events channel.
+// Parsing stops on EOF, error, or call to Stop. The Events channel is closed
+// when parsing stops.
+func (p *LineParser) Start(opt Options) error {
+	p.Lock()
+	defer p.Unlock()
+	if p.started {
+		return ErrStarted
+	}
+	if opt.Location == nil {
+		opt.Location = time.UTC
+	}
+	p.opt = opt
+	if opt.StartOffset > 0 {
+		if _, err := io.CopyN(ioutil.Discard, p.reader, int64(opt.StartOffset)); err != nil {
+			return err
+		}
+	}
+	go p.parse()
+	p.started = true
+	return nil
+}
+
+// StartContext starts the parser like Start and stops it like Stop when the
+// context is canceled or its deadline is exceeded.
+func (p *LineParser) StartContext(ctx context.Context, opt Options) error {
+	if err := p.Start(opt); err != nil {
+		return err
+	}
+	go func() {
+		select {
+		case <-ctx.Done():
+			p.Stop()
+		case <-p.doneChan:
+		}
+	}()
+	return nil
+}
+
+// Stop stops the parser before parsing the next event or while blocked on
+// sending the current event to the event channel.
+func (p *LineParser) Stop() {
+	select {
+	case <-p.stopChan:
+	default:
+		close(p.stopChan)
+	}
+}
+
+// Events returns the channel to which events are sent.
+func (p *LineParser) Events() <-chan Event {
+	return p.eventChan
+}
+
+// Error returns an error, if any, encountered while parsing.
+func (p *LineParser) Error() error {
+	return p.err
+}
+
+func (p *LineParser) parse() {
+	defer close(p.doneChan)
+	defer close(p.eventChan)
+	offset := p.opt.StartOffset
+	for n := 1; ; n++ {
+		select {
+		case <-p.stopChan:
+			return
+		default:
+		}
+
+		line, err := p.reader.ReadBytes('\n')
+		if err != nil && err != io.EOF {
+			p.err = fmt.Errorf("bufio.NewReader.ReadBytes: %s", err)
+			return
+		}
+		lineOffset := offset
+		offset += uint64(len(line))
+		if len(strings.TrimSpace(string(line))) > 0 {
+			e, decodeErr := p.decode(line, p.opt)
+			if decodeErr != nil {
+				p.err = fmt.Errorf("line %d: %s", n, decodeErr)
+				return
+			}
+			if e != nil {
+				e.Offset = lineOffset
+				e.EndOffset = offset
+				if !p.keepSource || p.opt.Source != "" {
+					e.Source = p.opt.Source
+				}
+				select {
+				case p.eventChan <- *e:
+				case <-p.stopChan:
+					return
+				}
+			}
+		}
+		if err == io.EOF {
+			return
+		}
+	}
+}
+
+func decodeEvent(line []byte, opt Options) (*Event, error) {
+	e := NewEvent()
+	if err := json.Unmarshal(line, e); err != nil {
+		return nil, err
+	}
+	if e.TimeMetrics == nil {
+		e.TimeMetrics = map[string]float64{}
+	}
+	if e.NumberMetrics == nil {
+		e.NumberMetrics = map[string]uint64{}
+	}
+	if e.BoolMetrics == nil {
+		e.BoolMetrics = map[string]bool{}
+	}
+	return e, nil
+}
+
+// proxySQLEvent is a line of the ProxySQL JSON events log.
+type proxySQLEvent struct {
+	Event        string `json:"event"`
+	Query        string `json:"query"`
+	Username     string `json:"username"`
+	Schemaname   string `json:"schemaname"`
+	Client       string `json:"client"`
+	ThreadId     uint64 `json:"thread_id"`
+	StartTime    string `json:"starttime"`
+	StartUs      int64  `json:"starttime_timestamp_us"`
+	DurationUs   uint64 `json:"duration_us"`
+	RowsSent     uint64 `json:"rows_sent"`
+	RowsAffected uint64 `json:"rows_affected"`
+}
+
+func decodeProxySQL(line []byte, opt Options) (*Event, error) {
+	var pe proxySQLEvent
+	if err := json.Unmarshal(line, &pe); err != nil {
+		return nil, err
+	}
+	if pe.Event != "COM_QUERY" && pe.Event != "COM_STMT_EXECUTE" {
+		return nil, nil
+	}
+	e := NewEvent()
+	e.Ts = pe.StartTime
+	if pe.StartUs > 0 {
+		e.Time = time.Unix(0, pe.StartUs*1000).In(opt.Location)
+	}
+	e.Query = pe.Query
+	e.User = pe.Username
+	e.Host = clientHost(pe.Client)
+	e.Db = pe.Schemaname
+	e.TimeMetrics["Query_time"] = float64(pe.DurationUs) / 1e6
+	e.NumberMetrics["Rows_sent"] = pe.RowsSent
+	e.NumberMetrics["Rows_affected"] = pe.RowsAffected
+	e.NumberMetrics["Thread_id"] = pe.ThreadId
+	e.ThreadId = pe.ThreadId
+	return e, nil
+}
+
+// vitessEvent is a line of the Vitess JSON query log.
+type vitessEvent struct {
+	SQL          string
+	Username     string
+	RemoteAddr   string
+	Keyspace     string
+	Start        string
+	TotalTime    float64
+	RowsAffected uint64
+	RowsReturned uint64
+}
+
+func decodeVitess(line []byte, opt Options) (*Event, error) {
+	var ve vitessEvent
+	if err := json.Unmarshal(line, &ve); err != nil {
+		return nil, err
+	}
+	if ve.SQL == "" {
+		return nil, nil
+	}
+	e := NewEvent()
+	e.Ts = ve.Start
+	if t, err := time.ParseInLocation("2006-01-02 15:04:05.000000", ve.Start, opt.Location); err == nil {
+		e.Time = t
+	}
+	e.Query = ve.SQL
+	e.User = ve.Username
+	e.Host = clientHost(ve.RemoteAddr)
+	e.Db = ve.Keyspace
+	e.TimeMetrics["Query_time"] = ve.TotalTime
+	e.NumberMetrics["Rows_sent"] = ve.RowsReturned
+	e.NumberMetrics["Rows_affected"] = ve.RowsAffected
+	return e, nil
+}
+
+// clientHost returns the host of a "host:port" address.
+func clientHost(addr string) string {
+	if host, _, err := net.SplitHostPort(addr); err == nil {
+		return host
+	}
+	return addr
+}
@@ -0,0 +1,201 @@
+/*
+	Copyright 2017 Daniel Nichter
+	Copyright 2014-2016 Percona LLC and/or its affiliates
+*/
+
+package slowlog_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-mysql/slowlog"
+	"github.com/go-test/deep"
+)
+
+func parseLineLog(t *testing.T, p *slowlog.LineParser, opt slowlog.Options) []slowlog.Event {
+	if err := p.Start(opt); err != nil {
+		t.Fatal(err)
+	}
+	got := []slowlog.Event{}
+	for e := range p.Events() {
+		got = append(got, e)
+	}
+	if err := p.Error(); err != nil {
+		t.Error(err)
+	}
+	return got
+}
+
+func TestProxySQLParser(t *testing.T) {
+	file, err := os.Open(path.Join("test", "proxy-logs", "proxysql.log"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	got := parseLineLog(t, slowlog.NewProxySQLParser(file), slowlog.Options{Source: "proxysql1"})
+	expect := []slowlog.Event{
+		{
+			Offset:    0,
+			EndOffset: 419,
+			Source:    "proxysql1",
+			Ts:        "2019-07-14 18:04:28.595961",
+			Time:      time.Date(2019, 7, 14, 18, 4, 28, 595961000, time.UTC),
+			Query:     "select @@version_comment limit 1",
+			User:      "sbtest",
+			Host:      "127.0.0.1",
+			Db:        "information_schema",
+			TimeMetrics: map[string]float64{
+				"Query_time": 0.000015,
+			},
+			ThreadId: 3,
+			NumberMetrics: map[string]uint64{
+				"Rows_sent":     1,
+				"Rows_affected": 0,
+				"Thread_id":     3,
+			},
+			BoolMetrics: map[string]bool{},
+		},
+		{
+			Offset:    865,
+			EndOffset: 1311,
+			Source:    "proxysql1",
+			Ts:        "2019-07-14 18:04:28.600000",
+			Time:      time.Date(2019, 7, 14, 18, 4, 28, 600000000, time.UTC),
+			Query:     "UPDATE sbtest1 SET k=k+1 WHERE id=?",
+			User:      "sbtest",
+			Host:      "10.0.0.5",
+			Db:        "sbtest",
+			TimeMetrics: map[string]float64{
+				"Query_time": 2.5,
+			},
+			ThreadId: 4,
+			NumberMetrics: map[string]uint64{
+				"Rows_sent":     0,
+				"Rows_affected": 1,
+				"Thread_id":     4,
+			},
+			BoolMetrics: map[string]bool{},
+		},
+	}
+	if diff := deep.Equal(got, expect); diff != nil {
+		t.Error(diff)
+	}
+}
+
+func TestVitessParser(t *testing.T) {
+	file, err := os.Open(path.Join("test", "proxy-logs", "vitess.log"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	loc := time.FixedZone("UTC-7", -7*3600)
+	got := parseLineLog(t, slowlog.NewVitessParser(file), slowlog.Options{Location: loc})
+	expect := []slowlog.Event{
+		{
+			Offset:    0,
+			EndOffset: 558,
+			Ts:        "2019-07-14 18:04:28.123456",
+			Time:      time.Date(2019, 7, 14, 18, 4, 28, 123456000, loc),
+			Query:     "select * from customer where id = :vtg1",
+			User:      "app",
+			Host:      "10.0.0.7",
+			Db:        "commerce",
+			TimeMetrics: map[string]float64{
+				"Query_time": 0.5,
+			},
+			NumberMetrics: map[string]uint64{
+				"Rows_sent":     1,
+				"Rows_affected": 0,
+			},
+			BoolMetrics: map[string]bool{},
+		},
+		{
+			Offset:    559,
+			EndOffset: 1091,
+			Ts:        "2019-07-14 18:04:29.000000",
+			Time:      time.Date(2019, 7, 14, 18, 4, 29, 0, loc),
+			Query:     "update customer set email = :vtg1 where id = :vtg2",
+			User:      "app",
+			Host:      "10.0.0.8",
+			Db:        "commerce",
+			TimeMetrics: map[string]float64{
+				"Query_time": 0.25,
+			},
+			NumberMetrics: map[string]uint64{
+				"Rows_sent":     0,
+				"Rows_affected": 1,
+			},
+			BoolMetrics: map[string]bool{},
+		},
+	}
+	if diff := deep.Equal(got, expect); diff != nil {
+		t.Error(diff)
+	}
+
+	// Resume at second event, after the blank line.
+	file.Seek(0, os.SEEK_SET)
+	got = parseLineLog(t, slowlog.NewVitessParser(file), slowlog.Options{StartOffset: 559, Location: loc})
+	if len(got) != 1 || got[0].Offset != 559 {
+		t.Errorf("got %d events from offset 559, expected 1: %+v", len(got), got)
+	}
+}
+
+func TestJSONParser(t *testing.T) {
+	events := parseSlowLog(t, "slow001.log", noOptions)
+	var buf bytes.Buffer
+	offsets := []uint64{}
+	for _, e := range events {
+		e.Source = "db1"
+		offsets = append(offsets, uint64(buf.Len()))
+		if err := json.NewEncoder(&buf).Encode(e); err != nil {
+			t.Fatal(err)
+		}
+	}
+	data := buf.Bytes()
+
+	got := parseLineLog(t, slowlog.NewJSONParser(bytes.NewReader(data)), noOptions)
+	expect := []slowlog.Event{}
+	for i, e := range events {
+		e.Offset = offsets[i]
+		e.EndOffset = uint64(len(data))
+		if i+1 < len(offsets) {
+			e.EndOffset = offsets[i+1]
+		}
+		e.Source = "db1"
+		expect = append(expect, e)
+	}
+	if diff := deep.Equal(got, expect); diff != nil {
+		t.Error(diff)
+	}
+
+	// Resume at the second event with Options.Source.
+	got = parseLineLog(t, slowlog.NewJSONParser(bytes.NewReader(data)), slowlog.Options{StartOffset: offsets[1], Source: "db2"})
+	expect = expect[1:]
+	expect[0].Source = "db2"
+	if diff := deep.Equal(got, expect); diff != nil {
+		t.Error(diff)
+	}
+}
+
+func TestLineParserError(t *testing.T) {
+	p := slowlog.NewVitessParser(strings.NewReader("{\"SQL\": \"select 1\"}\nnot json\n"))
+	if err := p.Start(slowlog.Options{}); err != nil {
+		t.Fatal(err)
+	}
+	n := 0
+	for range p.Events() {
+		n++
+	}
+	if n != 1 {
+		t.Errorf("got %d events, expected 1", n)
+	}
+	if err := p.Error(); err == nil || !strings.HasPrefix(err.Error(), "line 2:") {
+		t.Errorf("got error %v, expected line 2 error", err)
+	}
+}
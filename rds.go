@@ -0,0 +1,210 @@
+/*
+	Copyright 2017 Daniel Nichter
+	Copyright 2014-2016 Percona LLC and/or its affiliates
+*/
+
+package slowlog
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+)
+
+// RDS_SLOW_LOG is the slow log file of an Amazon RDS or Aurora MySQL instance.
+const RDS_SLOW_LOG = "slowquery/mysql-slowquery.log"
+
+// An RDSLogPortion is a portion of an RDS log file, like the output of the
+// DownloadDBLogFilePortion API.
+type RDSLogPortion struct {
+	Data    string // LogFileData
+	Marker  string // for the next portion
+	Pending bool   // AdditionalDataPending
+}
+
+// RDSClient calls the RDS API, like the rds.RDS client of the AWS SDK. It is
+// an interface so this package does not depend on the SDK:
+//
+//	func (c client) LogFiles(instance, prefix string) ([]string, error) {
+//	    files := []string{}
+//	    err := c.rds.DescribeDBLogFilesPages(&rds.DescribeDBLogFilesInput{
+//	        DBInstanceIdentifier: aws.String(instance),
+//	        FilenameContains:     aws.String(prefix),
+//	    }, func(out *rds.DescribeDBLogFilesOutput, last bool) bool {
+//	        for _, f := range out.DescribeDBLogFiles {
+//	            files = append(files, aws.StringValue(f.LogFileName))
+//	        }
+//	        return true
+//	    })
+//	    return files, err
+//	}
+//
+//	func (c client) DownloadLogPortion(instance, file, marker string) (slowlog.RDSLogPortion, error) {
+//	    out, err := c.rds.DownloadDBLogFilePortion(&rds.DownloadDBLogFilePortionInput{
+//	        DBInstanceIdentifier: aws.String(instance),
+//	        LogFileName:          aws.String(file),
+//	        Marker:               aws.String(marker),
+//	    })
+//	    if err != nil {
+//	        return slowlog.RDSLogPortion{}, err
+//	    }
+//	    return slowlog.RDSLogPortion{
+//	        Data:    aws.StringValue(out.LogFileData),
+//	        Marker:  aws.StringValue(out.Marker),
+//	        Pending: aws.BoolValue(out.AdditionalDataPending),
+//	    }, nil
+//	}
+type RDSClient interface {
+	// LogFiles returns the names of the log files of the instance that
+	// contain prefix, like DescribeDBLogFiles with FilenameContains.
+	LogFiles(instance, prefix string) ([]string, error)
+
+	// DownloadLogPortion returns the portion of the log file after marker,
+	// like DownloadDBLogFilePortion. Marker "0" is the start of the file.
+	DownloadLogPortion(instance, file, marker string) (RDSLogPortion, error)
+}
+
+// RDSReader is an io.Reader that downloads an RDS log file, like RDS_SLOW_LOG,
+// in portions. Use it with NewParser to parse the slow log of an RDS or Aurora
+// instance, which cannot be read from disk. It returns io.EOF when it has read
+// all data, so with Options.Follow, the parser reads it again every
+// Options.FollowInterval, which downloads the new data, if any.
+//
+// RDS rotates the log file every hour: its data is moved to a file named like
+// mysql-slowquery.log.2019-01-01.05 and the file is emptied. When the reader
+// has read all data, it checks for new rotated files, and reads the data of
+// the first one that it has not read, then reads the file again from the
+// start. Data written and rotated during more than one check is read from
+// every new rotated file in name order.
+type RDSReader struct {
+	c        RDSClient
+	instance string
+	file     string
+	// --
+	listed  bool
+	rotated map[string]bool // rotated files seen
+	queue   []rdsFile       // new rotated files to read before file
+	marker  string
+	read    int // bytes read from file since rotation
+	buf     string
+}
+
+type rdsFile struct {
+	name   string
+	marker string
+	skip   int // bytes already read from file before it was rotated
+}
+
+// NewRDSReader returns a new RDSReader for the log file of the instance, which
+// starts reading at the start of the file.
+func NewRDSReader(c RDSClient, instance, file string) *RDSReader {
+	return &RDSReader{
+		c:        c,
+		instance: instance,
+		file:     file,
+		// --
+		rotated: map[string]bool{},
+		marker:  "0",
+	}
+}
+
+// Read reads downloaded data, downloading the next portion if needed. It
+// returns io.EOF if there is no data to download, and errors from the
+// RDSClient with the file name.
+func (r *RDSReader) Read(b []byte) (int, error) {
+	for len(r.buf) == 0 {
+		if err := r.next(); err != nil {
+			return 0, err
+		}
+	}
+	n := copy(b, r.buf)
+	r.buf = r.buf[n:]
+	return n, nil
+}
+
+// next downloads the next portion into buf, which can be empty. It returns
+// io.EOF if there is no data to download.
+func (r *RDSReader) next() error {
+	if !r.listed {
+		// Files rotated before the reader started are not read.
+		if _, err := r.rotations(); err != nil {
+			return err
+		}
+		r.listed = true
+	}
+
+	if len(r.queue) > 0 {
+		f := &r.queue[0]
+		p, err := r.c.DownloadLogPortion(r.instance, f.name, f.marker)
+		if err != nil {
+			return fmt.Errorf("%s: %s", f.name, err)
+		}
+		data := p.Data
+		if f.skip > 0 {
+			n := f.skip
+			if n > len(data) {
+				n = len(data)
+			}
+			data = data[n:]
+			f.skip -= n
+		}
+		r.buf = data
+		f.marker = p.Marker
+		if !p.Pending {
+			r.queue = r.queue[1:]
+		}
+		return nil
+	}
+
+	p, err := r.c.DownloadLogPortion(r.instance, r.file, r.marker)
+	if err != nil {
+		return fmt.Errorf("%s: %s", r.file, err)
+	}
+	if p.Marker != "" {
+		r.marker = p.Marker
+	}
+	if p.Data != "" || p.Pending {
+		r.buf = p.Data
+		r.read += len(p.Data)
+		return nil
+	}
+
+	// All data read, check if the file was rotated.
+	files, err := r.rotations()
+	if err != nil {
+		return err
+	}
+	if len(files) == 0 {
+		return io.EOF
+	}
+	for i, name := range files {
+		f := rdsFile{name: name, marker: "0"}
+		if i == 0 {
+			f.skip = r.read
+		}
+		r.queue = append(r.queue, f)
+	}
+	r.marker = "0"
+	r.read = 0
+	return nil
+}
+
+// rotations returns the rotated files not seen before, sorted by name,
+// which is by time.
+func (r *RDSReader) rotations() ([]string, error) {
+	names, err := r.c.LogFiles(r.instance, r.file)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %s", r.file, err)
+	}
+	files := []string{}
+	for _, name := range names {
+		if !strings.HasPrefix(name, r.file+".") || r.rotated[name] {
+			continue
+		}
+		r.rotated[name] = true
+		files = append(files, name)
+	}
+	sort.Strings(files)
+	return files, nil
+}
@@ -0,0 +1,110 @@
+/*
+	Copyright 2017 Daniel Nichter
+	Copyright 2014-2016 Percona LLC and/or its affiliates
+*/
+
+package slowlog_test
+
+import (
+	"io"
+	"io/ioutil"
+	"path"
+	"strconv"
+	"testing"
+
+	"github.com/go-mysql/slowlog"
+)
+
+// fakeRDS returns portions of at most size bytes with the offset as marker.
+type fakeRDS struct {
+	files map[string]string
+	size  int
+}
+
+func (c *fakeRDS) LogFiles(instance, prefix string) ([]string, error) {
+	names := []string{}
+	for name := range c.files {
+		names = append(names, name)
+	}
+	return names, nil
+}
+
+func (c *fakeRDS) DownloadLogPortion(instance, file, marker string) (slowlog.RDSLogPortion, error) {
+	data := c.files[file]
+	off, err := strconv.Atoi(marker)
+	if err != nil {
+		return slowlog.RDSLogPortion{}, err
+	}
+	if off > len(data) {
+		off = len(data)
+	}
+	end := off + c.size
+	if end > len(data) {
+		end = len(data)
+	}
+	return slowlog.RDSLogPortion{
+		Data:    data[off:end],
+		Marker:  strconv.Itoa(end),
+		Pending: end < len(data),
+	}, nil
+}
+
+func TestRDSReader(t *testing.T) {
+	log := slowlog.RDS_SLOW_LOG
+	c := &fakeRDS{
+		files: map[string]string{
+			log + ".2019-01-01.04": "old",
+			log:                    "abc",
+		},
+		size: 2,
+	}
+	r := slowlog.NewRDSReader(c, "db1", log)
+	readAll := func(expect string) {
+		t.Helper()
+		got, err := ioutil.ReadAll(r)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(got) != expect {
+			t.Errorf("got %q, expected %q", got, expect)
+		}
+	}
+	readAll("abc")
+
+	c.files[log] = "abcdef"
+	readAll("def")
+
+	// Written then rotated, twice, between reads.
+	c.files[log] = "abcdefghi"
+	c.files[log+".2019-01-01.05"] = "abcdefghijk"
+	c.files[log+".2019-01-01.06"] = "lmn"
+	c.files[log] = "opq"
+	readAll("ghijklmnopq")
+	readAll("")
+}
+
+func TestRDSReaderParse(t *testing.T) {
+	data, err := ioutil.ReadFile(path.Join("test", "slow-logs", "slow001.log"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := &fakeRDS{
+		files: map[string]string{slowlog.RDS_SLOW_LOG: string(data)},
+		size:  100,
+	}
+	var r io.Reader = slowlog.NewRDSReader(c, "db1", slowlog.RDS_SLOW_LOG)
+	p := slowlog.NewParser(r)
+	if err := p.Start(slowlog.Options{}); err != nil {
+		t.Fatal(err)
+	}
+	n := 0
+	for range p.Events() {
+		n++
+	}
+	if err := p.Error(); err != nil {
+		t.Error(err)
+	}
+	if n != 2 {
+		t.Errorf("got %d events, expected 2", n)
+	}
+}
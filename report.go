@@ -0,0 +1,98 @@
+/*
+	Copyright 2017 Daniel Nichter
+	Copyright 2014-2016 Percona LLC and/or its affiliates
+*/
+
+package slowlog
+
+import (
+	"fmt"
+	"html/template"
+	"io"
+	"sort"
+	"text/tabwriter"
+)
+
+// ReportFormat is the format of a report written by WriteReport.
+type ReportFormat int
+
+const (
+	REPORT_TEXT ReportFormat = iota // plain text table
+	REPORT_HTML                     // HTML table, like for an email
+)
+
+func (f ReportFormat) String() string {
+	switch f {
+	case REPORT_TEXT:
+		return "text"
+	case REPORT_HTML:
+		return "html"
+	}
+	return fmt.Sprintf("ReportFormat(%d)", int(f))
+}
+
+// A reportRow is one class in a report.
+type reportRow struct {
+	Rank        int
+	Id          string
+	Time        float64 // Query_time sum
+	Pct         float64 // of global Query_time sum
+	Calls       uint64
+	Avg         float64
+	P95         float64
+	Fingerprint string
+}
+
+var htmlReport = template.Must(template.New("report").Parse(`<table>
+<tr><th>Rank</th><th>Class ID</th><th>Time (s)</th><th>Pct</th><th>Calls</th><th>Avg (s)</th><th>P95 (s)</th><th>Fingerprint</th></tr>
+{{range .}}<tr><td>{{.Rank}}</td><td>{{.Id}}</td><td>{{printf "%.6f" .Time}}</td><td>{{printf "%.1f%%" .Pct}}</td><td>{{.Calls}}</td><td>{{printf "%.6f" .Avg}}</td><td>{{printf "%.6f" .P95}}</td><td><code>{{.Fingerprint}}</code></td></tr>
+{{end}}</table>
+`))
+
+// WriteReport writes a profile of the classes in the finalized Result to w,
+// like the profile of pt-query-digest: one row per class, sorted by Query_time
+// sum descending, with the percentage of the global Query_time. To report
+// only the top classes, use TopClasses first.
+func WriteReport(w io.Writer, r Result, format ReportFormat) error {
+	rows := make([]reportRow, 0, len(r.Class))
+	total := 0.0
+	if r.Global != nil {
+		total = queryTime(r.Global)
+	}
+	for _, class := range r.Class {
+		row := reportRow{
+			Id:          class.Id,
+			Time:        queryTime(class),
+			Calls:       class.TotalQueries,
+			Fingerprint: class.Fingerprint,
+		}
+		if s, ok := class.Metrics.TimeMetrics["Query_time"]; ok {
+			row.Avg = s.Avg
+			row.P95 = s.P95
+		}
+		if total > 0 {
+			row.Pct = row.Time / total * 100
+		}
+		rows = append(rows, row)
+	}
+	sort.Slice(rows, func(i, j int) bool {
+		if rows[i].Time == rows[j].Time {
+			return rows[i].Id < rows[j].Id
+		}
+		return rows[i].Time > rows[j].Time
+	})
+	for i := range rows {
+		rows[i].Rank = i + 1
+	}
+
+	if format == REPORT_HTML {
+		return htmlReport.Execute(w, rows)
+	}
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintln(tw, "Rank\tClass ID\tTime (s)\tPct\tCalls\tAvg (s)\tP95 (s)\t  Fingerprint")
+	for _, row := range rows {
+		fmt.Fprintf(tw, "%d\t%s\t%.6f\t%.1f%%\t%d\t%.6f\t%.6f\t  %s\n",
+			row.Rank, row.Id, row.Time, row.Pct, row.Calls, row.Avg, row.P95, row.Fingerprint)
+	}
+	return tw.Flush()
+}
@@ -0,0 +1,56 @@
+/*
+	Copyright 2017 Daniel Nichter
+	Copyright 2014-2016 Percona LLC and/or its affiliates
+*/
+
+package slowlog_test
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/go-mysql/slowlog"
+)
+
+func TestWriteReport(t *testing.T) {
+	a := slowlog.NewAggregator(false, 0, 0)
+	add := func(id, fingerprint string, queryTime float64) {
+		e := slowlog.NewEvent()
+		e.Query = fingerprint
+		e.TimeMetrics["Query_time"] = queryTime
+		a.AddEvent(*e, id, fingerprint)
+	}
+	add("B", "select b", 1)
+	add("A", "select a", 3)
+	add("A", "select a", 5)
+	add("C", "select <c>", 1)
+	r := a.Finalize()
+
+	var buf bytes.Buffer
+	if err := slowlog.WriteReport(&buf, r, slowlog.REPORT_TEXT); err != nil {
+		t.Fatal(err)
+	}
+	expect := `  Rank  Class ID  Time (s)    Pct  Calls   Avg (s)   P95 (s)  Fingerprint
+     1         A  8.000000  80.0%      2  4.000000  5.000000  select a
+     2         B  1.000000  10.0%      1  1.000000  1.000000  select b
+     3         C  1.000000  10.0%      1  1.000000  1.000000  select <c>
+`
+	if got := buf.String(); got != expect {
+		t.Errorf("got:\n%s\nexpected:\n%s", got, expect)
+	}
+
+	buf.Reset()
+	if err := slowlog.WriteReport(&buf, r, slowlog.REPORT_HTML); err != nil {
+		t.Fatal(err)
+	}
+	got := buf.String()
+	for _, s := range []string{
+		"<td>1</td><td>A</td><td>8.000000</td><td>80.0%</td><td>2</td>",
+		"<code>select &lt;c&gt;</code>",
+	} {
+		if !strings.Contains(got, s) {
+			t.Errorf("HTML report does not contain %s:\n%s", s, got)
+		}
+	}
+}
@@ -0,0 +1,127 @@
+/*
+	Copyright 2017 Daniel Nichter
+	Copyright 2014-2016 Percona LLC and/or its affiliates
+*/
+
+package slowlog
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+)
+
+// S3Client gets S3 objects, like the s3.S3 client of the AWS SDK. It is an
+// interface so this package does not depend on the SDK:
+//
+//	func (c client) GetObject(bucket, key string, offset int64) (io.ReadCloser, int64, error) {
+//	    out, err := c.s3.GetObject(&s3.GetObjectInput{
+//	        Bucket: aws.String(bucket),
+//	        Key:    aws.String(key),
+//	        Range:  aws.String(fmt.Sprintf("bytes=%d-", offset)),
+//	    })
+//	    if err != nil {
+//	        return nil, 0, err
+//	    }
+//	    // Content-Range: bytes 100-199/200
+//	    var start, end, size int64
+//	    fmt.Sscanf(aws.StringValue(out.ContentRange), "bytes %d-%d/%d", &start, &end, &size)
+//	    return out.Body, size, nil
+//	}
+type S3Client interface {
+	// GetObject returns the body of the object from offset to the end, like
+	// GetObject with Range "bytes=offset-", and the size of the object.
+	GetObject(bucket, key string, offset int64) (io.ReadCloser, int64, error)
+}
+
+// S3Object is an io.ReadSeeker for an S3 object, like a slow log shipped to
+// S3. Use it with NewParser to parse the object without downloading it first.
+// The parser seeks to Options.StartOffset, so a consumer that saves the
+// Event.Offset of the last event resumes in the middle of the object after a
+// crash. Seeking gets the object again from the offset. If the object is
+// compressed, like slow.log.gz with COMPRESSION_AUTO, offsets are in
+// decompressed bytes, so the parser reads the object from the start and
+// discards StartOffset bytes.
+//
+// If reading the body fails, like when the connection is reset, the body is
+// closed and the next Read gets the object again from the current offset.
+type S3Object struct {
+	c      S3Client
+	bucket string
+	key    string
+	// --
+	body   io.ReadCloser
+	offset int64
+	size   int64 // -1 until the first GetObject
+}
+
+// NewS3Object returns a new S3Object for the object key in the bucket. The
+// object is not read until the first Read.
+func NewS3Object(c S3Client, bucket, key string) *S3Object {
+	return &S3Object{
+		c:      c,
+		bucket: bucket,
+		key:    key,
+		// --
+		size: -1,
+	}
+}
+
+// Read reads the object from the current offset. Errors from the S3Client
+// include the bucket and key.
+func (o *S3Object) Read(b []byte) (int, error) {
+	if o.body == nil {
+		if o.size >= 0 && o.offset >= o.size {
+			return 0, io.EOF // S3 returns an error for a range past the end
+		}
+		body, size, err := o.c.GetObject(o.bucket, o.key, o.offset)
+		if err != nil {
+			return 0, fmt.Errorf("s3://%s/%s: %s", o.bucket, o.key, err)
+		}
+		o.body = body
+		o.size = size
+	}
+	n, err := o.body.Read(b)
+	o.offset += int64(n)
+	if err != nil && err != io.EOF {
+		o.body.Close()
+		o.body = nil
+		return n, fmt.Errorf("s3://%s/%s: %s", o.bucket, o.key, err)
+	}
+	return n, err
+}
+
+// Seek sets the offset for the next Read. Seeking relative to the end,
+// io.SeekEnd, requires the size of the object, so it returns an error until
+// the object has been read.
+func (o *S3Object) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case os.SEEK_CUR:
+		offset += o.offset
+	case os.SEEK_END:
+		if o.size < 0 {
+			return 0, errors.New("size of S3 object not known until it is read")
+		}
+		offset += o.size
+	}
+	if offset < 0 {
+		return 0, errors.New("negative offset")
+	}
+	if offset != o.offset && o.body != nil {
+		o.body.Close()
+		o.body = nil
+	}
+	o.offset = offset
+	return offset, nil
+}
+
+// Close closes the body of the object, if open.
+func (o *S3Object) Close() error {
+	if o.body == nil {
+		return nil
+	}
+	err := o.body.Close()
+	o.body = nil
+	return err
+}
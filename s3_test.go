@@ -0,0 +1,91 @@
+/*
+	Copyright 2017 Daniel Nichter
+	Copyright 2014-2016 Percona LLC and/or its affiliates
+*/
+
+package slowlog_test
+
+import (
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"io"
+	"io/ioutil"
+	"path"
+	"testing"
+
+	"github.com/go-mysql/slowlog"
+)
+
+type fakeS3 struct {
+	objects map[string][]byte
+	gets    []int64 // offsets
+}
+
+func (c *fakeS3) GetObject(bucket, key string, offset int64) (io.ReadCloser, int64, error) {
+	data, ok := c.objects[bucket+"/"+key]
+	if !ok {
+		return nil, 0, errors.New("NoSuchKey")
+	}
+	c.gets = append(c.gets, offset)
+	return ioutil.NopCloser(bytes.NewReader(data[offset:])), int64(len(data)), nil
+}
+
+func TestS3Object(t *testing.T) {
+	data, err := ioutil.ReadFile(path.Join("test", "slow-logs", "slow001.log"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var gz bytes.Buffer
+	w := gzip.NewWriter(&gz)
+	w.Write(data)
+	w.Close()
+	c := &fakeS3{objects: map[string][]byte{
+		"logs/slow.log":    data,
+		"logs/slow.log.gz": gz.Bytes(),
+	}}
+
+	parse := func(key string, opt slowlog.Options) []slowlog.Event {
+		o := slowlog.NewS3Object(c, "logs", key)
+		defer o.Close()
+		p := slowlog.NewParser(o)
+		if err := p.Start(opt); err != nil {
+			t.Fatal(err)
+		}
+		events := []slowlog.Event{}
+		for e := range p.Events() {
+			events = append(events, e)
+		}
+		if err := p.Error(); err != nil {
+			t.Error(err)
+		}
+		return events
+	}
+
+	all := parse("slow.log", slowlog.Options{})
+	if len(all) != 2 {
+		t.Fatalf("got %d events, expected 2", len(all))
+	}
+
+	// Resume at the second event: seeks to its offset.
+	offset := all[1].Offset
+	c.gets = nil
+	got := parse("slow.log", slowlog.Options{StartOffset: offset})
+	if len(got) != 1 || got[0].Query != all[1].Query {
+		t.Errorf("got events %+v, expected second event", got)
+	}
+	if len(c.gets) != 1 || c.gets[0] != int64(offset) {
+		t.Errorf("got GetObject offsets %v, expected [%d]", c.gets, offset)
+	}
+
+	// Compressed object: offsets are in decompressed bytes.
+	got = parse("slow.log.gz", slowlog.Options{StartOffset: offset, Compression: slowlog.COMPRESSION_AUTO})
+	if len(got) != 1 || got[0].Query != all[1].Query {
+		t.Errorf("got events %+v, expected second event", got)
+	}
+
+	_, err = ioutil.ReadAll(slowlog.NewS3Object(c, "logs", "missing.log"))
+	if err == nil || err.Error() != "s3://logs/missing.log: NoSuchKey" {
+		t.Errorf("got error %v, expected s3://logs/missing.log: NoSuchKey", err)
+	}
+}
@@ -0,0 +1,92 @@
+/*
+	Copyright 2017 Daniel Nichter
+	Copyright 2014-2016 Percona LLC and/or its affiliates
+*/
+
+package slowlog
+
+import (
+	"encoding/binary"
+	"math"
+	"sort"
+)
+
+// SAMPLE_BLOCK_SIZE is the number of metric values kept uncompressed per
+// metric. When a block is full, it's compressed. Most classes have fewer
+// values, so they are never compressed.
+const SAMPLE_BLOCK_SIZE = 1024
+
+// samples are the values of a metric, kept to calculate exact percentiles.
+// Full blocks of values are sorted, delta-encoded, and stored as varints,
+// which are usually a fraction of the size of the values because values of
+// the same metric are close.
+type samples struct {
+	blocks [][]byte
+	n      int      // number of values in blocks
+	vals   []uint64 // uncompressed values, up to SAMPLE_BLOCK_SIZE
+}
+
+func (s *samples) add(v uint64) {
+	s.vals = append(s.vals, v)
+	if len(s.vals) == SAMPLE_BLOCK_SIZE {
+		s.compress()
+	}
+}
+
+// compress moves the uncompressed values to a new block.
+func (s *samples) compress() {
+	sort.Sort(byUint64(s.vals))
+	buf := make([]byte, 0, len(s.vals)*2)
+	tmp := make([]byte, binary.MaxVarintLen64)
+	prev := uint64(0)
+	for _, v := range s.vals {
+		n := binary.PutUvarint(tmp, v-prev)
+		buf = append(buf, tmp[:n]...)
+		prev = v
+	}
+	s.blocks = append(s.blocks, buf)
+	s.n += len(s.vals)
+	s.vals = s.vals[:0]
+}
+
+// len returns the number of values.
+func (s *samples) len() int {
+	return s.n + len(s.vals)
+}
+
+// values returns all values, unsorted.
+func (s *samples) values() []uint64 {
+	vals := make([]uint64, 0, s.len())
+	for _, block := range s.blocks {
+		prev := uint64(0)
+		for len(block) > 0 {
+			d, n := binary.Uvarint(block)
+			block = block[n:]
+			prev += d
+			vals = append(vals, prev)
+		}
+	}
+	return append(vals, s.vals...)
+}
+
+// merge adds the values of o.
+func (s *samples) merge(o *samples) {
+	s.blocks = append(s.blocks, o.blocks...)
+	s.n += o.n
+	for _, v := range o.vals {
+		s.add(v)
+	}
+}
+
+// timeBits returns the time value f, in seconds, as integer microseconds in
+// a uint64 that sorts like f. Time values are logged with microsecond
+// precision, so close values have small deltas, unlike the bits of the float
+// where small changes flip high mantissa bits.
+func timeBits(f float64) uint64 {
+	return uint64(int64(math.Round(f*1e6))) ^ (1 << 63) // sign bit: negative sorts first
+}
+
+// bitsTime returns the time value of timeBits.
+func bitsTime(b uint64) float64 {
+	return float64(int64(b^(1<<63))) / 1e6
+}
@@ -0,0 +1,72 @@
+/*
+	Copyright 2017 Daniel Nichter
+	Copyright 2014-2016 Percona LLC and/or its affiliates
+*/
+
+package slowlog
+
+import (
+	"math"
+	"math/rand"
+	"sort"
+	"testing"
+
+	"github.com/go-test/deep"
+)
+
+func TestSamplesTimeSize(t *testing.T) {
+	// Query times from 100 microseconds to tens of seconds, logged with
+	// microsecond precision.
+	r := rand.New(rand.NewSource(1))
+	n := 8 * SAMPLE_BLOCK_SIZE
+	vals := make([]float64, n)
+	for i := range vals {
+		vals[i] = math.Round(math.Exp(r.NormFloat64()*2-5)*1e6) / 1e6
+	}
+
+	s := samples{}
+	for _, v := range vals {
+		s.add(timeBits(v))
+	}
+	size := 0
+	for _, block := range s.blocks {
+		size += len(block)
+	}
+
+	// The bits of the float, delta-encoded the same way, for comparison.
+	f := samples{}
+	for _, v := range vals {
+		f.add(math.Float64bits(v))
+	}
+	floatSize := 0
+	for _, block := range f.blocks {
+		floatSize += len(block)
+	}
+
+	t.Logf("%.2f bytes per value, %.2f as float bits", float64(size)/float64(n), float64(floatSize)/float64(n))
+	if size*3 > n*8 {
+		t.Errorf("%d bytes for %d values, expected less than 1/3 of 8 bytes per value", size, n)
+	}
+
+	got := []float64{}
+	for _, b := range s.values() {
+		got = append(got, bitsTime(b))
+	}
+	sort.Float64s(got)
+	sort.Float64s(vals)
+	if diff := deep.Equal(got, vals); diff != nil {
+		t.Error(diff)
+	}
+}
+
+func TestTimeBits(t *testing.T) {
+	vals := []float64{-1.5, -0.000001, 0, 0.000001, 0.1, 0.2, 20, 86400}
+	for i, v := range vals {
+		if got := bitsTime(timeBits(v)); got != v {
+			t.Errorf("bitsTime(timeBits(%v)) = %v", v, got)
+		}
+		if i > 0 && timeBits(vals[i-1]) >= timeBits(v) {
+			t.Errorf("timeBits(%v) does not sort before timeBits(%v)", vals[i-1], v)
+		}
+	}
+}
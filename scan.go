@@ -0,0 +1,309 @@
+/*
+	Copyright 2017 Daniel Nichter
+	Copyright 2014-2016 Percona LLC and/or its affiliates
+*/
+
+package slowlog
+
+import (
+	"strings"
+)
+
+// Header lines are scanned byte by byte instead of with regular expressions,
+// which were most of the CPU time parsing large logs. Each scanner matches
+// exactly what the regular expression in its comment matched, including
+// leftmost-first backtracking.
+
+// isSpace is \s: ASCII whitespace.
+func isSpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\n' || c == '\f' || c == '\r'
+}
+
+// isWordByte is \w: ASCII letters, digits, and underscore.
+func isWordByte(c byte) bool {
+	return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '_'
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+// skipSpace returns the index of the first non-space byte in s at or after i.
+func skipSpace(s string, i int) int {
+	for i < len(s) && isSpace(s[i]) {
+		i++
+	}
+	return i
+}
+
+// skipNonSpace returns the index of the first space byte in s at or after i.
+func skipNonSpace(s string, i int) int {
+	for i < len(s) && !isSpace(s[i]) {
+		i++
+	}
+	return i
+}
+
+// isHeader matches `^#\s+[A-Z]`.
+func isHeader(line string) bool {
+	if len(line) < 3 || line[0] != '#' || !isSpace(line[1]) {
+		return false
+	}
+	i := skipSpace(line, 1)
+	return i < len(line) && line[i] >= 'A' && line[i] <= 'Z'
+}
+
+// isExtHeader matches `^#(\s+explain:|\s*$)`: MariaDB lines only in a header.
+func isExtHeader(line string) bool {
+	if len(line) == 0 || line[0] != '#' {
+		return false
+	}
+	i := skipSpace(line, 1)
+	if i == len(line) {
+		return true
+	}
+	return i > 1 && strings.HasPrefix(line[i:], "explain:")
+}
+
+// scanTime matches `Time: (\S+\s{1,2}\S+|\S+$)` and returns the submatch.
+func scanTime(line string) (string, bool) {
+	for off := 0; ; {
+		n := strings.Index(line[off:], "Time: ")
+		if n < 0 {
+			return "", false
+		}
+		start := off + n + len("Time: ")
+		off = off + n + 1
+
+		end := skipNonSpace(line, start)
+		if end == start {
+			continue
+		}
+		if end == len(line) {
+			return line[start:end], true
+		}
+		i := end + 1 // \s
+		if i < len(line) && isSpace(line[i]) {
+			i++
+		}
+		if i < len(line) && !isSpace(line[i]) {
+			return line[start:skipNonSpace(line, i)], true
+		}
+	}
+}
+
+// scanUserHost matches `User@Host: ([^\[]+|\[[^[]+\]).*?@ (\S*) \[(.*)\]` and
+// returns the first two submatches.
+func scanUserHost(line string) (user, host string, ok bool) {
+	for off := 0; ; {
+		n := strings.Index(line[off:], "User@Host: ")
+		if n < 0 {
+			return "", "", false
+		}
+		s := line[off+n+len("User@Host: "):]
+		off = off + n + 1
+
+		// [^\[]+, longest first
+		end := strings.IndexByte(s, '[')
+		if end < 0 {
+			end = len(s)
+		}
+		for ; end > 0; end-- {
+			if host, ok := scanHost(s[end:]); ok {
+				return s[:end], host, true
+			}
+		}
+
+		// \[[^[]+\], longest first
+		if len(s) == 0 || s[0] != '[' {
+			continue
+		}
+		end = strings.IndexByte(s[1:], '[') + 1
+		if end == 0 {
+			end = len(s)
+		}
+		for end--; end > 1; end-- {
+			if s[end] != ']' {
+				continue
+			}
+			if host, ok := scanHost(s[end+1:]); ok {
+				return s[:end+1], host, true
+			}
+		}
+	}
+}
+
+// scanHost matches `^.*?@ (\S*) \[(.*)\]` and returns the first submatch.
+func scanHost(s string) (string, bool) {
+	for off := 0; ; {
+		n := strings.Index(s[off:], "@ ")
+		if n < 0 {
+			return "", false
+		}
+		start := off + n + len("@ ")
+		off = off + n + 1
+
+		end := skipNonSpace(s, start)
+		if strings.HasPrefix(s[end:], " [") && strings.IndexByte(s[end+2:], ']') >= 0 {
+			return s[start:end], true
+		}
+	}
+}
+
+// scanId matches `Id: +(\d+)` and returns the submatch.
+func scanId(line string) (string, bool) {
+	for off := 0; ; {
+		n := strings.Index(line[off:], "Id:")
+		if n < 0 {
+			return "", false
+		}
+		i := off + n + len("Id:")
+		off = off + n + 1
+
+		start := i
+		for start < len(line) && line[start] == ' ' {
+			start++
+		}
+		end := start
+		for end < len(line) && isDigit(line[end]) {
+			end++
+		}
+		if start > i && end > start {
+			return line[start:end], true
+		}
+	}
+}
+
+// scanMariadbThread matches
+// `^# Thread_id: (\d+)\s+Schema: (\S*)\s+QC_hit: (Yes|No)\s*$` and returns
+// the submatches.
+func scanMariadbThread(line string) (id, db, qcHit string, ok bool) {
+	if !strings.HasPrefix(line, "# Thread_id: ") {
+		return "", "", "", false
+	}
+	i := len("# Thread_id: ")
+	end := i
+	for end < len(line) && isDigit(line[end]) {
+		end++
+	}
+	if end == i || end == len(line) || !isSpace(line[end]) {
+		return "", "", "", false
+	}
+	id = line[i:end]
+
+	i = skipSpace(line, end)
+	if !strings.HasPrefix(line[i:], "Schema: ") {
+		return "", "", "", false
+	}
+	i += len("Schema: ")
+	end = skipNonSpace(line, i)
+	if end == len(line) {
+		return "", "", "", false
+	}
+	db = line[i:end]
+
+	i = skipSpace(line, end)
+	if !strings.HasPrefix(line[i:], "QC_hit: ") {
+		return "", "", "", false
+	}
+	i += len("QC_hit: ")
+	if strings.HasPrefix(line[i:], "Yes") {
+		qcHit = "Yes"
+	} else if strings.HasPrefix(line[i:], "No") {
+		qcHit = "No"
+	} else {
+		return "", "", "", false
+	}
+	if skipSpace(line, i+len(qcHit)) != len(line) {
+		return "", "", "", false
+	}
+	return id, db, qcHit, true
+}
+
+// scanSchema matches `Schema: +(.*?) +Last_errno:` and returns the submatch.
+func scanSchema(line string) (string, bool) {
+	for off := 0; ; {
+		n := strings.Index(line[off:], "Schema:")
+		if n < 0 {
+			return "", false
+		}
+		i := off + n + len("Schema:")
+		off = off + n + 1
+
+		start := i
+		for start < len(line) && line[start] == ' ' {
+			start++
+		}
+		if start == i {
+			continue
+		}
+		// The first Last_errno after a space ends the shortest submatch.
+		for j := start; ; {
+			k := strings.Index(line[j:], "Last_errno:")
+			if k < 0 {
+				break
+			}
+			end := j + k
+			if end > start && line[end-1] == ' ' {
+				for end > start && line[end-1] == ' ' {
+					end--
+				}
+				return line[start:end], true
+			}
+			j = end + 1
+		}
+		// Backtrack: give the last space to the submatch, which is empty if
+		// Last_errno follows it.
+		if start-i > 1 && strings.HasPrefix(line[start:], "Last_errno:") {
+			return "", true
+		}
+	}
+}
+
+// scanQueryTime matches `Query_time: (\S+)` and returns the submatch.
+func scanQueryTime(line string) (string, bool) {
+	for off := 0; ; {
+		n := strings.Index(line[off:], "Query_time: ")
+		if n < 0 {
+			return "", false
+		}
+		start := off + n + len("Query_time: ")
+		off = off + n + 1
+
+		if end := skipNonSpace(line, start); end > start {
+			return line[start:end], true
+		}
+	}
+}
+
+// scanMetrics matches every `(\w+): (\S+|\z)` in the line, like
+// FindAllStringSubmatch, and calls fn with the submatches: the metric name
+// and value, like "Query_time" and "2". The value is empty at the end of the
+// line.
+func scanMetrics(line string, fn func(name, val string)) {
+	for i := 0; i < len(line); {
+		if !isWordByte(line[i]) {
+			i++
+			continue
+		}
+		start := i
+		for i < len(line) && isWordByte(line[i]) {
+			i++
+		}
+		if !strings.HasPrefix(line[i:], ": ") {
+			continue
+		}
+		name := line[start:i]
+		j := i + len(": ")
+		if j == len(line) {
+			fn(name, "")
+			return
+		}
+		end := skipNonSpace(line, j)
+		if end == j {
+			continue
+		}
+		fn(name, line[j:end])
+		i = end
+	}
+}
@@ -0,0 +1,187 @@
+/*
+	Copyright 2017 Daniel Nichter
+	Copyright 2014-2016 Percona LLC and/or its affiliates
+*/
+
+package slowlog
+
+import (
+	"bufio"
+	"os"
+	"path/filepath"
+	"regexp"
+	"testing"
+
+	"github.com/go-test/deep"
+)
+
+// The regular expressions that the scanners replaced. The scanners must match
+// the same lines and return the same submatches.
+var (
+	timeRe          = regexp.MustCompile(`Time: (\S+\s{1,2}\S+|\S+$)`)
+	userRe          = regexp.MustCompile(`User@Host: ([^\[]+|\[[^[]+\]).*?@ (\S*) \[(.*)\]`)
+	schemaRe        = regexp.MustCompile(`Schema: +(.*?) +Last_errno:`)
+	mariadbThreadRe = regexp.MustCompile(`^# Thread_id: (\d+)\s+Schema: (\S*)\s+QC_hit: (Yes|No)\s*$`)
+	headerRe        = regexp.MustCompile(`^#\s+[A-Z]`)
+	extHeaderRe     = regexp.MustCompile(`^#(\s+explain:|\s*$)`)
+	metricsRe       = regexp.MustCompile(`(\w+): (\S+|\z)`)
+	queryTimeRe     = regexp.MustCompile(`Query_time: (\S+)`)
+	idRe            = regexp.MustCompile(`Id: +(\d+)`)
+)
+
+var scanLines = []string{
+	"",
+	"#",
+	"# ",
+	"#  \t ",
+	"#Time: 071015 21:43:52",
+	"# time: 071015 21:43:52",
+	"# Time: 071015 21:43:52",
+	"# Time: 071015  21:43:52",
+	"# Time: 071015   21:43:52",
+	"# Time: 071015 ",
+	"# Time:  071015 21:43:52",
+	"# Time: 2019-01-01T00:00:00.123456Z",
+	"# Time: 2019-01-01T00:00:00Z # Time: 071015 21:43:52",
+	"# Time: 071218 11:48:27 # User@Host: [SQL_SLAVE] @  []",
+	"# User@Host: root[root] @ localhost []",
+	"# User@Host: root[root] @ localhost [127.0.0.1]  Id:    42",
+	"# User@Host: root @ localhost []",
+	"# User@Host: root @ localhost [] ",
+	"# User@Host: [SQL_SLAVE] @  []",
+	"# User@Host: [SQL_SLAVE][] @  []",
+	"# User@Host: [a]b[c] @ host [1.2.3.4]",
+	"# User@Host: [a]b @ host [1.2.3.4]",
+	"# User@Host: [[a]] @ host [1.2.3.4]",
+	"# User@Host: [] @ host []",
+	"# User@Host: a@b @ host [x]",
+	"# User@Host: a @ b @ host [x]",
+	"# User@Host: user @ host",
+	"# User@Host: user @ host [",
+	"# User@Host: user @ host\t[x]",
+	"# User@Host: user @ host [x] User@Host: other @ host2 [y]",
+	"# User@Host:  @ host [x] User@Host: other @ host2 [y]",
+	"# User@Host: [user @ host User@Host: other[other] @ host2 [y]",
+	"# User@Host: msandbox[msandbox] @ localhost []  Id:     1  Thread_id: 2",
+	"# Id: 1",
+	"# Id:1 Id:  2",
+	"# Id: x Id: 3",
+	"# Thread_id: 1  Schema: shop  QC_hit: No",
+	"# Thread_id: 1  Schema:   QC_hit: Yes  ",
+	"# Thread_id: 1  Schema: shop  QC_hit: Maybe",
+	"# Thread_id: 1  Schema: shop  QC_hit: Yes x",
+	"# Thread_id: x  Schema: shop  QC_hit: No",
+	"# Thread_id: 1Schema: shop  QC_hit: No",
+	"# Schema: shop  Last_errno: 0  Killed: 0",
+	"# Schema:   Last_errno: 0  Killed: 0",
+	"# Schema:  Last_errno: 0",
+	"# Schema: Last_errno: 0",
+	"# Schema: my db  Last_errno: 0",
+	"# Schema: shop",
+	"# Schema: shop  Killed: 0",
+	"# Schema: shopLast_errno: 0  Schema: db2 Last_errno: 1",
+	"# Schema: shop  Last_errno:",
+	"# Query_time: 1.2  Lock_time: 0  Rows_sent: 1  Rows_examined: 2",
+	"# Query_time:  1.2 Query_time: 3",
+	"# Query_time: ",
+	"# Rows_affected: 0  Bytes_sent: 1024",
+	"# Bytes_sent: 1024  Tmp_tables: ",
+	"# Start: 2019-01-01T00:00:00.000000Z End: 2019-01-01T00:00:01.000000Z",
+	"# QC_Hit: No  Full_scan: Yes  Full_join: No  Tmp_table: No",
+	"# a:  b: c d: e",
+	"# a: b:c: d",
+	"# a::  b:  c: ",
+	"# Log_slow_rate_type: query  Log_slow_rate_limit: 2\r",
+	"# explain: id select_type table",
+	"#\texplain: 1 SIMPLE t",
+	"#explain: 1",
+	"# Time: 071015 21:43:52\r",
+	"select 1",
+	"SET timestamp=1;",
+}
+
+// scanFixtureLines returns every line of the slow log fixtures.
+func scanFixtureLines(t testing.TB) []string {
+	files, err := filepath.Glob(filepath.Join("test", "slow-logs", "*.log"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := []string{}
+	for _, name := range files {
+		file, err := os.Open(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		s := bufio.NewScanner(file)
+		s.Buffer(nil, 1024*1024)
+		for s.Scan() {
+			lines = append(lines, s.Text())
+		}
+		file.Close()
+		if err := s.Err(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return lines
+}
+
+func TestScanners(t *testing.T) {
+	submatch := func(re *regexp.Regexp, line string, n int) []string {
+		m := re.FindStringSubmatch(line)
+		if m == nil {
+			return nil
+		}
+		return m[1 : n+1]
+	}
+	result := func(ok bool, vals ...string) []string {
+		if !ok {
+			return nil
+		}
+		return vals
+	}
+	for _, line := range append(scanLines, scanFixtureLines(t)...) {
+		if got, expect := isHeader(line), headerRe.MatchString(line); got != expect {
+			t.Errorf("isHeader(%q) = %t, expected %t", line, got, expect)
+		}
+		if got, expect := isExtHeader(line), extHeaderRe.MatchString(line); got != expect {
+			t.Errorf("isExtHeader(%q) = %t, expected %t", line, got, expect)
+		}
+
+		ts, ok := scanTime(line)
+		if diff := deep.Equal(result(ok, ts), submatch(timeRe, line, 1)); diff != nil {
+			t.Errorf("scanTime(%q): %v", line, diff)
+		}
+		user, host, ok := scanUserHost(line)
+		if diff := deep.Equal(result(ok, user, host), submatch(userRe, line, 2)); diff != nil {
+			t.Errorf("scanUserHost(%q): %v", line, diff)
+		}
+		id, ok := scanId(line)
+		if diff := deep.Equal(result(ok, id), submatch(idRe, line, 1)); diff != nil {
+			t.Errorf("scanId(%q): %v", line, diff)
+		}
+		id, db, qcHit, ok := scanMariadbThread(line)
+		if diff := deep.Equal(result(ok, id, db, qcHit), submatch(mariadbThreadRe, line, 3)); diff != nil {
+			t.Errorf("scanMariadbThread(%q): %v", line, diff)
+		}
+		db, ok = scanSchema(line)
+		if diff := deep.Equal(result(ok, db), submatch(schemaRe, line, 1)); diff != nil {
+			t.Errorf("scanSchema(%q): %v", line, diff)
+		}
+		qt, ok := scanQueryTime(line)
+		if diff := deep.Equal(result(ok, qt), submatch(queryTimeRe, line, 1)); diff != nil {
+			t.Errorf("scanQueryTime(%q): %v", line, diff)
+		}
+
+		got := [][]string{}
+		scanMetrics(line, func(name, val string) {
+			got = append(got, []string{name, val})
+		})
+		expect := [][]string{}
+		for _, m := range metricsRe.FindAllStringSubmatch(line, -1) {
+			expect = append(expect, m[1:])
+		}
+		if diff := deep.Equal(got, expect); diff != nil {
+			t.Errorf("scanMetrics(%q): %v", line, diff)
+		}
+	}
+}
@@ -0,0 +1,209 @@
+/*
+	Copyright 2017 Daniel Nichter
+	Copyright 2014-2016 Percona LLC and/or its affiliates
+*/
+
+package slowlog
+
+import (
+	"bytes"
+	"errors"
+	"sync"
+	"time"
+)
+
+// A Schedule returns when a ReportScheduler runs next, like a cron schedule.
+type Schedule interface {
+	// Next returns the first time after t to run, or the zero time to not
+	// run again.
+	Next(t time.Time) time.Time
+}
+
+// Periodic is a Schedule that runs every Interval from Offset after midnight,
+// like every 24 hours at 02:00 (Interval 24h, Offset 2h) or every hour at
+// minute 5 (Interval 1h, Offset 5m). Offset must be less than Interval.
+type Periodic struct {
+	Interval time.Duration
+	Offset   time.Duration
+	Location *time.Location // of midnight (default: UTC)
+}
+
+// Next returns the first time after t to run, or the zero time if Interval is
+// not positive.
+func (s Periodic) Next(t time.Time) time.Time {
+	if s.Interval <= 0 {
+		return time.Time{}
+	}
+	loc := s.Location
+	if loc == nil {
+		loc = time.UTC
+	}
+	t = t.In(loc)
+	next := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, loc).Add(s.Offset)
+	for !next.After(t) {
+		next = next.Add(s.Interval)
+	}
+	return next
+}
+
+// A Report is a report of the events between two runs of a ReportScheduler.
+type Report struct {
+	Start  time.Time // previous run, or when the scheduler started
+	End    time.Time // this run
+	Result Result    // finalized, after ReportOptions.Filter
+	Format ReportFormat
+	Body   []byte // written by WriteReport
+}
+
+// ReportOptions configure a ReportScheduler.
+type ReportOptions struct {
+	Options                           // parser options, Follow is always true and PoolEvents false
+	Class         ClassFunc           // class ID and fingerprint of each event (required)
+	Schedule      Schedule            // when to report (required)
+	Format        ReportFormat        // of Report.Body
+	NewAggregator func() *Aggregator  // new Aggregator for each report (default: NewAggregator(true, 0, 0))
+	Filter        func(Result) Result // applied before writing the report, like TopClasses or IgnoreList.Filter
+	Deliver       func(r Report)      // send the report, like by email or webhook (required)
+}
+
+// ReportScheduler follows a slow log and reports the events between runs of
+// a Schedule, like a nightly slow log report by email. At each run, it
+// finalizes the Result of the events since the previous run, writes the
+// report with WriteReport, and calls ReportOptions.Deliver. Events are
+// reported by the time they are received, not Event.Time.
+//
+// Deliver is called by the scheduler, so the parser blocks until it returns,
+// like StreamingDigest: no events are lost, but a slow Deliver, like one that
+// retries sending an email, delays the following reports. Deliver should
+// handle its own errors.
+type ReportScheduler struct {
+	p   Parser
+	opt ReportOptions
+	// --
+	started  bool
+	doneChan chan struct{}
+	*sync.Mutex
+}
+
+// NewReportScheduler returns a new ReportScheduler for the parser, which is
+// usually a FileParser.
+func NewReportScheduler(p Parser, opt ReportOptions) *ReportScheduler {
+	if opt.NewAggregator == nil {
+		opt.NewAggregator = func() *Aggregator { return NewAggregator(true, 0, 0) }
+	}
+	if opt.Clock == nil {
+		opt.Clock = WallClock
+	}
+	opt.Follow = true
+	opt.PoolEvents = false
+	s := &ReportScheduler{
+		p:   p,
+		opt: opt,
+		// --
+		doneChan: make(chan struct{}),
+		Mutex:    &sync.Mutex{},
+	}
+	return s
+}
+
+// Start starts the parser and the schedule. It returns an error if a
+// required option is nil, if the schedule never runs, if the scheduler was
+// already started, or if the parser cannot start.
+func (s *ReportScheduler) Start() error {
+	if s.opt.Class == nil {
+		return errors.New("ReportOptions.Class is nil")
+	}
+	if s.opt.Schedule == nil {
+		return errors.New("ReportOptions.Schedule is nil")
+	}
+	if s.opt.Deliver == nil {
+		return errors.New("ReportOptions.Deliver is nil")
+	}
+	if s.opt.Schedule.Next(s.opt.Clock.Now()).IsZero() {
+		return errors.New("ReportOptions.Schedule never runs")
+	}
+	s.Lock()
+	defer s.Unlock()
+	if s.started {
+		return ErrStarted
+	}
+	if err := s.p.Start(s.opt.Options); err != nil {
+		return err
+	}
+	s.started = true
+	go s.run()
+	return nil
+}
+
+// Stop stops the parser and the schedule. Events since the last run are not
+// reported. It returns when the scheduler has stopped.
+func (s *ReportScheduler) Stop() {
+	s.Lock()
+	started := s.started
+	s.Unlock()
+	if !started {
+		return
+	}
+	s.p.Stop()
+	<-s.doneChan
+}
+
+// Error returns the parser error, if any.
+func (s *ReportScheduler) Error() error {
+	return s.p.Error()
+}
+
+// --------------------------------------------------------------------------
+
+func (s *ReportScheduler) run() {
+	defer close(s.doneChan)
+	clock := s.opt.Clock
+	start := clock.Now()
+	a := s.opt.NewAggregator()
+	timer := s.after(start)
+	events := s.p.Events()
+	for {
+		select {
+		case e, ok := <-events:
+			if !ok {
+				return
+			}
+			id, fingerprint := s.opt.Class(e)
+			a.AddEvent(e, id, fingerprint)
+		case end := <-timer:
+			s.report(start, end, a.Finalize())
+			start = end
+			a = s.opt.NewAggregator()
+			timer = s.after(clock.Now())
+		}
+	}
+}
+
+// after returns a channel that receives the next run time after now, or nil,
+// which blocks forever, if the schedule does not run again.
+func (s *ReportScheduler) after(now time.Time) <-chan time.Time {
+	next := s.opt.Schedule.Next(now)
+	if next.IsZero() {
+		return nil
+	}
+	return s.opt.Clock.After(next.Sub(now))
+}
+
+func (s *ReportScheduler) report(start, end time.Time, r Result) {
+	if s.opt.Filter != nil {
+		r = s.opt.Filter(r)
+	}
+	var body bytes.Buffer
+	if err := WriteReport(&body, r, s.opt.Format); err != nil {
+		if l := logger(s.opt.Options, LOG_ANOMALIES); l != nil {
+			l.Printf("report: %s", err)
+		}
+	}
+	s.opt.Deliver(Report{
+		Start:  start,
+		End:    end,
+		Result: r,
+		Format: s.opt.Format,
+		Body:   body.Bytes(),
+	})
+}
@@ -0,0 +1,119 @@
+/*
+	Copyright 2017 Daniel Nichter
+	Copyright 2014-2016 Percona LLC and/or its affiliates
+*/
+
+package slowlog_test
+
+import (
+	"bytes"
+	"os"
+	"path"
+	"testing"
+	"time"
+
+	"github.com/go-mysql/slowlog"
+)
+
+func TestPeriodic(t *testing.T) {
+	loc := time.FixedZone("UTC-5", -5*3600)
+	tests := []struct {
+		s      slowlog.Periodic
+		t      time.Time
+		expect time.Time
+	}{
+		{
+			slowlog.Periodic{Interval: 24 * time.Hour, Offset: 2 * time.Hour},
+			time.Date(2019, 1, 1, 1, 0, 0, 0, time.UTC),
+			time.Date(2019, 1, 1, 2, 0, 0, 0, time.UTC),
+		},
+		{
+			slowlog.Periodic{Interval: 24 * time.Hour, Offset: 2 * time.Hour},
+			time.Date(2019, 1, 1, 2, 0, 0, 0, time.UTC),
+			time.Date(2019, 1, 2, 2, 0, 0, 0, time.UTC),
+		},
+		{
+			slowlog.Periodic{Interval: time.Hour, Offset: 5 * time.Minute},
+			time.Date(2019, 1, 1, 23, 30, 0, 0, time.UTC),
+			time.Date(2019, 1, 2, 0, 5, 0, 0, time.UTC),
+		},
+		{
+			slowlog.Periodic{Interval: 24 * time.Hour, Offset: 2 * time.Hour, Location: loc},
+			time.Date(2019, 1, 1, 3, 0, 0, 0, time.UTC), // 22:00 Dec 31 in loc
+			time.Date(2019, 1, 1, 7, 0, 0, 0, time.UTC), // 02:00 Jan 1 in loc
+		},
+		{
+			slowlog.Periodic{Offset: 2 * time.Hour},
+			time.Date(2019, 1, 1, 3, 0, 0, 0, time.UTC),
+			time.Time{}, // no Interval, never
+		},
+		{
+			slowlog.Periodic{Interval: -time.Hour},
+			time.Date(2019, 1, 1, 3, 0, 0, 0, time.UTC),
+			time.Time{},
+		},
+	}
+	for _, test := range tests {
+		if got := test.s.Next(test.t); !got.Equal(test.expect) {
+			t.Errorf("%+v: got next %s after %s, expected %s", test.s, got, test.t, test.expect)
+		}
+	}
+}
+
+func TestReportScheduler(t *testing.T) {
+	file, err := os.Open(path.Join("test", "slow-logs", "slow001.log"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+
+	start := time.Date(2019, 1, 1, 1, 30, 0, 0, time.UTC)
+	c := slowlog.NewManualClock(start)
+	reports := make(chan slowlog.Report, 1)
+	opt := slowlog.ReportOptions{
+		Options:  slowlog.Options{Clock: c},
+		Class:    func(e slowlog.Event) (string, string) { return "all", "all" },
+		Schedule: slowlog.Periodic{Interval: 24 * time.Hour, Offset: 2 * time.Hour},
+		Deliver:  func(r slowlog.Report) { reports <- r },
+	}
+	s := slowlog.NewReportScheduler(slowlog.NewFileParser(file), opt)
+	if err := s.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer s.Stop()
+
+	// Wait for the schedule timer and the follow timer at EOF.
+	for c.Timers() < 2 {
+		time.Sleep(time.Millisecond)
+	}
+	c.Advance(30 * time.Minute)
+	var r slowlog.Report
+	select {
+	case r = <-reports:
+	case <-time.After(2 * time.Second):
+		t.Fatal("timeout waiting for report")
+	}
+	if !r.Start.Equal(start) || !r.End.Equal(start.Add(30*time.Minute)) {
+		t.Errorf("got report from %s to %s, expected %s to %s", r.Start, r.End, start, start.Add(30*time.Minute))
+	}
+	if r.Result.Global.TotalQueries != 2 {
+		t.Errorf("got %d queries, expected 2", r.Result.Global.TotalQueries)
+	}
+	var expect bytes.Buffer
+	slowlog.WriteReport(&expect, r.Result, slowlog.REPORT_TEXT)
+	if !bytes.Equal(r.Body, expect.Bytes()) {
+		t.Errorf("got report body:\n%s\nexpected:\n%s", r.Body, expect.Bytes())
+	}
+}
+
+func TestReportSchedulerNeverRuns(t *testing.T) {
+	opt := slowlog.ReportOptions{
+		Class:    func(e slowlog.Event) (string, string) { return "all", "all" },
+		Schedule: slowlog.Periodic{},
+		Deliver:  func(r slowlog.Report) {},
+	}
+	s := slowlog.NewReportScheduler(slowlog.NewParser(bytes.NewReader(nil)), opt)
+	if err := s.Start(); err == nil || err.Error() != "ReportOptions.Schedule never runs" {
+		t.Errorf("got error %v, expected ReportOptions.Schedule never runs", err)
+	}
+}
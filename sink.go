@@ -0,0 +1,125 @@
+/*
+	Copyright 2017 Daniel Nichter
+	Copyright 2014-2016 Percona LLC and/or its affiliates
+*/
+
+package slowlog
+
+import (
+	"bufio"
+	"expvar"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+)
+
+// Parser runtime metrics sent to a MetricsSink. Rates, like lines per second,
+// are the rates of the counters.
+const (
+	PARSER_LINES        = "lines_total"             // counter: lines read
+	PARSER_BYTES        = "bytes_total"             // counter: bytes read
+	PARSER_EVENTS       = "events_total"            // counter: events sent
+	PARSER_SEND_WAIT    = "send_wait_seconds_total" // counter: time blocked sending events
+	PARSER_BYTES_BEHIND = "bytes_behind"            // gauge: Stats.BytesBehind
+	PARSER_ERRORS       = "errors_total"            // counter: Stats.Errors
+)
+
+// A MetricsSink receives parser runtime metrics, like PARSER_LINES, see
+// Options.MetricsSink. Its methods are called by the parser for every line, so
+// they must be fast, and they must be safe for concurrent use if the sink is
+// shared by several parsers.
+type MetricsSink interface {
+	Add(name string, n float64) // add n to the counter
+	Set(name string, v float64) // set the gauge to v
+}
+
+// ExpvarMetrics is a MetricsSink that publishes the metrics as an expvar.Map,
+// so they are served by /debug/vars.
+type ExpvarMetrics struct {
+	m *expvar.Map
+	*sync.Mutex
+}
+
+// NewExpvarMetrics returns a new ExpvarMetrics published as name. Like
+// expvar.NewMap, it panics if name is already published.
+func NewExpvarMetrics(name string) *ExpvarMetrics {
+	return &ExpvarMetrics{
+		m:     expvar.NewMap(name),
+		Mutex: &sync.Mutex{},
+	}
+}
+
+func (s *ExpvarMetrics) Add(name string, n float64) {
+	s.m.AddFloat(name, n)
+}
+
+func (s *ExpvarMetrics) Set(name string, v float64) {
+	s.Lock()
+	f, ok := s.m.Get(name).(*expvar.Float)
+	if !ok {
+		f = new(expvar.Float)
+		s.m.Set(name, f)
+	}
+	s.Unlock()
+	f.Set(v)
+}
+
+// PrometheusMetrics is a MetricsSink that serves the metrics over HTTP in the
+// Prometheus text format, without a dependency on the Prometheus client.
+// Metric names are prefixed with the namespace, like "slowlog_parser_".
+type PrometheusMetrics struct {
+	namespace string
+	counters  map[string]float64
+	gauges    map[string]float64
+	*sync.Mutex
+}
+
+// NewPrometheusMetrics returns a new PrometheusMetrics. Use it as an
+// http.Handler, like http.Handle("/metrics", m).
+func NewPrometheusMetrics(namespace string) *PrometheusMetrics {
+	return &PrometheusMetrics{
+		namespace: namespace,
+		counters:  map[string]float64{},
+		gauges:    map[string]float64{},
+		Mutex:     &sync.Mutex{},
+	}
+}
+
+func (s *PrometheusMetrics) Add(name string, n float64) {
+	s.Lock()
+	s.counters[name] += n
+	s.Unlock()
+}
+
+func (s *PrometheusMetrics) Set(name string, v float64) {
+	s.Lock()
+	s.gauges[name] = v
+	s.Unlock()
+}
+
+// ServeHTTP writes the metrics sorted by name.
+func (s *PrometheusMetrics) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	type metric struct {
+		name, typ string
+		val       float64
+	}
+	s.Lock()
+	metrics := make([]metric, 0, len(s.counters)+len(s.gauges))
+	for name, val := range s.counters {
+		metrics = append(metrics, metric{s.namespace + name, "counter", val})
+	}
+	for name, val := range s.gauges {
+		metrics = append(metrics, metric{s.namespace + name, "gauge", val})
+	}
+	s.Unlock()
+	sort.Slice(metrics, func(i, j int) bool { return metrics[i].name < metrics[j].name })
+
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	b := bufio.NewWriter(w)
+	for _, m := range metrics {
+		fmt.Fprintf(b, "# TYPE %s %s\n%s %s\n", m.name, m.typ, m.name, strconv.FormatFloat(m.val, 'g', -1, 64))
+	}
+	b.Flush()
+}
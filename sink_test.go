@@ -0,0 +1,86 @@
+/*
+	Copyright 2017 Daniel Nichter
+	Copyright 2014-2016 Percona LLC and/or its affiliates
+*/
+
+package slowlog_test
+
+import (
+	"expvar"
+	"net/http/httptest"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/go-mysql/slowlog"
+	"github.com/go-test/deep"
+)
+
+func TestMetricsSink(t *testing.T) {
+	file, err := os.Open(path.Join("test", "slow-logs", "slow001.log"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	fi, err := file.Stat()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sink := slowlog.NewPrometheusMetrics("slowlog_parser_")
+	ev := slowlog.NewExpvarMetrics("slowlog_parser_test")
+	p := slowlog.NewFileParser(file)
+	if err := p.Start(slowlog.Options{MetricsSink: multiSink{sink, ev}}); err != nil {
+		t.Fatal(err)
+	}
+	for range p.Events() {
+	}
+
+	w := httptest.NewRecorder()
+	sink.ServeHTTP(w, httptest.NewRequest("GET", "/metrics", nil))
+	got := map[string]string{}
+	for _, line := range strings.Split(strings.TrimSpace(w.Body.String()), "\n") {
+		if strings.HasPrefix(line, "#") {
+			continue
+		}
+		f := strings.Fields(line)
+		got[f[0]] = f[1]
+	}
+	if _, ok := got["slowlog_parser_send_wait_seconds_total"]; !ok {
+		t.Error("no send wait metric")
+	}
+	delete(got, "slowlog_parser_send_wait_seconds_total") // varies
+	expect := map[string]string{
+		"slowlog_parser_bytes_behind": "0",
+		"slowlog_parser_bytes_total":  strconv.FormatInt(fi.Size(), 10),
+		"slowlog_parser_events_total": "2",
+		"slowlog_parser_lines_total":  "13",
+	}
+	if diff := deep.Equal(got, expect); diff != nil {
+		t.Error(diff)
+	}
+
+	m := expvar.Get("slowlog_parser_test").(*expvar.Map)
+	if v := m.Get(slowlog.PARSER_EVENTS).String(); v != "2" {
+		t.Errorf("got expvar events %s, expected 2", v)
+	}
+	if v := m.Get(slowlog.PARSER_BYTES_BEHIND).String(); v != "0" {
+		t.Errorf("got expvar bytes behind %s, expected 0", v)
+	}
+}
+
+type multiSink []slowlog.MetricsSink
+
+func (m multiSink) Add(name string, n float64) {
+	for _, s := range m {
+		s.Add(name, n)
+	}
+}
+
+func (m multiSink) Set(name string, v float64) {
+	for _, s := range m {
+		s.Set(name, v)
+	}
+}
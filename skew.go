@@ -0,0 +1,86 @@
+/*
+	Copyright 2017 Daniel Nichter
+	Copyright 2014-2016 Percona LLC and/or its affiliates
+*/
+
+package slowlog
+
+import (
+	"sort"
+	"time"
+)
+
+// ClockOffsets are clock corrections keyed on Event.Source, added to
+// Event.Time so events from servers with clock skew line up, like when
+// comparing intervals across servers. A source whose clock is 2 seconds
+// behind has offset 2s. Set an offset when parsing one source with
+// Options.TimeOffset, or correct events from many sources with Correct or
+// SourceAggregator.SetClockOffsets.
+type ClockOffsets map[string]time.Duration
+
+// Correct adds the offset of the event source, if any, to its time. Events
+// without a time are not changed.
+func (o ClockOffsets) Correct(e *Event) {
+	if e.Time.IsZero() {
+		return
+	}
+	if offset, ok := o[e.Source]; ok {
+		e.Time = e.Time.Add(offset)
+	}
+}
+
+// EstimateClockOffsets estimates the clock offset of every source relative to
+// the reference source from marker events: events logged by every source at
+// the same real time, like a heartbeat query replicated to all servers. The
+// marker func returns the marker key of an event, like the heartbeat ID in the
+// query, or "" if the event is not a marker. The offset of a source is the
+// median difference between the time of a marker on the reference source and
+// on the source. Sources without markers in common with the reference source
+// are not returned. The reference source has offset 0.
+func EstimateClockOffsets(events []Event, reference string, marker func(Event) string) ClockOffsets {
+	markers := map[string]map[string]time.Time{} // source => key => time
+	for _, e := range events {
+		if e.Time.IsZero() {
+			continue
+		}
+		key := marker(e)
+		if key == "" {
+			continue
+		}
+		if markers[e.Source] == nil {
+			markers[e.Source] = map[string]time.Time{}
+		}
+		if _, ok := markers[e.Source][key]; !ok {
+			markers[e.Source][key] = e.Time // first if repeated
+		}
+	}
+
+	offsets := ClockOffsets{}
+	ref, ok := markers[reference]
+	if !ok {
+		return offsets
+	}
+	offsets[reference] = 0
+	for src, times := range markers {
+		if src == reference {
+			continue
+		}
+		diffs := []time.Duration{}
+		for key, t := range times {
+			if refTime, ok := ref[key]; ok {
+				diffs = append(diffs, refTime.Sub(t))
+			}
+		}
+		if len(diffs) == 0 {
+			continue
+		}
+		sort.Slice(diffs, func(i, j int) bool { return diffs[i] < diffs[j] })
+		n := len(diffs)
+		if n%2 == 1 {
+			offsets[src] = diffs[n/2]
+		} else {
+			offsets[src] = (diffs[n/2-1] + diffs[n/2]) / 2
+		}
+	}
+	return offsets
+}
@@ -0,0 +1,67 @@
+/*
+	Copyright 2017 Daniel Nichter
+	Copyright 2014-2016 Percona LLC and/or its affiliates
+*/
+
+package slowlog_test
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-mysql/slowlog"
+	"github.com/go-test/deep"
+)
+
+func TestClockOffsets(t *testing.T) {
+	start := time.Date(2023, 2, 5, 3, 0, 0, 0, time.UTC)
+	event := func(src, query string, secs float64) slowlog.Event {
+		e := slowlog.NewEvent()
+		e.Source = src
+		e.Query = query
+		e.Time = start.Add(time.Duration(secs * float64(time.Second)))
+		return *e
+	}
+	// db2 is 2s behind db1, and db3 is 1.5s ahead. One db2 marker was
+	// delayed, so the median ignores it.
+	events := []slowlog.Event{
+		event("db1", "SELECT /* heartbeat 1 */ 1", 0),
+		event("db2", "SELECT /* heartbeat 1 */ 1", -2),
+		event("db3", "SELECT /* heartbeat 1 */ 1", 1.5),
+		event("db1", "SELECT c FROM t", 5),
+		event("db1", "SELECT /* heartbeat 2 */ 1", 10),
+		event("db2", "SELECT /* heartbeat 2 */ 1", 8),
+		event("db1", "SELECT /* heartbeat 3 */ 1", 20),
+		event("db2", "SELECT /* heartbeat 3 */ 1", 25),
+		event("db4", "SELECT /* heartbeat 9 */ 1", 20),
+	}
+	marker := func(e slowlog.Event) string {
+		if !strings.Contains(e.Query, "heartbeat") {
+			return ""
+		}
+		return e.Query
+	}
+	got := slowlog.EstimateClockOffsets(events, "db1", marker)
+	expect := slowlog.ClockOffsets{
+		"db1": 0,
+		"db2": 2 * time.Second,
+		"db3": -1500 * time.Millisecond,
+	}
+	if diff := deep.Equal(got, expect); diff != nil {
+		t.Error(diff)
+	}
+
+	e := events[1]
+	got.Correct(&e)
+	if !e.Time.Equal(start) {
+		t.Errorf("got corrected time %s, expected %s", e.Time, start)
+	}
+
+	// Options.TimeOffset corrects the time when parsing.
+	parsed := parseSlowLog(t, "slow001.log", slowlog.Options{TimeOffset: 2 * time.Second})
+	expectTime := time.Date(2007, 10, 15, 21, 43, 54, 0, time.UTC)
+	if !parsed[0].Time.Equal(expectTime) || parsed[0].Ts != "071015 21:43:52" {
+		t.Errorf("got Ts %s Time %s, expected Ts 071015 21:43:52 Time %s", parsed[0].Ts, parsed[0].Time, expectTime)
+	}
+}
@@ -0,0 +1,138 @@
+/*
+	Copyright 2017 Daniel Nichter
+	Copyright 2014-2016 Percona LLC and/or its affiliates
+*/
+
+package slowlog
+
+import (
+	"fmt"
+	"time"
+)
+
+// SlowExtra are the fields logged by MySQL 8.0.14 and newer with
+// log_slow_extra=ON. The counters are also in Event.NumberMetrics by their
+// logged names, like Read_rnd_next, so they're aggregated per class like
+// other metrics. The Read_* counters are the Handler_read_* status variables
+// and the Sort_* and Created_tmp_* counters are the status variables of the
+// same name for the query. Count_hit_tmp_table_size is logged by MySQL 8.0.28
+// and newer.
+type SlowExtra struct {
+	ThreadId             uint64
+	Errno                uint64
+	Killed               uint64 // error code if killed, else 0
+	BytesReceived        uint64
+	BytesSent            uint64
+	ReadFirst            uint64
+	ReadLast             uint64
+	ReadKey              uint64
+	ReadNext             uint64
+	ReadPrev             uint64
+	ReadRnd              uint64
+	ReadRndNext          uint64
+	SortMergePasses      uint64
+	SortRangeCount       uint64
+	SortRows             uint64
+	SortScanCount        uint64
+	CreatedTmpDiskTables uint64
+	CreatedTmpTables     uint64
+	CountHitTmpTableSize uint64
+	Start                time.Time // Event.StartTs parsed like Event.Time; zero if invalid
+	End                  time.Time // Event.EndTs parsed like Event.Time; zero if invalid
+}
+
+// Duration returns End minus Start, the wall clock time of the query, or 0
+// if either is zero.
+func (s SlowExtra) Duration() time.Duration {
+	if s.Start.IsZero() || s.End.IsZero() {
+		return 0
+	}
+	return s.End.Sub(s.Start)
+}
+
+// newSlowExtra returns the SlowExtra of the event, or nil if the event has no
+// Start and End, which MySQL logs only with log_slow_extra=ON. Timestamps are
+// parsed like Event.Time.
+func newSlowExtra(e *Event, opt Options) *SlowExtra {
+	if e.StartTs == "" && e.EndTs == "" {
+		return nil
+	}
+	n := e.NumberMetrics
+	s := &SlowExtra{
+		ThreadId:             n["Thread_id"],
+		Errno:                n["Errno"],
+		Killed:               n["Killed"],
+		BytesReceived:        n["Bytes_received"],
+		BytesSent:            n["Bytes_sent"],
+		ReadFirst:            n["Read_first"],
+		ReadLast:             n["Read_last"],
+		ReadKey:              n["Read_key"],
+		ReadNext:             n["Read_next"],
+		ReadPrev:             n["Read_prev"],
+		ReadRnd:              n["Read_rnd"],
+		ReadRndNext:          n["Read_rnd_next"],
+		SortMergePasses:      n["Sort_merge_passes"],
+		SortRangeCount:       n["Sort_range_count"],
+		SortRows:             n["Sort_rows"],
+		SortScanCount:        n["Sort_scan_count"],
+		CreatedTmpDiskTables: n["Created_tmp_disk_tables"],
+		CreatedTmpTables:     n["Created_tmp_tables"],
+		CountHitTmpTableSize: n["Count_hit_tmp_table_size"],
+	}
+	if t, _, err := parseTs(e.StartTs, opt.Location, opt.DST); err == nil {
+		s.Start = t.Add(opt.TimeOffset)
+	}
+	if t, _, err := parseTs(e.EndTs, opt.Location, opt.DST); err == nil {
+		s.End = t.Add(opt.TimeOffset)
+	}
+	return s
+}
+
+// AccessPattern is how a query read rows, classified by SlowExtra counters.
+type AccessPattern int
+
+const (
+	ACCESS_NONE       AccessPattern = iota // no rows read by handlers, like SELECT 1
+	ACCESS_POINT                           // index lookups of single rows (Read_key)
+	ACCESS_RANGE                           // index range or lookup of several rows (Read_key and Read_next or Read_prev)
+	ACCESS_INDEX_SCAN                      // full index scan (Read_first or Read_last and Read_next or Read_prev), like EXPLAIN type index
+	ACCESS_FULL_SCAN                       // full table scan (Read_rnd_next is at least half the reads)
+)
+
+func (a AccessPattern) String() string {
+	switch a {
+	case ACCESS_NONE:
+		return "none"
+	case ACCESS_POINT:
+		return "point"
+	case ACCESS_RANGE:
+		return "range"
+	case ACCESS_INDEX_SCAN:
+		return "index_scan"
+	case ACCESS_FULL_SCAN:
+		return "full_scan"
+	}
+	return fmt.Sprintf("AccessPattern(%d)", int(a))
+}
+
+// AccessPattern classifies the query by its Handler_read_* counters. The
+// counters are for all tables, so a join that scans one table and looks up
+// rows in another is ACCESS_FULL_SCAN if the scan reads at least half the
+// rows. Unlike the Full_scan metric of
+// Percona Server and MariaDB, which is true if any table is scanned, this
+// separates index scans and small scans from large table scans.
+func (s SlowExtra) AccessPattern() AccessPattern {
+	next := s.ReadNext + s.ReadPrev
+	reads := s.ReadKey + next + s.ReadFirst + s.ReadLast + s.ReadRnd + s.ReadRndNext
+	switch {
+	case reads == 0:
+		return ACCESS_NONE
+	case s.ReadRndNext*2 >= reads:
+		return ACCESS_FULL_SCAN
+	case s.ReadFirst+s.ReadLast > 0 && next > s.ReadKey:
+		return ACCESS_INDEX_SCAN
+	case next > 0:
+		return ACCESS_RANGE
+	}
+	return ACCESS_POINT
+}
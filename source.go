@@ -0,0 +1,141 @@
+/*
+	Copyright 2017 Daniel Nichter
+	Copyright 2014-2016 Percona LLC and/or its affiliates
+*/
+
+package slowlog
+
+import (
+	"sync"
+)
+
+// A Quota limits the resources of one source in a SourceAggregator, so one
+// noisy source can't use all the resources of the others. Zero values are no
+// limit.
+type Quota struct {
+	MaxClasses         uint    // see Aggregator.SetMaxClasses
+	MaxEventsPerSecond float64 // events over the rate are dropped
+	EventBurst         uint    // events not dropped after being idle (default: 1 second of events, at least 1)
+	MaxExampleBytes    int     // see Aggregator.SetMaxExampleBytes
+}
+
+// SourceStats are the counters of one source in a SourceAggregator.
+type SourceStats struct {
+	Events  uint64 // events aggregated
+	Dropped uint64 // events dropped by Quota.MaxEventsPerSecond
+}
+
+// SourceAggregator aggregates events per Event.Source, each source by its own
+// Aggregator with a Quota. It is safe for concurrent use, like by a service
+// that receives events from many MySQL instances.
+type SourceAggregator struct {
+	newAggregator func() *Aggregator
+	quota         Quota
+	quotas        map[string]Quota
+	clock         Clock
+	offsets       ClockOffsets
+	sources       map[string]*source
+	*sync.Mutex
+}
+
+type source struct {
+	a     *Aggregator
+	limit *limiter
+	stats SourceStats
+}
+
+// NewSourceAggregator returns a new SourceAggregator that makes an Aggregator
+// for each source with newAggregator, with the default quota.
+func NewSourceAggregator(newAggregator func() *Aggregator, quota Quota) *SourceAggregator {
+	return &SourceAggregator{
+		newAggregator: newAggregator,
+		quota:         quota,
+		quotas:        map[string]Quota{},
+		clock:         WallClock,
+		sources:       map[string]*source{},
+		Mutex:         &sync.Mutex{},
+	}
+}
+
+// SetQuota sets the quota of the source instead of the default quota. Call
+// this function before adding events from the source.
+func (s *SourceAggregator) SetQuota(src string, quota Quota) {
+	s.Lock()
+	defer s.Unlock()
+	s.quotas[src] = quota
+}
+
+// SetClock sets the clock for Quota.MaxEventsPerSecond, WallClock by default.
+// Call this function before adding events.
+func (s *SourceAggregator) SetClock(clock Clock) {
+	s.Lock()
+	defer s.Unlock()
+	s.clock = clock
+}
+
+// SetClockOffsets sets clock corrections for sources whose clocks are skewed,
+// applied to Event.Time before aggregating, see ClockOffsets. Call this
+// function before adding events.
+func (s *SourceAggregator) SetClockOffsets(offsets ClockOffsets) {
+	s.Lock()
+	defer s.Unlock()
+	s.offsets = offsets
+}
+
+// AddEvent adds the event to the Aggregator of its source. It returns false
+// if the event is dropped by the source quota.
+func (s *SourceAggregator) AddEvent(e Event, id, fingerprint string) bool {
+	s.Lock()
+	defer s.Unlock()
+	if s.offsets != nil {
+		s.offsets.Correct(&e)
+	}
+	src, ok := s.sources[e.Source]
+	if !ok {
+		quota, ok := s.quotas[e.Source]
+		if !ok {
+			quota = s.quota
+		}
+		src = &source{a: s.newAggregator()}
+		if quota.MaxClasses > 0 {
+			src.a.SetMaxClasses(quota.MaxClasses)
+		}
+		if quota.MaxExampleBytes > 0 {
+			src.a.SetMaxExampleBytes(quota.MaxExampleBytes)
+		}
+		if quota.MaxEventsPerSecond > 0 {
+			src.limit = newLimiter(quota.MaxEventsPerSecond, float64(quota.EventBurst), s.clock)
+		}
+		s.sources[e.Source] = src
+	}
+	if src.limit != nil && !src.limit.take(1) {
+		src.stats.Dropped++
+		return false
+	}
+	src.stats.Events++
+	src.a.AddEvent(e, id, fingerprint)
+	return true
+}
+
+// Stats returns the stats of every source, keyed on source.
+func (s *SourceAggregator) Stats() map[string]SourceStats {
+	s.Lock()
+	defer s.Unlock()
+	stats := make(map[string]SourceStats, len(s.sources))
+	for name, src := range s.sources {
+		stats[name] = src.stats
+	}
+	return stats
+}
+
+// Finalize finalizes the Aggregator of every source and returns the Results,
+// keyed on source. Call this function when done adding events.
+func (s *SourceAggregator) Finalize() map[string]Result {
+	s.Lock()
+	defer s.Unlock()
+	results := make(map[string]Result, len(s.sources))
+	for name, src := range s.sources {
+		results[name] = src.a.Finalize()
+	}
+	return results
+}
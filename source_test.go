@@ -0,0 +1,110 @@
+/*
+	Copyright 2017 Daniel Nichter
+	Copyright 2014-2016 Percona LLC and/or its affiliates
+*/
+
+package slowlog_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/go-mysql/slowlog"
+	"github.com/go-test/deep"
+)
+
+func TestSourceAggregator(t *testing.T) {
+	clock := slowlog.NewManualClock(time.Date(2019, 1, 1, 0, 0, 0, 0, time.UTC))
+	s := slowlog.NewSourceAggregator(
+		func() *slowlog.Aggregator { return slowlog.NewAggregator(true, 0, 0) },
+		slowlog.Quota{MaxEventsPerSecond: 1, EventBurst: 1, MaxClasses: 1, MaxExampleBytes: 10},
+	)
+	s.SetClock(clock)
+	s.SetQuota("db2", slowlog.Quota{})
+
+	add := func(src, id string) bool {
+		e := slowlog.NewEvent()
+		e.Source = src
+		e.Query = "select " + id + " from a_long_table_name"
+		e.TimeMetrics["Query_time"] = 1
+		return s.AddEvent(*e, id, "select "+id)
+	}
+	// db1 is noisy: only 1 event per second.
+	if !add("db1", "1") {
+		t.Error("first db1 event dropped")
+	}
+	for i := 0; i < 4; i++ {
+		if add("db1", "1") {
+			t.Error("db1 event over quota not dropped")
+		}
+	}
+	clock.Advance(time.Second)
+	if !add("db1", "2") {
+		t.Error("db1 event after 1s dropped")
+	}
+	// db2 has no quota.
+	for i := 0; i < 5; i++ {
+		add("db2", "1")
+		add("db2", "2")
+	}
+
+	expect := map[string]slowlog.SourceStats{
+		"db1": {Events: 2, Dropped: 4},
+		"db2": {Events: 10},
+	}
+	if diff := deep.Equal(s.Stats(), expect); diff != nil {
+		t.Error(diff)
+	}
+
+	results := s.Finalize()
+	db1 := results["db1"]
+	if len(db1.Class) != 2 || db1.Class[slowlog.MISC_CLASS_ID] == nil {
+		t.Errorf("got %d db1 classes, expected 1 and MISC", len(db1.Class))
+	}
+	if q := db1.Class["1"].Example.Query; q != "select ..." {
+		t.Errorf("got db1 example %q, expected \"select ...\"", q)
+	}
+	db2 := results["db2"]
+	if len(db2.Class) != 2 || db2.Class[slowlog.MISC_CLASS_ID] != nil {
+		t.Errorf("got %d db2 classes, expected 2 without MISC", len(db2.Class))
+	}
+	if q := db2.Class["1"].Example.Query; q != "select 1 from a_long_table_name" {
+		t.Errorf("got db2 example %q, expected full query", q)
+	}
+}
+
+func TestSourceAggregatorSlowQuota(t *testing.T) {
+	// Less than 1 event per second without EventBurst: the first event and
+	// one every 2s are kept.
+	clock := slowlog.NewManualClock(time.Date(2019, 1, 1, 0, 0, 0, 0, time.UTC))
+	s := slowlog.NewSourceAggregator(
+		func() *slowlog.Aggregator { return slowlog.NewAggregator(true, 0, 0) },
+		slowlog.Quota{MaxEventsPerSecond: 0.5},
+	)
+	s.SetClock(clock)
+	add := func() bool {
+		e := slowlog.NewEvent()
+		e.Source = "db1"
+		e.Query = "select 1"
+		e.TimeMetrics["Query_time"] = 1
+		return s.AddEvent(*e, "1", "select 1")
+	}
+	if !add() {
+		t.Error("first event dropped")
+	}
+	if add() {
+		t.Error("event over quota not dropped")
+	}
+	clock.Advance(time.Second)
+	if add() {
+		t.Error("event after 1s not dropped")
+	}
+	clock.Advance(time.Second)
+	if !add() {
+		t.Error("event after 2s dropped")
+	}
+	expect := map[string]slowlog.SourceStats{"db1": {Events: 2, Dropped: 2}}
+	if diff := deep.Equal(s.Stats(), expect); diff != nil {
+		t.Error(diff)
+	}
+}
@@ -0,0 +1,173 @@
+/*
+	Copyright 2017 Daniel Nichter
+	Copyright 2014-2016 Percona LLC and/or its affiliates
+*/
+
+package slowlog
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// ErrNotFound is returned by Storage.Get if there is no Result for the key.
+var ErrNotFound = errors.New("not found")
+
+// Storage stores finalized Results, like one per time interval, so they can
+// be kept and compared over time. Keys are chosen by the caller, like the
+// interval start time. Implementations must be safe for concurrent use.
+type Storage interface {
+	// Put stores the Result, replacing any Result with the same key.
+	Put(key string, r Result) error
+
+	// Get returns the Result for the key, or ErrNotFound.
+	Get(key string) (Result, error)
+
+	// Iterate calls f for every Result, sorted by key, until f returns an
+	// error, which is returned.
+	Iterate(f func(key string, r Result) error) error
+}
+
+// MemoryStorage is a Storage that keeps Results in memory.
+type MemoryStorage struct {
+	results map[string]Result
+	*sync.Mutex
+}
+
+// NewMemoryStorage returns a new MemoryStorage.
+func NewMemoryStorage() *MemoryStorage {
+	return &MemoryStorage{
+		results: map[string]Result{},
+		Mutex:   &sync.Mutex{},
+	}
+}
+
+func (s *MemoryStorage) Put(key string, r Result) error {
+	s.Lock()
+	defer s.Unlock()
+	s.results[key] = r
+	return nil
+}
+
+func (s *MemoryStorage) Get(key string) (Result, error) {
+	s.Lock()
+	defer s.Unlock()
+	r, ok := s.results[key]
+	if !ok {
+		return Result{}, ErrNotFound
+	}
+	return r, nil
+}
+
+func (s *MemoryStorage) Iterate(f func(key string, r Result) error) error {
+	// Copy so f can call Put and Get.
+	s.Lock()
+	keys := make([]string, 0, len(s.results))
+	results := make(map[string]Result, len(s.results))
+	for key, r := range s.results {
+		keys = append(keys, key)
+		results[key] = r
+	}
+	s.Unlock()
+	sort.Strings(keys)
+	for _, key := range keys {
+		if err := f(key, results[key]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// DirStorage is a Storage that saves each Result as a JSON file named
+// key + ".json" in a directory. Keys must be valid file names. Unexported
+// Result data, like metric values for percentiles, is not saved, so a
+// Result is the same when loaded only if it was finalized.
+type DirStorage struct {
+	dir string
+	*sync.Mutex
+}
+
+// NewDirStorage returns a new DirStorage for the directory, which must exist.
+func NewDirStorage(dir string) *DirStorage {
+	return &DirStorage{
+		dir:   dir,
+		Mutex: &sync.Mutex{},
+	}
+}
+
+func (s *DirStorage) Put(key string, r Result) error {
+	file, err := s.file(key)
+	if err != nil {
+		return err
+	}
+	bytes, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+	s.Lock()
+	defer s.Unlock()
+	// Write and rename so a Result is never partially written.
+	tmp := file + ".tmp"
+	if err := ioutil.WriteFile(tmp, bytes, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, file)
+}
+
+func (s *DirStorage) Get(key string) (Result, error) {
+	file, err := s.file(key)
+	if err != nil {
+		return Result{}, err
+	}
+	s.Lock()
+	bytes, err := ioutil.ReadFile(file)
+	s.Unlock()
+	if err != nil {
+		if os.IsNotExist(err) {
+			return Result{}, ErrNotFound
+		}
+		return Result{}, err
+	}
+	r := Result{}
+	if err := json.Unmarshal(bytes, &r); err != nil {
+		return Result{}, fmt.Errorf("%s: %s", file, err)
+	}
+	return r, nil
+}
+
+func (s *DirStorage) Iterate(f func(key string, r Result) error) error {
+	files, err := filepath.Glob(filepath.Join(s.dir, "*.json"))
+	if err != nil {
+		return err
+	}
+	sort.Strings(files)
+	for _, file := range files {
+		key := strings.TrimSuffix(filepath.Base(file), ".json")
+		r, err := s.Get(key)
+		if err == ErrNotFound {
+			continue // removed since Glob
+		}
+		if err != nil {
+			return err
+		}
+		if err := f(key, r); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// file returns the file for the key.
+func (s *DirStorage) file(key string) (string, error) {
+	if key == "" || key == "." || key == ".." || strings.ContainsAny(key, `/\`) {
+		return "", fmt.Errorf("invalid key: %q", key)
+	}
+	return filepath.Join(s.dir, key+".json"), nil
+}
@@ -0,0 +1,87 @@
+/*
+	Copyright 2017 Daniel Nichter
+	Copyright 2014-2016 Percona LLC and/or its affiliates
+*/
+
+package slowlog_test
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/go-mysql/slowlog"
+	"github.com/go-test/deep"
+)
+
+func testStorage(t *testing.T, s slowlog.Storage) {
+	if _, err := s.Get("2019-01-01"); err != slowlog.ErrNotFound {
+		t.Errorf("got error %v, expected ErrNotFound", err)
+	}
+
+	results := map[string]slowlog.Result{}
+	for i, key := range []string{"2019-01-02", "2019-01-01"} {
+		a := slowlog.NewAggregator(true, 0, 0)
+		e := slowlog.NewEvent()
+		e.TimeMetrics["Query_time"] = float64(i + 1)
+		e.NumberMetrics["Rows_sent"] = uint64(i)
+		e.Query = "select 1"
+		a.AddEvent(*e, "1", "select ?")
+		results[key] = a.Finalize()
+		if err := s.Put(key, results[key]); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	got, err := s.Get("2019-01-02")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := deep.Equal(got, results["2019-01-02"]); diff != nil {
+		t.Error(diff)
+	}
+
+	keys := []string{}
+	err = s.Iterate(func(key string, r slowlog.Result) error {
+		keys = append(keys, key)
+		if diff := deep.Equal(r, results[key]); diff != nil {
+			t.Errorf("%s: %v", key, diff)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Error(err)
+	}
+	if diff := deep.Equal(keys, []string{"2019-01-01", "2019-01-02"}); diff != nil {
+		t.Error(diff)
+	}
+
+	stop := errors.New("stop")
+	n := 0
+	err = s.Iterate(func(key string, r slowlog.Result) error {
+		n++
+		return stop
+	})
+	if err != stop || n != 1 {
+		t.Errorf("Iterate returned %v after %d calls, expected stop after 1", err, n)
+	}
+}
+
+func TestMemoryStorage(t *testing.T) {
+	testStorage(t, slowlog.NewMemoryStorage())
+}
+
+func TestDirStorage(t *testing.T) {
+	dir, err := ioutil.TempDir("", "slowlog-test-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	s := slowlog.NewDirStorage(dir)
+	testStorage(t, s)
+
+	if err := s.Put("../x", slowlog.Result{}); err == nil {
+		t.Error("no error for key with path separator")
+	}
+}
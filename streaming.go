@@ -0,0 +1,235 @@
+/*
+	Copyright 2017 Daniel Nichter
+	Copyright 2014-2016 Percona LLC and/or its affiliates
+*/
+
+package slowlog
+
+import (
+	"errors"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// DEFAULT_STREAMING_INTERVAL is the default StreamingOptions.Interval.
+const DEFAULT_STREAMING_INTERVAL = time.Minute
+
+// StreamingOptions configure a StreamingDigest.
+type StreamingOptions struct {
+	Options                                       // parser options, Follow is always true and PoolEvents false
+	Class         ClassFunc                       // class ID and fingerprint of each event (required)
+	Interval      time.Duration                   // how often to publish metrics (default: DEFAULT_STREAMING_INTERVAL)
+	NewAggregator func() *Aggregator              // new Aggregator for each interval (default: NewAggregator(false, 0, 0))
+	OnResult      func(start time.Time, r Result) // called with the Result of each interval, like TrendStore.Add
+}
+
+// StreamingDigest follows a slow log and aggregates its events in intervals,
+// like a rolling digest. At the end of each interval, it finalizes the
+// interval Result, passes it to StreamingOptions.OnResult, and adds it to
+// the metrics that it serves over HTTP in the OpenMetrics text format, like
+// WriteOpenMetrics. Counters are cumulative since Start, and gauges (p95 and
+// max) are from the last interval, so it can be scraped by Prometheus like
+// any exporter. Classes are served until the digest is stopped, so use a
+// ClassFunc that returns a bounded number of classes.
+//
+// Latency: an event is published at most Interval after the digest receives
+// it, and the parser reads new lines every Options.FollowInterval, so an event
+// is published at most Interval + FollowInterval after it is written to the
+// slow log, as long as the digest keeps up with the log.
+//
+// Backpressure: events are never dropped. If the log is written faster than
+// the events are aggregated, the parser blocks sending events, so it falls
+// behind the log instead of using more memory. Then latency is not bounded:
+// watch PARSER_BYTES_BEHIND and PARSER_SEND_WAIT with Options.MetricsSink,
+// and limit the parser with Options.MaxEventsPerSecond if needed.
+//
+// Intervals are by the time events are received, not Event.Time, because
+// event times can be old (or missing) when the digest starts or lags.
+type StreamingDigest struct {
+	p   Parser
+	opt StreamingOptions
+	// --
+	total     map[string]*Class // cumulative classes
+	last      Result            // last interval
+	lastStart time.Time
+	published bool
+	started   bool
+	doneChan  chan struct{}
+	*sync.Mutex
+}
+
+// NewStreamingDigest returns a new StreamingDigest for the parser, which is
+// usually a FileParser.
+func NewStreamingDigest(p Parser, opt StreamingOptions) *StreamingDigest {
+	if opt.Interval <= 0 {
+		opt.Interval = DEFAULT_STREAMING_INTERVAL
+	}
+	if opt.NewAggregator == nil {
+		opt.NewAggregator = func() *Aggregator { return NewAggregator(false, 0, 0) }
+	}
+	if opt.Clock == nil {
+		opt.Clock = WallClock
+	}
+	opt.Follow = true
+	opt.PoolEvents = false
+	d := &StreamingDigest{
+		p:   p,
+		opt: opt,
+		// --
+		total:    map[string]*Class{},
+		doneChan: make(chan struct{}),
+		Mutex:    &sync.Mutex{},
+	}
+	return d
+}
+
+// Start starts the parser and aggregating events. It returns an error if
+// StreamingOptions.Class is nil, if the digest was already started, or if
+// the parser cannot start.
+func (d *StreamingDigest) Start() error {
+	if d.opt.Class == nil {
+		return errors.New("StreamingOptions.Class is nil")
+	}
+	d.Lock()
+	defer d.Unlock()
+	if d.started {
+		return ErrStarted
+	}
+	if err := d.p.Start(d.opt.Options); err != nil {
+		return err
+	}
+	d.started = true
+	go d.run()
+	return nil
+}
+
+// Stop stops the parser, then publishes the current, partial interval so no
+// events are lost. It returns when the digest has stopped.
+func (d *StreamingDigest) Stop() {
+	d.Lock()
+	started := d.started
+	d.Unlock()
+	if !started {
+		return
+	}
+	d.p.Stop()
+	<-d.doneChan
+}
+
+// Error returns the parser error, if any.
+func (d *StreamingDigest) Error() error {
+	return d.p.Error()
+}
+
+// Last returns the start and Result of the last published interval. It
+// returns false if no interval has been published.
+func (d *StreamingDigest) Last() (time.Time, Result, bool) {
+	d.Lock()
+	defer d.Unlock()
+	return d.lastStart, d.last, d.published
+}
+
+// ServeHTTP writes the metrics in the OpenMetrics text format. Use the digest
+// as an http.Handler, like http.Handle("/metrics", d).
+func (d *StreamingDigest) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/openmetrics-text; version=1.0.0; charset=utf-8")
+	d.Lock()
+	defer d.Unlock()
+	WriteOpenMetrics(w, Result{Class: d.total})
+}
+
+// --------------------------------------------------------------------------
+
+func (d *StreamingDigest) run() {
+	defer close(d.doneChan)
+	clock := d.opt.Clock
+	start := clock.Now().Truncate(d.opt.Interval)
+	a := d.opt.NewAggregator()
+	timer := clock.After(start.Add(d.opt.Interval).Sub(clock.Now()))
+	events := d.p.Events()
+	for {
+		select {
+		case e, ok := <-events:
+			if !ok {
+				d.publish(start, a.Finalize())
+				return
+			}
+			id, fingerprint := d.opt.Class(e)
+			a.AddEvent(e, id, fingerprint)
+		case now := <-timer:
+			d.publish(start, a.Finalize())
+			// If the digest was blocked, empty intervals are skipped.
+			start = now.Truncate(d.opt.Interval)
+			a = d.opt.NewAggregator()
+			timer = clock.After(start.Add(d.opt.Interval).Sub(clock.Now()))
+		}
+	}
+}
+
+// publish adds the interval Result to the cumulative classes, then calls
+// StreamingOptions.OnResult.
+func (d *StreamingDigest) publish(start time.Time, r Result) {
+	if l := logger(d.opt.Options, LOG_DEBUG); l != nil {
+		l.Printf("interval %s: %d classes", start, len(r.Class))
+	}
+	d.Lock()
+	for _, c := range d.total {
+		c.resetGauges() // not in this interval
+	}
+	for id, c := range r.Class {
+		t, ok := d.total[id]
+		if !ok {
+			t = &Class{Id: c.Id, Fingerprint: c.Fingerprint, Metrics: NewMetrics()}
+			d.total[id] = t
+		}
+		t.addTotals(c)
+	}
+	d.last = r
+	d.lastStart = start
+	d.published = true
+	d.Unlock()
+	if d.opt.OnResult != nil {
+		d.opt.OnResult(start, r)
+	}
+}
+
+// addTotals adds the counters of the finalized class c, and sets the gauges
+// to those of c.
+func (t *Class) addTotals(c *Class) {
+	t.TotalQueries += c.TotalQueries
+	for name, s := range c.Metrics.TimeMetrics {
+		ts, ok := t.Metrics.TimeMetrics[name]
+		if !ok {
+			ts = &TimeStats{}
+			t.Metrics.TimeMetrics[name] = ts
+		}
+		ts.Sum += s.Sum
+		ts.P95 = s.P95
+		ts.Max = s.Max
+	}
+	for name, s := range c.Metrics.NumberMetrics {
+		ns, ok := t.Metrics.NumberMetrics[name]
+		if !ok {
+			ns = &NumberStats{}
+			t.Metrics.NumberMetrics[name] = ns
+		}
+		ns.Sum += s.Sum
+	}
+	for name, s := range c.Metrics.BoolMetrics {
+		bs, ok := t.Metrics.BoolMetrics[name]
+		if !ok {
+			bs = &BoolStats{}
+			t.Metrics.BoolMetrics[name] = bs
+		}
+		bs.Sum += s.Sum
+		bs.Cnt += s.Cnt
+	}
+}
+
+func (t *Class) resetGauges() {
+	for _, s := range t.Metrics.TimeMetrics {
+		s.P95 = 0
+		s.Max = 0
+	}
+}
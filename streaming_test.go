@@ -0,0 +1,105 @@
+/*
+	Copyright 2017 Daniel Nichter
+	Copyright 2014-2016 Percona LLC and/or its affiliates
+*/
+
+package slowlog_test
+
+import (
+	"net/http/httptest"
+	"os"
+	"path"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-mysql/slowlog"
+)
+
+func TestStreamingDigest(t *testing.T) {
+	file, err := os.Open(path.Join("test", "slow-logs", "slow001.log"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+
+	c := slowlog.NewManualClock(time.Date(2019, 1, 1, 0, 0, 0, 0, time.UTC))
+	results := make(chan slowlog.Result, 2)
+	opt := slowlog.StreamingOptions{
+		Options:  slowlog.Options{Clock: c},
+		Class:    func(e slowlog.Event) (string, string) { return "all", "all" },
+		Interval: time.Minute,
+		OnResult: func(start time.Time, r slowlog.Result) { results <- r },
+	}
+	d := slowlog.NewStreamingDigest(slowlog.NewFileParser(file), opt)
+	if err := d.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer d.Stop()
+
+	metrics := func() map[string]string {
+		w := httptest.NewRecorder()
+		d.ServeHTTP(w, httptest.NewRequest("GET", "/metrics", nil))
+		got := map[string]string{}
+		for _, line := range strings.Split(w.Body.String(), "\n") {
+			if line == "" || strings.HasPrefix(line, "#") {
+				continue
+			}
+			n := strings.LastIndexByte(line, ' ')
+			got[line[0:n]] = line[n+1:]
+		}
+		return got
+	}
+	const (
+		queries = `slowlog_queries_total{class="all",fingerprint="all"}`
+		max     = `slowlog_time_max_seconds{class="all",fingerprint="all",metric="Query_time"}`
+	)
+	next := func() slowlog.Result {
+		// Wait for the interval timer and the follow timer at EOF, so all
+		// events have been received before the interval ends.
+		for c.Timers() < 2 {
+			time.Sleep(time.Millisecond)
+		}
+		c.Advance(time.Minute)
+		select {
+		case r := <-results:
+			return r
+		case <-time.After(2 * time.Second):
+			t.Fatal("timeout waiting for interval result")
+		}
+		return slowlog.Result{}
+	}
+
+	if _, _, ok := d.Last(); ok {
+		t.Error("last interval before first interval ends")
+	}
+	r := next()
+	if r.Global.TotalQueries != 2 {
+		t.Errorf("got %d queries in first interval, expected 2", r.Global.TotalQueries)
+	}
+	got := metrics()
+	if got[queries] != "2" {
+		t.Errorf("got %s queries, expected 2", got[queries])
+	}
+	if got[max] != "2" {
+		t.Errorf("got max Query_time %s, expected 2", got[max])
+	}
+	start, _, ok := d.Last()
+	if !ok || !start.Equal(time.Date(2019, 1, 1, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("got last interval %s %t, expected 2019-01-01 00:00:00 true", start, ok)
+	}
+
+	// No events in the second interval: counters are cumulative, gauges
+	// are only for the interval.
+	r = next()
+	if r.Global.TotalQueries != 0 {
+		t.Errorf("got %d queries in second interval, expected 0", r.Global.TotalQueries)
+	}
+	got = metrics()
+	if got[queries] != "2" {
+		t.Errorf("got %s queries, expected 2", got[queries])
+	}
+	if got[max] != "0" {
+		t.Errorf("got max Query_time %s, expected 0", got[max])
+	}
+}
@@ -0,0 +1,122 @@
+/*
+	Copyright 2017 Daniel Nichter
+	Copyright 2014-2016 Percona LLC and/or its affiliates
+*/
+
+package slowlog
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// ClassChangeType is the type of a ClassChange.
+type ClassChangeType int
+
+const (
+	CLASS_NEW  ClassChangeType = iota // class in interval for the first time
+	CLASS_GONE                        // class not in the last gone intervals, see NewClassTracker
+)
+
+// A ClassChange is a class that is new or gone, sent by a ClassTracker.
+type ClassChange struct {
+	Type        ClassChangeType
+	Id          string    // class ID
+	Fingerprint string    // class fingerprint
+	Interval    time.Time // start of interval in which the change was detected
+}
+
+// ClassTracker detects classes that are new or gone in a stream of interval
+// Results, like one Result every 5 minutes, to alert on new slow queries after
+// a deploy, for example. The first Result is the baseline: its classes are not
+// reported as new. A class is gone if it is not in the last gone Results; then
+// it is forgotten, so it is new if seen again.
+type ClassTracker struct {
+	gone     uint
+	classes  map[string]*trackedClass
+	baseline bool
+	changes  chan ClassChange
+	*sync.Mutex
+}
+
+type trackedClass struct {
+	fingerprint string
+	missing     uint // number of Results since class last seen
+}
+
+// NewClassTracker returns a new ClassTracker that reports a class gone after
+// gone Results without it (minimum 1). Changes are sent on a channel buffered
+// with bufferSize changes.
+func NewClassTracker(gone uint, bufferSize int) *ClassTracker {
+	if gone < 1 {
+		gone = 1
+	}
+	return &ClassTracker{
+		gone:    gone,
+		classes: map[string]*trackedClass{},
+		changes: make(chan ClassChange, bufferSize),
+		Mutex:   &sync.Mutex{},
+	}
+}
+
+// Changes returns the channel to which changes are sent. It is closed by Close.
+func (t *ClassTracker) Changes() <-chan ClassChange {
+	return t.changes
+}
+
+// Add adds the Result for the interval that begins at start and sends the
+// changes, sorted by type and class ID. It blocks while the changes channel
+// is full, so the caller must receive changes concurrently or buffer enough.
+func (t *ClassTracker) Add(start time.Time, r Result) {
+	t.Lock()
+	defer t.Unlock()
+
+	newClasses := []ClassChange{}
+	for id, class := range r.Class {
+		if c, ok := t.classes[id]; ok {
+			c.missing = 0
+			continue
+		}
+		t.classes[id] = &trackedClass{fingerprint: class.Fingerprint}
+		if t.baseline {
+			newClasses = append(newClasses, ClassChange{
+				Type:        CLASS_NEW,
+				Id:          id,
+				Fingerprint: class.Fingerprint,
+				Interval:    start,
+			})
+		}
+	}
+	t.baseline = true
+
+	goneClasses := []ClassChange{}
+	for id, c := range t.classes {
+		if _, ok := r.Class[id]; ok {
+			continue
+		}
+		c.missing++
+		if c.missing < t.gone {
+			continue
+		}
+		delete(t.classes, id)
+		goneClasses = append(goneClasses, ClassChange{
+			Type:        CLASS_GONE,
+			Id:          id,
+			Fingerprint: c.fingerprint,
+			Interval:    start,
+		})
+	}
+
+	for _, changes := range [][]ClassChange{newClasses, goneClasses} {
+		sort.Slice(changes, func(i, j int) bool { return changes[i].Id < changes[j].Id })
+		for _, c := range changes {
+			t.changes <- c
+		}
+	}
+}
+
+// Close closes the changes channel. Add must not be called after Close.
+func (t *ClassTracker) Close() {
+	close(t.changes)
+}
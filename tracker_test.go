@@ -0,0 +1,52 @@
+/*
+	Copyright 2017 Daniel Nichter
+	Copyright 2014-2016 Percona LLC and/or its affiliates
+*/
+
+package slowlog_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/go-mysql/slowlog"
+	"github.com/go-test/deep"
+)
+
+func TestClassTracker(t *testing.T) {
+	result := func(ids ...string) slowlog.Result {
+		a := slowlog.NewAggregator(false, 0, 0)
+		for _, id := range ids {
+			e := slowlog.NewEvent()
+			e.Query = "select " + id
+			e.TimeMetrics["Query_time"] = 1
+			a.AddEvent(*e, id, "select "+id)
+		}
+		return a.Finalize()
+	}
+	start := time.Date(2019, 1, 1, 0, 0, 0, 0, time.UTC)
+	at := func(i int) time.Time { return start.Add(time.Duration(i) * time.Minute) }
+
+	tr := slowlog.NewClassTracker(2, 10)
+	tr.Add(at(0), result("a", "b"))      // baseline
+	tr.Add(at(1), result("a", "c", "d")) // c, d new, b missing once
+	tr.Add(at(2), result("a", "c"))      // b gone, d missing once
+	tr.Add(at(3), result("a", "b", "c")) // b new again, d gone
+	tr.Add(at(4), result("a", "b", "c")) // no changes
+	tr.Close()
+
+	got := []slowlog.ClassChange{}
+	for c := range tr.Changes() {
+		got = append(got, c)
+	}
+	expect := []slowlog.ClassChange{
+		{Type: slowlog.CLASS_NEW, Id: "c", Fingerprint: "select c", Interval: at(1)},
+		{Type: slowlog.CLASS_NEW, Id: "d", Fingerprint: "select d", Interval: at(1)},
+		{Type: slowlog.CLASS_GONE, Id: "b", Fingerprint: "select b", Interval: at(2)},
+		{Type: slowlog.CLASS_NEW, Id: "b", Fingerprint: "select b", Interval: at(3)},
+		{Type: slowlog.CLASS_GONE, Id: "d", Fingerprint: "select d", Interval: at(3)},
+	}
+	if diff := deep.Equal(got, expect); diff != nil {
+		t.Error(diff)
+	}
+}
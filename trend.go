@@ -0,0 +1,286 @@
+/*
+	Copyright 2017 Daniel Nichter
+	Copyright 2014-2016 Percona LLC and/or its affiliates
+*/
+
+package slowlog
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"sort"
+	"sync"
+	"time"
+)
+
+// A TrendTier is one resolution of a TrendStore: class stats are summed into
+// points Interval long which are kept for Retention. Points begin at multiples
+// of Interval since midnight UTC, or since midnight in Location if set, so 1
+// hour points begin at the top of the hour local time, and 1 day points begin
+// at local midnight, even on days that are 23 or 25 hours long due to DST.
+// Intervals longer than a day must be whole days, and intervals shorter than
+// a day should divide a day.
+type TrendTier struct {
+	Interval  time.Duration
+	Retention time.Duration
+	Location  *time.Location // time zone of point boundaries and TrendPoint.Start (default: nil, UTC)
+}
+
+const day = 24 * time.Hour
+
+// align returns the start of the point that t is in.
+func (tier TrendTier) align(t time.Time) time.Time {
+	if tier.Location == nil {
+		return t.Truncate(tier.Interval)
+	}
+	t = t.In(tier.Location)
+	if tier.Interval%day == 0 {
+		// Local date, truncated to whole days since the zero time like
+		// Truncate, at local midnight.
+		y, m, d := t.Date()
+		date := time.Date(y, m, d, 0, 0, 0, 0, time.UTC).Truncate(tier.Interval)
+		y, m, d = date.Date()
+		return time.Date(y, m, d, 0, 0, 0, 0, tier.Location)
+	}
+	// Truncate the local wall clock time, keeping the UTC offset of t so an
+	// hour repeated when DST ends is two points.
+	_, offset := t.Zone()
+	off := time.Duration(offset) * time.Second
+	return t.Add(off).Truncate(tier.Interval).Add(-off)
+}
+
+// next returns the start of the point after the one that begins at start.
+func (tier TrendTier) next(start time.Time) time.Time {
+	if tier.Location != nil && tier.Interval%day == 0 {
+		return tier.align(start.AddDate(0, 0, int(tier.Interval/day)))
+	}
+	return tier.align(start.Add(tier.Interval))
+}
+
+// DEFAULT_TREND_TIERS keep 5 minute points for 1 day, 1 hour points for 7 days,
+// and 1 day points for 30 days.
+var DEFAULT_TREND_TIERS = []TrendTier{
+	{Interval: 5 * time.Minute, Retention: 24 * time.Hour},
+	{Interval: time.Hour, Retention: 7 * 24 * time.Hour},
+	{Interval: 24 * time.Hour, Retention: 30 * 24 * time.Hour},
+}
+
+// A TrendPoint is the stats of one class for one interval. P95QueryTime is
+// the max P95 of the Results added to the point because the values needed to
+// compute the real P95 are not kept.
+type TrendPoint struct {
+	Start        time.Time
+	Queries      uint64  // Class.TotalQueries
+	QueryTime    float64 // Query_time Sum
+	MaxQueryTime float64 // Query_time Max
+	P95QueryTime float64 // Query_time P95, see above
+}
+
+// TrendStore keeps per-class stats over time at several resolutions, like the
+// DEFAULT_TREND_TIERS. Every added Result is summed into a point in each tier,
+// so coarser tiers are downsampled copies of finer tiers. Points older than
+// their tier retention, relative to the newest Result, are removed when a
+// Result is added. TrendStore is safe for concurrent use.
+type TrendStore struct {
+	tiers  []TrendTier
+	points []map[string]map[int64]*TrendPoint // tier => class ID => start (Unix) => point
+	last   time.Time                          // start of newest Result
+	*sync.Mutex
+}
+
+// NewTrendStore returns a new TrendStore with the tiers, which must be ordered
+// from finest to coarsest. If tiers is empty, DEFAULT_TREND_TIERS are used.
+func NewTrendStore(tiers []TrendTier) *TrendStore {
+	if len(tiers) == 0 {
+		tiers = DEFAULT_TREND_TIERS
+	}
+	s := &TrendStore{
+		tiers:  tiers,
+		points: make([]map[string]map[int64]*TrendPoint, len(tiers)),
+		Mutex:  &sync.Mutex{},
+	}
+	for i := range s.points {
+		s.points[i] = map[string]map[int64]*TrendPoint{}
+	}
+	return s
+}
+
+// Add adds the classes in the finalized Result for the interval that begins
+// at start, then removes expired points.
+func (s *TrendStore) Add(start time.Time, r Result) {
+	s.Lock()
+	defer s.Unlock()
+	for id, class := range r.Class {
+		for i, tier := range s.tiers {
+			s.add(i, id, tier.align(start), class)
+		}
+	}
+	if start.After(s.last) {
+		s.last = start
+	}
+	s.expire()
+}
+
+// Trend returns the points for the class between start (inclusive) and end
+// (exclusive), sorted by time, from the finest tier that retains points back
+// to start. Point Start times are in the tier Location, if set.
+func (s *TrendStore) Trend(id string, start, end time.Time) []TrendPoint {
+	s.Lock()
+	defer s.Unlock()
+	return s.trend(s.tier(start), id, start, end)
+}
+
+// FilledTrend returns the points for the class like Trend, and a point with
+// zero stats for every interval between start and end without one, so the
+// points are consecutive intervals, like for a chart. The first point is the
+// first that begins at or after start.
+func (s *TrendStore) FilledTrend(id string, start, end time.Time) []TrendPoint {
+	s.Lock()
+	defer s.Unlock()
+	n := s.tier(start)
+	tier := s.tiers[n]
+	trend := s.trend(n, id, start, end)
+	filled := []TrendPoint{}
+	t := tier.align(start)
+	if t.Before(start) {
+		t = tier.next(t)
+	}
+	for ; t.Before(end); t = tier.next(t) {
+		if len(trend) > 0 && trend[0].Start.Equal(t) {
+			filled = append(filled, trend[0])
+			trend = trend[1:]
+			continue
+		}
+		p := TrendPoint{Start: t}
+		if tier.Location != nil {
+			p.Start = t.In(tier.Location)
+		}
+		filled = append(filled, p)
+	}
+	return filled
+}
+
+// tier returns the index of the finest tier that retains points back to
+// start. The caller must hold the lock.
+func (s *TrendStore) tier(start time.Time) int {
+	for i, tier := range s.tiers {
+		if !start.Before(s.last.Add(-tier.Retention)) {
+			return i
+		}
+	}
+	return len(s.tiers) - 1
+}
+
+// trend returns the points for the class in the tier between start and end,
+// sorted by time. The caller must hold the lock.
+func (s *TrendStore) trend(n int, id string, start, end time.Time) []TrendPoint {
+	trend := []TrendPoint{}
+	for _, p := range s.points[n][id] {
+		if !p.Start.Before(start) && p.Start.Before(end) {
+			tp := *p
+			if loc := s.tiers[n].Location; loc != nil {
+				tp.Start = tp.Start.In(loc)
+			}
+			trend = append(trend, tp)
+		}
+	}
+	sort.Slice(trend, func(i, j int) bool { return trend[i].Start.Before(trend[j].Start) })
+	return trend
+}
+
+// Save writes all points as JSON to w. Use Load to read them into a
+// TrendStore with the same tiers.
+func (s *TrendStore) Save(w io.Writer) error {
+	s.Lock()
+	defer s.Unlock()
+	saved := make([]map[string][]*TrendPoint, len(s.points))
+	for i := range s.points {
+		saved[i] = map[string][]*TrendPoint{}
+		for id, points := range s.points[i] {
+			for _, p := range points {
+				saved[i][id] = append(saved[i][id], p)
+			}
+		}
+	}
+	return json.NewEncoder(w).Encode(saved)
+}
+
+// Load reads points written by Save and adds them to the TrendStore.
+func (s *TrendStore) Load(r io.Reader) error {
+	saved := []map[string][]*TrendPoint{}
+	if err := json.NewDecoder(r).Decode(&saved); err != nil {
+		return err
+	}
+	if len(saved) != len(s.tiers) {
+		return errors.New("saved trend tiers do not match")
+	}
+	s.Lock()
+	defer s.Unlock()
+	for i := range saved {
+		for id, points := range saved[i] {
+			for _, p := range points {
+				s.merge(i, id, p)
+				if p.Start.After(s.last) {
+					s.last = p.Start
+				}
+			}
+		}
+	}
+	s.expire()
+	return nil
+}
+
+func (s *TrendStore) add(tier int, id string, start time.Time, class *Class) {
+	p := &TrendPoint{
+		Start:   start,
+		Queries: class.TotalQueries,
+	}
+	if qt := class.Metrics.TimeMetrics["Query_time"]; qt != nil {
+		p.QueryTime = qt.Sum
+		p.MaxQueryTime = qt.Max
+		p.P95QueryTime = qt.P95
+	}
+	s.merge(tier, id, p)
+}
+
+func (s *TrendStore) merge(tier int, id string, p *TrendPoint) {
+	points, ok := s.points[tier][id]
+	if !ok {
+		points = map[int64]*TrendPoint{}
+		s.points[tier][id] = points
+	}
+	key := p.Start.Unix()
+	cur, ok := points[key]
+	if !ok {
+		cp := *p
+		points[key] = &cp
+		return
+	}
+	cur.Queries += p.Queries
+	cur.QueryTime += p.QueryTime
+	if p.MaxQueryTime > cur.MaxQueryTime {
+		cur.MaxQueryTime = p.MaxQueryTime
+	}
+	if p.P95QueryTime > cur.P95QueryTime {
+		cur.P95QueryTime = p.P95QueryTime
+	}
+}
+
+// expire removes points older than their tier retention. The caller must
+// hold the lock.
+func (s *TrendStore) expire() {
+	for i, tier := range s.tiers {
+		oldest := s.last.Add(-tier.Retention)
+		for id, points := range s.points[i] {
+			for key, p := range points {
+				if !p.Start.Add(tier.Interval).After(oldest) {
+					delete(points, key)
+				}
+			}
+			if len(points) == 0 {
+				delete(s.points[i], id)
+			}
+		}
+	}
+}
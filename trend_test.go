@@ -0,0 +1,153 @@
+/*
+	Copyright 2017 Daniel Nichter
+	Copyright 2014-2016 Percona LLC and/or its affiliates
+*/
+
+package slowlog_test
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/go-mysql/slowlog"
+	"github.com/go-test/deep"
+)
+
+func TestTrendStore(t *testing.T) {
+	tiers := []slowlog.TrendTier{
+		{Interval: 5 * time.Minute, Retention: time.Hour},
+		{Interval: time.Hour, Retention: 24 * time.Hour},
+	}
+	s := slowlog.NewTrendStore(tiers)
+	start := time.Date(2019, 1, 1, 0, 0, 0, 0, time.UTC)
+	result := func(queryTime float64) slowlog.Result {
+		a := slowlog.NewAggregator(false, 0, 0)
+		e := slowlog.NewEvent()
+		e.Query = "select 1"
+		e.TimeMetrics["Query_time"] = queryTime
+		a.AddEvent(*e, "1", "select ?")
+		return a.Finalize()
+	}
+	// 2 hours of 5 minute Results: 1s, 2s, ... 24s
+	for i := 0; i < 24; i++ {
+		s.Add(start.Add(time.Duration(i)*5*time.Minute), result(float64(i+1)))
+	}
+
+	// Last hour is still 5 minute points, the first 2 of which are:
+	got := s.Trend("1", start.Add(70*time.Minute), start.Add(80*time.Minute))
+	expect := []slowlog.TrendPoint{
+		{Start: start.Add(70 * time.Minute), Queries: 1, QueryTime: 15, MaxQueryTime: 15, P95QueryTime: 15},
+		{Start: start.Add(75 * time.Minute), Queries: 1, QueryTime: 16, MaxQueryTime: 16, P95QueryTime: 16},
+	}
+	if diff := deep.Equal(got, expect); diff != nil {
+		t.Error(diff)
+	}
+
+	// First hour is downsampled to 1 hour points.
+	got = s.Trend("1", start, start.Add(2*time.Hour))
+	expect = []slowlog.TrendPoint{
+		{Start: start, Queries: 12, QueryTime: 78, MaxQueryTime: 12, P95QueryTime: 12},
+		{Start: start.Add(time.Hour), Queries: 12, QueryTime: 222, MaxQueryTime: 24, P95QueryTime: 24},
+	}
+	if diff := deep.Equal(got, expect); diff != nil {
+		t.Error(diff)
+	}
+
+	if got := s.Trend("2", start, start.Add(2*time.Hour)); len(got) != 0 {
+		t.Errorf("got %d points for unknown class, expected 0", len(got))
+	}
+
+	// Save and load into a new store.
+	var buf bytes.Buffer
+	if err := s.Save(&buf); err != nil {
+		t.Fatal(err)
+	}
+	s2 := slowlog.NewTrendStore(tiers)
+	if err := s2.Load(&buf); err != nil {
+		t.Fatal(err)
+	}
+	got = s2.Trend("1", start, start.Add(2*time.Hour))
+	for i := range got {
+		got[i].Start = got[i].Start.UTC()
+	}
+	if diff := deep.Equal(got, expect); diff != nil {
+		t.Error(diff)
+	}
+}
+
+func TestTrendStoreLocation(t *testing.T) {
+	loc, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Skip(err)
+	}
+	result := func() slowlog.Result {
+		a := slowlog.NewAggregator(false, 0, 0)
+		e := slowlog.NewEvent()
+		e.Query = "select 1"
+		e.TimeMetrics["Query_time"] = 1
+		a.AddEvent(*e, "1", "select ?")
+		return a.Finalize()
+	}
+	edt := time.FixedZone("EDT", -4*3600)
+	est := time.FixedZone("EST", -5*3600)
+	// DST ends 2019-11-03 at 2:00 EDT, which is 1:00 EST.
+	times := []time.Time{
+		time.Date(2019, 11, 2, 23, 30, 0, 0, edt),
+		time.Date(2019, 11, 3, 1, 30, 0, 0, edt),
+		time.Date(2019, 11, 3, 1, 30, 0, 0, est), // 1 hour later
+		time.Date(2019, 11, 3, 4, 10, 0, 0, est),
+	}
+
+	// Hour points begin at the top of the hour local time, and the hour that
+	// is repeated when DST ends is two points. Gaps are filled.
+	s := slowlog.NewTrendStore([]slowlog.TrendTier{
+		{Interval: time.Hour, Retention: 24 * time.Hour, Location: loc},
+	})
+	for _, ts := range times {
+		s.Add(ts, result())
+	}
+	got := s.FilledTrend("1", time.Date(2019, 11, 2, 23, 0, 0, 0, loc), time.Date(2019, 11, 3, 5, 0, 0, 0, loc))
+	expect := []slowlog.TrendPoint{
+		{Start: time.Date(2019, 11, 2, 23, 0, 0, 0, edt), Queries: 1, QueryTime: 1, MaxQueryTime: 1, P95QueryTime: 1},
+		{Start: time.Date(2019, 11, 3, 0, 0, 0, 0, edt)},
+		{Start: time.Date(2019, 11, 3, 1, 0, 0, 0, edt), Queries: 1, QueryTime: 1, MaxQueryTime: 1, P95QueryTime: 1},
+		{Start: time.Date(2019, 11, 3, 1, 0, 0, 0, est), Queries: 1, QueryTime: 1, MaxQueryTime: 1, P95QueryTime: 1},
+		{Start: time.Date(2019, 11, 3, 2, 0, 0, 0, est)},
+		{Start: time.Date(2019, 11, 3, 3, 0, 0, 0, est)},
+		{Start: time.Date(2019, 11, 3, 4, 0, 0, 0, est), Queries: 1, QueryTime: 1, MaxQueryTime: 1, P95QueryTime: 1},
+	}
+	if len(got) != len(expect) {
+		t.Fatalf("got %d points, expected %d: %+v", len(got), len(expect), got)
+	}
+	for i := range got {
+		if got[i].Start.Location() != loc {
+			t.Errorf("point %d: got location %s, expected %s", i, got[i].Start.Location(), loc)
+		}
+		got[i].Start = got[i].Start.In(expect[i].Start.Location())
+	}
+	if diff := deep.Equal(got, expect); diff != nil {
+		t.Error(diff)
+	}
+
+	// Day points begin at local midnight, so the day that DST ends is 25
+	// hours long.
+	s = slowlog.NewTrendStore([]slowlog.TrendTier{
+		{Interval: 24 * time.Hour, Retention: 7 * 24 * time.Hour, Location: loc},
+	})
+	for _, ts := range times {
+		s.Add(ts, result())
+	}
+	got = s.FilledTrend("1", time.Date(2019, 11, 2, 0, 0, 0, 0, loc), time.Date(2019, 11, 5, 0, 0, 0, 0, loc))
+	expect = []slowlog.TrendPoint{
+		{Start: time.Date(2019, 11, 2, 0, 0, 0, 0, loc), Queries: 1, QueryTime: 1, MaxQueryTime: 1, P95QueryTime: 1},
+		{Start: time.Date(2019, 11, 3, 0, 0, 0, 0, loc), Queries: 3, QueryTime: 3, MaxQueryTime: 1, P95QueryTime: 1},
+		{Start: time.Date(2019, 11, 4, 0, 0, 0, 0, loc)},
+	}
+	if diff := deep.Equal(got, expect); diff != nil {
+		t.Error(diff)
+	}
+	if d := got[2].Start.Sub(got[1].Start); d != 25*time.Hour {
+		t.Errorf("got %s day, expected 25h", d)
+	}
+}
@@ -0,0 +1,144 @@
+/*
+	Copyright 2017 Daniel Nichter
+	Copyright 2014-2016 Percona LLC and/or its affiliates
+*/
+
+// Package slowlog is the v2 API of github.com/go-mysql/slowlog. Events are
+// interfaces instead of structs with public maps, so new kinds of event data,
+// like typed times, labels, and extra fields, can be added without breaking
+// callers. The v2 API wraps the v1 API: Wrap and Unwrap convert events between
+// them, so v2 events can be aggregated by the v1 Aggregator.
+package slowlog
+
+import (
+	"sort"
+	"time"
+
+	v1 "github.com/go-mysql/slowlog"
+)
+
+// Kind is the kind of a Value.
+type Kind int
+
+const (
+	KIND_TIME   Kind = iota // seconds, like Query_time
+	KIND_NUMBER             // unsigned integer, like Rows_sent
+	KIND_BOOL               // yes/no, like Full_scan
+	KIND_STRING             // other header fields, like InnoDB_trx_id
+)
+
+// A Value is the value of an event field. Only the field for its Kind is set.
+type Value struct {
+	Kind   Kind
+	Time   float64
+	Number uint64
+	Bool   bool
+	String string
+}
+
+// An Event is a query and its metadata and metrics from a log.
+type Event interface {
+	Offset() uint64  // byte offset in log at which event starts
+	Source() string  // where event came from, like file name
+	Time() time.Time // zero if unknown
+	Query() string   // SQL query or admin command
+	Admin() bool     // true if Query is admin command
+	User() string
+	Host() string
+	Db() string
+	Fields() []string // names of metrics and extra fields, sorted
+
+	// Field returns the value of the metric or extra field, or false if
+	// the event does not have it.
+	Field(name string) (Value, bool)
+}
+
+type event struct {
+	e v1.Event
+}
+
+// Wrap returns the v1 event as a v2 Event. The v1 event must not be changed
+// after.
+func Wrap(e v1.Event) Event {
+	return event{e}
+}
+
+// Unwrap returns the v2 Event as a v1 event. If the Event was not made by
+// Wrap, the v1 event is built from its methods.
+func Unwrap(e Event) v1.Event {
+	if w, ok := e.(event); ok {
+		return w.e
+	}
+	v := v1.NewEvent()
+	v.Offset = e.Offset()
+	v.Source = e.Source()
+	v.Time = e.Time()
+	v.Query = e.Query()
+	v.Admin = e.Admin()
+	v.User = e.User()
+	v.Host = e.Host()
+	v.Db = e.Db()
+	for _, name := range e.Fields() {
+		val, _ := e.Field(name)
+		switch val.Kind {
+		case KIND_TIME:
+			v.TimeMetrics[name] = val.Time
+		case KIND_NUMBER:
+			v.NumberMetrics[name] = val.Number
+		case KIND_BOOL:
+			v.BoolMetrics[name] = val.Bool
+		default:
+			if v.Extra == nil {
+				v.Extra = map[string]string{}
+			}
+			v.Extra[name] = val.String
+		}
+	}
+	v.ThreadId = v.NumberMetrics["Thread_id"]
+	v.Killed = v.NumberMetrics["Killed"]
+	v.LastErrno = v.NumberMetrics["Last_errno"]
+	return *v
+}
+
+func (w event) Offset() uint64  { return w.e.Offset }
+func (w event) Source() string  { return w.e.Source }
+func (w event) Time() time.Time { return w.e.Time }
+func (w event) Query() string   { return w.e.Query }
+func (w event) Admin() bool     { return w.e.Admin }
+func (w event) User() string    { return w.e.User }
+func (w event) Host() string    { return w.e.Host }
+func (w event) Db() string      { return w.e.Db }
+
+func (w event) Fields() []string {
+	names := []string{}
+	for name := range w.e.TimeMetrics {
+		names = append(names, name)
+	}
+	for name := range w.e.NumberMetrics {
+		names = append(names, name)
+	}
+	for name := range w.e.BoolMetrics {
+		names = append(names, name)
+	}
+	for name := range w.e.Extra {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func (w event) Field(name string) (Value, bool) {
+	if v, ok := w.e.TimeMetrics[name]; ok {
+		return Value{Kind: KIND_TIME, Time: v}, true
+	}
+	if v, ok := w.e.NumberMetrics[name]; ok {
+		return Value{Kind: KIND_NUMBER, Number: v}, true
+	}
+	if v, ok := w.e.BoolMetrics[name]; ok {
+		return Value{Kind: KIND_BOOL, Bool: v}, true
+	}
+	if v, ok := w.e.Extra[name]; ok {
+		return Value{Kind: KIND_STRING, String: v}, true
+	}
+	return Value{}, false
+}
@@ -0,0 +1,104 @@
+/*
+	Copyright 2017 Daniel Nichter
+	Copyright 2014-2016 Percona LLC and/or its affiliates
+*/
+
+package slowlog_test
+
+import (
+	"context"
+	"os"
+	"path"
+	"testing"
+	"time"
+
+	v1 "github.com/go-mysql/slowlog"
+	"github.com/go-mysql/slowlog/v2"
+	"github.com/go-test/deep"
+)
+
+func TestWrap(t *testing.T) {
+	e := v1.NewEvent()
+	e.Query = "select 1"
+	e.Db = "db1"
+	e.TimeMetrics["Query_time"] = 1.5
+	e.NumberMetrics["Rows_sent"] = 1
+	e.BoolMetrics["Full_scan"] = true
+	e.Extra = map[string]string{"InnoDB_trx_id": "1A2B"}
+
+	w := slowlog.Wrap(*e)
+	if w.Query() != "select 1" || w.Db() != "db1" {
+		t.Errorf("got query %q db %q, expected \"select 1\" and db1", w.Query(), w.Db())
+	}
+	expect := []string{"Full_scan", "InnoDB_trx_id", "Query_time", "Rows_sent"}
+	if diff := deep.Equal(w.Fields(), expect); diff != nil {
+		t.Error(diff)
+	}
+	got := []slowlog.Value{}
+	for _, name := range w.Fields() {
+		v, _ := w.Field(name)
+		got = append(got, v)
+	}
+	values := []slowlog.Value{
+		{Kind: slowlog.KIND_BOOL, Bool: true},
+		{Kind: slowlog.KIND_STRING, String: "1A2B"},
+		{Kind: slowlog.KIND_TIME, Time: 1.5},
+		{Kind: slowlog.KIND_NUMBER, Number: 1},
+	}
+	if diff := deep.Equal(got, values); diff != nil {
+		t.Error(diff)
+	}
+	if _, ok := w.Field("Lock_time"); ok {
+		t.Error("got Lock_time, expected none")
+	}
+	if diff := deep.Equal(slowlog.Unwrap(w), *e); diff != nil {
+		t.Error(diff)
+	}
+}
+
+// other is an Event not made by Wrap.
+type other struct{ slowlog.Event }
+
+func TestUnwrapOther(t *testing.T) {
+	e := v1.NewEvent()
+	e.Query = "select 1"
+	e.TimeMetrics["Query_time"] = 1.5
+	e.Extra = map[string]string{"InnoDB_trx_id": "1A2B"}
+	got := slowlog.Unwrap(other{slowlog.Wrap(*e)})
+	if diff := deep.Equal(got, *e); diff != nil {
+		t.Error(diff)
+	}
+}
+
+func TestParser(t *testing.T) {
+	file, err := os.Open(path.Join("..", "test", "slow-logs", "slow001.log"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	p := slowlog.NewParser(file)
+	err = p.Start(context.Background(),
+		slowlog.WithSource("db1"),
+		slowlog.WithLocation(time.UTC),
+		slowlog.WithHeaderFilter(func(e slowlog.Event) bool {
+			v, _ := e.Field("Query_time")
+			return v.Time >= 2
+		}),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := []string{}
+	for e := range p.Events() {
+		if e.Source() != "db1" {
+			t.Errorf("got source %q, expected db1", e.Source())
+		}
+		got = append(got, e.Query())
+	}
+	if err := p.Error(); err != nil {
+		t.Error(err)
+	}
+	if diff := deep.Equal(got, []string{"select sleep(2) from n", "select sleep(2) from test.n"}); diff != nil {
+		t.Error(diff)
+	}
+}
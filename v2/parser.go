@@ -0,0 +1,119 @@
+/*
+	Copyright 2017 Daniel Nichter
+	Copyright 2014-2016 Percona LLC and/or its affiliates
+*/
+
+package slowlog
+
+import (
+	"context"
+	"io"
+	"sync"
+	"time"
+
+	v1 "github.com/go-mysql/slowlog"
+)
+
+// An Option sets a parser option. Options are functions so new options can be
+// added without changing the Parser interface.
+type Option func(*v1.Options)
+
+// WithOptions sets all v1 options, to use options that have no Option func.
+// Options after it override its fields.
+func WithOptions(opt v1.Options) Option {
+	return func(o *v1.Options) { *o = opt }
+}
+
+// WithStartOffset sets the byte offset at which to start parsing.
+func WithStartOffset(offset uint64) Option {
+	return func(o *v1.Options) { o.StartOffset = offset }
+}
+
+// WithSource sets Event.Source (default: file name, if any).
+func WithSource(source string) Option {
+	return func(o *v1.Options) { o.Source = source }
+}
+
+// WithLocation sets the time zone of timestamps without one (default: UTC).
+func WithLocation(loc *time.Location) Option {
+	return func(o *v1.Options) { o.Location = loc }
+}
+
+// WithFollow makes the parser wait for new lines at the end of the log until
+// stopped, like tail -f.
+func WithFollow(interval time.Duration) Option {
+	return func(o *v1.Options) {
+		o.Follow = true
+		o.FollowInterval = interval
+	}
+}
+
+// WithHeaderFilter skips events for which f returns false before parsing all
+// their metrics and query, see v1.HeaderFilter.
+func WithHeaderFilter(f func(Event) bool) Option {
+	return func(o *v1.Options) {
+		o.HeaderFilter = func(e v1.Event) bool { return f(Wrap(e)) }
+	}
+}
+
+// A Parser parses Events from a log. Events are sent on the Events channel,
+// which is closed when parsing stops: at the end of the log, on error, when
+// the context is done, or when Stop is called. Error returns the error, if
+// any. A Parser cannot be restarted.
+type Parser interface {
+	Start(ctx context.Context, opts ...Option) error
+	Events() <-chan Event
+	Stop()
+	Error() error
+}
+
+type parser struct {
+	p         *v1.ReaderParser
+	eventChan chan Event
+	stopChan  chan struct{}
+	stopOnce  *sync.Once
+}
+
+// NewParser returns a Parser for the slow log read from r, like a file.
+func NewParser(r io.Reader) Parser {
+	return &parser{
+		p:         v1.NewParser(r),
+		eventChan: make(chan Event),
+		stopChan:  make(chan struct{}),
+		stopOnce:  &sync.Once{},
+	}
+}
+
+func (p *parser) Start(ctx context.Context, opts ...Option) error {
+	opt := v1.Options{}
+	for _, o := range opts {
+		o(&opt)
+	}
+	if err := p.p.StartContext(ctx, opt); err != nil {
+		return err
+	}
+	go func() {
+		defer close(p.eventChan)
+		for e := range p.p.Events() {
+			select {
+			case p.eventChan <- Wrap(e):
+			case <-p.stopChan:
+				return
+			}
+		}
+	}()
+	return nil
+}
+
+func (p *parser) Events() <-chan Event {
+	return p.eventChan
+}
+
+func (p *parser) Stop() {
+	p.stopOnce.Do(func() { close(p.stopChan) })
+	p.p.Stop()
+}
+
+func (p *parser) Error() error {
+	return p.p.Error()
+}
@@ -0,0 +1,180 @@
+/*
+	Copyright 2017 Daniel Nichter
+	Copyright 2014-2016 Percona LLC and/or its affiliates
+*/
+
+package slowlog
+
+import (
+	"bufio"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// WriteEvent writes the event to w in slow log format, so it can be parsed
+// again. The event is not written exactly as logged: metrics are written on
+// one line, Query_time, Lock_time, Rows_sent, and Rows_examined first, then
+// the others sorted by name, with time metrics to microseconds, then Extra
+// fields sorted by name.
+func WriteEvent(w io.Writer, e Event) error {
+	b := bufio.NewWriter(w)
+	if e.Ts != "" {
+		b.WriteString("# Time: " + e.Ts + "\n")
+	}
+	if e.User != "" || e.Host != "" {
+		b.WriteString("# User@Host: " + e.User + "[" + e.User + "] @ " + e.Host + " []\n")
+	}
+
+	b.WriteString("#")
+	written := map[string]bool{}
+	metric := func(name string) {
+		if written[name] {
+			return
+		}
+		if v, ok := e.TimeMetrics[name]; ok {
+			b.WriteString(" " + name + ": " + strconv.FormatFloat(v, 'f', 6, 64))
+		} else if v, ok := e.NumberMetrics[name]; ok {
+			b.WriteString(" " + name + ": " + strconv.FormatUint(v, 10))
+		} else if v, ok := e.BoolMetrics[name]; ok {
+			if v {
+				b.WriteString(" " + name + ": Yes")
+			} else {
+				b.WriteString(" " + name + ": No")
+			}
+		} else {
+			return
+		}
+		written[name] = true
+	}
+	for _, name := range []string{"Query_time", "Lock_time", "Rows_sent", "Rows_examined"} {
+		metric(name)
+	}
+	names := []string{}
+	for name := range e.TimeMetrics {
+		names = append(names, name)
+	}
+	for name := range e.NumberMetrics {
+		names = append(names, name)
+	}
+	for name := range e.BoolMetrics {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		metric(name)
+	}
+	if e.StartTs != "" {
+		b.WriteString(" Start: " + e.StartTs)
+	}
+	if e.EndTs != "" {
+		b.WriteString(" End: " + e.EndTs)
+	}
+	if e.RateType != "" {
+		b.WriteString(" Log_slow_rate_type: " + e.RateType)
+	}
+	if e.RateLimit != 0 {
+		b.WriteString(" Log_slow_rate_limit: " + strconv.FormatUint(uint64(e.RateLimit), 10))
+	}
+	extra := []string{}
+	for name := range e.Extra {
+		if name != "explain" {
+			extra = append(extra, name)
+		}
+	}
+	sort.Strings(extra)
+	for _, name := range extra {
+		b.WriteString(" " + name + ": " + e.Extra[name])
+	}
+	b.WriteString("\n")
+	if explain, ok := e.Extra["explain"]; ok {
+		for _, line := range strings.Split(explain, "\n") {
+			b.WriteString("# explain: " + line + "\n")
+		}
+	}
+
+	if e.Db != "" {
+		b.WriteString("use " + e.Db + ";\n")
+	}
+	if e.Admin {
+		b.WriteString("# administrator command: " + e.Query + ";\n")
+	} else {
+		b.WriteString(e.Query + ";\n")
+	}
+	return b.Flush()
+}
+
+// WriteSQL writes the queries of the events to w as a SQL script that can be
+// run by the mysql client to reproduce them, like in a test environment. A
+// USE statement is written when the db changes, and each query is preceded by
+// a comment with its Ts and Query_time. Admin commands are skipped. Queries
+// are written as logged, so they must not contain the delimiter of the mysql
+// client, like a CREATE PROCEDURE.
+func WriteSQL(w io.Writer, events []Event) error {
+	b := bufio.NewWriter(w)
+	db := ""
+	for _, e := range events {
+		if e.Admin {
+			continue
+		}
+		if e.Db != "" && e.Db != db {
+			b.WriteString("USE `" + strings.Replace(e.Db, "`", "``", -1) + "`;\n")
+			db = e.Db
+		}
+		b.WriteString("-- Ts: " + e.Ts + " Query_time: " + strconv.FormatFloat(e.TimeMetrics["Query_time"], 'f', 6, 64) + "\n")
+		b.WriteString(strings.TrimRight(e.Query, "; \t\n") + ";\n")
+	}
+	return b.Flush()
+}
+
+// RepresentativeEvents returns n events, or all events if there are n or
+// fewer, spread evenly by Query_time from fastest to slowest, so they
+// represent the class (or any events) better than only the slowest. The
+// events are returned in their original order.
+func RepresentativeEvents(events []Event, n int) []Event {
+	if n <= 0 {
+		return []Event{}
+	}
+	if len(events) <= n {
+		return events
+	}
+	byTime := make([]int, len(events)) // indexes of events sorted by Query_time
+	for i := range byTime {
+		byTime[i] = i
+	}
+	sort.SliceStable(byTime, func(i, j int) bool {
+		return events[byTime[i]].TimeMetrics["Query_time"] < events[byTime[j]].TimeMetrics["Query_time"]
+	})
+	picked := make([]int, 0, n)
+	for i := 0; i < n; i++ {
+		pos := 0
+		if n > 1 {
+			pos = i * (len(events) - 1) / (n - 1)
+		}
+		picked = append(picked, byTime[pos])
+	}
+	sort.Ints(picked)
+	rep := make([]Event, len(picked))
+	for i, idx := range picked {
+		rep[i] = events[idx]
+	}
+	return rep
+}
+
+// ExtractSQL receives events until the channel is closed, like Parser.Events,
+// and writes n RepresentativeEvents of the class with the ID to w with
+// WriteSQL. All events of the class are kept in memory until the channel is
+// closed.
+func ExtractSQL(w io.Writer, events <-chan Event, class ClassFunc, id string, n int) error {
+	classEvents := []Event{}
+	for e := range events {
+		if e.Admin {
+			continue
+		}
+		if classId, _ := class(e); classId == id {
+			classEvents = append(classEvents, e)
+		}
+	}
+	return WriteSQL(w, RepresentativeEvents(classEvents, n))
+}
@@ -0,0 +1,106 @@
+/*
+	Copyright 2017 Daniel Nichter
+	Copyright 2014-2016 Percona LLC and/or its affiliates
+*/
+
+package slowlog_test
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/go-mysql/slowlog"
+	"github.com/go-test/deep"
+)
+
+// Events written by WriteEvent parse the same.
+func TestWriteEvent(t *testing.T) {
+	for _, f := range []string{"slow001.log", "slow002.log", "slow010.log", "slow026.log", "slow034.log"} {
+		events := parseSlowLog(t, f, noOptions)
+
+		var buf bytes.Buffer
+		for _, e := range events {
+			if err := slowlog.WriteEvent(&buf, e); err != nil {
+				t.Fatal(err)
+			}
+		}
+		tmp, err := ioutil.TempFile("", "slowlog-test-")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer os.Remove(tmp.Name())
+		if _, err := tmp.Write(buf.Bytes()); err != nil {
+			t.Fatal(err)
+		}
+		tmp.Seek(0, os.SEEK_SET)
+
+		p := slowlog.NewFileParser(tmp)
+		if err := p.Start(noOptions); err != nil {
+			t.Fatal(err)
+		}
+		got := []slowlog.Event{}
+		for e := range p.Events() {
+			e.Offset = 0
+			e.EndOffset = 0
+			e.Source = ""
+			got = append(got, e)
+		}
+		tmp.Close()
+
+		for i := range events {
+			events[i].Offset = 0
+		}
+		if diff := deep.Equal(got, events); diff != nil {
+			t.Errorf("%s: %v", f, diff)
+		}
+	}
+}
+
+func TestExtractSQL(t *testing.T) {
+	events := make(chan slowlog.Event, 20)
+	for i := 1; i <= 9; i++ {
+		e := slowlog.NewEvent()
+		e.Ts = fmt.Sprintf("071015 21:43:%02d", i)
+		e.Db = "db1"
+		if i > 5 {
+			e.Db = "db2"
+		}
+		e.Query = fmt.Sprintf("SELECT c FROM t WHERE id = %d;", i)
+		e.TimeMetrics["Query_time"] = float64(10 - i) // slowest first
+		events <- *e
+		other := slowlog.NewEvent()
+		other.Query = "SELECT 1"
+		events <- *other
+	}
+	quit := slowlog.NewEvent()
+	quit.Admin = true
+	quit.Query = "Quit"
+	events <- *quit
+	close(events)
+
+	class := func(e slowlog.Event) (string, string) {
+		if strings.HasPrefix(e.Query, "SELECT c") {
+			return "1", "select c from t where id = ?"
+		}
+		return "2", e.Query
+	}
+	var buf bytes.Buffer
+	if err := slowlog.ExtractSQL(&buf, events, class, "1", 3); err != nil {
+		t.Fatal(err)
+	}
+	expect := "USE `db1`;\n" +
+		"-- Ts: 071015 21:43:01 Query_time: 9.000000\n" +
+		"SELECT c FROM t WHERE id = 1;\n" +
+		"-- Ts: 071015 21:43:05 Query_time: 5.000000\n" +
+		"SELECT c FROM t WHERE id = 5;\n" +
+		"USE `db2`;\n" +
+		"-- Ts: 071015 21:43:09 Query_time: 1.000000\n" +
+		"SELECT c FROM t WHERE id = 9;\n"
+	if buf.String() != expect {
+		t.Errorf("got:\n%s\nexpected:\n%s", buf.String(), expect)
+	}
+}